@@ -0,0 +1,138 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const maxNameLength = 100
+
+var (
+	errMissingName   = errors.New("name is required")
+	errNameTooLong   = fmt.Errorf("name must not be longer than %d characters", maxNameLength)
+	errMissingScopes = errors.New("at least one scope is required")
+)
+
+type Handler struct {
+	APIKeysStore store.APIKeysStore
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// CreateAPIKey is http api POST /api-keys
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &CreateAPIKeyRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateAPIKey failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	dbReq, err := getCreateAPIKeyDBRequest(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateAPIKey get database request from http request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateAPIKey failed to generate key")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	dbReq.KeyPrefix = prefix
+	dbReq.KeyHash = hash
+	res, err := h.APIKeysStore.CreateAPIKey(ctx, dbReq)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateAPIKey failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := getAPIKeyResponseFromDBResult(res)
+	response.Key = key
+	responses.WriteCreatedResponse(ctx, w, response)
+}
+
+// GetAllAPIKeys is http api GET /api-keys
+func (h *Handler) GetAllAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.APIKeysStore.GetAllAPIKeys(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllAPIKeys failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := &GetAllAPIKeysResponse{APIKeys: make([]APIKey, 0, len(res.APIKeys))}
+	for _, apiKey := range res.APIKeys {
+		response.APIKeys = append(response.APIKeys, getAPIKeyResponseFromDBResult(apiKey))
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
+
+// RevokeAPIKey is http api DELETE /api-keys/{apiKeyId}
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.APIKeysStore.RevokeAPIKey(ctx, mux.Vars(r)["apiKeyId"])
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+			responses.WriteError(ctx, w, http.StatusNotFound, body)
+			return
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("RevokeAPIKey failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteNoContentResponse(ctx, w)
+}
+
+func getAPIKeyResponseFromDBResult(apiKey store.APIKey) APIKey {
+	return APIKey{
+		APIKeyID:  apiKey.APIKeyID,
+		TenantID:  apiKey.TenantID,
+		Name:      apiKey.Name,
+		KeyPrefix: apiKey.KeyPrefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+		RevokedAt: apiKey.RevokedAt,
+	}
+}
+
+func getCreateAPIKeyDBRequest(req *CreateAPIKeyRequest) (store.CreateAPIKeyRequest, error) {
+	if req.Name == "" {
+		return store.CreateAPIKeyRequest{}, errMissingName
+	}
+	if len(req.Name) > maxNameLength {
+		return store.CreateAPIKeyRequest{}, errNameTooLong
+	}
+	if len(req.Scopes) == 0 {
+		return store.CreateAPIKeyRequest{}, errMissingScopes
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := auth.KnownScopes[auth.Scope(scope)]; !ok {
+			return store.CreateAPIKeyRequest{}, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return store.CreateAPIKeyRequest{
+		Name:   req.Name,
+		Scopes: req.Scopes,
+	}, nil
+}
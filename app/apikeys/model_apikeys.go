@@ -0,0 +1,26 @@
+package apikeys
+
+import (
+	"time"
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKey struct {
+	APIKeyID  string     `json:"apiKeyId"`
+	TenantID  string     `json:"tenantId"`
+	Name      string     `json:"name"`
+	KeyPrefix string     `json:"keyPrefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	// Key is only returned when the key is created.
+	Key string `json:"key,omitempty"`
+}
+
+type GetAllAPIKeysResponse struct {
+	APIKeys []APIKey `json:"apiKeys"`
+}
@@ -2,11 +2,15 @@ package articles
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 
+	"github.com/warehouse/app/csvio"
+	"github.com/warehouse/app/metrics"
 	"github.com/warehouse/app/server/responses"
 	"github.com/warehouse/app/store"
 )
@@ -20,34 +24,323 @@ func NewHandler() *Handler {
 }
 
 // CreateOrUpdateArticles is http api POST /articles
+//
+// A text/csv body has a header line and a row per article, invalid rows are
+// reported with their line. With ?dryRun=true nothing is stored, the
+// response tells what would be.
 func (h *Handler) CreateOrUpdateArticles(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	req := &CreateOrUpdateArticlesRequest{}
-	err := json.NewDecoder(r.Body).Decode(req)
+	dryRun, err := responses.DryRun(r)
+	if err != nil {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	if dryRun {
+		h.dryRunCreateOrUpdateArticles(w, r)
+		return
+	}
+	req, err := decodeCreateOrUpdateArticlesRequest(r)
+	var lineErrs csvio.Errors
+	if errors.As(err, &lineErrs) {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles got invalid csv rows")
+		responses.WriteLineErrors(ctx, w, lineErrs)
+		return
+	}
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("CreateOrUpdateArticles failed to unmarshal request")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles failed to unmarshal request")
 		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
 		responses.WriteError(ctx, w, http.StatusBadRequest, body)
 		return
 	}
-	dbReq, err := getCreateOrUpdateArticleDBRequest(req)
+	dbReq, err := GetCreateOrUpdateArticlesDBRequest(req)
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("CreateOrUpdateArticles get database request from http request")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles get database request from http request")
 		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
 		responses.WriteError(ctx, w, http.StatusBadRequest, body)
 		return
 	}
 	err = h.ArticleStore.CreateOrUpdateArticles(ctx, dbReq)
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("CreateOrUpdateArticles failed to execute database query")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles failed to execute database query")
 		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
 		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
 		return
 	}
+	metrics.ArticlesImported.Add(float64(len(dbReq.Articles)), store.TenantFromContext(ctx))
 	responses.WriteCreatedResponse(ctx, w, nil)
 }
 
-func getCreateOrUpdateArticleDBRequest(req *CreateOrUpdateArticlesRequest) (store.CreateOrUpdateArticlesRequest, error) {
+// dryRunCreateOrUpdateArticles validates every article, and runs the valid
+// ones in a transaction that is rolled back to tell what they would change.
+func (h *Handler) dryRunCreateOrUpdateArticles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var articles []Article
+	var lines []int
+	var err error
+	if responses.RequestContentType(r) == responses.ContentTypeCSV {
+		articles, lines, err = readArticlesCSV(r.Body)
+	} else {
+		req := &CreateOrUpdateArticlesRequest{}
+		err = json.NewDecoder(r.Body).Decode(req)
+		articles = req.Inventory
+	}
+	var lineErrs csvio.Errors
+	if errors.As(err, &lineErrs) {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles dry run got an invalid csv file")
+		responses.WriteLineErrors(ctx, w, lineErrs)
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles dry run failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+
+	response := &DryRunResponse{
+		Valid:     true,
+		Inventory: make([]DryRunArticle, 0, len(articles)),
+		Products:  make([]ProductStockChange, 0),
+	}
+	dbReq := store.CreateOrUpdateArticlesRequest{}
+	// dbIndexes are the indexes of the articles of dbReq in the response
+	dbIndexes := make([]int, 0, len(articles))
+	seen := make(map[string]int)
+	for i, article := range articles {
+		item := DryRunArticle{Article: article}
+		if lines != nil {
+			item.Line = lines[i]
+		}
+		item.Errors = validateArticle(article, item.Line)
+		if first, ok := seen[article.ArticleID]; ok && article.ArticleID != "" {
+			item.Errors = append(item.Errors, responses.FieldError{
+				Line:    item.Line,
+				Field:   "art_id",
+				Message: "art_id is repeated, first at " + location(first, lines),
+			})
+		} else {
+			seen[article.ArticleID] = i
+		}
+		if len(item.Errors) > 0 {
+			response.Valid = false
+		} else {
+			stock, _ := strconv.Atoi(article.Stock)
+			dbReq.Articles = append(dbReq.Articles, store.Article{
+				ArticleID:   article.ArticleID,
+				ArticleName: article.Name,
+				Stock:       stock,
+			})
+			dbIndexes = append(dbIndexes, i)
+		}
+		response.Inventory = append(response.Inventory, item)
+	}
+
+	diff, err := h.ArticleStore.DryRunCreateOrUpdateArticles(ctx, dbReq)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticles dry run failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	for j, dbItem := range diff.Items {
+		item := &response.Inventory[dbIndexes[j]]
+		item.Action = dbItem.Action
+		if dbItem.Before != nil {
+			item.Before = GetArticleResponseFromDBResult(*dbItem.Before)
+		}
+		if dbItem.Action == store.ImportActionCreate {
+			response.Creates++
+		} else {
+			response.Updates++
+		}
+	}
+	for _, change := range diff.ProductStocks {
+		response.Products = append(response.Products, ProductStockChange{
+			ProductID:   change.ProductID,
+			StockBefore: change.Before,
+			StockAfter:  change.After,
+		})
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
+
+// GetAllArticles is http api GET /articles
+//
+// Accept: text/csv gets a row per article instead and application/x-ndjson an
+// article per line, both streamed from the database.
+func (h *Handler) GetAllArticles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	contentType := responses.Negotiate(r, responses.ContentTypeJSON, responses.ContentTypeCSV, responses.ContentTypeNDJSON)
+	if contentType != responses.ContentTypeJSON {
+		h.streamAllArticles(w, r, contentType)
+		return
+	}
+	res, err := h.ArticleStore.GetAllArticles(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllArticles failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteOkResponse(ctx, w, GetAllArticlesResponseFromDBResult(res))
+}
+
+// streamAllArticles writes the articles while they are read, in constant
+// memory. A client going away cancels the query with the request context.
+func (h *Handler) streamAllArticles(w http.ResponseWriter, r *http.Request, contentType string) {
+	ctx := r.Context()
+	stream := responses.NewStream(w, contentType)
+	var write func(article *ArticleWithVersion) error
+	var flush func() error
+	if contentType == responses.ContentTypeCSV {
+		writer := csvio.NewWriter(stream)
+		// buffered, it is sent with the first rows
+		_ = writer.Write(csvColumns)
+		write = func(article *ArticleWithVersion) error {
+			return writer.Write(articleCSVRow(article))
+		}
+		flush = writer.Flush
+	} else {
+		writer := responses.NewNDJSONWriter(stream)
+		write = func(article *ArticleWithVersion) error {
+			return writer.Write(article)
+		}
+		flush = writer.Flush
+	}
+	err := h.ArticleStore.StreamArticles(ctx, func(article store.Article) error {
+		return write(GetArticleResponseFromDBResult(article))
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		return
+	}
+	if stream.Started() {
+		log.Ctx(ctx).Warn().AnErr("error", err).Msg("GetAllArticles stream was cut short")
+		return
+	}
+	log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllArticles failed to execute database query")
+	body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+	responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+}
+
+// GetArticle is http api GET /articles/{articleId}
+func (h *Handler) GetArticle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.ArticleStore.GetArticle(ctx, mux.Vars(r)["articleId"])
+	if err != nil {
+		writeStoreError(w, r, "GetArticle", err)
+		return
+	}
+	responses.SetETag(w, res.Version)
+	responses.WriteOkResponse(ctx, w, GetArticleResponseFromDBResult(res))
+}
+
+// UpdateArticle is http api PUT /articles/{articleId}
+//
+// An If-Match header with the ETag of GET /articles/{articleId} makes the
+// update fail with 412 when the article was changed in the meantime.
+func (h *Handler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expectedVersion, err := responses.IfMatchVersion(r)
+	if err != nil {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidHeaderError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	req := &UpdateArticleRequest{}
+	err = json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateArticle failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	dbReq, err := GetUpdateArticleDBRequest(mux.Vars(r)["articleId"], expectedVersion, req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateArticle get database request from http request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	res, err := h.ArticleStore.UpdateArticle(ctx, dbReq)
+	if err != nil {
+		writeStoreError(w, r, "UpdateArticle", err)
+		return
+	}
+	responses.SetETag(w, res.Version)
+	responses.WriteOkResponse(ctx, w, GetArticleResponseFromDBResult(res))
+}
+
+func decodeCreateOrUpdateArticlesRequest(r *http.Request) (*CreateOrUpdateArticlesRequest, error) {
+	if responses.RequestContentType(r) == responses.ContentTypeCSV {
+		return ReadArticlesCSV(r.Body)
+	}
+	req := &CreateOrUpdateArticlesRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	return req, err
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	ctx := r.Context()
+	switch {
+	case errors.Is(err, store.ErrArticleNotFound):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, article not found", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+		responses.WriteError(ctx, w, http.StatusNotFound, body)
+	case errors.Is(err, store.ErrVersionConflict):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, version conflict", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.VersionConflict, err.Error())
+		responses.WriteError(ctx, w, http.StatusPreconditionFailed, body)
+	default:
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+	}
+}
+
+func GetArticleResponseFromDBResult(dbResult store.Article) *ArticleWithVersion {
+	return &ArticleWithVersion{
+		Article: Article{
+			ArticleID: dbResult.ArticleID,
+			Name:      dbResult.ArticleName,
+			Stock:     strconv.Itoa(dbResult.Stock),
+		},
+		Version: dbResult.Version,
+	}
+}
+
+func GetAllArticlesResponseFromDBResult(dbResult store.GetAllArticlesResponse) *GetAllArticlesResponse {
+	response := &GetAllArticlesResponse{Inventory: make([]ArticleWithVersion, 0, len(dbResult.Articles))}
+	for _, article := range dbResult.Articles {
+		response.Inventory = append(response.Inventory, *GetArticleResponseFromDBResult(article))
+	}
+	return response
+}
+
+func GetUpdateArticleDBRequest(
+	articleID string,
+	expectedVersion int,
+	req *UpdateArticleRequest,
+) (store.UpdateArticleRequest, error) {
+	stock, err := strconv.Atoi(req.Stock)
+	if err != nil {
+		log.Error().AnErr("error", err).Msg("failed to parse article stock to integer")
+		return store.UpdateArticleRequest{}, err
+	}
+	return store.UpdateArticleRequest{
+		Article: store.Article{
+			ArticleID:   articleID,
+			ArticleName: req.Name,
+			Stock:       stock,
+		},
+		ExpectedVersion: expectedVersion,
+	}, nil
+}
+
+func GetCreateOrUpdateArticlesDBRequest(req *CreateOrUpdateArticlesRequest) (store.CreateOrUpdateArticlesRequest, error) {
 	res := store.CreateOrUpdateArticlesRequest{}
 	for _, article := range req.Inventory {
 		stock, err := strconv.Atoi(article.Stock)
@@ -0,0 +1,65 @@
+package articles
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/warehouse/app/csvio"
+)
+
+// csvColumns are the columns of GET /articles as text/csv, POST /articles
+// takes the first three.
+var csvColumns = []string{"art_id", "name", "stock", "version"}
+
+// ReadArticlesCSV reads a text/csv body of POST /articles, a row per article.
+// Every invalid row is returned in csvio.Errors.
+func ReadArticlesCSV(r io.Reader) (*CreateOrUpdateArticlesRequest, error) {
+	articles, lines, err := readArticlesCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var lineErrs csvio.Errors
+	for i, article := range articles {
+		for _, fieldErr := range validateArticle(article, lines[i]) {
+			lineErrs = append(lineErrs, csvio.LineError{Line: fieldErr.Line, Message: fieldErr.Message})
+		}
+	}
+	if len(lineErrs) > 0 {
+		return nil, lineErrs
+	}
+	return &CreateOrUpdateArticlesRequest{Inventory: articles}, nil
+}
+
+// readArticlesCSV returns the articles of a text/csv body with the lines of
+// their rows, without validating them.
+func readArticlesCSV(r io.Reader) ([]Article, []int, error) {
+	reader, err := csvio.NewReader(r, csvColumns[:3]...)
+	if err != nil {
+		return nil, nil, err
+	}
+	articles := make([]Article, 0)
+	lines := make([]int, 0)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return articles, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if record.Empty() {
+			continue
+		}
+		articles = append(articles, Article{
+			ArticleID: record.Get("art_id"),
+			Name:      record.Get("name"),
+			Stock:     record.Get("stock"),
+		})
+		lines = append(lines, record.Line)
+	}
+}
+
+func articleCSVRow(article *ArticleWithVersion) []string {
+	return []string{article.ArticleID, article.Name, article.Stock, strconv.Itoa(article.Version)}
+}
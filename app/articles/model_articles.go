@@ -1,5 +1,9 @@
 package articles
 
+import (
+	"github.com/warehouse/app/server/responses"
+)
+
 type CreateOrUpdateArticlesRequest struct {
 	Inventory []Article `json:"inventory"`
 }
@@ -9,3 +13,47 @@ type Article struct {
 	Name      string `json:"name"`
 	Stock     string `json:"stock"`
 }
+
+type UpdateArticleRequest struct {
+	Name  string `json:"name"`
+	Stock string `json:"stock"`
+}
+
+type ArticleWithVersion struct {
+	Article
+	Version int `json:"version"`
+}
+
+// GetAllArticlesResponse has the shape of CreateOrUpdateArticlesRequest, so
+// that an export can be imported again.
+type GetAllArticlesResponse struct {
+	Inventory []ArticleWithVersion `json:"inventory"`
+}
+
+// DryRunResponse is what POST /articles?dryRun=true would do. It is Valid
+// when no article has errors, Creates and Updates count the valid ones.
+type DryRunResponse struct {
+	Valid     bool            `json:"valid"`
+	Creates   int             `json:"creates"`
+	Updates   int             `json:"updates"`
+	Inventory []DryRunArticle `json:"inventory"`
+	// Products are the existing products whose stock would change.
+	Products []ProductStockChange `json:"products"`
+}
+
+type DryRunArticle struct {
+	// Line is the line of the row of a text/csv body.
+	Line int `json:"line,omitempty"`
+	Article
+	// Action is create or update, missing when the article has errors.
+	Action string `json:"action,omitempty"`
+	// Before is the stored article an update would change.
+	Before *ArticleWithVersion    `json:"before,omitempty"`
+	Errors []responses.FieldError `json:"errors,omitempty"`
+}
+
+type ProductStockChange struct {
+	ProductID   string `json:"productId"`
+	StockBefore int    `json:"stockBefore"`
+	StockAfter  int    `json:"stockAfter"`
+}
@@ -0,0 +1,50 @@
+package articles
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/warehouse/app/server/responses"
+)
+
+const (
+	// maxArticleIDLength and maxNameLength are the sizes of the article_id
+	// and article_name columns.
+	maxArticleIDLength = 10
+	maxNameLength      = 30
+)
+
+// validateArticle returns what keeps an article of an import from being
+// stored, line is the line of its row in a text/csv body.
+func validateArticle(article Article, line int) []responses.FieldError {
+	var fieldErrs []responses.FieldError
+	add := func(field, message string) {
+		fieldErrs = append(fieldErrs, responses.FieldError{Line: line, Field: field, Message: message})
+	}
+	switch {
+	case article.ArticleID == "":
+		add("art_id", "art_id is empty")
+	case utf8.RuneCountInString(article.ArticleID) > maxArticleIDLength:
+		add("art_id", fmt.Sprintf("art_id is longer than %d characters", maxArticleIDLength))
+	}
+	if utf8.RuneCountInString(article.Name) > maxNameLength {
+		add("name", fmt.Sprintf("name is longer than %d characters", maxNameLength))
+	}
+	switch stock, err := strconv.Atoi(article.Stock); {
+	case err != nil:
+		add("stock", "stock is not an integer: "+strconv.Quote(article.Stock))
+	case stock < 0:
+		add("stock", "stock is negative")
+	}
+	return fieldErrs
+}
+
+// location names an item of an import in its messages, by its line in a
+// text/csv body.
+func location(i int, lines []int) string {
+	if lines != nil {
+		return fmt.Sprintf("line %d", lines[i])
+	}
+	return fmt.Sprintf("item %d", i)
+}
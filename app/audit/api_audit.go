@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+var (
+	errInvalidTime     = errors.New("from and to must be RFC 3339 timestamps")
+	errInvalidBeforeID = errors.New("beforeId must be a positive integer")
+	errInvalidLimit    = errors.New("limit must be between 1 and 1000")
+)
+
+type Handler struct {
+	AuditStore store.AuditStore
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// GetAuditRecords is http api GET /audit
+//
+// It returns the newest audit records first. The actor, resourceType,
+// resourceId, from and to query parameters narrow them down, beforeId pages
+// back through older records.
+func (h *Handler) GetAuditRecords(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req, err := getAuditRecordsDBRequest(r)
+	if err != nil {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	res, err := h.AuditStore.GetAuditRecords(ctx, req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAuditRecords failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := &GetAuditRecordsResponse{Records: make([]AuditRecord, 0, len(res.Records))}
+	for _, record := range res.Records {
+		response.Records = append(response.Records, getAuditRecordResponseFromDBResult(record))
+	}
+	if len(res.Records) == req.Limit {
+		response.NextBeforeID = res.Records[len(res.Records)-1].AuditID
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
+
+func getAuditRecordsDBRequest(r *http.Request) (store.GetAuditRecordsRequest, error) {
+	query := r.URL.Query()
+	req := store.GetAuditRecordsRequest{
+		Actor:        query.Get("actor"),
+		ResourceType: query.Get("resourceType"),
+		ResourceID:   query.Get("resourceId"),
+		Limit:        defaultLimit,
+	}
+	var err error
+	req.From, err = parseTime(query.Get("from"))
+	if err != nil {
+		return store.GetAuditRecordsRequest{}, err
+	}
+	req.To, err = parseTime(query.Get("to"))
+	if err != nil {
+		return store.GetAuditRecordsRequest{}, err
+	}
+	if value := query.Get("beforeId"); value != "" {
+		req.BeforeID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || req.BeforeID < 1 {
+			return store.GetAuditRecordsRequest{}, errInvalidBeforeID
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		req.Limit, err = strconv.Atoi(value)
+		if err != nil || req.Limit < 1 || req.Limit > maxLimit {
+			return store.GetAuditRecordsRequest{}, errInvalidLimit
+		}
+	}
+	return req, nil
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errInvalidTime
+	}
+	return &t, nil
+}
+
+func getAuditRecordResponseFromDBResult(record store.AuditRecord) AuditRecord {
+	return AuditRecord{
+		AuditID:      record.AuditID,
+		OccurredAt:   record.OccurredAt,
+		Actor:        record.Actor,
+		Route:        record.Route,
+		RequestID:    record.RequestID,
+		Method:       record.Method,
+		Path:         record.Path,
+		ResourceType: record.ResourceType,
+		ResourceID:   record.ResourceID,
+		Before:       record.Before,
+		After:        record.After,
+		Outcome:      string(record.Outcome),
+		StatusCode:   record.StatusCode,
+	}
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/idempotency"
+	"github.com/warehouse/app/requestlog"
+	"github.com/warehouse/app/server/recorder"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	// recordTimeout bounds recording the outcome once the handler is done,
+	// this must happen even if the client already went away.
+	recordTimeout = 5 * time.Second
+)
+
+// Middleware audits every POST, PUT, PATCH and DELETE. The store records the
+// changes a request commits in the same transaction, the middleware records
+// the outcome of requests that didn't commit any.
+type Middleware struct {
+	Store store.AuditStore
+}
+
+func NewMiddleware() *Middleware {
+	return &Middleware{}
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		req := store.AuditRequest{
+			RequestID: requestlog.RequestIDFromContext(r.Context()),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+		}
+		if req.RequestID == "" {
+			req.RequestID = requestlog.NewRequestID()
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			req.Route = route.GetName()
+		}
+		ctx := store.WithAudit(r.Context(), req)
+		rec := recorder.New(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if store.AuditRecorded(ctx) {
+			return
+		}
+		outcome := store.AuditOutcomeSuccess
+		switch {
+		case rec.Header().Get(idempotency.HeaderReplayed) == "true":
+			outcome = store.AuditOutcomeReplayed
+		case rec.StatusCode() >= http.StatusBadRequest:
+			outcome = store.AuditOutcomeFailure
+		}
+		// record the outcome even if the client disconnected meanwhile
+		recordCtx, cancel := context.WithTimeout(detached{ctx}, recordTimeout)
+		defer cancel()
+		err := m.Store.CreateAuditRecord(recordCtx, store.AuditRecord{
+			Outcome:    outcome,
+			StatusCode: rec.StatusCode(),
+		})
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Str("requestId", req.RequestID).Msg("failed to record audit outcome")
+		}
+	})
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// detached keeps the values of a request context, like the tenant, the actor
+// and the audit trail, without being cancelled with the request.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
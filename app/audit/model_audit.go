@@ -0,0 +1,29 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditRecord struct {
+	AuditID      int64           `json:"auditId"`
+	OccurredAt   time.Time       `json:"occurredAt"`
+	Actor        string          `json:"actor,omitempty"`
+	Route        string          `json:"route"`
+	RequestID    string          `json:"requestId"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	ResourceType string          `json:"resourceType,omitempty"`
+	ResourceID   string          `json:"resourceId,omitempty"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	Outcome      string          `json:"outcome"`
+	StatusCode   int             `json:"statusCode,omitempty"`
+}
+
+type GetAuditRecordsResponse struct {
+	Records []AuditRecord `json:"records"`
+	// NextBeforeID is passed as beforeId to get the next page, it is omitted
+	// on the last one.
+	NextBeforeID int64 `json:"nextBeforeId,omitempty"`
+}
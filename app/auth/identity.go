@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+)
+
+type Scope string
+
+const (
+	// ScopePublic marks routes that don't require authentication.
+	ScopePublic         Scope = ""
+	ScopeInventoryRead  Scope = "inventory:read"
+	ScopeInventoryWrite Scope = "inventory:write"
+	ScopeSalesWrite     Scope = "sales:write"
+	// ScopeAdmin grants every other scope.
+	ScopeAdmin Scope = "admin"
+)
+
+var KnownScopes = map[Scope]struct{}{
+	ScopeInventoryRead:  {},
+	ScopeInventoryWrite: {},
+	ScopeSalesWrite:     {},
+	ScopeAdmin:          {},
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject names the caller, e.g. "apikey:<id>".
+	Subject string
+	Scopes  []Scope
+	// Tenant the caller is bound to, empty when its credentials don't name
+	// one.
+	Tenant string
+}
+
+func (id Identity) HasScope(scope Scope) bool {
+	for _, granted := range id.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller of the request, ok is false for
+// public routes and when authentication is disabled.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// minRefreshInterval throttles reloading the key set for unknown key ids,
+	// so that tokens with made up ids can't be used to hammer the issuer.
+	minRefreshInterval = 30 * time.Second
+	maxJWKSSize        = 1 << 20
+)
+
+var (
+	errUnknownKey        = errors.New("token is signed with an unknown key")
+	errUnexpectedJWKSRes = errors.New("unexpected status code fetching the jwks")
+)
+
+// KeySet holds the keys tokens are verified with, loaded from a JWKS
+// document.
+type KeySet struct {
+	load func(ctx context.Context) ([]byte, error)
+
+	// refreshMu lets one reload for an unknown key id run at a time,
+	// refreshedAt is when the last one ended.
+	refreshMu   sync.Mutex
+	refreshedAt time.Time
+
+	mu       sync.RWMutex
+	keys     []verificationKey
+	loadedAt time.Time
+}
+
+type verificationKey struct {
+	kid string
+	// alg is the algorithm the key is restricted to, empty allows any
+	// algorithm of its type.
+	alg string
+	key interface{}
+}
+
+// jwk is the subset of RFC 7517 used by RS256, ES256 and HS256 keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func NewFileKeySet(path string) *KeySet {
+	return &KeySet{
+		load: func(_ context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+}
+
+func NewURLKeySet(url string, client *http.Client) *KeySet {
+	return &KeySet{
+		load: func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("%w: %d", errUnexpectedJWKSRes, res.StatusCode)
+			}
+			return io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+		},
+	}
+}
+
+// Refresh reloads the keys, the previous keys are kept if that fails.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	data, err := ks.load(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.loadedAt = time.Now()
+	return nil
+}
+
+// Run refreshes the keys every interval until ctx is cancelled, picking up
+// rotated keys.
+func (ks *KeySet) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := ks.Refresh(ctx)
+			if err != nil {
+				log.Error().AnErr("error", err).Msg("failed to refresh the jwks")
+			}
+		}
+	}
+}
+
+// key returns the key for kid that can verify alg. A key set that doesn't know
+// kid is reloaded once, in case the issuer rotated its keys.
+func (ks *KeySet) key(ctx context.Context, kid, alg string) (interface{}, error) {
+	key, ok := ks.find(kid, alg)
+	if ok {
+		return key, nil
+	}
+	ks.refreshForUnknownKey(ctx)
+	key, ok = ks.find(kid, alg)
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// refreshForUnknownKey reloads the keys unless they were loaded less than
+// minRefreshInterval ago. Requests waiting for a reload share it rather than
+// starting one each.
+func (ks *KeySet) refreshForUnknownKey(ctx context.Context) {
+	arrived := time.Now()
+	ks.refreshMu.Lock()
+	defer ks.refreshMu.Unlock()
+	if ks.refreshedAt.After(arrived) {
+		return
+	}
+	ks.mu.RLock()
+	loadedAt := ks.loadedAt
+	ks.mu.RUnlock()
+	if time.Since(loadedAt) < minRefreshInterval {
+		return
+	}
+	err := ks.Refresh(ctx)
+	ks.refreshedAt = time.Now()
+	if err != nil {
+		log.Error().AnErr("error", err).Msg("failed to refresh the jwks for an unknown key")
+	}
+}
+
+func (ks *KeySet) find(kid, alg string) (interface{}, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var match interface{}
+	matches := 0
+	for _, key := range ks.keys {
+		if (kid != "" && key.kid != kid) || (key.alg != "" && key.alg != alg) || !keyFitsAlg(key.key, alg) {
+			continue
+		}
+		match = key.key
+		matches++
+	}
+	// without a kid the key has to be unambiguous
+	if matches == 1 || (kid != "" && matches > 0) {
+		return match, true
+	}
+	return nil, false
+}
+
+func keyFitsAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return alg == algRS256
+	case *ecdsa.PublicKey:
+		return alg == algES256
+	case []byte:
+		return alg == algHS256
+	}
+	return false
+}
+
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+	keys := make([]verificationKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		keys = append(keys, verificationKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return keys, nil
+}
+
+// publicKey returns nil for key types that are not supported.
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the P-256 curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("empty symmetric key")
+		}
+		return secret, nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("missing key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
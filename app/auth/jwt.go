@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	algRS256 = "RS256"
+	algES256 = "ES256"
+	algHS256 = "HS256"
+
+	es256SignatureSize = 64
+)
+
+var (
+	errMalformedToken       = errors.New("malformed token")
+	errUnsupportedAlgorithm = errors.New("unsupported token algorithm")
+	errInvalidSignature     = errors.New("invalid token signature")
+	errTokenExpired         = errors.New("token is expired")
+	errTokenNotYetValid     = errors.New("token is not valid yet")
+	errMissingExpiry        = errors.New("token has no exp claim")
+	errInvalidIssuer        = errors.New("token has an unexpected issuer")
+	errInvalidAudience      = errors.New("token is not intended for this audience")
+	errMissingSubject       = errors.New("token has no sub claim")
+	errInvalidTenantClaim   = errors.New("token tenant claim is not a string")
+)
+
+// JWTValidator checks bearer tokens and maps their claims to an Identity.
+type JWTValidator struct {
+	Keys *KeySet
+	// Issuer and Audience are checked against iss and aud unless empty.
+	Issuer   string
+	Audience string
+	// ScopesClaim names the claim holding the granted scopes, either a space
+	// separated string like the OAuth2 scope claim or an array.
+	ScopesClaim string
+	// TenantClaim names the string claim binding the token to a tenant, the
+	// token is not bound to one when it is missing.
+	TenantClaim string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	now    func() time.Time
+}
+
+func NewJWTValidator(keys *KeySet, issuer, audience, scopesClaim string, leeway time.Duration) *JWTValidator {
+	return &JWTValidator{
+		Keys:        keys,
+		Issuer:      issuer,
+		Audience:    audience,
+		ScopesClaim: scopesClaim,
+		Leeway:      leeway,
+		now:         time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *json.Number    `json:"exp"`
+	NotBefore *json.Number    `json:"nbf"`
+}
+
+func (v *JWTValidator) Validate(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errMalformedToken
+	}
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+	if header.Alg != algRS256 && header.Alg != algES256 && header.Alg != algHS256 {
+		return Identity{}, errUnsupportedAlgorithm
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+	key, err := v.Keys.key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return Identity{}, err
+	}
+	err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+	var claims jwtClaims
+	var rawClaims map[string]json.RawMessage
+	err = unmarshalNumbers(payload, &claims)
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+	err = json.Unmarshal(payload, &rawClaims)
+	if err != nil {
+		return Identity{}, errMalformedToken
+	}
+	err = v.validateClaims(claims)
+	if err != nil {
+		return Identity{}, err
+	}
+	id := Identity{
+		Subject: claims.Subject,
+		Scopes:  parseScopesClaim(rawClaims[v.ScopesClaim]),
+	}
+	if v.TenantClaim != "" && rawClaims[v.TenantClaim] != nil {
+		err = json.Unmarshal(rawClaims[v.TenantClaim], &id.Tenant)
+		if err != nil {
+			return Identity{}, errInvalidTenantClaim
+		}
+	}
+	return id, nil
+}
+
+func (v *JWTValidator) validateClaims(claims jwtClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return errMissingExpiry
+	}
+	exp, err := numericDate(*claims.ExpiresAt)
+	if err != nil {
+		return errMalformedToken
+	}
+	if !now.Before(exp.Add(v.Leeway)) {
+		return errTokenExpired
+	}
+	if claims.NotBefore != nil {
+		nbf, err := numericDate(*claims.NotBefore)
+		if err != nil {
+			return errMalformedToken
+		}
+		if now.Add(v.Leeway).Before(nbf) {
+			return errTokenNotYetValid
+		}
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return errInvalidIssuer
+	}
+	if v.Audience != "" && !audienceContains(claims.Audience, v.Audience) {
+		return errInvalidAudience
+	}
+	if claims.Subject == "" {
+		return errMissingSubject
+	}
+	return nil
+}
+
+func verifySignature(alg string, key interface{}, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+	switch alg {
+	case algRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return errInvalidSignature
+		}
+	case algES256:
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		// JWS carries the raw r || s, not ASN.1
+		if !ok || len(signature) != es256SignatureSize {
+			return errInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:es256SignatureSize/2])
+		s := new(big.Int).SetBytes(signature[es256SignatureSize/2:])
+		if !ecdsa.Verify(publicKey, digest[:], r, s) {
+			return errInvalidSignature
+		}
+	case algHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return errInvalidSignature
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errInvalidSignature
+		}
+	default:
+		return errUnsupportedAlgorithm
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unmarshalNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func numericDate(value json.Number) (time.Time, error) {
+	seconds, err := value.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+// audienceContains reports whether aud, a string or an array of strings,
+// contains audience.
+func audienceContains(aud json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(aud, &single) == nil {
+		return single == audience
+	}
+	var many []string
+	if json.Unmarshal(aud, &many) != nil {
+		return false
+	}
+	for _, value := range many {
+		if value == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// parseScopesClaim keeps the known scopes of a space separated string or an
+// array of strings.
+func parseScopesClaim(claim json.RawMessage) []Scope {
+	var values []string
+	var single string
+	if json.Unmarshal(claim, &single) == nil {
+		values = strings.Fields(single)
+	} else if json.Unmarshal(claim, &values) != nil {
+		return nil
+	}
+	scopes := make([]Scope, 0, len(values))
+	for _, value := range values {
+		if _, ok := KnownScopes[Scope(value)]; ok {
+			scopes = append(scopes, Scope(value))
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	HeaderAPIKey = "X-API-Key"
+
+	apiKeyPrefix         = "wh_"
+	generatedAPIKeyBytes = 32
+	// displayedPrefixLength is how much of a key is kept in clear text to
+	// recognize it in listings.
+	displayedPrefixLength = 11
+	adminKeySubject       = "config:admin"
+)
+
+var (
+	errMissingCredentials = errors.New("missing api key or bearer token")
+	errInvalidCredentials = errors.New("invalid or revoked api key")
+	errMissingScope       = errors.New("credentials are missing the required scope")
+	errAPIKeyLookup       = errors.New("failed to look up api key")
+)
+
+// Authenticator rejects requests that don't carry credentials with the
+// scope required by their route.
+type Authenticator struct {
+	APIKeysStore store.APIKeysStore
+	// AdminKey is accepted with the admin scope without being stored, to
+	// create the first keys. Empty disables it.
+	AdminKey string
+	// JWT validates bearer tokens, nil only accepts api keys.
+	JWT *JWTValidator
+}
+
+func NewAuthenticator(adminKey string) *Authenticator {
+	return &Authenticator{AdminKey: adminKey}
+}
+
+// Handler returns a mux middleware that looks up the scope of the matched
+// route by its name in scopes. Unknown routes require the admin scope.
+func (a *Authenticator) Handler(scopes map[string]Scope) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := ScopeAdmin
+			if route := mux.CurrentRoute(r); route != nil {
+				if routeScope, ok := scopes[route.GetName()]; ok {
+					scope = routeScope
+				}
+			}
+			if scope == ScopePublic {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+			id, err := a.authenticate(r)
+			if errors.Is(err, errAPIKeyLookup) {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("authentication failed to execute database query")
+				body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+				responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+				return
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", a.challenge())
+				body := responses.GenerateErrorResponseBody(ctx, responses.Unauthenticated, err.Error())
+				responses.WriteError(ctx, w, http.StatusUnauthorized, body)
+				return
+			}
+			if !id.HasScope(scope) {
+				body := responses.GenerateErrorResponseBody(ctx, responses.Forbidden, errMissingScope.Error()+" "+string(scope))
+				responses.WriteError(ctx, w, http.StatusForbidden, body)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withCaller(ctx, id)))
+		})
+	}
+}
+
+// withCaller makes the identity available to the handlers, to the store for
+// the changes it records and to the log lines of the request.
+func withCaller(ctx context.Context, id Identity) context.Context {
+	ctx = WithIdentity(ctx, id)
+	ctx = store.WithActor(ctx, id.Subject)
+	logger := zerolog.Ctx(ctx)
+	if logger.GetLevel() == zerolog.Disabled {
+		logger = &log.Logger
+	}
+	return logger.With().Str("actor", id.Subject).Logger().WithContext(ctx)
+}
+
+func (a *Authenticator) challenge() string {
+	if a.JWT != nil {
+		return "Bearer"
+	}
+	return HeaderAPIKey
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Identity, error) {
+	key := r.Header.Get(HeaderAPIKey)
+	if key == "" {
+		return a.authenticateBearer(r)
+	}
+	if a.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(a.AdminKey)) == 1 {
+		return Identity{Subject: adminKeySubject, Scopes: []Scope{ScopeAdmin}}, nil
+	}
+	apiKey, err := a.APIKeysStore.GetAPIKeyByHash(r.Context(), HashAPIKey(key))
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		return Identity{}, errInvalidCredentials
+	}
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", errAPIKeyLookup, err)
+	}
+	id := Identity{Subject: "apikey:" + apiKey.APIKeyID, Tenant: apiKey.TenantID}
+	for _, scope := range apiKey.Scopes {
+		id.Scopes = append(id.Scopes, Scope(scope))
+	}
+	return id, nil
+}
+
+func (a *Authenticator) authenticateBearer(r *http.Request) (Identity, error) {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" || a.JWT == nil {
+		return Identity{}, errMissingCredentials
+	}
+	const bearer = "bearer "
+	if len(authorization) <= len(bearer) || !strings.EqualFold(authorization[:len(bearer)], bearer) {
+		return Identity{}, errMissingCredentials
+	}
+	return a.JWT.Validate(r.Context(), strings.TrimSpace(authorization[len(bearer):]))
+}
+
+// GenerateAPIKey returns a new random key together with the prefix and hash
+// to store for it.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, generatedAPIKeyBytes)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(secret)
+	return key, key[:displayedPrefixLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey is the form a key is stored and looked up in. Keys are long
+// random strings, so a fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/warehouse/app/store"
+)
+
+// ArticlesStore invalidates the products using the articles it changes in
+// Products.
+type ArticlesStore struct {
+	store.ArticlesStore
+	Products *ProductsStore
+}
+
+func (s *ArticlesStore) CreateOrUpdateArticles(ctx context.Context, req store.CreateOrUpdateArticlesRequest) error {
+	err := s.ArticlesStore.CreateOrUpdateArticles(ctx, req)
+	articleIDs := make([]string, 0, len(req.Articles))
+	for _, article := range req.Articles {
+		articleIDs = append(articleIDs, article.ArticleID)
+	}
+	s.Products.InvalidateArticles(ctx, articleIDs)
+	return err
+}
+
+func (s *ArticlesStore) UpdateArticle(ctx context.Context, req store.UpdateArticleRequest) (store.Article, error) {
+	article, err := s.ArticlesStore.UpdateArticle(ctx, req)
+	s.Products.InvalidateArticles(ctx, []string{req.ArticleID})
+	return article, err
+}
+
+// PurchaseOrdersStore invalidates the products using the articles received
+// in Products.
+type PurchaseOrdersStore struct {
+	store.PurchaseOrdersStore
+	Products *ProductsStore
+}
+
+func (s *PurchaseOrdersStore) ReceivePurchaseOrder(
+	ctx context.Context,
+	req store.ReceivePurchaseOrderRequest,
+) (store.PurchaseOrder, error) {
+	purchaseOrder, err := s.PurchaseOrdersStore.ReceivePurchaseOrder(ctx, req)
+	articleIDs := make([]string, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		articleIDs = append(articleIDs, line.ArticleID)
+	}
+	s.Products.InvalidateArticles(ctx, articleIDs)
+	return purchaseOrder, err
+}
@@ -0,0 +1,331 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/store"
+)
+
+const listenRetryInterval = 5 * time.Second
+
+// key identifies a cached response, productID is empty for GetAllProducts.
+type key struct {
+	tenant    string
+	productID string
+}
+
+type articleKey struct {
+	tenant    string
+	articleID string
+}
+
+type entry struct {
+	key key
+	// readAt is when the read of the response started, the response is at
+	// least as fresh.
+	readAt   time.Time
+	products store.GetAllProductsResponse
+	product  store.Product
+}
+
+// Stats are the counters of a cache since it was created.
+type Stats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+	Entries       int
+}
+
+// ProductsStore caches GetAllProducts and GetProduct of the store it wraps in
+// an LRU of size entries. Its own writes, and those of ArticlesStore and
+// PurchaseOrdersStore wrapping the same cache, invalidate the products they
+// change before returning. Writes of other instances are seen through Run, a
+// response is never served once it is older than maxStaleness.
+//
+// Misses read from the primary, a response of a lagging replica could be
+// older than its readAt and outlive an invalidation that came before it. Reads
+// of a context made with store.WithPrimaryReads skip the cache.
+type ProductsStore struct {
+	next         store.ProductsStore
+	size         int
+	maxStaleness time.Duration
+
+	mu      sync.Mutex
+	entries map[key]*list.Element
+	lru     *list.List
+	// products maps the articles of the cached products to them.
+	products map[articleKey]map[string]struct{}
+	// generations counts the invalidations of every tenant, a response read
+	// while one happened isn't cached.
+	generations map[string]uint64
+	purges      uint64
+	stats       Stats
+}
+
+func NewProductsStore(next store.ProductsStore, size int, maxStaleness time.Duration) *ProductsStore {
+	return &ProductsStore{
+		next:         next,
+		size:         size,
+		maxStaleness: maxStaleness,
+		entries:      make(map[key]*list.Element),
+		lru:          list.New(),
+		products:     make(map[articleKey]map[string]struct{}),
+		generations:  make(map[string]uint64),
+	}
+}
+
+func (c *ProductsStore) GetAllProducts(ctx context.Context) (store.GetAllProductsResponse, error) {
+	if store.PrimaryReadsFromContext(ctx) {
+		return c.next.GetAllProducts(ctx)
+	}
+	k := key{tenant: store.TenantFromContext(ctx)}
+	if cached, ok := c.get(k); ok {
+		return cached.products, nil
+	}
+	generation, readAt := c.startRead(k.tenant)
+	res, err := c.next.GetAllProducts(store.WithPrimaryReads(ctx))
+	if err != nil {
+		return res, err
+	}
+	c.put(&entry{key: k, readAt: readAt, products: res}, generation)
+	return res, nil
+}
+
+func (c *ProductsStore) GetProduct(ctx context.Context, productID string) (store.Product, error) {
+	if store.PrimaryReadsFromContext(ctx) {
+		return c.next.GetProduct(ctx, productID)
+	}
+	k := key{tenant: store.TenantFromContext(ctx), productID: productID}
+	if cached, ok := c.get(k); ok {
+		return cached.product, nil
+	}
+	generation, readAt := c.startRead(k.tenant)
+	product, err := c.next.GetProduct(store.WithPrimaryReads(ctx), productID)
+	if err != nil {
+		return product, err
+	}
+	c.put(&entry{key: k, readAt: readAt, product: product}, generation)
+	return product, nil
+}
+
+// StreamProducts isn't cached, a stream is for listings too large to hold.
+func (c *ProductsStore) StreamProducts(ctx context.Context, fn func(product store.Product) error) error {
+	return c.next.StreamProducts(ctx, fn)
+}
+
+// CreateOrUpdateProducts only adds products, the stock of the others stays.
+func (c *ProductsStore) CreateOrUpdateProducts(ctx context.Context, req store.CreateOrUpdateProductsRequest) error {
+	err := c.next.CreateOrUpdateProducts(ctx, req)
+	c.invalidate(store.TenantFromContext(ctx))
+	return err
+}
+
+// DryRunCreateOrUpdateProducts changes nothing to invalidate.
+func (c *ProductsStore) DryRunCreateOrUpdateProducts(
+	ctx context.Context,
+	req store.CreateOrUpdateProductsRequest,
+) (store.ImportDiff, error) {
+	return c.next.DryRunCreateOrUpdateProducts(ctx, req)
+}
+
+// RemoveProductAndUpdateArticles changes the stock of every product sharing
+// an article with the one sold. They are all invalidated when the articles of
+// the sold product aren't cached.
+func (c *ProductsStore) RemoveProductAndUpdateArticles(
+	ctx context.Context,
+	req store.RemoveProductAndUpdateArticlesRequest,
+) error {
+	err := c.next.RemoveProductAndUpdateArticles(ctx, req)
+	tenant := store.TenantFromContext(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key{tenant: tenant, productID: req.ProductID}]
+	if !ok {
+		c.invalidateTenantLocked(tenant)
+		return err
+	}
+	articleIDs := articleIDsOf(element.Value.(*entry).product.Articles)
+	c.invalidateArticlesLocked(tenant, articleIDs)
+	return err
+}
+
+func (c *ProductsStore) UpdateProduct(ctx context.Context, req store.UpdateProductRequest) (store.Product, error) {
+	product, err := c.next.UpdateProduct(ctx, req)
+	c.invalidate(store.TenantFromContext(ctx), req.ProductID)
+	return product, err
+}
+
+// InvalidateArticles drops the products using the articles.
+func (c *ProductsStore) InvalidateArticles(ctx context.Context, articleIDs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateArticlesLocked(store.TenantFromContext(ctx), articleIDs)
+}
+
+// Invalidate drops the product of a product event, every change of the stock
+// of a product records one.
+func (c *ProductsStore) Invalidate(event store.OutboxEvent) {
+	if event.AggregateType != store.OutboxAggregateProduct {
+		return
+	}
+	c.invalidate(event.TenantID, event.AggregateID)
+}
+
+// Run invalidates the products changed by the other instances from the
+// outbox until ctx is cancelled.
+func (c *ProductsStore) Run(ctx context.Context, outboxStore store.OutboxStore) {
+	for ctx.Err() == nil {
+		err := outboxStore.ListenOutboxEvents(ctx, c.Invalidate)
+		if err == nil {
+			continue
+		}
+		log.Error().AnErr("error", err).Msg("products cache failed to listen to the outbox, retrying")
+		// the events missed meanwhile are lost
+		c.Purge()
+		select {
+		case <-ctx.Done():
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+// Purge drops every cached response.
+func (c *ProductsStore) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purges++
+	c.stats.Invalidations += uint64(len(c.entries))
+	c.entries = make(map[key]*list.Element)
+	c.lru.Init()
+	c.products = make(map[articleKey]map[string]struct{})
+}
+
+func (c *ProductsStore) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+func (c *ProductsStore) get(k key) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[k]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	cached := element.Value.(*entry)
+	if time.Since(cached.readAt) > c.maxStaleness {
+		c.removeLocked(element)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	c.stats.Hits++
+	return cached, true
+}
+
+func (c *ProductsStore) startRead(tenant string) (uint64, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generationLocked(tenant), time.Now()
+}
+
+func (c *ProductsStore) generationLocked(tenant string) uint64 {
+	return c.generations[tenant] + c.purges
+}
+
+// put caches e unless the tenant had an invalidation since its read started,
+// the response may predate it.
+func (c *ProductsStore) put(e *entry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generationLocked(e.key.tenant) != generation {
+		return
+	}
+	if element, ok := c.entries[e.key]; ok {
+		c.removeLocked(element)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for _, articleID := range articleIDsOf(e.product.Articles) {
+		ak := articleKey{tenant: e.key.tenant, articleID: articleID}
+		if c.products[ak] == nil {
+			c.products[ak] = make(map[string]struct{})
+		}
+		c.products[ak][e.key.productID] = struct{}{}
+	}
+	for c.lru.Len() > c.size {
+		c.removeLocked(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate drops the list of products of tenant and the products.
+func (c *ProductsStore) invalidate(tenant string, productIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateLocked(tenant, productIDs)
+}
+
+func (c *ProductsStore) invalidateLocked(tenant string, productIDs []string) {
+	c.generations[tenant]++
+	c.removeKeyLocked(key{tenant: tenant})
+	for _, productID := range productIDs {
+		c.removeKeyLocked(key{tenant: tenant, productID: productID})
+	}
+}
+
+func (c *ProductsStore) invalidateArticlesLocked(tenant string, articleIDs []string) {
+	var productIDs []string
+	for _, articleID := range articleIDs {
+		for productID := range c.products[articleKey{tenant: tenant, articleID: articleID}] {
+			productIDs = append(productIDs, productID)
+		}
+	}
+	c.invalidateLocked(tenant, productIDs)
+}
+
+func (c *ProductsStore) invalidateTenantLocked(tenant string) {
+	var productIDs []string
+	for k := range c.entries {
+		if k.tenant == tenant && k.productID != "" {
+			productIDs = append(productIDs, k.productID)
+		}
+	}
+	c.invalidateLocked(tenant, productIDs)
+}
+
+func (c *ProductsStore) removeKeyLocked(k key) {
+	if element, ok := c.entries[k]; ok {
+		c.removeLocked(element)
+		c.stats.Invalidations++
+	}
+}
+
+func (c *ProductsStore) removeLocked(element *list.Element) {
+	e := c.lru.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	for _, articleID := range articleIDsOf(e.product.Articles) {
+		ak := articleKey{tenant: e.key.tenant, articleID: articleID}
+		delete(c.products[ak], e.key.productID)
+		if len(c.products[ak]) == 0 {
+			delete(c.products, ak)
+		}
+	}
+}
+
+func articleIDsOf(articles []store.ProductArticle) []string {
+	articleIDs := make([]string, 0, len(articles))
+	for _, article := range articles {
+		articleIDs = append(articleIDs, article.ArticleID)
+	}
+	return articleIDs
+}
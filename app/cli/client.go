@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/warehouse/app/articles"
+	"github.com/warehouse/app/products"
+)
+
+// Client is how the commands reach the warehouse, through the http api of a
+// running service or straight through the database. Both speak the request
+// and response bodies of the http api, so that the output of a command
+// doesn't depend on it.
+type Client interface {
+	ImportArticles(ctx context.Context, req *articles.CreateOrUpdateArticlesRequest) error
+	ImportProducts(ctx context.Context, req *products.CreateOrUpdateProductsRequest) error
+	GetAllArticles(ctx context.Context) (*articles.GetAllArticlesResponse, error)
+	GetAllProducts(ctx context.Context) (*products.GetAllProductsWithStockResponse, error)
+	SellProduct(ctx context.Context, productID string) error
+	GetArticle(ctx context.Context, articleID string) (*articles.ArticleWithVersion, error)
+	// UpdateArticle fails with store.ErrVersionConflict when the article
+	// isn't at expectedVersion anymore.
+	UpdateArticle(
+		ctx context.Context,
+		articleID string,
+		expectedVersion int,
+		req *articles.UpdateArticleRequest,
+	) (*articles.ArticleWithVersion, error)
+	Close() error
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warehouse/app/articles"
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/products"
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+	"github.com/warehouse/app/tenancy"
+)
+
+// APIError is a response of the service with an error status.
+type APIError struct {
+	StatusCode int
+	responses.ErrorResponse
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is lets a 412 match store.ErrVersionConflict, like StoreClient returns it.
+func (e *APIError) Is(target error) bool {
+	return target == store.ErrVersionConflict && e.StatusCode == http.StatusPreconditionFailed
+}
+
+// HTTPClient calls the http api of a running service.
+type HTTPClient struct {
+	BaseURL string
+	APIKey  string
+	// Tenant is sent as X-Tenant-ID when set.
+	Tenant     string
+	HTTPClient *http.Client
+}
+
+func NewHTTPClient(baseURL, apiKey, tenant string, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		APIKey:     apiKey,
+		Tenant:     tenant,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *HTTPClient) ImportArticles(ctx context.Context, req *articles.CreateOrUpdateArticlesRequest) error {
+	_, err := c.do(ctx, http.MethodPost, "/articles", nil, req, nil)
+	return err
+}
+
+func (c *HTTPClient) ImportProducts(ctx context.Context, req *products.CreateOrUpdateProductsRequest) error {
+	_, err := c.do(ctx, http.MethodPost, "/products", nil, req, nil)
+	return err
+}
+
+func (c *HTTPClient) GetAllArticles(ctx context.Context) (*articles.GetAllArticlesResponse, error) {
+	res := &articles.GetAllArticlesResponse{}
+	_, err := c.do(ctx, http.MethodGet, "/articles", nil, nil, res)
+	return res, err
+}
+
+func (c *HTTPClient) GetAllProducts(ctx context.Context) (*products.GetAllProductsWithStockResponse, error) {
+	res := &products.GetAllProductsWithStockResponse{}
+	_, err := c.do(ctx, http.MethodGet, "/products", nil, nil, res)
+	return res, err
+}
+
+func (c *HTTPClient) SellProduct(ctx context.Context, productID string) error {
+	_, err := c.do(ctx, http.MethodPost, "/products/sell", nil, &products.SellProductRequest{ProductID: productID}, nil)
+	return err
+}
+
+func (c *HTTPClient) GetArticle(ctx context.Context, articleID string) (*articles.ArticleWithVersion, error) {
+	res := &articles.ArticleWithVersion{}
+	_, err := c.do(ctx, http.MethodGet, "/articles/"+url.PathEscape(articleID), nil, nil, res)
+	return res, err
+}
+
+func (c *HTTPClient) UpdateArticle(
+	ctx context.Context,
+	articleID string,
+	expectedVersion int,
+	req *articles.UpdateArticleRequest,
+) (*articles.ArticleWithVersion, error) {
+	header := http.Header{}
+	if expectedVersion > 0 {
+		header.Set("If-Match", strconv.Quote(strconv.Itoa(expectedVersion)))
+	}
+	res := &articles.ArticleWithVersion{}
+	_, err := c.do(ctx, http.MethodPut, "/articles/"+url.PathEscape(articleID), header, req, res)
+	return res, err
+}
+
+func (c *HTTPClient) Close() error {
+	c.HTTPClient.CloseIdleConnections()
+	return nil
+}
+
+// do sends body as JSON and decodes the response into res, when both are
+// set.
+func (c *HTTPClient) do(
+	ctx context.Context,
+	method, path string,
+	header http.Header,
+	body, res interface{},
+) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, c.APIKey)
+	}
+	if c.Tenant != "" {
+		req.Header.Set(tenancy.HeaderTenantID, c.Tenant)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		// a body that isn't an error response, e.g. from a proxy, leaves
+		// only the status
+		_ = json.Unmarshal(data, &apiErr.ErrorResponse)
+		return resp, apiErr
+	}
+	if res != nil && len(data) > 0 {
+		err = json.Unmarshal(data, res)
+	}
+	return resp, err
+}
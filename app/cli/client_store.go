@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/warehouse/app/articles"
+	"github.com/warehouse/app/products"
+	"github.com/warehouse/app/store"
+)
+
+// StoreClient works on the database directly, for the tenant of the context
+// of every call.
+type StoreClient struct {
+	DB *store.PostgresDB
+}
+
+func NewStoreClient(db *store.PostgresDB) *StoreClient {
+	return &StoreClient{DB: db}
+}
+
+func (c *StoreClient) ImportArticles(ctx context.Context, req *articles.CreateOrUpdateArticlesRequest) error {
+	dbReq, err := articles.GetCreateOrUpdateArticlesDBRequest(req)
+	if err != nil {
+		return err
+	}
+	return c.DB.CreateOrUpdateArticles(ctx, dbReq)
+}
+
+func (c *StoreClient) ImportProducts(ctx context.Context, req *products.CreateOrUpdateProductsRequest) error {
+	dbReq, err := products.GetCreateOrUpdateProductsDBRequest(req)
+	if err != nil {
+		return err
+	}
+	return c.DB.CreateOrUpdateProducts(ctx, dbReq)
+}
+
+func (c *StoreClient) GetAllArticles(ctx context.Context) (*articles.GetAllArticlesResponse, error) {
+	res, err := c.DB.GetAllArticles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return articles.GetAllArticlesResponseFromDBResult(res), nil
+}
+
+func (c *StoreClient) GetAllProducts(ctx context.Context) (*products.GetAllProductsWithStockResponse, error) {
+	res, err := c.DB.GetAllProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return products.GetProductsResponseFromDBResult(res), nil
+}
+
+func (c *StoreClient) SellProduct(ctx context.Context, productID string) error {
+	return c.DB.RemoveProductAndUpdateArticles(ctx, store.RemoveProductAndUpdateArticlesRequest{ProductID: productID})
+}
+
+func (c *StoreClient) GetArticle(ctx context.Context, articleID string) (*articles.ArticleWithVersion, error) {
+	res, err := c.DB.GetArticle(ctx, articleID)
+	if err != nil {
+		return nil, err
+	}
+	return articles.GetArticleResponseFromDBResult(res), nil
+}
+
+func (c *StoreClient) UpdateArticle(
+	ctx context.Context,
+	articleID string,
+	expectedVersion int,
+	req *articles.UpdateArticleRequest,
+) (*articles.ArticleWithVersion, error) {
+	dbReq, err := articles.GetUpdateArticleDBRequest(articleID, expectedVersion, req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.DB.UpdateArticle(ctx, dbReq)
+	if err != nil {
+		return nil, err
+	}
+	return articles.GetArticleResponseFromDBResult(res), nil
+}
+
+func (c *StoreClient) Close() error {
+	return c.DB.Close()
+}
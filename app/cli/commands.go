@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/warehouse/app/articles"
+	"github.com/warehouse/app/products"
+	"github.com/warehouse/app/server"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	KindArticles = "articles"
+	KindProducts = "products"
+
+	OutputTable = "table"
+	OutputJSON  = "json"
+
+	// adjustRetries is how many times AdjustStock starts over when the
+	// article changed between its read and its update.
+	adjustRetries = 3
+)
+
+var (
+	ErrUnknownKind     = errors.New("unknown kind, expected articles or products")
+	ErrUnknownOutput   = errors.New("unknown output, expected table or json")
+	ErrInvalidQuantity = errors.New("quantity must be at least 1")
+	ErrNegativeStock   = errors.New("adjustment would make the stock negative")
+)
+
+// Options pick how the commands reach the warehouse and print their results.
+type Options struct {
+	// Server is the URL of the http api, the database of the configuration is
+	// used when it is empty.
+	Server  string
+	APIKey  string
+	Tenant  string
+	Timeout time.Duration
+	Output  string
+}
+
+// OptionsFromConfig returns the options set by the environment.
+func OptionsFromConfig(cfg server.Configuration) Options {
+	return Options{
+		Server:  cfg.CLI.Server,
+		APIKey:  cfg.CLI.APIKey,
+		Tenant:  cfg.CLI.Tenant,
+		Timeout: time.Duration(cfg.CLI.Timeout) * time.Millisecond,
+		Output:  OutputTable,
+	}
+}
+
+// Connect returns the client of opts. The context of the calls of a client on
+// the database must carry the tenant, see Context.
+func Connect(ctx context.Context, cfg server.Configuration, opts Options) (Client, error) {
+	if opts.Output != OutputTable && opts.Output != OutputJSON {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOutput, opts.Output)
+	}
+	if opts.Server != "" {
+		return NewHTTPClient(opts.Server, opts.APIKey, opts.Tenant, opts.Timeout), nil
+	}
+	db, err := server.NewPostgresDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreClient(db), nil
+}
+
+// Context scopes the calls of a client to the tenant of opts, the http api
+// gets it from a header instead.
+func Context(ctx context.Context, opts Options) context.Context {
+	return store.WithTenant(ctx, opts.Tenant)
+}
+
+// Import creates or updates the articles or products of r, a body of POST
+// /articles or POST /products, and returns how many it had.
+func Import(ctx context.Context, client Client, kind string, r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	switch kind {
+	case KindArticles:
+		req := &articles.CreateOrUpdateArticlesRequest{}
+		err := decoder.Decode(req)
+		if err != nil {
+			return 0, err
+		}
+		return len(req.Inventory), client.ImportArticles(ctx, req)
+	case KindProducts:
+		req := &products.CreateOrUpdateProductsRequest{}
+		err := decoder.Decode(req)
+		if err != nil {
+			return 0, err
+		}
+		return len(req.Products), client.ImportProducts(ctx, req)
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+}
+
+// Export writes the articles or products as a body Import takes back.
+func Export(ctx context.Context, client Client, kind string, out io.Writer) error {
+	var body interface{}
+	switch kind {
+	case KindArticles:
+		res, err := client.GetAllArticles(ctx)
+		if err != nil {
+			return err
+		}
+		req := &articles.CreateOrUpdateArticlesRequest{Inventory: make([]articles.Article, 0, len(res.Inventory))}
+		for _, article := range res.Inventory {
+			req.Inventory = append(req.Inventory, article.Article)
+		}
+		body = req
+	case KindProducts:
+		res, err := client.GetAllProducts(ctx)
+		if err != nil {
+			return err
+		}
+		req := &products.CreateOrUpdateProductsRequest{Products: make([]products.Product, 0, len(res.Products))}
+		for _, product := range res.Products {
+			req.Products = append(req.Products, product.Product)
+		}
+		body = req
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+	return writeJSON(out, body)
+}
+
+// ListProducts writes the products with their stock, as GET /products
+// returns them for the json output.
+func ListProducts(ctx context.Context, client Client, output string, out io.Writer) error {
+	res, err := client.GetAllProducts(ctx)
+	if err != nil {
+		return err
+	}
+	if output == OutputJSON {
+		return writeJSON(out, res)
+	}
+	rows := make([][]string, 0, len(res.Products))
+	for _, product := range res.Products {
+		rows = append(rows, []string{
+			product.ProductID,
+			product.Name,
+			strconv.Itoa(product.Stock),
+			strconv.Itoa(product.Version),
+		})
+	}
+	return writeTable(out, []string{"ID", "NAME", "STOCK", "VERSION"}, rows)
+}
+
+// SellProduct sells quantity units of the product one after the other, like
+// POST /products/sell would, and returns how many were sold when one fails.
+func SellProduct(ctx context.Context, client Client, productID string, quantity int) (int, error) {
+	if quantity < 1 {
+		return 0, ErrInvalidQuantity
+	}
+	for sold := 0; sold < quantity; sold++ {
+		err := client.SellProduct(ctx, productID)
+		if err != nil {
+			return sold, err
+		}
+	}
+	return quantity, nil
+}
+
+// AdjustStock adds delta, which may be negative, to the stock of the article.
+// The update requires the version read, it starts over when another write got
+// in between.
+func AdjustStock(ctx context.Context, client Client, articleID string, delta int) (*articles.ArticleWithVersion, error) {
+	var err error
+	for attempt := 0; attempt < adjustRetries; attempt++ {
+		var article *articles.ArticleWithVersion
+		article, err = client.GetArticle(ctx, articleID)
+		if err != nil {
+			return nil, err
+		}
+		stock, parseErr := strconv.Atoi(article.Stock)
+		if parseErr != nil {
+			return nil, fmt.Errorf("stock of article %s: %w", articleID, parseErr)
+		}
+		if stock+delta < 0 {
+			return nil, fmt.Errorf("%w: %d%+d", ErrNegativeStock, stock, delta)
+		}
+		req := &articles.UpdateArticleRequest{Name: article.Name, Stock: strconv.Itoa(stock + delta)}
+		article, err = client.UpdateArticle(ctx, articleID, article.Version, req)
+		if !errors.Is(err, store.ErrVersionConflict) {
+			return article, err
+		}
+	}
+	return nil, err
+}
+
+// WriteArticle writes an article as GET /articles/{id} returns it for the
+// json output.
+func WriteArticle(article *articles.ArticleWithVersion, output string, out io.Writer) error {
+	if output == OutputJSON {
+		return writeJSON(out, article)
+	}
+	row := []string{article.ArticleID, article.Name, article.Stock, strconv.Itoa(article.Version)}
+	return writeTable(out, []string{"ID", "NAME", "STOCK", "VERSION"}, [][]string{row})
+}
+
+func writeJSON(out io.Writer, body interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(body)
+}
+
+func writeTable(out io.Writer, header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				_, _ = io.WriteString(w, "\t")
+			}
+			_, _ = io.WriteString(w, cell)
+		}
+		_, _ = io.WriteString(w, "\n")
+	}
+	return w.Flush()
+}
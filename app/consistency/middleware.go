@@ -0,0 +1,61 @@
+package consistency
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/warehouse/app/server/recorder"
+	"github.com/warehouse/app/store"
+)
+
+// HeaderLastWrite carries the time of the last write of a client. The
+// response of every successful write sets it, a client sending it back on its
+// next requests reads its own writes.
+const HeaderLastWrite = "X-Last-Write"
+
+// maxClockSkew tolerates the clock of the instance that handled the write
+// being ahead of the one reading.
+const maxClockSkew = time.Second
+
+// ReadYourWrites sends the reads of a client to the primary for Window after
+// its last write, when replicas may not have caught up yet.
+type ReadYourWrites struct {
+	Window time.Duration
+}
+
+func NewReadYourWrites(window time.Duration) *ReadYourWrites {
+	return &ReadYourWrites{Window: window}
+}
+
+func (m *ReadYourWrites) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.Window <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// a client can't pin its reads to the primary by sending a time in
+		// the future, it is ignored like a malformed one
+		lastWrite, err := time.Parse(time.RFC3339Nano, r.Header.Get(HeaderLastWrite))
+		if age := time.Since(lastWrite); err == nil && age < m.Window && age > -maxClockSkew {
+			r = r.WithContext(store.WithPrimaryReads(r.Context()))
+		}
+		if isWrite(r.Method) {
+			rec := recorder.New(w)
+			rec.OnWriteHeader = func(statusCode int) {
+				if statusCode < http.StatusBadRequest {
+					rec.Header().Set(HeaderLastWrite, time.Now().UTC().Format(time.RFC3339Nano))
+				}
+			}
+			w = rec
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
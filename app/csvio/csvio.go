@@ -0,0 +1,153 @@
+package csvio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// flushRows is how many rows a Writer buffers before sending them on.
+const flushRows = 100
+
+// LineError is a row of a file that can't be imported, lines count from 1
+// and the header is line 1.
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Errors are the rows of a file that can't be imported, a file with any isn't
+// imported at all.
+type Errors []LineError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, lineErr := range e {
+		messages = append(messages, fmt.Sprintf("line %d: %s", lineErr.Line, lineErr.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Reader reads the rows of a file whose first line names the columns. Columns
+// it doesn't know are ignored, so that an export with more of them can be
+// imported back.
+type Reader struct {
+	csv     *csv.Reader
+	columns map[string]int
+}
+
+// Record is a row of a file with the line it starts at.
+type Record struct {
+	Line    int
+	values  []string
+	columns map[string]int
+}
+
+// NewReader reads the header of r, which must have every required column.
+func NewReader(r io.Reader, required ...string) (*Reader, error) {
+	reader := &Reader{csv: csv.NewReader(r), columns: make(map[string]int)}
+	reader.csv.FieldsPerRecord = -1
+	reader.csv.TrimLeadingSpace = true
+	header, err := reader.csv.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, Errors{{Line: 1, Message: "missing header"}}
+	}
+	if err != nil {
+		return nil, lineErrors(err)
+	}
+	for i, column := range header {
+		// spreadsheets may start the file with a byte order mark
+		column = strings.TrimPrefix(column, "\ufeff")
+		reader.columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	var missing []string
+	for _, column := range required {
+		if _, ok := reader.columns[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, Errors{{Line: 1, Message: "missing columns " + strings.Join(missing, ", ")}}
+	}
+	return reader, nil
+}
+
+// Read returns the next row, io.EOF after the last one. Errors of the file
+// itself, e.g. an unterminated quote, are Errors.
+func (r *Reader) Read() (Record, error) {
+	values, err := r.csv.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, err
+		}
+		return Record{}, lineErrors(err)
+	}
+	line, _ := r.csv.FieldPos(0)
+	return Record{Line: line, values: values, columns: r.columns}, nil
+}
+
+// Get returns the trimmed value of column, empty when the row doesn't have it.
+func (r Record) Get(column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.values) {
+		return ""
+	}
+	return strings.TrimSpace(r.values[i])
+}
+
+// Empty tells whether every value of the row is blank, e.g. a trailing line
+// of a spreadsheet.
+func (r Record) Empty() bool {
+	for _, value := range r.values {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func lineErrors(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Errors{{Line: parseErr.StartLine, Message: parseErr.Err.Error()}}
+	}
+	return err
+}
+
+// Writer streams rows to w, flushing them to the client every flushRows rows
+// when w is an http.Flusher.
+type Writer struct {
+	csv     *csv.Writer
+	flusher http.Flusher
+	rows    int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	flusher, _ := w.(http.Flusher)
+	return &Writer{csv: csv.NewWriter(w), flusher: flusher}
+}
+
+func (w *Writer) Write(record []string) error {
+	err := w.csv.Write(record)
+	if err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%flushRows == 0 {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush sends the buffered rows on, the last ones are only sent by it.
+func (w *Writer) Flush() error {
+	w.csv.Flush()
+	err := w.csv.Error()
+	if err == nil && w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	replayPageSize    = 500
+	heartbeatInterval = 15 * time.Second
+)
+
+var (
+	errStreamingUnsupported = errors.New("streaming is not supported by the connection")
+	errInvalidLastEventID   = errors.New("last event id must be a positive integer")
+	errShuttingDown         = errors.New("server is shutting down")
+)
+
+// stockEventTypes are the outbox events streamed by GET /events/stock.
+var stockEventTypes = []string{
+	store.OutboxEventArticleCreated,
+	store.OutboxEventArticleUpdated,
+	store.OutboxEventProductStockChanged,
+}
+
+type Handler struct {
+	OutboxStore store.OutboxStore
+	Hub         *Hub
+}
+
+func NewHandler(hub *Hub) *Handler {
+	return &Handler{Hub: hub}
+}
+
+// StreamStock is http api GET /events/stock
+//
+// It streams article and product stock changes as Server-Sent Events. The
+// articleId and productId query parameters, repeated or comma separated,
+// restrict the stream to those resources. A client reconnecting with
+// Last-Event-ID first gets every change it missed.
+func (h *Handler) StreamStock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errStreamingUnsupported.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	lastEventID, err := parseLastEventID(r)
+	if err != nil {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	filter := newStockFilter(r)
+	// subscribe before replaying, so nothing committed in between is lost
+	sub := h.Hub.Subscribe(filter.match)
+	if sub == nil {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errShuttingDown.Error())
+		responses.WriteError(ctx, w, http.StatusServiceUnavailable, body)
+		return
+	}
+	defer h.Hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if lastEventID > 0 {
+		lastEventID, err = h.replay(w, r, filter, lastEventID)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("StreamStock failed to replay missed events")
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event, open := <-sub.events:
+			if !open {
+				return
+			}
+			if event.EventID <= lastEventID {
+				continue
+			}
+			err = writeEvent(w, event)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *Handler) replay(w http.ResponseWriter, r *http.Request, filter stockFilter, lastEventID int64) (int64, error) {
+	for {
+		events, err := h.OutboxStore.GetOutboxEvents(r.Context(), store.GetOutboxEventsRequest{
+			AfterEventID: lastEventID,
+			EventTypes:   stockEventTypes,
+			Limit:        replayPageSize,
+		})
+		if err != nil {
+			return lastEventID, err
+		}
+		for _, event := range events {
+			lastEventID = event.EventID
+			if !filter.match(event) {
+				continue
+			}
+			err = writeEvent(w, event)
+			if err != nil {
+				return lastEventID, err
+			}
+		}
+		if len(events) < replayPageSize {
+			return lastEventID, nil
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event store.OutboxEvent) error {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.EventID, event.EventType, data)
+	return err
+}
+
+func parseLastEventID(r *http.Request) (int64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errInvalidLastEventID
+	}
+	return id, nil
+}
+
+type stockFilter struct {
+	tenant     string
+	articleIDs map[string]struct{}
+	productIDs map[string]struct{}
+}
+
+func newStockFilter(r *http.Request) stockFilter {
+	query := r.URL.Query()
+	return stockFilter{
+		tenant:     store.TenantFromContext(r.Context()),
+		articleIDs: idSet(query["articleId"]),
+		productIDs: idSet(query["productId"]),
+	}
+}
+
+func (f stockFilter) match(event store.OutboxEvent) bool {
+	if event.TenantID != f.tenant || !isStockEvent(event) {
+		return false
+	}
+	if len(f.articleIDs) == 0 && len(f.productIDs) == 0 {
+		return true
+	}
+	switch event.AggregateType {
+	case store.OutboxAggregateArticle:
+		_, ok := f.articleIDs[event.AggregateID]
+		return ok
+	case store.OutboxAggregateProduct:
+		_, ok := f.productIDs[event.AggregateID]
+		return ok
+	}
+	return false
+}
+
+func isStockEvent(event store.OutboxEvent) bool {
+	for _, eventType := range stockEventTypes {
+		if event.EventType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func idSet(values []string) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for _, value := range values {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
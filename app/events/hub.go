@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/store"
+)
+
+const (
+	subscriberBufferSize = 64
+	listenRetryInterval  = 5 * time.Second
+)
+
+// Hub fans out committed outbox events to the connected stream clients.
+// A client that does not keep up is disconnected instead of slowing everybody
+// down, it can resume with Last-Event-ID.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Subscription receives the events of the hub it matches until it is closed.
+type Subscription struct {
+	events chan store.OutboxEvent
+	match  func(store.OutboxEvent) bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Run feeds the hub from the outbox until ctx is cancelled, then disconnects
+// every client.
+func (h *Hub) Run(ctx context.Context, outboxStore store.OutboxStore) {
+	defer h.Close()
+	for ctx.Err() == nil {
+		err := outboxStore.ListenOutboxEvents(ctx, h.Publish)
+		if err == nil {
+			continue
+		}
+		log.Error().AnErr("error", err).Msg("stock event hub failed to listen to the outbox, retrying")
+		select {
+		case <-ctx.Done():
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+// Publish only queues event for the subscriptions matching it, so that the
+// events of other tenants don't fill the buffer of a client and get it
+// disconnected.
+func (h *Hub) Publish(event store.OutboxEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if !sub.match(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events match accepts, or nil once
+// the hub is closed.
+func (h *Hub) Subscribe(match func(store.OutboxEvent) bool) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	sub := &Subscription{
+		events: make(chan store.OutboxEvent, subscriberBufferSize),
+		match:  match,
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Close disconnects every client and refuses new ones, it is called on
+// server shutdown so that open streams don't hold it up.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
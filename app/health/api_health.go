@@ -0,0 +1,79 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Handler struct {
+	Registry *Registry
+	// shuttingDown is set once the server started shutting down.
+	shuttingDown int32
+}
+
+func NewHandler() *Handler {
+	return &Handler{Registry: NewRegistry()}
+}
+
+// Shutdown makes the service report it isn't ready, so that no new traffic
+// is routed to it while it finishes the requests in flight.
+func (h *Handler) Shutdown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// Health is http api GET /health
+//
+// It tells that the process is alive and serving requests. Dependencies are
+// left to GET /readiness, restarting the service wouldn't fix them.
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, r, http.StatusOK, Report{Status: StatusPass})
+}
+
+// Ready is http api GET /readiness
+//
+// It runs the registered checks and returns 503 when a critical one fails or
+// the server is shutting down.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.shuttingDown) == 1 {
+		writeReport(w, r, http.StatusServiceUnavailable, Report{Status: StatusFail, Checks: []CheckResult{{
+			Name:     "shutdown",
+			Status:   StatusFail,
+			Critical: true,
+			Error:    "server is shutting down",
+		}}})
+		return
+	}
+	report := h.Registry.Run(r.Context())
+	statusCode := http.StatusOK
+	if report.Status == StatusFail {
+		statusCode = http.StatusServiceUnavailable
+	}
+	for _, result := range report.Checks {
+		if result.Status != StatusPass {
+			log.Ctx(r.Context()).Warn().
+				Str("check", result.Name).
+				Bool("critical", result.Critical).
+				Str("error", result.Error).
+				Msg("readiness check failed")
+		}
+	}
+	writeReport(w, r, statusCode, report)
+}
+
+func writeReport(w http.ResponseWriter, r *http.Request, statusCode int, report Report) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "couldn't marshal health report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_, err = w.Write(body)
+	if err != nil {
+		log.Ctx(r.Context()).Warn().AnErr("error", err).Msg("error writing the health report")
+	}
+}
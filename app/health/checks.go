@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/warehouse/app/store"
+)
+
+var (
+	ErrMissingMigration = errors.New("database migration missing")
+	ErrNewerMigration   = errors.New("database migrated by a newer version")
+	ErrOutboxBacklog    = errors.New("outbox backlog over threshold")
+)
+
+// Database pings the database.
+func Database(db store.HealthStore) Checker {
+	return CheckerFunc(db.Ping)
+}
+
+// Migration fails until expected, the file of a changeset, is applied to the
+// database, so that the service never runs against a schema older than the
+// one it was built for.
+func Migration(db store.HealthStore, expected string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		applied, err := db.GetAppliedMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if appliedIndex(applied, expected) < 0 {
+			return fmt.Errorf("%w: %s is not applied yet, database is at %s", ErrMissingMigration, path.Base(expected), lastApplied(applied))
+		}
+		return nil
+	})
+}
+
+// MigrationAhead fails once changesets newer than expected are applied. During
+// a rolling deploy the instances of the previous build see the changesets of
+// the next one, they keep serving, but it is worth a warning.
+func MigrationAhead(db store.HealthStore, expected string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		applied, err := db.GetAppliedMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if i := appliedIndex(applied, expected); i >= 0 && i < len(applied)-1 {
+			return fmt.Errorf("%w: database is at %s, expected %s", ErrNewerMigration, lastApplied(applied), path.Base(expected))
+		}
+		return nil
+	})
+}
+
+func appliedIndex(applied []string, expected string) int {
+	for i, filename := range applied {
+		if path.Base(filename) == path.Base(expected) {
+			return i
+		}
+	}
+	return -1
+}
+
+func lastApplied(applied []string) string {
+	if len(applied) == 0 {
+		return "no changeset"
+	}
+	return path.Base(applied[len(applied)-1])
+}
+
+// OutboxBacklog fails once more than threshold outbox events are waiting to
+// be published.
+func OutboxBacklog(db store.HealthStore, threshold int64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		backlog, err := db.GetOutboxBacklog(ctx)
+		if err != nil {
+			return err
+		}
+		if backlog > threshold {
+			return fmt.Errorf("%w: %d events unpublished, threshold is %d", ErrOutboxBacklog, backlog, threshold)
+		}
+		return nil
+	})
+}
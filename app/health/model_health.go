@@ -0,0 +1,15 @@
+package health
+
+// Report is the body of GET /readiness and GET /health.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+type CheckResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Critical   bool   `json:"critical"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPass = "pass"
+	// StatusWarn is reported when only checks that aren't critical fail.
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// Checker tells whether a dependency of the service works.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc turns a function into a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (fn CheckerFunc) Check(ctx context.Context) error {
+	return fn(ctx)
+}
+
+// Check is a Checker run by a Registry. The service isn't ready while a
+// critical check fails, the others are only reported.
+type Check struct {
+	Name     string
+	Critical bool
+	// Timeout fails the check when it takes longer, 0 leaves it to the
+	// caller.
+	Timeout time.Duration
+	Checker Checker
+}
+
+// Registry runs the checks of GET /readiness.
+type Registry struct {
+	mu     sync.Mutex
+	checks []Check
+}
+
+func NewRegistry(checks ...Check) *Registry {
+	return &Registry{checks: checks}
+}
+
+func (reg *Registry) Register(checks ...Check) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.checks = append(reg.checks, checks...)
+}
+
+// Run runs every check at once and reports them in the order they were
+// registered.
+func (reg *Registry) Run(ctx context.Context) Report {
+	reg.mu.Lock()
+	checks := make([]Check, len(reg.checks))
+	copy(checks, reg.checks)
+	reg.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusPass, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusPass {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusPass {
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) CheckResult {
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, check.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := check.Checker.Check(ctx)
+	result := CheckResult{
+		Name:       check.Name,
+		Critical:   check.Critical,
+		Status:     StatusPass,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,200 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/server/recorder"
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	// completeTimeout bounds storing the response once the handler is done,
+	// this must happen even if the client already went away.
+	completeTimeout = 5 * time.Second
+	retryAfter      = "1"
+)
+
+var (
+	errKeyTooLong   = errors.New("Idempotency-Key must not be longer than 255 characters")
+	errKeyReused    = errors.New("Idempotency-Key was already used with a different request")
+	errKeyInProgess = errors.New("a request with this Idempotency-Key is still in progress")
+)
+
+// Middleware makes mutating requests carrying an Idempotency-Key header safe
+// to retry. The first request runs and its status and body are stored under
+// the key together with a hash of the request. Repeating it returns the
+// stored response without running the handler again, while reusing the key
+// for a different request is rejected. Server errors are not stored, so that
+// the request can be retried.
+type Middleware struct {
+	Store       store.IdempotencyStore
+	Retention   time.Duration
+	LockTimeout time.Duration
+}
+
+func NewMiddleware(idempotencyStore store.IdempotencyStore, retention, lockTimeout time.Duration) *Middleware {
+	return &Middleware{
+		Store:       idempotencyStore,
+		Retention:   retention,
+		LockTimeout: lockTimeout,
+	}
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if len(key) > maxKeyLength {
+			body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errKeyTooLong.Error())
+			responses.WriteError(ctx, w, http.StatusBadRequest, body)
+			return
+		}
+		requestBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+			responses.WriteError(ctx, w, http.StatusBadRequest, body)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(requestBody))
+		requestHash := hashRequest(r, requestBody)
+
+		// keys are per caller, so that one can't replay the response of another
+		var subject string
+		if id, ok := auth.IdentityFromContext(ctx); ok {
+			subject = id.Subject
+		}
+		res, err := m.Store.AcquireIdempotencyKey(ctx, store.AcquireIdempotencyKeyRequest{
+			Key:         key,
+			Subject:     subject,
+			RequestHash: requestHash,
+			Retention:   m.Retention,
+			LockTimeout: m.LockTimeout,
+		})
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("idempotency middleware failed to acquire key")
+			body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+			responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+			return
+		}
+		if !res.Acquired {
+			writeExisting(ctx, w, res.Record, requestHash)
+			return
+		}
+
+		rec := recorder.New(w)
+		rec.KeepBody = true
+		// done stays false when the handler panics, its response is unknown then
+		done := false
+		defer func() {
+			// store the outcome even if the client disconnected meanwhile, under
+			// the tenant the key was acquired for
+			storeCtx := store.WithTenant(context.Background(), store.TenantFromContext(ctx))
+			storeCtx, cancel := context.WithTimeout(storeCtx, completeTimeout)
+			defer cancel()
+			record := res.Record
+			if !done || rec.StatusCode() >= http.StatusInternalServerError {
+				// the panic goes on once the key is released
+				if err := m.Store.ReleaseIdempotencyKey(storeCtx, record); err != nil {
+					log.Ctx(ctx).Error().AnErr("error", err).Msg("idempotency middleware failed to release key")
+				}
+				return
+			}
+			record.Completed = true
+			record.StatusCode = rec.StatusCode()
+			record.ContentType = rec.Header().Get("Content-Type")
+			record.Body = rec.Body.Bytes()
+			if err := m.Store.CompleteIdempotencyKey(storeCtx, record); err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("idempotency middleware failed to store the response")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		done = true
+	})
+}
+
+// RunCleanup deletes expired keys every interval until ctx is cancelled.
+func (m *Middleware) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := m.Store.DeleteExpiredIdempotencyKeys(ctx, m.Retention)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to delete expired idempotency keys")
+				continue
+			}
+			if deleted > 0 {
+				log.Ctx(ctx).Info().Int64("deleted", deleted).Msg("deleted expired idempotency keys")
+			}
+		}
+	}
+}
+
+func writeExisting(ctx context.Context, w http.ResponseWriter, record store.IdempotencyRecord, requestHash string) {
+	if record.RequestHash != requestHash {
+		body := responses.GenerateErrorResponseBody(ctx, responses.IdempotencyKeyReused, errKeyReused.Error())
+		responses.WriteError(ctx, w, http.StatusUnprocessableEntity, body)
+		return
+	}
+	if !record.Completed {
+		w.Header().Set("Retry-After", retryAfter)
+		body := responses.GenerateErrorResponseBody(ctx, responses.RequestInProgress, errKeyInProgess.Error())
+		responses.WriteError(ctx, w, http.StatusConflict, body)
+		return
+	}
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+	if len(record.Body) > 0 {
+		_, err := w.Write(record.Body)
+		if err != nil {
+			log.Ctx(ctx).Warn().AnErr("error", err).Msg("error writing the replayed response body")
+		}
+	}
+}
+
+// hashRequest identifies a request by method, path, query and body.
+func hashRequest(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.RequestURI()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strconv.Itoa(len(body))))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
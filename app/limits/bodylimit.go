@@ -0,0 +1,122 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/warehouse/app/server/responses"
+)
+
+var errBodyTooLarge = errors.New("request body must not be larger than")
+
+// BodyLimiter caps the size of request bodies. Requests announcing a larger
+// body are rejected before reading it, the others can't read past the limit.
+type BodyLimiter struct {
+	// Default is the limit in bytes of routes without their own, 0 disables
+	// it.
+	Default int64
+	// Routes overrides the default limit by route name.
+	Routes map[string]int64
+}
+
+func NewBodyLimiter(defaultLimit int64, routes map[string]int64) *BodyLimiter {
+	return &BodyLimiter{
+		Default: defaultLimit,
+		Routes:  routes,
+	}
+}
+
+func (l *BodyLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var route string
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+		limit := l.limit(route)
+		if limit <= 0 || r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if r.ContentLength > limit {
+			writeBodyTooLarge(ctx, w, limit)
+			return
+		}
+		// bodies of unknown length only turn out to be too large while the
+		// handler reads them, the handler then fails with a bad request that
+		// is answered as too large instead
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), limit: limit}
+		r.Body = body
+		next.ServeHTTP(&bodyLimitWriter{ResponseWriter: w, ctx: ctx, body: body}, r)
+	})
+}
+
+func (l *BodyLimiter) limit(route string) int64 {
+	if limit, ok := l.Routes[route]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+func writeBodyTooLarge(ctx context.Context, w http.ResponseWriter, limit int64) {
+	message := errBodyTooLarge.Error() + " " + strconv.FormatInt(limit, 10) + " bytes"
+	body := responses.GenerateErrorResponseBody(ctx, responses.RequestBodyTooLarge, message)
+	responses.WriteError(ctx, w, http.StatusRequestEntityTooLarge, body)
+}
+
+// limitedBody notices when reading failed because the body is too large.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// bodyLimitWriter replaces the error response of a handler that failed to
+// read a body that is too large.
+type bodyLimitWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	body     *limitedBody
+	replaced bool
+}
+
+func (w *bodyLimitWriter) WriteHeader(statusCode int) {
+	if w.replaced {
+		return
+	}
+	if w.body.exceeded && statusCode >= http.StatusBadRequest {
+		w.replaced = true
+		writeBodyTooLarge(w.ctx, w.ResponseWriter, w.body.limit)
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *bodyLimitWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps event streams working behind the writer.
+func (w *bodyLimitWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,252 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/server/recorder"
+	"github.com/warehouse/app/server/responses"
+)
+
+const headerForwardedFor = "X-Forwarded-For"
+
+var errTooManyRequests = errors.New("too many requests, retry later")
+
+// Limit lets a client send Rate requests per second to a route, and up to
+// Burst at once after being idle. A zero Rate doesn't limit the route.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter keeps a token bucket per route and client. Authenticated
+// clients are told apart by their tenant and credentials, everybody else by
+// IP address.
+type RateLimiter struct {
+	Default Limit
+	// Routes overrides the default limit by route name.
+	Routes map[string]Limit
+	// Unauthorized limits the requests of an IP address that fail
+	// authentication, across all routes. Once its bucket is empty, the
+	// address is rejected before its credentials are checked.
+	Unauthorized Limit
+	// TrustedHops is how many proxies in front of the service append the
+	// address they got the request from to X-Forwarded-For. The client is
+	// the entry that many from the right, the ones left of it are sent by
+	// the client itself. 0 ignores the header.
+	TrustedHops int
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	now     func() time.Time
+}
+
+type bucketKey struct {
+	// unauthorized buckets count the failed authentications of an IP
+	// address.
+	unauthorized bool
+	route        string
+	tenant       string
+	client       string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(defaultLimit Limit, routes map[string]Limit) *RateLimiter {
+	return &RateLimiter{
+		Default: defaultLimit,
+		Routes:  routes,
+		buckets: make(map[bucketKey]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var route string
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+		key := bucketKey{route: route}
+		key.tenant, key.client = l.client(r)
+		l.serve(w, r, next, key)
+	})
+}
+
+// UnauthorizedHandler runs before the credentials are checked, and rejects
+// the IP addresses that failed authentication too often. Only requests
+// answered with 401 take from their buckets, so that the clients behind a
+// shared address aren't limited by each other's successful requests.
+func (l *RateLimiter) UnauthorizedHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := l.Unauthorized
+		if limit.Rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := bucketKey{unauthorized: true, client: l.ip(r)}
+		if allowed, retryAfter := l.peek(key, limit); !allowed {
+			writeTooManyRequests(w, r, retryAfter)
+			return
+		}
+		rec := recorder.New(w)
+		next.ServeHTTP(rec, r)
+		if rec.StatusCode() == http.StatusUnauthorized {
+			l.take(key, limit)
+		}
+	})
+}
+
+func (l *RateLimiter) serve(w http.ResponseWriter, r *http.Request, next http.Handler, key bucketKey) {
+	limit := l.limit(key)
+	if limit.Rate <= 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+	allowed, retryAfter := l.take(key, limit)
+	if !allowed {
+		writeTooManyRequests(w, r, retryAfter)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	ctx := r.Context()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	body := responses.GenerateErrorResponseBody(ctx, responses.TooManyRequests, errTooManyRequests.Error())
+	responses.WriteError(ctx, w, http.StatusTooManyRequests, body)
+}
+
+// RunCleanup forgets the buckets of clients that were idle long enough for
+// them to fill up again every interval until ctx is cancelled.
+func (l *RateLimiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.cleanup()
+		}
+	}
+}
+
+func (l *RateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key, b := range l.buckets {
+		limit := l.limit(key)
+		if limit.Rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(burst(limit)) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *RateLimiter) limit(key bucketKey) Limit {
+	if key.unauthorized {
+		return l.Unauthorized
+	}
+	if limit, ok := l.Routes[key.route]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// take removes a token from the bucket, or returns how long it takes until
+// the next one is available.
+func (l *RateLimiter) take(key bucketKey, limit Limit) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key, limit)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// peek is take without removing the token.
+func (l *RateLimiter) peek(key bucketKey, limit Limit) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key, limit)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	return true, 0
+}
+
+// refill adds the tokens accrued since the bucket was last used, l.mu must be
+// held.
+func (l *RateLimiter) refill(key bucketKey, limit Limit) *bucket {
+	now := l.now()
+	capacity := float64(burst(limit))
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.last = now
+	return b
+}
+
+// client returns the tenant and the credentials of an authenticated client,
+// subjects are only unique within a tenant. Others are told apart by IP
+// address.
+func (l *RateLimiter) client(r *http.Request) (string, string) {
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		return id.Tenant, id.Subject
+	}
+	return "", l.ip(r)
+}
+
+func (l *RateLimiter) ip(r *http.Request) string {
+	if l.TrustedHops > 0 {
+		var hops []string
+		for _, forwarded := range r.Header.Values(headerForwardedFor) {
+			for _, hop := range strings.Split(forwarded, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		// with fewer entries the request didn't pass all the proxies, and
+		// the header can't be trusted
+		if len(hops) >= l.TrustedHops {
+			return "ip:" + hops[len(hops)-l.TrustedHops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// burst is at least one request, otherwise no request would ever pass.
+func burst(limit Limit) int {
+	if limit.Burst < 1 {
+		return 1
+	}
+	return limit.Burst
+}
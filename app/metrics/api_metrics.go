@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/server/responses"
+)
+
+var errTenantCredentials = errors.New("metrics cover every tenant, credentials bound to a tenant can't read them")
+
+type Handler struct {
+	Registry *Registry
+}
+
+func NewHandler() *Handler {
+	return &Handler{Registry: NewDefaultRegistry(nil)}
+}
+
+// GetMetrics is http api GET /metrics
+//
+// It returns the metrics in the Prometheus text exposition format. They
+// include the inventory of every tenant, so only admins that aren't bound to
+// a tenant can read them.
+func (h *Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	if id, ok := auth.IdentityFromContext(r.Context()); ok && id.Tenant != "" {
+		body := responses.GenerateErrorResponseBody(r.Context(), responses.Forbidden, errTenantCredentials.Error())
+		responses.WriteError(r.Context(), w, http.StatusForbidden, body)
+		return
+	}
+	families := h.Registry.Gather(r.Context())
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	err := WriteText(w, families)
+	if err != nil {
+		log.Ctx(r.Context()).Warn().AnErr("error", err).Msg("error writing the metrics")
+	}
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/cache"
+	"github.com/warehouse/app/store"
+)
+
+// collectTimeout bounds the database queries of a scrape.
+const collectTimeout = 5 * time.Second
+
+var (
+	HTTPRequests = NewCounterVec(
+		"warehouse_http_requests_total",
+		"HTTP requests by route and status code.",
+		"route", "status",
+	)
+	HTTPRequestDuration = NewHistogramVec(
+		"warehouse_http_request_duration_seconds",
+		"Latency of HTTP requests by route and status code.",
+		DefaultBuckets,
+		"route", "status",
+	)
+	QueryDuration = NewHistogramVec(
+		"warehouse_db_query_duration_seconds",
+		"Latency of database statements by name and outcome.",
+		DefaultBuckets,
+		"statement", "outcome",
+	)
+	ProductsSold = NewCounterVec(
+		"warehouse_products_sold_total",
+		"Products sold by tenant.",
+		"tenant",
+	)
+	ArticlesImported = NewCounterVec(
+		"warehouse_articles_imported_total",
+		"Articles created or updated by POST /articles by tenant.",
+		"tenant",
+	)
+)
+
+// NewDefaultRegistry returns a registry with the metrics of this package, and
+// those read from the database on every scrape when metricsStore is set.
+func NewDefaultRegistry(metricsStore store.MetricsStore) *Registry {
+	reg := NewRegistry(HTTPRequests, HTTPRequestDuration, QueryDuration, ProductsSold, ArticlesImported)
+	if metricsStore != nil {
+		metricsStore.ObserveQueries(ObserveQuery)
+		reg.Register(DBStatsCollector(metricsStore), InventoryCollector(metricsStore))
+	}
+	return reg
+}
+
+// ObserveQuery is the store.QueryObserver that fills QueryDuration.
+func ObserveQuery(statement string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	QueryDuration.Observe(duration.Seconds(), statement, outcome)
+}
+
+// DBStatsCollector exposes the connection pool statistics.
+func DBStatsCollector(metricsStore store.MetricsStore) Collector {
+	return CollectorFunc(func(ctx context.Context) []Family {
+		stats := metricsStore.Stats()
+		return []Family{
+			{
+				Name: "warehouse_db_connections_max",
+				Help: "Maximum number of open connections to the database, 0 is unlimited.",
+				Type: TypeGauge,
+				Samples: []Sample{
+					{Value: float64(stats.MaxOpenConnections)},
+				},
+			},
+			{
+				Name: "warehouse_db_connections",
+				Help: "Open connections to the database by state.",
+				Type: TypeGauge,
+				Samples: []Sample{
+					{Labels: []Label{{"state", "in_use"}}, Value: float64(stats.InUse)},
+					{Labels: []Label{{"state", "idle"}}, Value: float64(stats.Idle)},
+				},
+			},
+			{
+				Name: "warehouse_db_wait_total",
+				Help: "Times a query waited for a free connection.",
+				Type: TypeCounter,
+				Samples: []Sample{
+					{Value: float64(stats.WaitCount)},
+				},
+			},
+			{
+				Name: "warehouse_db_wait_seconds_total",
+				Help: "Time spent waiting for a free connection.",
+				Type: TypeCounter,
+				Samples: []Sample{
+					{Value: stats.WaitDuration.Seconds()},
+				},
+			},
+			{
+				Name: "warehouse_db_connections_closed_total",
+				Help: "Connections closed by the pool by reason.",
+				Type: TypeCounter,
+				Samples: []Sample{
+					{Labels: []Label{{"reason", "max_idle"}}, Value: float64(stats.MaxIdleClosed)},
+					{Labels: []Label{{"reason", "max_idle_time"}}, Value: float64(stats.MaxIdleTimeClosed)},
+					{Labels: []Label{{"reason", "max_lifetime"}}, Value: float64(stats.MaxLifetimeClosed)},
+				},
+			},
+		}
+	})
+}
+
+// InventoryCollector exposes the stock of every tenant. Its families are
+// left out of a scrape when the database can't be queried.
+func InventoryCollector(metricsStore store.MetricsStore) Collector {
+	return CollectorFunc(func(ctx context.Context) []Family {
+		ctx, cancel := context.WithTimeout(ctx, collectTimeout)
+		defer cancel()
+		inventories, err := metricsStore.GetInventoryMetrics(ctx)
+		if err != nil {
+			log.Error().AnErr("error", err).Msg("failed to collect inventory metrics")
+			return nil
+		}
+		units := Family{
+			Name: "warehouse_article_units",
+			Help: "Units in stock of all articles by tenant.",
+			Type: TypeGauge,
+		}
+		outOfStock := Family{
+			Name: "warehouse_products_out_of_stock",
+			Help: "Products that can't be built from the articles in stock by tenant.",
+			Type: TypeGauge,
+		}
+		for _, inventory := range inventories {
+			labels := []Label{{"tenant", inventory.Tenant}}
+			units.Samples = append(units.Samples, Sample{Labels: labels, Value: float64(inventory.ArticleUnits)})
+			outOfStock.Samples = append(outOfStock.Samples, Sample{Labels: labels, Value: float64(inventory.ProductsOutOfStock)})
+		}
+		return []Family{units, outOfStock}
+	})
+}
+
+// ProductsCacheCollector exposes the counters of the products cache.
+func ProductsCacheCollector(productsCache *cache.ProductsStore) Collector {
+	return CollectorFunc(func(ctx context.Context) []Family {
+		stats := productsCache.Stats()
+		return []Family{
+			{
+				Name: "warehouse_products_cache_requests_total",
+				Help: "Reads of the products cache by result.",
+				Type: TypeCounter,
+				Samples: []Sample{
+					{Labels: []Label{{"result", "hit"}}, Value: float64(stats.Hits)},
+					{Labels: []Label{{"result", "miss"}}, Value: float64(stats.Misses)},
+				},
+			},
+			{
+				Name: "warehouse_products_cache_evictions_total",
+				Help: "Responses dropped from the products cache to make room.",
+				Type: TypeCounter,
+				Samples: []Sample{
+					{Value: float64(stats.Evictions)},
+				},
+			},
+			{
+				Name: "warehouse_products_cache_invalidations_total",
+				Help: "Responses dropped from the products cache after a change of the products.",
+				Type: TypeCounter,
+				Samples: []Sample{
+					{Value: float64(stats.Invalidations)},
+				},
+			},
+			{
+				Name: "warehouse_products_cache_entries",
+				Help: "Responses in the products cache.",
+				Type: TypeGauge,
+				Samples: []Sample{
+					{Value: float64(stats.Entries)},
+				},
+			},
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/warehouse/app/server/recorder"
+)
+
+// Middleware counts every request and times it until the handler returns, by
+// route name and status code.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var route string
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+		start := time.Now()
+		rec := recorder.New(w)
+		next.ServeHTTP(rec, r)
+		status := strconv.Itoa(rec.StatusCode())
+		HTTPRequests.Inc(route, status)
+		HTTPRequestDuration.Observe(time.Since(start).Seconds(), route, status)
+	})
+}
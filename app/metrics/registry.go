@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+
+	// ContentType of the Prometheus text exposition format.
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one line of a family, Suffix is appended to the family name,
+// e.g. _bucket for histograms.
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with all its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector returns the current samples of its metrics on every scrape.
+type Collector interface {
+	Collect(ctx context.Context) []Family
+}
+
+// CollectorFunc turns a function into a Collector, for metrics that are read
+// from elsewhere when scraped.
+type CollectorFunc func(ctx context.Context) []Family
+
+func (fn CollectorFunc) Collect(ctx context.Context) []Family {
+	return fn(ctx)
+}
+
+// Registry gathers the collectors exposed by GET /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry(collectors ...Collector) *Registry {
+	return &Registry{collectors: collectors}
+}
+
+func (reg *Registry) Register(collectors ...Collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, collectors...)
+}
+
+// Gather collects every family sorted by name.
+func (reg *Registry) Gather(ctx context.Context) []Family {
+	reg.mu.Lock()
+	collectors := make([]Collector, len(reg.collectors))
+	copy(collectors, reg.collectors)
+	reg.mu.Unlock()
+	families := make([]Family, 0, len(collectors))
+	for _, collector := range collectors {
+		families = append(families, collector.Collect(ctx)...)
+	}
+	sort.SliceStable(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	return families
+}
+
+// WriteText writes families in the Prometheus text exposition format.
+func WriteText(w io.Writer, families []Family) error {
+	buf := bufio.NewWriter(w)
+	for _, family := range families {
+		buf.WriteString("# HELP " + family.Name + " " + escapeHelp(family.Help) + "\n")
+		buf.WriteString("# TYPE " + family.Name + " " + family.Type + "\n")
+		for _, sample := range family.Samples {
+			buf.WriteString(family.Name + sample.Suffix)
+			if len(sample.Labels) > 0 {
+				buf.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					buf.WriteString(label.Name + `="` + escapeLabelValue(label.Value) + `"`)
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+	return buf.Flush()
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds of latency histograms.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// labelSeparator never occurs in valid UTF-8, which every label value is.
+const labelSeparator = "\xff"
+
+// vec keeps one series per combination of label values.
+type vec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]interface{}
+}
+
+func newVec(name, help string, labelNames []string) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]interface{}),
+	}
+}
+
+// get returns the series of the label values, created with create when it
+// doesn't exist yet. vec.mu must be held.
+func (v *vec) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(v.labelNames) {
+		panic("metrics: " + v.name + " takes the labels " + strings.Join(v.labelNames, ", "))
+	}
+	key := strings.Join(labelValues, labelSeparator)
+	series, ok := v.series[key]
+	if !ok {
+		series = create()
+		v.series[key] = series
+	}
+	return series
+}
+
+// sortedSeries returns the label values and series ordered by label values.
+// vec.mu must be held.
+func (v *vec) sortedSeries() ([][]Label, []interface{}) {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	labels := make([][]Label, 0, len(keys))
+	series := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		values := strings.Split(key, labelSeparator)
+		seriesLabels := make([]Label, 0, len(values))
+		for i, name := range v.labelNames {
+			seriesLabels = append(seriesLabels, Label{Name: name, Value: values[i]})
+		}
+		labels = append(labels, seriesLabels)
+		series = append(series, v.series[key])
+	}
+	return labels, series
+}
+
+// CounterVec counts events by label values.
+type CounterVec struct {
+	vec
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, labelNames)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter of the label values by delta, which must not be
+// negative.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " can't decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value := c.get(labelValues, func() interface{} { return new(float64) }).(*float64)
+	*value += delta
+}
+
+func (c *CounterVec) Collect(ctx context.Context) []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	labels, series := c.sortedSeries()
+	family := Family{Name: c.name, Help: c.help, Type: TypeCounter}
+	for i, value := range series {
+		family.Samples = append(family.Samples, Sample{Labels: labels[i], Value: *value.(*float64)})
+	}
+	return []Family{family}
+}
+
+// HistogramVec counts observations into buckets by label values.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{vec: newVec(name, help, labelNames), buckets: buckets}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series := h.get(labelValues, func() interface{} {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	}).(*histogram)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *HistogramVec) Collect(ctx context.Context) []Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	labels, series := h.sortedSeries()
+	family := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for i, s := range series {
+		hist := s.(*histogram)
+		for j, bound := range h.buckets {
+			family.Samples = append(family.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: withLabel(labels[i], "le", formatValue(bound)),
+				Value:  float64(hist.counts[j]),
+			})
+		}
+		family.Samples = append(family.Samples,
+			Sample{Suffix: "_bucket", Labels: withLabel(labels[i], "le", formatValue(math.Inf(1))), Value: float64(hist.count)},
+			Sample{Suffix: "_sum", Labels: labels[i], Value: hist.sum},
+			Sample{Suffix: "_count", Labels: labels[i], Value: float64(hist.count)},
+		)
+	}
+	return []Family{family}
+}
+
+func withLabel(labels []Label, name, value string) []Label {
+	extended := make([]Label, 0, len(labels)+1)
+	extended = append(extended, labels...)
+	return append(extended, Label{Name: name, Value: value})
+}
@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/store"
+)
+
+const dispatchBatchSize = 100
+
+// Dispatcher publishes outbox events to a Sink at least once. Events of the
+// same aggregate are published in the order they were written: once one of
+// them fails, the following events of that aggregate wait for the next round.
+type Dispatcher struct {
+	Store    store.OutboxStore
+	Sink     Sink
+	Interval time.Duration
+	// Lease is how long a batch is hidden from other dispatchers while it is
+	// published, a batch left behind by a dispatcher that died is published
+	// again once it runs out.
+	Lease time.Duration
+}
+
+// NewDispatcher returns a dispatcher whose sink takes at most publishTimeout
+// to publish an event.
+func NewDispatcher(outboxStore store.OutboxStore, sink Sink, interval, publishTimeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		Store:    outboxStore,
+		Sink:     sink,
+		Interval: interval,
+		// the batch is published sequentially, keep it until all of it timed out
+		Lease: publishTimeout*dispatchBatchSize + time.Minute,
+	}
+}
+
+// Run publishes pending events every Interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := d.DispatchPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Error().AnErr("error", err).Msg("outbox dispatch failed")
+			}
+		}
+	}
+}
+
+// DispatchPending publishes one batch of pending events.
+func (d *Dispatcher) DispatchPending(ctx context.Context) error {
+	return d.Store.ProcessOutboxEvents(ctx, store.ProcessOutboxEventsRequest{
+		Limit:   dispatchBatchSize,
+		Lease:   d.Lease,
+		Publish: d.publish,
+	})
+}
+
+func (d *Dispatcher) publish(ctx context.Context, events []store.OutboxEvent) []int64 {
+	published := make([]int64, 0, len(events))
+	blocked := make(map[string]struct{})
+	for _, event := range events {
+		aggregate := event.AggregateType + "/" + event.AggregateID
+		if _, ok := blocked[aggregate]; ok {
+			continue
+		}
+		err := d.Sink.Publish(ctx, event)
+		if err != nil {
+			log.Warn().
+				AnErr("error", err).
+				Int64("eventId", event.EventID).
+				Str("aggregate", aggregate).
+				Msg("failed to publish outbox event")
+			blocked[aggregate] = struct{}{}
+			continue
+		}
+		published = append(published, event.EventID)
+	}
+	return published
+}
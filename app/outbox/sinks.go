@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/store"
+	"github.com/warehouse/app/tracing"
+)
+
+// Sink publishes outbox events somewhere. Publish must return nil only once
+// the event is durably handed over, the event is retried otherwise.
+type Sink interface {
+	Publish(ctx context.Context, event store.OutboxEvent) error
+}
+
+// WriterSink writes every event as one JSON line, it is used for stdout and
+// NDJSON files. Sinks of NewFileSink sync the file before an event counts as
+// published, those of NewWriterSink hand it over once written, keeping it is
+// up to whatever reads from w.
+type WriterSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	sync func() error
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func NewFileSink(f *os.File) *WriterSink {
+	return &WriterSink{w: f, sync: f.Sync}
+}
+
+func (s *WriterSink) Publish(_ context.Context, event store.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if s.sync != nil {
+		return s.sync()
+	}
+	return nil
+}
+
+// HTTPSink posts every event as JSON to URL and expects a 2xx answer.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	return &HTTPSink{URL: url, Client: client}
+}
+
+func (s *HTTPSink) Publish(ctx context.Context, event store.OutboxEvent) (err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"POST outbox",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", s.URL), attribute.String("outbox.event", event.EventType)),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	tracing.Inject(ctx, req.Header)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("outbox http sink responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// ChannelSink hands events to an in-process consumer, mostly for tests.
+type ChannelSink struct {
+	Events chan store.OutboxEvent
+}
+
+func NewChannelSink(size int) *ChannelSink {
+	return &ChannelSink{Events: make(chan store.OutboxEvent, size)}
+}
+
+func (s *ChannelSink) Publish(ctx context.Context, event store.OutboxEvent) error {
+	select {
+	case s.Events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// MultiSink publishes to every sink in order and fails if any of them fails.
+// A retried event is sent again to the sinks that already got it.
+type MultiSink []Sink
+
+func (s MultiSink) Publish(ctx context.Context, event store.OutboxEvent) error {
+	for _, sink := range s {
+		err := sink.Publish(ctx, event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
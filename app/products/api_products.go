@@ -3,11 +3,15 @@ package products
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 
+	"github.com/warehouse/app/csvio"
+	"github.com/warehouse/app/metrics"
 	"github.com/warehouse/app/server/responses"
 	"github.com/warehouse/app/store"
 )
@@ -21,19 +25,38 @@ func NewHandler() *Handler {
 }
 
 // CreateOrUpdateProducts is http api POST /products
+//
+// A text/csv body has a header line and a row per article of a product,
+// invalid rows are reported with their line. With ?dryRun=true nothing is
+// stored, the response tells what would be.
 func (h *Handler) CreateOrUpdateProducts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	req := &CreateOrUpdateProductsRequest{}
-	err := json.NewDecoder(r.Body).Decode(req)
+	dryRun, err := responses.DryRun(r)
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("CreateOrUpdateProducts failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	if dryRun {
+		h.dryRunCreateOrUpdateProducts(w, r)
+		return
+	}
+	req, err := decodeCreateOrUpdateProductsRequest(r)
+	var lineErrs csvio.Errors
+	if errors.As(err, &lineErrs) {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts got invalid csv rows")
+		responses.WriteLineErrors(ctx, w, lineErrs)
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts failed to unmarshal request")
 		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
 		responses.WriteError(ctx, w, http.StatusBadRequest, body)
 		return
 	}
-	dbReq, err := getCreateOrUpdateProductsDBRequest(req)
+	dbReq, err := GetCreateOrUpdateProductsDBRequest(req)
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("CreateOrUpdateProducts get database request from http request")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts get database request from http request")
 		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
 		responses.WriteError(ctx, w, http.StatusBadRequest, body)
 		return
@@ -41,12 +64,12 @@ func (h *Handler) CreateOrUpdateProducts(w http.ResponseWriter, r *http.Request)
 	err = h.ProductsStore.CreateOrUpdateProducts(ctx, dbReq)
 	if err != nil {
 		if errors.Is(err, store.ErrArticleNotFound) {
-			log.Error().AnErr("error", err).Msg("CreateOrUpdateProducts failed to execute database query, article not found")
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts failed to execute database query, article not found")
 			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
 			responses.WriteError(ctx, w, http.StatusNotFound, body)
 			return
 		}
-		log.Error().AnErr("error", err).Msg("CreateOrUpdateProducts failed to execute database query")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts failed to execute database query")
 		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
 		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
 		return
@@ -54,13 +77,93 @@ func (h *Handler) CreateOrUpdateProducts(w http.ResponseWriter, r *http.Request)
 	responses.WriteCreatedResponse(ctx, w, nil)
 }
 
+// dryRunCreateOrUpdateProducts validates every product, and runs the valid
+// ones in a transaction that is rolled back to tell what they would change.
+// A product using an article that isn't stored is invalid.
+func (h *Handler) dryRunCreateOrUpdateProducts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var products []Product
+	var lines []productLines
+	var err error
+	if responses.RequestContentType(r) == responses.ContentTypeCSV {
+		products, lines, err = readProductsCSV(r.Body)
+	} else {
+		req := &CreateOrUpdateProductsRequest{}
+		err = json.NewDecoder(r.Body).Decode(req)
+		products = req.Products
+		lines = make([]productLines, len(products))
+	}
+	var lineErrs csvio.Errors
+	if errors.As(err, &lineErrs) {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts dry run got an invalid csv file")
+		responses.WriteLineErrors(ctx, w, lineErrs)
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts dry run failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+
+	response := &DryRunResponse{
+		Valid:    true,
+		Products: make([]DryRunProduct, 0, len(products)),
+	}
+	dbReq := store.CreateOrUpdateProductsRequest{Products: make([]store.Product, 0, len(products))}
+	// dbIndexes are the indexes of the products of dbReq in the response
+	dbIndexes := make([]int, 0, len(products))
+	for i, product := range products {
+		item := DryRunProduct{Line: lines[i].product, Product: product}
+		item.Errors = validateProduct(product, lines[i])
+		if len(item.Errors) > 0 {
+			response.Valid = false
+		} else {
+			// validated, the amounts are integers
+			storeProduct, _ := getStoreProduct(product)
+			dbReq.Products = append(dbReq.Products, storeProduct)
+			dbIndexes = append(dbIndexes, i)
+		}
+		response.Products = append(response.Products, item)
+	}
+
+	diff, err := h.ProductsStore.DryRunCreateOrUpdateProducts(ctx, dbReq)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateProducts dry run failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	for j, dbItem := range diff.Items {
+		i := dbIndexes[j]
+		item := &response.Products[i]
+		if len(dbItem.MissingArticles) > 0 {
+			indexes := articleIndexes(item.Product)
+			for _, articleID := range dbItem.MissingArticles {
+				index := indexes[articleID]
+				item.Errors = append(item.Errors, responses.FieldError{
+					Line:    lines[i].article(index),
+					Field:   fmt.Sprintf("contain_articles[%d].art_id", index),
+					Message: fmt.Sprintf("article %s doesn't exist", articleID),
+				})
+			}
+			response.Valid = false
+			continue
+		}
+		item.Action = dbItem.Action
+		item.Stock = dbItem.Stock
+		response.Creates++
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
+
 // SellProduct is http api POST /products/sell
 func (h *Handler) SellProduct(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	req := &SellProductRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("SellProduct failed to unmarshal request")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("SellProduct failed to unmarshal request")
 		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
 		responses.WriteError(ctx, w, http.StatusBadRequest, body)
 		return
@@ -72,40 +175,194 @@ func (h *Handler) SellProduct(w http.ResponseWriter, r *http.Request) {
 		})
 	if err != nil {
 		if errors.Is(err, store.ErrProductNotFound) {
-			log.Error().AnErr("error", err).Msg("SellProduct failed to execute database query, product not found")
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("SellProduct failed to execute database query, product not found")
 			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
 			responses.WriteError(ctx, w, http.StatusNotFound, body)
 			return
 		}
 		if errors.Is(err, store.ErrProductStockFinished) {
-			log.Error().AnErr("error", err).Msg("SellProduct failed to execute database query, product stock finished")
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("SellProduct failed to execute database query, product stock finished")
 			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceFinished, err.Error())
 			responses.WriteError(ctx, w, http.StatusBadRequest, body)
 			return
 		}
-		log.Error().AnErr("error", err).Msg("SellProduct failed to execute database query")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("SellProduct failed to execute database query")
 		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
 		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
 		return
 	}
+	metrics.ProductsSold.Inc(store.TenantFromContext(ctx))
 	responses.WriteNoContentResponse(ctx, w)
 }
 
 // GetAllProductsWithStock is http api GET /products
+//
+// Accept: text/csv gets a row per article of a product instead and
+// application/x-ndjson a product per line, both streamed from the database.
 func (h *Handler) GetAllProductsWithStock(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	contentType := responses.Negotiate(r, responses.ContentTypeJSON, responses.ContentTypeCSV, responses.ContentTypeNDJSON)
+	if contentType != responses.ContentTypeJSON {
+		h.streamAllProducts(w, r, contentType)
+		return
+	}
 	res, err := h.ProductsStore.GetAllProducts(ctx)
 	if err != nil {
-		log.Error().AnErr("error", err).Msg("GetAllProductsWithStock failed to execute database query")
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllProductsWithStock failed to execute database query")
 		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
 		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
 		return
 	}
-	response := getProductsResponseFromDBResult(res)
+	response := GetProductsResponseFromDBResult(res)
 	responses.WriteOkResponse(ctx, w, response)
 }
 
-func getProductsResponseFromDBResult(dbResult store.GetAllProductsResponse) *GetAllProductsWithStockResponse {
+// streamAllProducts writes the products while they are read, in constant
+// memory. A client going away cancels the query with the request context.
+func (h *Handler) streamAllProducts(w http.ResponseWriter, r *http.Request, contentType string) {
+	ctx := r.Context()
+	stream := responses.NewStream(w, contentType)
+	var write func(product *ProductWithStock) error
+	var flush func() error
+	if contentType == responses.ContentTypeCSV {
+		writer := csvio.NewWriter(stream)
+		// buffered, it is sent with the first rows
+		_ = writer.Write(csvColumns)
+		write = func(product *ProductWithStock) error {
+			for _, row := range productCSVRows(product) {
+				err := writer.Write(row)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		flush = writer.Flush
+	} else {
+		writer := responses.NewNDJSONWriter(stream)
+		write = func(product *ProductWithStock) error {
+			return writer.Write(product)
+		}
+		flush = writer.Flush
+	}
+	err := h.ProductsStore.StreamProducts(ctx, func(product store.Product) error {
+		return write(getProductResponseFromDBResult(product))
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		return
+	}
+	if stream.Started() {
+		log.Ctx(ctx).Warn().AnErr("error", err).Msg("GetAllProductsWithStock stream was cut short")
+		return
+	}
+	log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllProductsWithStock failed to execute database query")
+	body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+	responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+}
+
+// GetProduct is http api GET /products/{productId}
+func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.ProductsStore.GetProduct(ctx, mux.Vars(r)["productId"])
+	if err != nil {
+		writeStoreError(w, r, "GetProduct", err)
+		return
+	}
+	responses.SetETag(w, res.Version)
+	responses.WriteOkResponse(ctx, w, getProductResponseFromDBResult(res))
+}
+
+// UpdateProduct is http api PUT /products/{productId}
+//
+// It replaces the name and articles of the product. An If-Match header with
+// the ETag of GET /products/{productId} makes the update fail with 412 when
+// the product was changed in the meantime.
+func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expectedVersion, err := responses.IfMatchVersion(r)
+	if err != nil {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidHeaderError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	req := &Product{}
+	err = json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateProduct failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	product, err := getStoreProduct(*req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateProduct get database request from http request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	product.ProductID = mux.Vars(r)["productId"]
+	res, err := h.ProductsStore.UpdateProduct(ctx, store.UpdateProductRequest{
+		Product:         product,
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		writeStoreError(w, r, "UpdateProduct", err)
+		return
+	}
+	responses.SetETag(w, res.Version)
+	responses.WriteOkResponse(ctx, w, getProductResponseFromDBResult(res))
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	ctx := r.Context()
+	switch {
+	case errors.Is(err, store.ErrProductNotFound):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, product not found", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+		responses.WriteError(ctx, w, http.StatusNotFound, body)
+	case errors.Is(err, store.ErrVersionConflict):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, version conflict", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.VersionConflict, err.Error())
+		responses.WriteError(ctx, w, http.StatusPreconditionFailed, body)
+	default:
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+	}
+}
+
+func getProductResponseFromDBResult(product store.Product) *ProductWithStock {
+	productArticles := make([]Article, 0, len(product.Articles))
+	for _, productArticle := range product.Articles {
+		productArticles = append(productArticles, Article{
+			Amount:    strconv.Itoa(productArticle.ArticleAmount),
+			ArticleID: productArticle.ArticleID,
+		})
+	}
+	return &ProductWithStock{
+		Stock:     product.Stock,
+		ProductID: product.ProductID,
+		Version:   product.Version,
+		Product: Product{
+			Name:     product.ProductName,
+			Articles: productArticles,
+		},
+	}
+}
+
+func decodeCreateOrUpdateProductsRequest(r *http.Request) (*CreateOrUpdateProductsRequest, error) {
+	if responses.RequestContentType(r) == responses.ContentTypeCSV {
+		return ReadProductsCSV(r.Body)
+	}
+	req := &CreateOrUpdateProductsRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	return req, err
+}
+
+func GetProductsResponseFromDBResult(dbResult store.GetAllProductsResponse) *GetAllProductsWithStockResponse {
 	response := &GetAllProductsWithStockResponse{}
 	for _, product := range dbResult.Products {
 		productArticles := make([]Article, 0)
@@ -118,6 +375,7 @@ func getProductsResponseFromDBResult(dbResult store.GetAllProductsResponse) *Get
 		response.Products = append(response.Products, ProductWithStock{
 			Stock:     product.Stock,
 			ProductID: product.ProductID,
+			Version:   product.Version,
 			Product: Product{
 				Name:     product.ProductName,
 				Articles: productArticles,
@@ -127,28 +385,35 @@ func getProductsResponseFromDBResult(dbResult store.GetAllProductsResponse) *Get
 	return response
 }
 
-func getCreateOrUpdateProductsDBRequest(req *CreateOrUpdateProductsRequest) (store.CreateOrUpdateProductsRequest, error) {
+func GetCreateOrUpdateProductsDBRequest(req *CreateOrUpdateProductsRequest) (store.CreateOrUpdateProductsRequest, error) {
 	res := store.CreateOrUpdateProductsRequest{
 		Products: []store.Product{},
 	}
 	for _, product := range req.Products {
-		productArticles := make([]store.ProductArticle, 0)
-		for _, productArticle := range product.Articles {
-			articleAmount, err := strconv.Atoi(productArticle.Amount)
-			if err != nil {
-				log.Error().AnErr("error", err).Msg("failed to parse product article amount to integer")
-				return store.CreateOrUpdateProductsRequest{}, err
-			}
-			productArticles = append(productArticles, store.ProductArticle{
-				ArticleID:     productArticle.ArticleID,
-				ArticleAmount: articleAmount,
-			})
-		}
-		storeProduct := store.Product{
-			ProductName: product.Name,
-			Articles:    productArticles,
+		storeProduct, err := getStoreProduct(product)
+		if err != nil {
+			return store.CreateOrUpdateProductsRequest{}, err
 		}
 		res.Products = append(res.Products, storeProduct)
 	}
 	return res, nil
 }
+
+func getStoreProduct(product Product) (store.Product, error) {
+	productArticles := make([]store.ProductArticle, 0)
+	for _, productArticle := range product.Articles {
+		articleAmount, err := strconv.Atoi(productArticle.Amount)
+		if err != nil {
+			log.Error().AnErr("error", err).Msg("failed to parse product article amount to integer")
+			return store.Product{}, err
+		}
+		productArticles = append(productArticles, store.ProductArticle{
+			ArticleID:     productArticle.ArticleID,
+			ArticleAmount: articleAmount,
+		})
+	}
+	return store.Product{
+		ProductName: product.Name,
+		Articles:    productArticles,
+	}, nil
+}
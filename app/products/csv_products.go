@@ -0,0 +1,97 @@
+package products
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/warehouse/app/csvio"
+)
+
+// csvColumns are the columns of GET /products as text/csv, a row per article
+// of a product. POST /products takes name, art_id and amount_of.
+var csvColumns = []string{"product_id", "name", "stock", "version", "art_id", "amount_of"}
+
+// ReadProductsCSV reads a text/csv body of POST /products, a row per article
+// of a product. The rows of a product share its name, a row without art_id
+// and amount_of only names it. Every invalid row is returned in
+// csvio.Errors.
+func ReadProductsCSV(r io.Reader) (*CreateOrUpdateProductsRequest, error) {
+	products, lines, err := readProductsCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	var lineErrs csvio.Errors
+	for i, product := range products {
+		for _, fieldErr := range validateProduct(product, lines[i]) {
+			lineErrs = append(lineErrs, csvio.LineError{Line: fieldErr.Line, Message: fieldErr.Message})
+		}
+	}
+	if len(lineErrs) > 0 {
+		sort.SliceStable(lineErrs, func(i, j int) bool {
+			return lineErrs[i].Line < lineErrs[j].Line
+		})
+		return nil, lineErrs
+	}
+	return &CreateOrUpdateProductsRequest{Products: products}, nil
+}
+
+// readProductsCSV returns the products of a text/csv body with the lines of
+// their rows, without validating them.
+func readProductsCSV(r io.Reader) ([]Product, []productLines, error) {
+	reader, err := csvio.NewReader(r, "name", "art_id", "amount_of")
+	if err != nil {
+		return nil, nil, err
+	}
+	products := make([]Product, 0)
+	lines := make([]productLines, 0)
+	byName := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return products, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if record.Empty() {
+			continue
+		}
+		name := record.Get("name")
+		i, ok := byName[name]
+		// rows without a name are each reported on their own
+		if !ok || name == "" {
+			i = len(products)
+			byName[name] = i
+			products = append(products, Product{Name: name, Articles: make([]Article, 0)})
+			lines = append(lines, productLines{product: record.Line})
+		}
+		article := Article{ArticleID: record.Get("art_id"), Amount: record.Get("amount_of")}
+		if article.ArticleID != "" || article.Amount != "" {
+			products[i].Articles = append(products[i].Articles, article)
+			lines[i].articles = append(lines[i].articles, record.Line)
+		}
+	}
+}
+
+// productCSVRows returns a row per article of product, a product without
+// articles still gets one.
+func productCSVRows(product *ProductWithStock) [][]string {
+	articles := product.Articles
+	if len(articles) == 0 {
+		articles = []Article{{}}
+	}
+	rows := make([][]string, 0, len(articles))
+	for _, article := range articles {
+		rows = append(rows, []string{
+			product.ProductID,
+			product.Name,
+			strconv.Itoa(product.Stock),
+			strconv.Itoa(product.Version),
+			article.ArticleID,
+			article.Amount,
+		})
+	}
+	return rows
+}
@@ -1,5 +1,7 @@
 package products
 
+import "github.com/warehouse/app/server/responses"
+
 type CreateOrUpdateProductsRequest struct {
 	Products []Product `json:"products"`
 }
@@ -16,6 +18,7 @@ type Article struct {
 
 type SellProductRequest struct {
 	ProductID string `json:"productId"`
+	Version   int    `json:"version"`
 }
 
 type GetAllProductsWithStockResponse struct {
@@ -26,4 +29,24 @@ type ProductWithStock struct {
 	Product
 	Stock     int    `json:"stock"`
 	ProductID string `json:"productId"`
+	Version   int    `json:"version"`
+}
+
+// DryRunResponse is what POST /products?dryRun=true would do. It is Valid
+// when no product has errors, Creates counts the valid ones.
+type DryRunResponse struct {
+	Valid    bool            `json:"valid"`
+	Creates  int             `json:"creates"`
+	Products []DryRunProduct `json:"products"`
+}
+
+type DryRunProduct struct {
+	// Line is the line of the first row of the product in a text/csv body.
+	Line int `json:"line,omitempty"`
+	Product
+	// Action is create, missing when the product has errors.
+	Action string `json:"action,omitempty"`
+	// Stock is the stock the product would have once created.
+	Stock  int                    `json:"stock"`
+	Errors []responses.FieldError `json:"errors,omitempty"`
 }
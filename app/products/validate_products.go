@@ -0,0 +1,85 @@
+package products
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/warehouse/app/server/responses"
+)
+
+const (
+	// maxNameLength and maxArticleIDLength are the sizes of the product_name
+	// and article_id columns.
+	maxNameLength      = 30
+	maxArticleIDLength = 10
+)
+
+// productLines are the lines of the rows of a product of a text/csv body,
+// zero for a JSON one.
+type productLines struct {
+	product  int
+	articles []int
+}
+
+func (l productLines) article(i int) int {
+	if i < len(l.articles) {
+		return l.articles[i]
+	}
+	return l.product
+}
+
+// validateProduct returns what keeps a product of an import from being
+// stored.
+func validateProduct(product Product, lines productLines) []responses.FieldError {
+	var fieldErrs []responses.FieldError
+	switch {
+	case product.Name == "":
+		fieldErrs = append(fieldErrs, responses.FieldError{Line: lines.product, Field: "name", Message: "name is empty"})
+	case utf8.RuneCountInString(product.Name) > maxNameLength:
+		fieldErrs = append(fieldErrs, responses.FieldError{
+			Line:    lines.product,
+			Field:   "name",
+			Message: fmt.Sprintf("name is longer than %d characters", maxNameLength),
+		})
+	}
+	seen := make(map[string]int)
+	for i, article := range product.Articles {
+		add := func(field, message string) {
+			fieldErrs = append(fieldErrs, responses.FieldError{
+				Line:    lines.article(i),
+				Field:   fmt.Sprintf("contain_articles[%d].%s", i, field),
+				Message: message,
+			})
+		}
+		switch {
+		case article.ArticleID == "":
+			add("art_id", "art_id is empty")
+		case utf8.RuneCountInString(article.ArticleID) > maxArticleIDLength:
+			add("art_id", fmt.Sprintf("art_id is longer than %d characters", maxArticleIDLength))
+		}
+		if first, ok := seen[article.ArticleID]; ok && article.ArticleID != "" {
+			add("art_id", fmt.Sprintf("art_id %s is repeated, first at contain_articles[%d]", article.ArticleID, first))
+		} else {
+			seen[article.ArticleID] = i
+		}
+		switch amount, err := strconv.Atoi(article.Amount); {
+		case err != nil:
+			add("amount_of", "amount_of is not an integer: "+strconv.Quote(article.Amount))
+		case amount < 1:
+			add("amount_of", "amount_of must be at least 1")
+		}
+	}
+	return fieldErrs
+}
+
+// articleIndexes maps the articles of a product to their index.
+func articleIndexes(product Product) map[string]int {
+	indexes := make(map[string]int, len(product.Articles))
+	for i, article := range product.Articles {
+		if _, ok := indexes[article.ArticleID]; !ok {
+			indexes[article.ArticleID] = i
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,208 @@
+package purchaseorders
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+var (
+	errMissingLines    = errors.New("at least one line is required")
+	errInvalidLine     = errors.New("every line needs an articleId and a positive quantity")
+	errDuplicateLine   = errors.New("article appears more than once in lines")
+	errInvalidCost     = errors.New("unitCostCents must not be negative")
+	errMissingSupplier = errors.New("supplierId is required")
+)
+
+type Handler struct {
+	PurchaseOrdersStore store.PurchaseOrdersStore
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// CreatePurchaseOrder is http api POST /purchase-orders
+func (h *Handler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &CreatePurchaseOrderRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreatePurchaseOrder failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	dbReq, err := getCreatePurchaseOrderDBRequest(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreatePurchaseOrder get database request from http request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	res, err := h.PurchaseOrdersStore.CreatePurchaseOrder(ctx, dbReq)
+	if err != nil {
+		if errors.Is(err, store.ErrSupplierNotFound) || errors.Is(err, store.ErrArticleNotFound) {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("CreatePurchaseOrder failed to execute database query, resource not found")
+			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+			responses.WriteError(ctx, w, http.StatusNotFound, body)
+			return
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreatePurchaseOrder failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteCreatedResponse(ctx, w, getPurchaseOrderResponseFromDBResult(res))
+}
+
+// GetPurchaseOrder is http api GET /purchase-orders/{purchaseOrderId}
+func (h *Handler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.PurchaseOrdersStore.GetPurchaseOrder(ctx, mux.Vars(r)["purchaseOrderId"])
+	if err != nil {
+		writeStoreError(w, r, "GetPurchaseOrder", err)
+		return
+	}
+	responses.WriteOkResponse(ctx, w, getPurchaseOrderResponseFromDBResult(res))
+}
+
+// UpdatePurchaseOrderState is http api PATCH /purchase-orders/{purchaseOrderId}
+func (h *Handler) UpdatePurchaseOrderState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &UpdatePurchaseOrderStateRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdatePurchaseOrderState failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	res, err := h.PurchaseOrdersStore.UpdatePurchaseOrderState(ctx, store.UpdatePurchaseOrderStateRequest{
+		PurchaseOrderID: mux.Vars(r)["purchaseOrderId"],
+		State:           store.PurchaseOrderState(req.State),
+	})
+	if err != nil {
+		writeStoreError(w, r, "UpdatePurchaseOrderState", err)
+		return
+	}
+	responses.WriteOkResponse(ctx, w, getPurchaseOrderResponseFromDBResult(res))
+}
+
+// CreateReceipt is http api POST /purchase-orders/{purchaseOrderId}/receipts
+func (h *Handler) CreateReceipt(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &CreateReceiptRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateReceipt failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	dbReq, err := getReceivePurchaseOrderDBRequest(mux.Vars(r)["purchaseOrderId"], req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateReceipt get database request from http request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	res, err := h.PurchaseOrdersStore.ReceivePurchaseOrder(ctx, dbReq)
+	if err != nil {
+		writeStoreError(w, r, "CreateReceipt", err)
+		return
+	}
+	responses.WriteCreatedResponse(ctx, w, getPurchaseOrderResponseFromDBResult(res))
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	ctx := r.Context()
+	switch {
+	case errors.Is(err, store.ErrPurchaseOrderNotFound):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, purchase order not found", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+		responses.WriteError(ctx, w, http.StatusNotFound, body)
+	case errors.Is(err, store.ErrInvalidPurchaseOrderTransition):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, invalid state transition", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidStateTransition, err.Error())
+		responses.WriteError(ctx, w, http.StatusConflict, body)
+	case errors.Is(err, store.ErrPurchaseOrderLineNotFound), errors.Is(err, store.ErrReceiptExceedsOrderedQuantity):
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, invalid receipt", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+	default:
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+	}
+}
+
+func getPurchaseOrderResponseFromDBResult(dbResult store.PurchaseOrder) *PurchaseOrder {
+	response := &PurchaseOrder{
+		PurchaseOrderID: dbResult.PurchaseOrderID,
+		SupplierID:      dbResult.SupplierID,
+		State:           string(dbResult.State),
+		Lines:           make([]PurchaseOrderLine, 0, len(dbResult.Lines)),
+	}
+	for _, line := range dbResult.Lines {
+		response.Lines = append(response.Lines, PurchaseOrderLine{
+			ArticleID:        line.ArticleID,
+			Quantity:         line.QuantityOrdered,
+			QuantityReceived: line.QuantityReceived,
+			UnitCostCents:    line.UnitCostCents,
+		})
+	}
+	return response
+}
+
+func getCreatePurchaseOrderDBRequest(req *CreatePurchaseOrderRequest) (store.CreatePurchaseOrderRequest, error) {
+	if req.SupplierID == "" {
+		return store.CreatePurchaseOrderRequest{}, errMissingSupplier
+	}
+	if len(req.Lines) == 0 {
+		return store.CreatePurchaseOrderRequest{}, errMissingLines
+	}
+	res := store.CreatePurchaseOrderRequest{SupplierID: req.SupplierID}
+	seen := make(map[string]struct{}, len(req.Lines))
+	for _, line := range req.Lines {
+		if line.ArticleID == "" || line.Quantity <= 0 {
+			return store.CreatePurchaseOrderRequest{}, errInvalidLine
+		}
+		if line.UnitCostCents < 0 {
+			return store.CreatePurchaseOrderRequest{}, errInvalidCost
+		}
+		if _, ok := seen[line.ArticleID]; ok {
+			return store.CreatePurchaseOrderRequest{}, errDuplicateLine
+		}
+		seen[line.ArticleID] = struct{}{}
+		res.Lines = append(res.Lines, store.PurchaseOrderLine{
+			ArticleID:       line.ArticleID,
+			QuantityOrdered: line.Quantity,
+			UnitCostCents:   line.UnitCostCents,
+		})
+	}
+	return res, nil
+}
+
+func getReceivePurchaseOrderDBRequest(purchaseOrderID string, req *CreateReceiptRequest) (store.ReceivePurchaseOrderRequest, error) {
+	if len(req.Lines) == 0 {
+		return store.ReceivePurchaseOrderRequest{}, errMissingLines
+	}
+	res := store.ReceivePurchaseOrderRequest{PurchaseOrderID: purchaseOrderID}
+	for _, line := range req.Lines {
+		if line.ArticleID == "" || line.Quantity <= 0 {
+			return store.ReceivePurchaseOrderRequest{}, errInvalidLine
+		}
+		res.Lines = append(res.Lines, store.ReceiptLine{
+			ArticleID: line.ArticleID,
+			Quantity:  line.Quantity,
+		})
+	}
+	return res, nil
+}
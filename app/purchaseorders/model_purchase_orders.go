@@ -0,0 +1,33 @@
+package purchaseorders
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID string              `json:"supplierId"`
+	Lines      []PurchaseOrderLine `json:"lines"`
+}
+
+type UpdatePurchaseOrderStateRequest struct {
+	State string `json:"state"`
+}
+
+type CreateReceiptRequest struct {
+	Lines []ReceiptLine `json:"lines"`
+}
+
+type ReceiptLine struct {
+	ArticleID string `json:"articleId"`
+	Quantity  int    `json:"quantity"`
+}
+
+type PurchaseOrderLine struct {
+	ArticleID        string `json:"articleId"`
+	Quantity         int    `json:"quantity"`
+	QuantityReceived int    `json:"quantityReceived"`
+	UnitCostCents    int64  `json:"unitCostCents"`
+}
+
+type PurchaseOrder struct {
+	PurchaseOrderID string              `json:"purchaseOrderId"`
+	SupplierID      string              `json:"supplierId"`
+	State           string              `json:"state"`
+	Lines           []PurchaseOrderLine `json:"lines"`
+}
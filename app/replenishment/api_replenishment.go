@@ -0,0 +1,211 @@
+package replenishment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+// maxReferenceLength is the size of the reference column of reservations.
+const maxReferenceLength = 64
+
+var (
+	errNegativeSettings   = errors.New("reorderPoint, safetyStock and reorderQuantity must not be negative")
+	errInvalidReservation = errors.New("quantity must be positive and reference at most 64 characters")
+)
+
+type Handler struct {
+	ReplenishmentStore  store.ReplenishmentStore
+	PurchaseOrdersStore store.PurchaseOrdersStore
+	// DemandWindowDays is how far back product sales are looked at to
+	// estimate the daily demand of an article.
+	DemandWindowDays int
+}
+
+func NewHandler(demandWindowDays int) *Handler {
+	return &Handler{DemandWindowDays: demandWindowDays}
+}
+
+// UpdateArticleReplenishment is http api PUT /articles/{articleId}/replenishment
+func (h *Handler) UpdateArticleReplenishment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &ArticleReplenishmentRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateArticleReplenishment failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	if req.ReorderPoint < 0 || req.SafetyStock < 0 || req.ReorderQuantity < 0 {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errNegativeSettings.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	err = h.ReplenishmentStore.UpdateArticleReplenishment(ctx, store.ArticleReplenishment{
+		ArticleID:       mux.Vars(r)["articleId"],
+		ReorderPoint:    req.ReorderPoint,
+		SafetyStock:     req.SafetyStock,
+		ReorderQuantity: req.ReorderQuantity,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrArticleNotFound) {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateArticleReplenishment failed to execute database query, article not found")
+			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+			responses.WriteError(ctx, w, http.StatusNotFound, body)
+			return
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("UpdateArticleReplenishment failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteNoContentResponse(ctx, w)
+}
+
+// GetSuggestions is http api GET /replenishment/suggestions
+func (h *Handler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	suggestions, err := h.suggestions(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetSuggestions failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteOkResponse(ctx, w, &GetSuggestionsResponse{Suggestions: suggestions})
+}
+
+// CreateReservation is http api POST /products/{productId}/reservations
+//
+// A reservation holds units of a product for an order that isn't sold yet,
+// the suggestions count them as gone until it is deleted.
+func (h *Handler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &CreateReservationRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateReservation failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	if req.Quantity < 1 || len(req.Reference) > maxReferenceLength {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errInvalidReservation.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	reservation, err := h.ReplenishmentStore.CreateReservation(ctx, store.Reservation{
+		ProductID: mux.Vars(r)["productId"],
+		Quantity:  req.Quantity,
+		Reference: req.Reference,
+	})
+	if err != nil {
+		writeStoreError(w, r, "CreateReservation", err)
+		return
+	}
+	responses.WriteCreatedResponse(ctx, w, Reservation{
+		ReservationID: reservation.ReservationID,
+		ProductID:     reservation.ProductID,
+		Quantity:      reservation.Quantity,
+		Reference:     reservation.Reference,
+	})
+}
+
+// DeleteReservation is http api DELETE /reservations/{reservationId}
+func (h *Handler) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.ReplenishmentStore.DeleteReservation(ctx, mux.Vars(r)["reservationId"])
+	if err != nil {
+		writeStoreError(w, r, "DeleteReservation", err)
+		return
+	}
+	responses.WriteNoContentResponse(ctx, w)
+}
+
+func writeStoreError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	ctx := r.Context()
+	if errors.Is(err, store.ErrProductNotFound) || errors.Is(err, store.ErrReservationNotFound) {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query, resource not found", name)
+		body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+		responses.WriteError(ctx, w, http.StatusNotFound, body)
+		return
+	}
+	log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s failed to execute database query", name)
+	body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+	responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+}
+
+func (h *Handler) suggestions(ctx context.Context) ([]Suggestion, error) {
+	res, err := h.ReplenishmentStore.GetReplenishmentCandidates(ctx, store.GetReplenishmentCandidatesRequest{
+		DemandWindowDays: h.DemandWindowDays,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suggest(res.Candidates, h.DemandWindowDays), nil
+}
+
+// suggest returns the candidates whose projected stock at the end of the
+// supplier lead time is below their reorder point. The projection starts from
+// the current stock, adds what is still to be received on open purchase
+// orders, and removes what reservations hold and what every product using the
+// article is expected to sell during the lead time, at its current amount of
+// the article. The suggested quantity brings the article back to reorder point
+// plus safety stock, and is never less than the configured reorder quantity.
+func suggest(candidates []store.ReplenishmentCandidate, demandWindowDays int) []Suggestion {
+	suggestions := make([]Suggestion, 0)
+	for _, candidate := range candidates {
+		reserved := 0
+		expectedDemand := 0
+		consumers := make([]Consumer, 0, len(candidate.Consumers))
+		for _, consumer := range candidate.Consumers {
+			expectedSales := 0
+			if demandWindowDays > 0 {
+				// round up, a partial unit still has to be on the shelf
+				expectedSales = (consumer.Sold*candidate.LeadTimeDays + demandWindowDays - 1) / demandWindowDays
+			}
+			reserved += consumer.Reserved * consumer.ArticleAmount
+			expectedDemand += expectedSales * consumer.ArticleAmount
+			consumers = append(consumers, Consumer{
+				ProductID:     consumer.ProductID,
+				Name:          consumer.ProductName,
+				ArticleAmount: consumer.ArticleAmount,
+				Sold:          consumer.Sold,
+				Reserved:      consumer.Reserved,
+				ExpectedSales: expectedSales,
+			})
+		}
+		projected := candidate.Stock + candidate.OnOrder - reserved - expectedDemand
+		if projected >= candidate.ReorderPoint {
+			continue
+		}
+		quantity := candidate.ReorderPoint + candidate.SafetyStock - projected
+		if quantity < candidate.ReorderQuantity {
+			quantity = candidate.ReorderQuantity
+		}
+		suggestions = append(suggestions, Suggestion{
+			ArticleID:         candidate.ArticleID,
+			Name:              candidate.ArticleName,
+			Stock:             candidate.Stock,
+			OnOrder:           candidate.OnOrder,
+			Reserved:          reserved,
+			ExpectedDemand:    expectedDemand,
+			ReorderPoint:      candidate.ReorderPoint,
+			SafetyStock:       candidate.SafetyStock,
+			SuggestedQuantity: quantity,
+			SupplierID:        candidate.SupplierID,
+			LeadTimeDays:      candidate.LeadTimeDays,
+			UnitCostCents:     candidate.UnitCostCents,
+			Consumers:         consumers,
+		})
+	}
+	return suggestions
+}
@@ -0,0 +1,78 @@
+package replenishment
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/store"
+)
+
+// RunAutoDraft drafts purchase orders for the current suggestions every
+// interval until ctx is cancelled. Drafts count as open orders, so an article
+// is not drafted again while its previous draft is still around. Every tenant
+// is drafted for separately.
+func (h *Handler) RunAutoDraft(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tenants, err := h.ReplenishmentStore.GetTenants(ctx)
+			if err != nil {
+				log.Error().AnErr("error", err).Msg("auto draft of purchase orders failed to list tenants")
+				continue
+			}
+			for _, tenant := range tenants {
+				err = h.DraftPurchaseOrders(store.WithTenant(ctx, tenant))
+				if err != nil {
+					log.Error().AnErr("error", err).Str("tenant", tenant).Msg("auto draft of purchase orders failed")
+				}
+			}
+		}
+	}
+}
+
+// DraftPurchaseOrders creates one draft purchase order per preferred supplier
+// covering all suggestions of that supplier. Articles without a supplier are
+// skipped.
+func (h *Handler) DraftPurchaseOrders(ctx context.Context) error {
+	suggestions, err := h.suggestions(ctx)
+	if err != nil {
+		return err
+	}
+	bySupplier := make(map[string][]store.PurchaseOrderLine)
+	suppliers := make([]string, 0)
+	for _, suggestion := range suggestions {
+		if suggestion.SupplierID == "" {
+			log.Warn().Str("articleId", suggestion.ArticleID).Msg("article needs replenishment but has no supplier")
+			continue
+		}
+		if _, ok := bySupplier[suggestion.SupplierID]; !ok {
+			suppliers = append(suppliers, suggestion.SupplierID)
+		}
+		bySupplier[suggestion.SupplierID] = append(bySupplier[suggestion.SupplierID], store.PurchaseOrderLine{
+			ArticleID:       suggestion.ArticleID,
+			QuantityOrdered: suggestion.SuggestedQuantity,
+			UnitCostCents:   suggestion.UnitCostCents,
+		})
+	}
+	for _, supplierID := range suppliers {
+		purchaseOrder, err := h.PurchaseOrdersStore.CreatePurchaseOrder(ctx, store.CreatePurchaseOrderRequest{
+			SupplierID: supplierID,
+			Lines:      bySupplier[supplierID],
+		})
+		if err != nil {
+			return err
+		}
+		log.Info().
+			Str("purchaseOrderId", purchaseOrder.PurchaseOrderID).
+			Str("supplierId", supplierID).
+			Int("lines", len(purchaseOrder.Lines)).
+			Msg("drafted purchase order from replenishment suggestions")
+	}
+	return nil
+}
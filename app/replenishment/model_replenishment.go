@@ -0,0 +1,51 @@
+package replenishment
+
+type ArticleReplenishmentRequest struct {
+	ReorderPoint    int `json:"reorderPoint"`
+	SafetyStock     int `json:"safetyStock"`
+	ReorderQuantity int `json:"reorderQuantity"`
+}
+
+type GetSuggestionsResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+type Suggestion struct {
+	ArticleID         string `json:"articleId"`
+	Name              string `json:"name"`
+	Stock             int    `json:"stock"`
+	OnOrder           int    `json:"onOrder"`
+	Reserved          int    `json:"reserved"`
+	ExpectedDemand    int    `json:"expectedDemand"`
+	ReorderPoint      int    `json:"reorderPoint"`
+	SafetyStock       int    `json:"safetyStock"`
+	SuggestedQuantity int    `json:"suggestedQuantity"`
+	SupplierID        string `json:"supplierId,omitempty"`
+	LeadTimeDays      int    `json:"leadTimeDays"`
+	UnitCostCents     int64  `json:"unitCostCents"`
+	// Consumers are the products using the article, its expected demand and
+	// reserved units are theirs times their amount of the article.
+	Consumers []Consumer `json:"consumers"`
+}
+
+type Consumer struct {
+	ProductID     string `json:"productId"`
+	Name          string `json:"name"`
+	ArticleAmount int    `json:"articleAmount"`
+	// Sold is the number of the product sold in the demand window.
+	Sold          int `json:"sold"`
+	Reserved      int `json:"reserved"`
+	ExpectedSales int `json:"expectedSales"`
+}
+
+type CreateReservationRequest struct {
+	Quantity  int    `json:"quantity"`
+	Reference string `json:"reference"`
+}
+
+type Reservation struct {
+	ReservationID string `json:"reservationId"`
+	ProductID     string `json:"productId"`
+	Quantity      int    `json:"quantity"`
+	Reference     string `json:"reference,omitempty"`
+}
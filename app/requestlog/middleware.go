@@ -0,0 +1,90 @@
+package requestlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/recorder"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+
+	maxRequestIDLength = 100
+	requestIDBytes     = 16
+)
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the id of the request, or an empty string
+// outside of a request.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Middleware identifies every request with the X-Request-ID a client or proxy
+// sent, or a new one, and returns it on the response. The log lines of the
+// request carry it together with the method, path and route, and one access
+// log line is written once the request is done.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(HeaderRequestID)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = NewRequestID()
+		}
+		w.Header().Set(HeaderRequestID, requestID)
+
+		var route string
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+		ctx := WithRequestID(r.Context(), requestID)
+		logger := zerolog.Ctx(ctx)
+		if logger.GetLevel() == zerolog.Disabled {
+			logger = &log.Logger
+		}
+		requestLogger := logger.With().
+			Str("requestId", requestID).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("route", route).
+			Logger()
+		ctx = requestLogger.WithContext(ctx)
+
+		rec := recorder.New(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		event := requestLogger.Info()
+		if rec.StatusCode() >= http.StatusInternalServerError {
+			event = requestLogger.Error()
+		}
+		event.
+			Int("status", rec.StatusCode()).
+			Int64("bytes", rec.Bytes()).
+			Dur("duration", time.Since(start)).
+			Msg("request handled")
+	})
+}
+
+// NewRequestID makes up an id for a request that didn't come with one.
+func NewRequestID() string {
+	random := make([]byte, requestIDBytes)
+	_, err := rand.Read(random)
+	if err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/warehouse/app/auth"
+)
+
+const jwksFetchTimeout = 10 * time.Second
+
+func newAuthenticator(cfg Configuration) (*auth.Authenticator, error) {
+	authenticator := auth.NewAuthenticator(cfg.Auth.AdminKey)
+	var keys *auth.KeySet
+	switch {
+	case cfg.Auth.JWKSFile != "" && cfg.Auth.JWKSURL != "":
+		return nil, ErrAmbiguousJWKS
+	case cfg.Auth.JWKSFile != "":
+		keys = auth.NewFileKeySet(cfg.Auth.JWKSFile)
+	case cfg.Auth.JWKSURL != "":
+		keys = auth.NewURLKeySet(cfg.Auth.JWKSURL, &http.Client{Timeout: jwksFetchTimeout})
+	default:
+		return authenticator, nil
+	}
+	authenticator.JWT = auth.NewJWTValidator(
+		keys,
+		cfg.Auth.JWTIssuer,
+		cfg.Auth.JWTAudience,
+		cfg.Auth.JWTScopesClaim,
+		time.Duration(cfg.Auth.JWTLeeway)*time.Millisecond,
+	)
+	authenticator.JWT.TenantClaim = cfg.Auth.JWTTenantClaim
+	return authenticator, nil
+}
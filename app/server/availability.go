@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// CheckAvailability compares product_availability with the stock computed
+// from the articles from scratch and writes every drift to out, fix
+// overwrites them. It returns how many products drifted.
+func CheckAvailability(cfg Configuration, fix bool, out io.Writer) (int, error) {
+	ctx := context.Background()
+	db, err := NewPostgresDB(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	drifts, err := db.CheckProductAvailability(ctx, fix)
+	if err != nil {
+		return 0, err
+	}
+	for _, drift := range drifts {
+		_, err = fmt.Fprintf(
+			out,
+			"tenant=%s product=%s stored=%s actual=%s\n",
+			drift.Tenant,
+			drift.ProductID,
+			formatStock(drift.Stored),
+			formatStock(drift.Actual),
+		)
+		if err != nil {
+			return len(drifts), err
+		}
+	}
+	summary := "%d products drifted\n"
+	if fix {
+		summary = "%d products drifted and were fixed\n"
+	}
+	_, err = fmt.Fprintf(out, summary, len(drifts))
+	return len(drifts), err
+}
+
+func formatStock(stock *int) string {
+	if stock == nil {
+		return "none"
+	}
+	return strconv.Itoa(*stock)
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"time"
+
+	"github.com/warehouse/app/cache"
+	"github.com/warehouse/app/metrics"
+)
+
+// setProductsCache puts a cache of size responses in front of the products
+// store. The stores changing the stock of products invalidate it.
+func (srv *Server) setProductsCache(size int, maxStaleness time.Duration) {
+	srv.ProductsCache = cache.NewProductsStore(srv.ProductsHandler.ProductsStore, size, maxStaleness)
+	srv.ProductsHandler.ProductsStore = srv.ProductsCache
+	srv.ArticlesHandler.ArticleStore = &cache.ArticlesStore{
+		ArticlesStore: srv.ArticlesHandler.ArticleStore,
+		Products:      srv.ProductsCache,
+	}
+	srv.PurchaseOrdersHandler.PurchaseOrdersStore = &cache.PurchaseOrdersStore{
+		PurchaseOrdersStore: srv.PurchaseOrdersHandler.PurchaseOrdersStore,
+		Products:            srv.ProductsCache,
+	}
+	srv.ReplenishmentHandler.PurchaseOrdersStore = srv.PurchaseOrdersHandler.PurchaseOrdersStore
+	srv.MetricsHandler.Registry.Register(metrics.ProductsCacheCollector(srv.ProductsCache))
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"time"
+
+	"github.com/warehouse/app/health"
+	"github.com/warehouse/app/store"
+)
+
+// readinessChecks are run by GET /readiness, the database and its schema are
+// critical, a schema ahead of this build and the outbox backlog only warn.
+func readinessChecks(cfg Configuration, db store.HealthStore) []health.Check {
+	timeout := time.Duration(cfg.Readiness.CheckTimeout) * time.Millisecond
+	expectedMigration := cfg.Readiness.ExpectedMigration
+	if expectedMigration == "" {
+		expectedMigration = store.LatestMigration()
+	}
+	return []health.Check{
+		{
+			Name:     "database",
+			Critical: true,
+			Timeout:  timeout,
+			Checker:  health.Database(db),
+		},
+		{
+			Name:     "migration",
+			Critical: true,
+			Timeout:  timeout,
+			Checker:  health.Migration(db, expectedMigration),
+		},
+		{
+			Name:    "migration_ahead",
+			Timeout: timeout,
+			Checker: health.MigrationAhead(db, expectedMigration),
+		},
+		{
+			Name:    "outbox",
+			Timeout: timeout,
+			Checker: health.OutboxBacklog(db, cfg.Readiness.OutboxBacklogThreshold),
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"github.com/warehouse/app/limits"
+)
+
+func newRateLimiter(cfg Configuration) *limits.RateLimiter {
+	routes := make(map[string]limits.Limit)
+	for route, rate := range cfg.RateLimit.RouteRates {
+		routes[route] = limits.Limit{Rate: rate, Burst: cfg.RateLimit.Burst}
+	}
+	for route, burst := range cfg.RateLimit.RouteBursts {
+		limit, ok := routes[route]
+		if !ok {
+			limit.Rate = cfg.RateLimit.Rate
+		}
+		limit.Burst = burst
+		routes[route] = limit
+	}
+	limiter := limits.NewRateLimiter(limits.Limit{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst}, routes)
+	limiter.Unauthorized = limits.Limit{Rate: cfg.RateLimit.UnauthorizedRate, Burst: cfg.RateLimit.UnauthorizedBurst}
+	if cfg.RateLimit.TrustForwardedFor {
+		limiter.TrustedHops = cfg.RateLimit.TrustedHops
+	}
+	return limiter
+}
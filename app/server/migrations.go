@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Migrate runs action against the database and writes what it did to out:
+// up applies the missing migrations, down reverts the last steps ones and
+// status lists every migration with when it was applied.
+func Migrate(cfg Configuration, action string, steps int, out io.Writer) error {
+	if action != "up" && action != "down" && action != "status" {
+		return fmt.Errorf("%w: %q", ErrUnknownMigrateAction, action)
+	}
+	ctx := context.Background()
+	db, err := NewPostgresDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	switch action {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		return writeMigrations(out, "applied", applied, err)
+	case "down":
+		reverted, err := db.MigrateDown(ctx, steps)
+		return writeMigrations(out, "reverted", reverted, err)
+	}
+	statuses, err := db.GetMigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.AppliedAt != nil {
+			state = "applied " + status.AppliedAt.Format(time.RFC3339)
+		}
+		if status.Unknown {
+			state += " (unknown to this build)"
+		}
+		_, err = fmt.Fprintf(out, "%s %s\n", status.Name, state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMigrations reports the migrations done before err, if any, stopped
+// the others.
+func writeMigrations(out io.Writer, verb string, names []string, err error) error {
+	for _, name := range names {
+		_, writeErr := fmt.Fprintf(out, "%s %s\n", verb, name)
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%d migrations %s\n", len(names), verb)
+	return err
+}
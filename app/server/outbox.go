@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/warehouse/app/outbox"
+)
+
+const outboxFilePermissions = 0o644
+
+// newOutboxSinks builds the sinks listed in cfg.Outbox.Sinks. The returned
+// closer releases the files opened for them.
+func newOutboxSinks(cfg Configuration) (outbox.MultiSink, io.Closer, error) {
+	sinks := outbox.MultiSink{}
+	closers := multiCloser{}
+	for _, name := range strings.Split(cfg.Outbox.Sinks, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "stdout":
+			sinks = append(sinks, outbox.NewWriterSink(os.Stdout))
+		case "file":
+			f, err := os.OpenFile(cfg.Outbox.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, outboxFilePermissions)
+			if err != nil {
+				_ = closers.Close()
+				return nil, nil, fmt.Errorf("opening outbox file: %w", err)
+			}
+			closers = append(closers, f)
+			sinks = append(sinks, outbox.NewFileSink(f))
+		case "http":
+			if cfg.Outbox.HTTPURL == "" {
+				_ = closers.Close()
+				return nil, nil, ErrMissingOutboxURL
+			}
+			client := &http.Client{Timeout: time.Duration(cfg.Outbox.HTTPTimeout) * time.Millisecond}
+			sinks = append(sinks, outbox.NewHTTPSink(cfg.Outbox.HTTPURL, client))
+		default:
+			_ = closers.Close()
+			return nil, nil, fmt.Errorf("%w: %q", ErrUnknownOutboxSink, name)
+		}
+	}
+	return sinks, closers, nil
+}
+
+type multiCloser []io.Closer
+
+func (c multiCloser) Close() error {
+	var firstErr error
+	for _, closer := range c {
+		err := closer.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
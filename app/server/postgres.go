@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/warehouse/app/store"
+)
+
+// NewPostgresDB connects to the database, waiting for it to be reachable for
+// up to the startup timeout.
+func NewPostgresDB(ctx context.Context, cfg Configuration) (*store.PostgresDB, error) {
+	pgCfg := cfg.PostgresConfiguration
+	if err := checkReadYourWritesWindow(cfg); err != nil {
+		return nil, err
+	}
+	db, err := store.NewPostgresDB(store.Config{
+		Host:                pgCfg.Host,
+		Port:                pgCfg.Port,
+		DB:                  pgCfg.DB,
+		CredentialsFileName: pgCfg.CredentialsFileName,
+		SSLMode:             pgCfg.SSLMode,
+		SSLRootCert:         pgCfg.SSLRootCert,
+		ApplicationName:     pgCfg.ApplicationName,
+		ConnectTimeout:      time.Duration(pgCfg.ConnectTimeout) * time.Millisecond,
+		StatementTimeout:    time.Duration(pgCfg.StatementTimeout) * time.Millisecond,
+		MaxOpenConns:        pgCfg.MaxOpenConns,
+		MaxIdleConns:        pgCfg.MaxIdleConns,
+		ConnMaxLifetime:     time.Duration(pgCfg.ConnMaxLifetime) * time.Millisecond,
+		ConnMaxIdleTime:     time.Duration(pgCfg.ConnMaxIdleTime) * time.Millisecond,
+		TxRetries:           pgCfg.TxRetries,
+		ReplicaDSNs:         pgCfg.ReplicaDSNs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pgCfg.StartupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(pgCfg.StartupTimeout)*time.Millisecond)
+		defer cancel()
+	}
+	err = db.WaitForConnection(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkReadYourWritesWindow makes sure a replica still in rotation is never
+// further behind than the window of read your writes. It can be up to
+// ReplicaMaxLag behind when checked, and fall further behind until the next
+// check.
+func checkReadYourWritesWindow(cfg Configuration) error {
+	pgCfg := cfg.PostgresConfiguration
+	if len(pgCfg.ReplicaDSNs) == 0 || pgCfg.ReadYourWritesWindow <= 0 {
+		return nil
+	}
+	if pgCfg.ReplicaMaxLag <= 0 || pgCfg.ReplicaCheckInterval <= 0 ||
+		pgCfg.ReadYourWritesWindow < pgCfg.ReplicaMaxLag+pgCfg.ReplicaCheckInterval {
+		return ErrReadYourWritesWindow
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package recorder
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Recorder passes a response through while keeping its status and size, and
+// a copy of its body when KeepBody is set. It is an http.Flusher, so that
+// event streams keep working behind it. It is not part of responses, which
+// imports the logging and tracing middlewares using it.
+type Recorder struct {
+	http.ResponseWriter
+	// OnWriteHeader runs once, before the status is written, e.g. to set
+	// headers depending on it.
+	OnWriteHeader func(statusCode int)
+	KeepBody      bool
+	Body          bytes.Buffer
+
+	statusCode int
+	bytes      int64
+}
+
+func New(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+func (rec *Recorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = statusCode
+		if rec.OnWriteHeader != nil {
+			rec.OnWriteHeader(statusCode)
+		}
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *Recorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.KeepBody {
+		rec.Body.Write(b)
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *Recorder) Flush() {
+	if rec.statusCode == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// StatusCode is the status of the response, 200 when the handler wrote
+// nothing, which net/http answers with.
+func (rec *Recorder) StatusCode() int {
+	if rec.statusCode == 0 {
+		return http.StatusOK
+	}
+	return rec.statusCode
+}
+
+// Bytes is the size of the body written so far.
+func (rec *Recorder) Bytes() int64 {
+	return rec.bytes
+}
@@ -0,0 +1,75 @@
+package responses
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/warehouse/app/csvio"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeCSV  = "text/csv"
+)
+
+// RequestContentType returns the media type of the body of r, without its
+// parameters, application/json when it isn't set.
+func RequestContentType(r *http.Request) string {
+	value := r.Header.Get("Content-Type")
+	if value == "" {
+		return ContentTypeJSON
+	}
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return value
+	}
+	return mediaType
+}
+
+// Negotiate returns the offer the Accept header of r prefers, by quality and
+// then by the order of the header. The first offer is the default, also when
+// none is acceptable, clients that didn't ask for a format get JSON.
+func Negotiate(r *http.Request, offers ...string) string {
+	best, bestQuality := offers[0], 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		for _, offer := range offers {
+			if !acceptsMediaType(mediaType, offer) {
+				continue
+			}
+			// ties go to the earlier range, and to the earlier offer for a
+			// wildcard
+			if quality > bestQuality {
+				best, bestQuality = offer, quality
+			}
+		}
+	}
+	return best
+}
+
+func acceptsMediaType(accepted, offer string) bool {
+	if accepted == "*/*" || accepted == offer {
+		return true
+	}
+	return strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*"))
+}
+
+// WriteLineErrors writes the invalid rows of an imported file as a 400.
+func WriteLineErrors(ctx context.Context, w http.ResponseWriter, lineErrs csvio.Errors) {
+	body := GenerateErrorResponseBody(ctx, InvalidBodyError, "the file has invalid rows")
+	body.Errors = lineErrs
+	WriteError(ctx, w, http.StatusBadRequest, body)
+}
@@ -0,0 +1,31 @@
+package responses
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+var ErrInvalidDryRun = errors.New("dryRun must be true or false")
+
+// FieldError is what is wrong with a field of an item of a request.
+type FieldError struct {
+	// Line is the line of the row of a text/csv body the field is on.
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// DryRun tells whether the dryRun query parameter of r asks to only report
+// what the request would do.
+func DryRun(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dryRun")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, ErrInvalidDryRun
+	}
+	return dryRun, nil
+}
@@ -0,0 +1,33 @@
+package responses
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidIfMatch = errors.New("If-Match must be * or a single ETag returned by this api")
+
+// SetETag sets the ETag header of a versioned resource.
+func SetETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// IfMatchVersion returns the version required by the If-Match header of r, or
+// 0 when the header is missing or *, i.e. any version is accepted.
+func IfMatchVersion(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, ErrInvalidIfMatch
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		return 0, ErrInvalidIfMatch
+	}
+	return version, nil
+}
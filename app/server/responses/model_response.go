@@ -6,6 +6,10 @@ import (
 	"net/http"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/csvio"
+	"github.com/warehouse/app/requestlog"
+	"github.com/warehouse/app/tracing"
 )
 
 const (
@@ -15,16 +19,37 @@ const (
 	MarshalError              = "E004"
 	ResourceNotFound          = "E005"
 	ResourceFinished          = "E006"
+	InvalidStateTransition    = "E007"
+	IdempotencyKeyReused      = "E008"
+	RequestInProgress         = "E009"
+	VersionConflict           = "E010"
+	Unauthenticated           = "E011"
+	Forbidden                 = "E012"
+	InvalidTenant             = "E013"
+	TooManyRequests           = "E014"
+	RequestBodyTooLarge       = "E015"
+	InvalidHeaderError        = "E016"
 )
 
 type ErrorResponse struct {
 	Code string `json:"errorCode,omitempty"`
 	// Unique object id
 	Message string `json:"message,omitempty"`
+	// RequestID is the X-Request-ID of the request.
+	RequestID string `json:"requestId,omitempty"`
+	// TraceID finds the trace of the request in the tracing backend.
+	TraceID string `json:"traceId,omitempty"`
+	// Errors are the rows of an imported file that are invalid.
+	Errors csvio.Errors `json:"errors,omitempty"`
 }
 
 func GenerateErrorResponseBody(ctx context.Context, errorCode string, message string) ErrorResponse {
-	return ErrorResponse{Code: errorCode, Message: message}
+	return ErrorResponse{
+		Code:      errorCode,
+		Message:   message,
+		RequestID: requestlog.RequestIDFromContext(ctx),
+		TraceID:   tracing.TraceIDFromContext(ctx),
+	}
 }
 
 func WriteError(ctx context.Context, w http.ResponseWriter, statusCode int, errorBody ErrorResponse) {
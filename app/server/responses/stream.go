@@ -0,0 +1,80 @@
+package responses
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// streamFlushRows is how many rows an NDJSONWriter writes before sending them
+// on.
+const streamFlushRows = 100
+
+// Stream is the body of a 200 response written while it is produced. The
+// status and headers are only sent with its first bytes, until then a failure
+// can still be answered with WriteError.
+type Stream struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func NewStream(w http.ResponseWriter, contentType string) *Stream {
+	return &Stream{w: w, contentType: contentType}
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	s.start()
+	return s.w.Write(p)
+}
+
+// Flush sends what was written to the client.
+func (s *Stream) Flush() {
+	s.start()
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Started tells whether the response was sent, an error can't be anymore.
+func (s *Stream) Started() bool {
+	return s.started
+}
+
+func (s *Stream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", s.contentType+"; charset=UTF-8")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// NDJSONWriter writes a JSON document per line to a Stream.
+type NDJSONWriter struct {
+	stream  *Stream
+	encoder *json.Encoder
+	rows    int
+}
+
+func NewNDJSONWriter(stream *Stream) *NDJSONWriter {
+	return &NDJSONWriter{stream: stream, encoder: json.NewEncoder(stream)}
+}
+
+func (w *NDJSONWriter) Write(row interface{}) error {
+	err := w.encoder.Encode(row)
+	if err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%streamFlushRows == 0 {
+		w.stream.Flush()
+	}
+	return nil
+}
+
+func (w *NDJSONWriter) Flush() error {
+	w.stream.Flush()
+	return nil
+}
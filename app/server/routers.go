@@ -4,6 +4,12 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/limits"
+	"github.com/warehouse/app/metrics"
+	"github.com/warehouse/app/requestlog"
+	"github.com/warehouse/app/tracing"
 )
 
 const prefix = ""
@@ -13,48 +19,75 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// Scope is required from the caller, auth.ScopePublic opens the route to
+	// everybody.
+	Scope auth.Scope
 }
 
 type Routes []Route
 
-func NewRouter(routes Routes) *mux.Router {
+// NewRouter registers routes, traces, logs and measures them, the
+// authenticator enforces their scopes unless it is nil. The limiter, unless
+// nil, rejects the IP addresses that failed authentication too often before
+// their credentials are checked.
+func NewRouter(routes Routes, authenticator *auth.Authenticator, limiter *limits.RateLimiter) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
+	scopes := make(map[string]auth.Scope, len(routes))
 	for _, route := range routes {
 		router.
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(route.HandlerFunc)
+			Handler(tracing.Handler(route.Name, route.HandlerFunc))
+		scopes[route.Name] = route.Scope
+	}
+	router.Use(tracing.Middleware)
+	router.Use(requestlog.Middleware)
+	router.Use(metrics.Middleware)
+	if limiter != nil {
+		router.Use(limiter.UnauthorizedHandler)
+	}
+	if authenticator != nil {
+		router.Use(authenticator.Handler(scopes))
 	}
 	return router
 }
 
-func Health(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-}
-func Ready(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-}
-
 func makeRoutes(srv *Server) Routes {
 	generalRoutes := Routes{
 		Route{
 			"Health",
 			http.MethodGet,
 			prefix + "/health",
-			Health,
+			srv.HealthHandler.Health,
+			auth.ScopePublic,
 		},
 		Route{
 			"Ready",
 			http.MethodGet,
 			prefix + "/readiness",
-			Ready,
+			srv.HealthHandler.Ready,
+			auth.ScopePublic,
+		},
+		Route{
+			"GetMetrics",
+			http.MethodGet,
+			prefix + "/metrics",
+			srv.MetricsHandler.GetMetrics,
+			auth.ScopeAdmin,
 		},
 	}
 	return union(
 		generalRoutes,
 		getProductsRoutes(srv),
 		getArticlesRoutes(srv),
+		getSuppliersRoutes(srv),
+		getPurchaseOrdersRoutes(srv),
+		getReplenishmentRoutes(srv),
+		getWebhooksRoutes(srv),
+		getEventsRoutes(srv),
+		getAPIKeysRoutes(srv),
+		getAuditRoutes(srv),
 	)
 }
 
@@ -65,18 +98,35 @@ func getProductsRoutes(srv *Server) Routes {
 			http.MethodPost,
 			prefix + "/products",
 			srv.ProductsHandler.CreateOrUpdateProducts,
+			auth.ScopeInventoryWrite,
 		},
 		{
 			"SellProduct",
 			http.MethodPost,
 			prefix + "/products/sell",
 			srv.ProductsHandler.SellProduct,
+			auth.ScopeSalesWrite,
 		},
 		{
 			"GetAllProductsWithStock",
 			http.MethodGet,
 			prefix + "/products",
 			srv.ProductsHandler.GetAllProductsWithStock,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"GetProduct",
+			http.MethodGet,
+			prefix + "/products/{productId}",
+			srv.ProductsHandler.GetProduct,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"UpdateProduct",
+			http.MethodPut,
+			prefix + "/products/{productId}",
+			srv.ProductsHandler.UpdateProduct,
+			auth.ScopeInventoryWrite,
 		},
 	}
 }
@@ -88,6 +138,203 @@ func getArticlesRoutes(srv *Server) Routes {
 			http.MethodPost,
 			prefix + "/articles",
 			srv.ArticlesHandler.CreateOrUpdateArticles,
+			auth.ScopeInventoryWrite,
+		},
+		{
+			"GetAllArticles",
+			http.MethodGet,
+			prefix + "/articles",
+			srv.ArticlesHandler.GetAllArticles,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"GetArticle",
+			http.MethodGet,
+			prefix + "/articles/{articleId}",
+			srv.ArticlesHandler.GetArticle,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"UpdateArticle",
+			http.MethodPut,
+			prefix + "/articles/{articleId}",
+			srv.ArticlesHandler.UpdateArticle,
+			auth.ScopeInventoryWrite,
+		},
+	}
+}
+
+func getSuppliersRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"CreateSupplier",
+			http.MethodPost,
+			prefix + "/suppliers",
+			srv.SuppliersHandler.CreateSupplier,
+			auth.ScopeInventoryWrite,
+		},
+		{
+			"GetAllSuppliers",
+			http.MethodGet,
+			prefix + "/suppliers",
+			srv.SuppliersHandler.GetAllSuppliers,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"CreateOrUpdateArticleSupplier",
+			http.MethodPost,
+			prefix + "/suppliers/{supplierId}/articles",
+			srv.SuppliersHandler.CreateOrUpdateArticleSupplier,
+			auth.ScopeInventoryWrite,
+		},
+		{
+			"GetArticleSuppliers",
+			http.MethodGet,
+			prefix + "/suppliers/{supplierId}/articles",
+			srv.SuppliersHandler.GetArticleSuppliers,
+			auth.ScopeInventoryRead,
+		},
+	}
+}
+
+func getPurchaseOrdersRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"CreatePurchaseOrder",
+			http.MethodPost,
+			prefix + "/purchase-orders",
+			srv.PurchaseOrdersHandler.CreatePurchaseOrder,
+			auth.ScopeInventoryWrite,
+		},
+		{
+			"GetPurchaseOrder",
+			http.MethodGet,
+			prefix + "/purchase-orders/{purchaseOrderId}",
+			srv.PurchaseOrdersHandler.GetPurchaseOrder,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"UpdatePurchaseOrderState",
+			http.MethodPatch,
+			prefix + "/purchase-orders/{purchaseOrderId}",
+			srv.PurchaseOrdersHandler.UpdatePurchaseOrderState,
+			auth.ScopeInventoryWrite,
+		},
+		{
+			"CreatePurchaseOrderReceipt",
+			http.MethodPost,
+			prefix + "/purchase-orders/{purchaseOrderId}/receipts",
+			srv.PurchaseOrdersHandler.CreateReceipt,
+			auth.ScopeInventoryWrite,
+		},
+	}
+}
+
+func getReplenishmentRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"UpdateArticleReplenishment",
+			http.MethodPut,
+			prefix + "/articles/{articleId}/replenishment",
+			srv.ReplenishmentHandler.UpdateArticleReplenishment,
+			auth.ScopeInventoryWrite,
+		},
+		{
+			"GetReplenishmentSuggestions",
+			http.MethodGet,
+			prefix + "/replenishment/suggestions",
+			srv.ReplenishmentHandler.GetSuggestions,
+			auth.ScopeInventoryRead,
+		},
+		{
+			"CreateReservation",
+			http.MethodPost,
+			prefix + "/products/{productId}/reservations",
+			srv.ReplenishmentHandler.CreateReservation,
+			auth.ScopeSalesWrite,
+		},
+		{
+			"DeleteReservation",
+			http.MethodDelete,
+			prefix + "/reservations/{reservationId}",
+			srv.ReplenishmentHandler.DeleteReservation,
+			auth.ScopeSalesWrite,
+		},
+	}
+}
+
+func getWebhooksRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"CreateWebhook",
+			http.MethodPost,
+			prefix + "/webhooks",
+			srv.WebhooksHandler.CreateWebhook,
+			auth.ScopeAdmin,
+		},
+		{
+			"GetAllWebhooks",
+			http.MethodGet,
+			prefix + "/webhooks",
+			srv.WebhooksHandler.GetAllWebhooks,
+			auth.ScopeAdmin,
+		},
+		{
+			"DeleteWebhook",
+			http.MethodDelete,
+			prefix + "/webhooks/{subscriptionId}",
+			srv.WebhooksHandler.DeleteWebhook,
+			auth.ScopeAdmin,
+		},
+	}
+}
+
+func getEventsRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"StreamStock",
+			http.MethodGet,
+			prefix + "/events/stock",
+			srv.EventsHandler.StreamStock,
+			auth.ScopeInventoryRead,
+		},
+	}
+}
+
+func getAPIKeysRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"CreateAPIKey",
+			http.MethodPost,
+			prefix + "/api-keys",
+			srv.APIKeysHandler.CreateAPIKey,
+			auth.ScopeAdmin,
+		},
+		{
+			"GetAllAPIKeys",
+			http.MethodGet,
+			prefix + "/api-keys",
+			srv.APIKeysHandler.GetAllAPIKeys,
+			auth.ScopeAdmin,
+		},
+		{
+			"RevokeAPIKey",
+			http.MethodDelete,
+			prefix + "/api-keys/{apiKeyId}",
+			srv.APIKeysHandler.RevokeAPIKey,
+			auth.ScopeAdmin,
+		},
+	}
+}
+
+func getAuditRoutes(srv *Server) Routes {
+	return Routes{
+		{
+			"GetAuditRecords",
+			http.MethodGet,
+			prefix + "/audit",
+			srv.AuditHandler.GetAuditRecords,
+			auth.ScopeAdmin,
 		},
 	}
 }
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -10,16 +11,63 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
+	"github.com/warehouse/app/apikeys"
 	"github.com/warehouse/app/articles"
+	"github.com/warehouse/app/audit"
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/cache"
+	"github.com/warehouse/app/consistency"
+	"github.com/warehouse/app/events"
+	"github.com/warehouse/app/health"
+	"github.com/warehouse/app/idempotency"
+	"github.com/warehouse/app/limits"
+	"github.com/warehouse/app/metrics"
+	"github.com/warehouse/app/outbox"
 	"github.com/warehouse/app/products"
+	"github.com/warehouse/app/purchaseorders"
+	"github.com/warehouse/app/replenishment"
 	"github.com/warehouse/app/store"
+	"github.com/warehouse/app/suppliers"
+	"github.com/warehouse/app/tenancy"
+	"github.com/warehouse/app/tracing"
+	"github.com/warehouse/app/webhooks"
 )
 
 type Server struct {
-	ProductsHandler *products.Handler
-	ArticlesHandler *articles.Handler
+	ProductsHandler       *products.Handler
+	ArticlesHandler       *articles.Handler
+	SuppliersHandler      *suppliers.Handler
+	PurchaseOrdersHandler *purchaseorders.Handler
+	ReplenishmentHandler  *replenishment.Handler
+	WebhooksHandler       *webhooks.Handler
+	EventsHandler         *events.Handler
+	APIKeysHandler        *apikeys.Handler
+	AuditHandler          *audit.Handler
+	Audit                 *audit.Middleware
+	Idempotency           *idempotency.Middleware
+	RateLimiter           *limits.RateLimiter
+	MetricsHandler        *metrics.Handler
+	HealthHandler         *health.Handler
+	HealthStore           store.HealthStore
+	ReplicasStore         store.ReplicasStore
+	ReadYourWrites        *consistency.ReadYourWrites
+	Tenancy               *tenancy.Middleware
+	BodyLimiter           *limits.BodyLimiter
+	OutboxStore           store.OutboxStore
+	// ProductsCache is nil when products aren't cached.
+	ProductsCache *cache.ProductsStore
+	// Authenticator is nil when authentication is disabled.
+	Authenticator *auth.Authenticator
+	// TracerProvider is shut down with the server, exporting the spans
+	// left, when it isn't nil.
+	TracerProvider *sdktrace.TracerProvider
+	// OutboxSinks receive every outbox event, in addition to the sinks from
+	// the configuration.
+	OutboxSinks outbox.MultiSink
 }
 
 func (srv *Server) setHandlers() {
@@ -29,6 +77,51 @@ func (srv *Server) setHandlers() {
 	if srv.ProductsHandler == nil {
 		srv.ProductsHandler = products.NewHandler()
 	}
+	if srv.SuppliersHandler == nil {
+		srv.SuppliersHandler = suppliers.NewHandler()
+	}
+	if srv.PurchaseOrdersHandler == nil {
+		srv.PurchaseOrdersHandler = purchaseorders.NewHandler()
+	}
+	if srv.ReplenishmentHandler == nil {
+		srv.ReplenishmentHandler = replenishment.NewHandler(0)
+	}
+	if srv.WebhooksHandler == nil {
+		srv.WebhooksHandler = webhooks.NewHandler(false)
+	}
+	if srv.EventsHandler == nil {
+		srv.EventsHandler = events.NewHandler(events.NewHub())
+	}
+	if srv.APIKeysHandler == nil {
+		srv.APIKeysHandler = apikeys.NewHandler()
+	}
+	if srv.AuditHandler == nil {
+		srv.AuditHandler = audit.NewHandler()
+	}
+	if srv.Audit == nil {
+		srv.Audit = audit.NewMiddleware()
+	}
+	if srv.Idempotency == nil {
+		srv.Idempotency = idempotency.NewMiddleware(nil, 0, 0)
+	}
+	if srv.MetricsHandler == nil {
+		srv.MetricsHandler = metrics.NewHandler()
+	}
+	if srv.HealthHandler == nil {
+		srv.HealthHandler = health.NewHandler()
+	}
+	if srv.ReadYourWrites == nil {
+		srv.ReadYourWrites = consistency.NewReadYourWrites(0)
+	}
+	if srv.Tenancy == nil {
+		srv.Tenancy = tenancy.NewMiddleware(false)
+	}
+	if srv.RateLimiter == nil {
+		srv.RateLimiter = limits.NewRateLimiter(limits.Limit{}, nil)
+	}
+	if srv.BodyLimiter == nil {
+		srv.BodyLimiter = limits.NewBodyLimiter(0, nil)
+	}
 }
 
 func (srv *Server) setStores(pgDB interface{}) error {
@@ -40,42 +133,206 @@ func (srv *Server) setStores(pgDB interface{}) error {
 	if srv.ArticlesHandler.ArticleStore, ok = pgDB.(store.ArticlesStore); !ok {
 		return ErrInvalidTypeForStore
 	}
+	if srv.SuppliersHandler.SuppliersStore, ok = pgDB.(store.SuppliersStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	if srv.PurchaseOrdersHandler.PurchaseOrdersStore, ok = pgDB.(store.PurchaseOrdersStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	if srv.ReplenishmentHandler.ReplenishmentStore, ok = pgDB.(store.ReplenishmentStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	srv.ReplenishmentHandler.PurchaseOrdersStore = srv.PurchaseOrdersHandler.PurchaseOrdersStore
+	if srv.WebhooksHandler.WebhooksStore, ok = pgDB.(store.WebhooksStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	if srv.OutboxStore, ok = pgDB.(store.OutboxStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	srv.EventsHandler.OutboxStore = srv.OutboxStore
+	if srv.Idempotency.Store, ok = pgDB.(store.IdempotencyStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	if srv.APIKeysHandler.APIKeysStore, ok = pgDB.(store.APIKeysStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	if srv.Authenticator != nil {
+		srv.Authenticator.APIKeysStore = srv.APIKeysHandler.APIKeysStore
+	}
+	if srv.AuditHandler.AuditStore, ok = pgDB.(store.AuditStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	srv.Audit.Store = srv.AuditHandler.AuditStore
+	metricsStore, ok := pgDB.(store.MetricsStore)
+	if !ok {
+		return ErrInvalidTypeForStore
+	}
+	srv.MetricsHandler.Registry = metrics.NewDefaultRegistry(metricsStore)
+	if srv.HealthStore, ok = pgDB.(store.HealthStore); !ok {
+		return ErrInvalidTypeForStore
+	}
+	if srv.ReplicasStore, ok = pgDB.(store.ReplicasStore); !ok {
+		return ErrInvalidTypeForStore
+	}
 	return nil
 }
 
+// startBackgroundJobs starts the goroutines that run next to the http server
+// until ctx is cancelled. The returned closer releases their resources.
+func (srv *Server) startBackgroundJobs(ctx context.Context, cfg Configuration) (io.Closer, error) {
+	if srv.Authenticator != nil && srv.Authenticator.JWT != nil {
+		// fail early rather than rejecting every token
+		err := srv.Authenticator.JWT.Keys.Refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+		go srv.Authenticator.JWT.Keys.Run(ctx, time.Duration(cfg.Auth.JWKSRefreshInterval)*time.Millisecond)
+	}
+	if cfg.Replenishment.AutoDraftIntervalSeconds > 0 {
+		go srv.ReplenishmentHandler.RunAutoDraft(
+			ctx,
+			time.Duration(cfg.Replenishment.AutoDraftIntervalSeconds)*time.Second,
+		)
+	}
+	dispatcher := webhooks.NewDispatcher(
+		srv.WebhooksHandler.WebhooksStore,
+		time.Duration(cfg.Webhooks.DispatchInterval)*time.Millisecond,
+		time.Duration(cfg.Webhooks.Timeout)*time.Millisecond,
+		cfg.Webhooks.MaxAttempts,
+		cfg.Webhooks.AllowPrivateTargets,
+	)
+	go dispatcher.Run(ctx)
+	outboxSinks, outboxClosers, err := newOutboxSinks(cfg)
+	if err != nil {
+		return nil, err
+	}
+	outboxSinks = append(outboxSinks, srv.OutboxSinks...)
+	if len(outboxSinks) > 0 {
+		outboxDispatcher := outbox.NewDispatcher(
+			srv.OutboxStore,
+			outboxSinks,
+			time.Duration(cfg.Outbox.DispatchInterval)*time.Millisecond,
+			time.Duration(cfg.Outbox.HTTPTimeout)*time.Millisecond,
+		)
+		go outboxDispatcher.Run(ctx)
+	}
+	go srv.EventsHandler.Hub.Run(ctx, srv.OutboxStore)
+	if srv.ProductsCache != nil {
+		go srv.ProductsCache.Run(ctx, srv.OutboxStore)
+	}
+	if cfg.Idempotency.CleanupInterval > 0 {
+		go srv.Idempotency.RunCleanup(ctx, time.Duration(cfg.Idempotency.CleanupInterval)*time.Millisecond)
+	}
+	if srv.ReplicasStore != nil && cfg.PostgresConfiguration.ReplicaCheckInterval > 0 {
+		go srv.ReplicasStore.RunReplicaChecks(
+			ctx,
+			time.Duration(cfg.PostgresConfiguration.ReplicaCheckInterval)*time.Millisecond,
+			time.Duration(cfg.PostgresConfiguration.ReplicaMaxLag)*time.Millisecond,
+		)
+	}
+	if cfg.RateLimit.CleanupInterval > 0 {
+		go srv.RateLimiter.RunCleanup(ctx, time.Duration(cfg.RateLimit.CleanupInterval)*time.Millisecond)
+	}
+	closers := multiCloser{outboxClosers}
+	if srv.TracerProvider != nil {
+		closers = append(closers, tracerProviderCloser{srv.TracerProvider})
+	}
+	return closers, nil
+}
+
 func StartServer(cfg Configuration) error {
+	// requests get a logger with their fields, everything else, like the
+	// background jobs, logs with the global one
+	zerolog.DefaultContextLogger = &log.Logger
 	ctx := context.Background()
 	log.Ctx(ctx).Info().Msg("enter StartServer")
 	defer log.Ctx(ctx).Info().Msg("exit StartServer")
 
-	server := &Server{}
+	server := &Server{
+		ReplenishmentHandler: replenishment.NewHandler(cfg.Replenishment.DemandWindowDays),
+		WebhooksHandler:      webhooks.NewHandler(cfg.Webhooks.AllowPrivateTargets),
+		Idempotency: idempotency.NewMiddleware(
+			nil,
+			time.Duration(cfg.Idempotency.Retention)*time.Millisecond,
+			time.Duration(cfg.Idempotency.LockTimeout)*time.Millisecond,
+		),
+		RateLimiter: newRateLimiter(cfg),
+		BodyLimiter: limits.NewBodyLimiter(cfg.BodyLimit.Default, cfg.BodyLimit.RouteLimits),
+		ReadYourWrites: consistency.NewReadYourWrites(
+			time.Duration(cfg.PostgresConfiguration.ReadYourWritesWindow) * time.Millisecond,
+		),
+		Tenancy: tenancy.NewMiddleware(cfg.Tenancy.MultiTenant),
+	}
+
+	if cfg.Auth.Enabled {
+		authenticator, err := newAuthenticator(cfg)
+		if err != nil {
+			log.Error().AnErr("error", err).Msg("failed to configure authentication")
+			return err
+		}
+		server.Authenticator = authenticator
+	}
+
+	tracerProvider, err := newTracerProvider(ctx, cfg)
+	if err != nil {
+		log.Error().AnErr("error", err).Msg("failed to configure tracing")
+		return err
+	}
+	tracing.SetProvider(tracerProvider)
+	server.TracerProvider = tracerProvider
 
 	if server.ProductsHandler == nil {
-		db, err := store.NewPostgresDB(
-			cfg.PostgresConfiguration.Port,
-			cfg.PostgresConfiguration.Host,
-			cfg.PostgresConfiguration.DB,
-			cfg.PostgresConfiguration.CredentialsFileName,
-		)
+		db, err := NewPostgresDB(ctx, cfg)
 		if err != nil {
 			log.Error().Msg("failed to get postgres client")
 			return err
 		}
+		if cfg.PostgresConfiguration.AutoMigrate {
+			applied, err := db.MigrateUp(ctx)
+			if err != nil {
+				log.Error().AnErr("error", err).Msg("failed to migrate the database")
+				_ = db.Close()
+				return err
+			}
+			log.Info().Strs("migrations", applied).Msg("database migrated")
+		}
+		db.ProductLowStockThreshold = cfg.Webhooks.ProductLowStockThreshold
 		err = server.setStores(db)
 		if err != nil {
 			log.Error().Msg("failed to set postgres client to handlers")
 			return err
 		}
+		if cfg.ProductsCache.Size > 0 {
+			server.setProductsCache(
+				cfg.ProductsCache.Size,
+				time.Duration(cfg.ProductsCache.MaxStaleness)*time.Millisecond,
+			)
+		}
+		server.HealthHandler.Registry.Register(readinessChecks(cfg, server.HealthStore)...)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	router := NewRouter(makeRoutes(server))
+	jobs, err := server.startBackgroundJobs(ctx, cfg)
+	if err != nil {
+		log.Error().AnErr("error", err).Msg("failed to start background jobs")
+		return err
+	}
+	defer jobs.Close()
+	router := NewRouter(makeRoutes(server), server.Authenticator, server.RateLimiter)
+	router.Use(server.RateLimiter.Handler)
+	router.Use(server.Tenancy.Handler)
+	router.Use(server.ReadYourWrites.Handler)
+	router.Use(server.Audit.Handler)
+	router.Use(server.BodyLimiter.Handler)
+	router.Use(server.Idempotency.Handler)
 	httpServer := &http.Server{
 		Addr:              ":" + strconv.Itoa(cfg.HTTP.Port),
 		Handler:           router,
 		BaseContext:       func(_ net.Listener) context.Context { return ctx },
 		ReadHeaderTimeout: time.Duration(cfg.HTTP.Timeout) * time.Millisecond,
 	}
+	// open event streams never finish on their own, end them when shutting down
+	httpServer.RegisterOnShutdown(server.EventsHandler.Hub.Close)
 	// start httpServer listening
 	httpServerErr := make(chan error, 1)
 	go func() {
@@ -110,6 +367,9 @@ func StartServer(cfg Configuration) error {
 		}
 	}
 
+	// stop getting new traffic before refusing it
+	server.HealthHandler.Shutdown()
+	time.Sleep(time.Duration(cfg.Readiness.ShutdownDelay) * time.Millisecond)
 	gracefullCtx, cancelShutdown := context.WithTimeout(context.Background(), serverGracefulShutdownTime)
 	defer cancelShutdown()
 	return httpServer.Shutdown(gracefullCtx)
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/warehouse/app/tracing"
+)
+
+// tracerShutdownTimeout bounds exporting the remaining spans on shutdown.
+const tracerShutdownTimeout = 10 * time.Second
+
+// newTracerProvider builds the tracer provider for cfg.Tracing.Exporter, one
+// without an exporter for none. The otlp exporter is configured by the
+// standard OTEL_EXPORTER_OTLP_* environment variables.
+func newTracerProvider(ctx context.Context, cfg Configuration) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Tracing.Exporter {
+	case "", "none":
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTraceExporter, cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tracing.NewProvider(ctx, exporter, cfg.Tracing.ServiceName, cfg.Tracing.SampleRatio)
+}
+
+// tracerProviderCloser exports the remaining spans when it is closed.
+type tracerProviderCloser struct {
+	provider *sdktrace.TracerProvider
+}
+
+func (c tracerProviderCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	return c.provider.Shutdown(ctx)
+}
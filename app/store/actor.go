@@ -0,0 +1,21 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type actorKey struct{}
+
+// WithActor records who makes the changes done with ctx, e.g. in the stock
+// history.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFromContext is NULL when the change was not made on behalf of an
+// authenticated caller, like by a background job.
+func actorFromContext(ctx context.Context) sql.NullString {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return sql.NullString{String: actor, Valid: ok && actor != ""}
+}
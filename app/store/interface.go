@@ -2,21 +2,157 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"time"
 )
 
 type ProductsStore interface {
 	CreateOrUpdateProducts(ctx context.Context, req CreateOrUpdateProductsRequest) error
+	// DryRunCreateOrUpdateProducts returns what CreateOrUpdateProducts would
+	// change, without changing anything. Products using articles that don't
+	// exist are left out.
+	DryRunCreateOrUpdateProducts(ctx context.Context, req CreateOrUpdateProductsRequest) (ImportDiff, error)
 	RemoveProductAndUpdateArticles(ctx context.Context, req RemoveProductAndUpdateArticlesRequest) error
 	GetAllProducts(ctx context.Context) (GetAllProductsResponse, error)
+	StreamProducts(ctx context.Context, fn func(product Product) error) error
+	GetProduct(ctx context.Context, productID string) (Product, error)
+	UpdateProduct(ctx context.Context, req UpdateProductRequest) (Product, error)
 }
 
 type ArticlesStore interface {
 	CreateOrUpdateArticles(ctx context.Context, req CreateOrUpdateArticlesRequest) error
+	// DryRunCreateOrUpdateArticles returns what CreateOrUpdateArticles would
+	// change, without changing anything.
+	DryRunCreateOrUpdateArticles(ctx context.Context, req CreateOrUpdateArticlesRequest) (ImportDiff, error)
+	GetArticle(ctx context.Context, articleID string) (Article, error)
+	GetAllArticles(ctx context.Context) (GetAllArticlesResponse, error)
+	StreamArticles(ctx context.Context, fn func(article Article) error) error
+	UpdateArticle(ctx context.Context, req UpdateArticleRequest) (Article, error)
+}
+
+type SuppliersStore interface {
+	CreateSupplier(ctx context.Context, req CreateSupplierRequest) (Supplier, error)
+	GetAllSuppliers(ctx context.Context) (GetAllSuppliersResponse, error)
+	CreateOrUpdateArticleSupplier(ctx context.Context, req ArticleSupplier) error
+	GetArticleSuppliers(ctx context.Context, supplierID string) (GetArticleSuppliersResponse, error)
+}
+
+type PurchaseOrdersStore interface {
+	CreatePurchaseOrder(ctx context.Context, req CreatePurchaseOrderRequest) (PurchaseOrder, error)
+	GetPurchaseOrder(ctx context.Context, purchaseOrderID string) (PurchaseOrder, error)
+	UpdatePurchaseOrderState(ctx context.Context, req UpdatePurchaseOrderStateRequest) (PurchaseOrder, error)
+	ReceivePurchaseOrder(ctx context.Context, req ReceivePurchaseOrderRequest) (PurchaseOrder, error)
+}
+
+type ReplenishmentStore interface {
+	UpdateArticleReplenishment(ctx context.Context, req ArticleReplenishment) error
+	GetReplenishmentCandidates(
+		ctx context.Context,
+		req GetReplenishmentCandidatesRequest,
+	) (GetReplenishmentCandidatesResponse, error)
+	GetTenants(ctx context.Context) ([]string, error)
+	CreateReservation(ctx context.Context, req Reservation) (Reservation, error)
+	DeleteReservation(ctx context.Context, reservationID string) error
+}
+
+type WebhooksStore interface {
+	CreateWebhookSubscription(ctx context.Context, req WebhookSubscription) (WebhookSubscription, error)
+	GetAllWebhookSubscriptions(ctx context.Context) (GetAllWebhookSubscriptionsResponse, error)
+	DeleteWebhookSubscription(ctx context.Context, subscriptionID string) error
+	ClaimWebhookDeliveries(ctx context.Context, req ClaimWebhookDeliveriesRequest) (ClaimWebhookDeliveriesResponse, error)
+	MarkWebhookDelivered(ctx context.Context, deliveryID int64) error
+	FailWebhookDelivery(ctx context.Context, req FailWebhookDeliveryRequest) error
+}
+
+type OutboxStore interface {
+	ProcessOutboxEvents(ctx context.Context, req ProcessOutboxEventsRequest) error
+	GetOutboxEvents(ctx context.Context, req GetOutboxEventsRequest) ([]OutboxEvent, error)
+	// ListenOutboxEvents calls fn for every outbox event committed from now on
+	// until ctx is cancelled.
+	ListenOutboxEvents(ctx context.Context, fn func(OutboxEvent)) error
+}
+
+type IdempotencyStore interface {
+	AcquireIdempotencyKey(ctx context.Context, req AcquireIdempotencyKeyRequest) (AcquireIdempotencyKeyResponse, error)
+	CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, record IdempotencyRecord) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+type APIKeysStore interface {
+	CreateAPIKey(ctx context.Context, req CreateAPIKeyRequest) (APIKey, error)
+	GetAllAPIKeys(ctx context.Context) (GetAllAPIKeysResponse, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	RevokeAPIKey(ctx context.Context, apiKeyID string) error
+}
+
+type AuditStore interface {
+	CreateAuditRecord(ctx context.Context, record AuditRecord) error
+	GetAuditRecords(ctx context.Context, req GetAuditRecordsRequest) (GetAuditRecordsResponse, error)
+}
+
+type MetricsStore interface {
+	GetInventoryMetrics(ctx context.Context) ([]InventoryMetrics, error)
+	Stats() sql.DBStats
+	// ObserveQueries has observer called after every statement.
+	ObserveQueries(observer QueryObserver)
+}
+
+type HealthStore interface {
+	Ping(ctx context.Context) error
+	// GetLastMigration returns the file of the last changeset applied to the
+	// database.
+	GetLastMigration(ctx context.Context) (string, error)
+	// GetAppliedMigrations returns the files of the changesets applied to the
+	// database in the order they were applied.
+	GetAppliedMigrations(ctx context.Context) ([]string, error)
+	// GetOutboxBacklog counts the outbox events not published yet.
+	GetOutboxBacklog(ctx context.Context) (int64, error)
+}
+
+type AvailabilityStore interface {
+	CheckProductAvailability(ctx context.Context, fix bool) ([]ProductAvailabilityDrift, error)
+}
+
+type MigrationsStore interface {
+	// MigrateUp applies the migrations the database is missing in order and
+	// returns their names.
+	MigrateUp(ctx context.Context) ([]string, error)
+	// MigrateDown reverts the last steps migrations applied and returns their
+	// names.
+	MigrateDown(ctx context.Context, steps int) ([]string, error)
+	GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+type ReplicasStore interface {
+	// RunReplicaChecks takes unhealthy replicas out of the rotation of the
+	// reads, and back in once they recover, until ctx is cancelled.
+	RunReplicaChecks(ctx context.Context, interval, maxLag time.Duration)
 }
 
 var (
 	ErrProductNotFound      = errors.New("product not found")
 	ErrArticleNotFound      = errors.New("article not found")
 	ErrProductStockFinished = errors.New("product stock has finished")
+	ErrVersionConflict      = errors.New("resource was modified by another request")
+
+	ErrSupplierNotFound               = errors.New("supplier not found")
+	ErrPurchaseOrderNotFound          = errors.New("purchase order not found")
+	ErrPurchaseOrderLineNotFound      = errors.New("purchase order has no line for article")
+	ErrInvalidPurchaseOrderTransition = errors.New("invalid purchase order state transition")
+	ErrReceiptExceedsOrderedQuantity  = errors.New("received quantity exceeds ordered quantity")
+
+	ErrReservationNotFound = errors.New("reservation not found")
+
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+
+	ErrIdempotencyKeyUnavailable = errors.New("idempotency key kept expiring while acquiring it")
+	ErrIdempotencyKeyLost        = errors.New("idempotency key is no longer held by the request")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	ErrInvalidMigrationName  = errors.New("invalid migration file name")
+	ErrUnknownMigration      = errors.New("migration is not part of this build")
+	ErrIrreversibleMigration = errors.New("migration can't be reverted")
 )
@@ -0,0 +1,5 @@
+DROP TABLE "product_article";
+DROP TABLE "article";
+DROP TABLE "product";
+DROP FUNCTION sync_updated_at();
+DROP EXTENSION IF EXISTS "uuid-ossp";
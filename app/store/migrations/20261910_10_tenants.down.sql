@@ -0,0 +1,62 @@
+DROP FUNCTION inventory_tenants();
+
+DROP POLICY tenant_isolation ON "article";
+ALTER TABLE "article" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "article" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "product";
+ALTER TABLE "product" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "product" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "product_article";
+ALTER TABLE "product_article" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "product_article" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "supplier";
+ALTER TABLE "supplier" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "supplier" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "article_supplier";
+ALTER TABLE "article_supplier" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "article_supplier" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "purchase_order";
+ALTER TABLE "purchase_order" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "purchase_order" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "purchase_order_line";
+ALTER TABLE "purchase_order_line" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "purchase_order_line" DISABLE ROW LEVEL SECURITY;
+DROP POLICY tenant_isolation ON "stock_history";
+ALTER TABLE "stock_history" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "stock_history" DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX "api_key_tenant_id";
+DROP INDEX "outbox_event_tenant_id";
+DROP INDEX "webhook_subscription_tenant_id";
+DROP INDEX "purchase_order_tenant_id";
+DROP INDEX "supplier_tenant_id";
+DROP INDEX "product_article_tenant_id";
+DROP INDEX "product_tenant_id";
+
+-- fails when tenants share article ids or idempotency keys, their rows have to
+-- be removed first
+ALTER TABLE "idempotency_key" DROP CONSTRAINT idempotency_key_pkey;
+ALTER TABLE "idempotency_key" ADD PRIMARY KEY (idempotency_key);
+ALTER TABLE "purchase_order_line" DROP CONSTRAINT purchase_order_line_article_id_fkey;
+ALTER TABLE "article_supplier" DROP CONSTRAINT article_supplier_article_id_fkey;
+ALTER TABLE "article_supplier" DROP CONSTRAINT article_supplier_pkey;
+ALTER TABLE "article_supplier" ADD PRIMARY KEY (article_id, supplier_id);
+ALTER TABLE "article" DROP CONSTRAINT article_pkey;
+ALTER TABLE "article" ADD PRIMARY KEY (article_id);
+ALTER TABLE "article_supplier" ADD CONSTRAINT article_supplier_article_id_fkey
+    FOREIGN KEY (article_id) REFERENCES article (article_id);
+ALTER TABLE "purchase_order_line" ADD CONSTRAINT purchase_order_line_article_id_fkey
+    FOREIGN KEY (article_id) REFERENCES article (article_id);
+
+ALTER TABLE "article" DROP COLUMN tenant_id;
+ALTER TABLE "product" DROP COLUMN tenant_id;
+ALTER TABLE "product_article" DROP COLUMN tenant_id;
+ALTER TABLE "supplier" DROP COLUMN tenant_id;
+ALTER TABLE "article_supplier" DROP COLUMN tenant_id;
+ALTER TABLE "purchase_order" DROP COLUMN tenant_id;
+ALTER TABLE "purchase_order_line" DROP COLUMN tenant_id;
+ALTER TABLE "stock_history" DROP COLUMN tenant_id;
+ALTER TABLE "webhook_subscription" DROP COLUMN tenant_id;
+ALTER TABLE "outbox_event" DROP COLUMN tenant_id;
+ALTER TABLE "idempotency_key" DROP COLUMN tenant_id;
+ALTER TABLE "api_key" DROP COLUMN tenant_id;
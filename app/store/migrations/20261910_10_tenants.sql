@@ -0,0 +1,108 @@
+-- every existing row belongs to the default tenant, new rows have to name theirs
+ALTER TABLE "article" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "product" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "product_article" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "supplier" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "article_supplier" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "purchase_order" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "purchase_order_line" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "stock_history" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "webhook_subscription" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "outbox_event" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "idempotency_key" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+ALTER TABLE "api_key" ADD COLUMN tenant_id varchar(64) DEFAULT 'default' not null;
+
+ALTER TABLE "article" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "product" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "product_article" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "supplier" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "article_supplier" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "purchase_order" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "purchase_order_line" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "stock_history" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "webhook_subscription" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "outbox_event" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "idempotency_key" ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE "api_key" ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- article ids are only unique within a tenant
+ALTER TABLE "article_supplier" DROP CONSTRAINT article_supplier_article_id_fkey;
+ALTER TABLE "purchase_order_line" DROP CONSTRAINT purchase_order_line_article_id_fkey;
+ALTER TABLE "article" DROP CONSTRAINT article_pkey;
+ALTER TABLE "article" ADD PRIMARY KEY (tenant_id, article_id);
+ALTER TABLE "article_supplier" DROP CONSTRAINT article_supplier_pkey;
+ALTER TABLE "article_supplier" ADD PRIMARY KEY (tenant_id, article_id, supplier_id);
+ALTER TABLE "article_supplier" ADD CONSTRAINT article_supplier_article_id_fkey
+    FOREIGN KEY (tenant_id, article_id) REFERENCES article (tenant_id, article_id);
+ALTER TABLE "purchase_order_line" ADD CONSTRAINT purchase_order_line_article_id_fkey
+    FOREIGN KEY (tenant_id, article_id) REFERENCES article (tenant_id, article_id);
+ALTER TABLE "idempotency_key" DROP CONSTRAINT idempotency_key_pkey;
+ALTER TABLE "idempotency_key" ADD PRIMARY KEY (tenant_id, idempotency_key);
+
+CREATE INDEX "product_tenant_id" ON "product" (tenant_id);
+CREATE INDEX "product_article_tenant_id" ON "product_article" (tenant_id, article_id);
+CREATE INDEX "supplier_tenant_id" ON "supplier" (tenant_id);
+CREATE INDEX "purchase_order_tenant_id" ON "purchase_order" (tenant_id);
+CREATE INDEX "webhook_subscription_tenant_id" ON "webhook_subscription" (tenant_id);
+CREATE INDEX "outbox_event_tenant_id" ON "outbox_event" (tenant_id, event_id);
+CREATE INDEX "api_key_tenant_id" ON "api_key" (tenant_id);
+
+-- Row level security is the second line of defense behind the tenant_id
+-- conditions of the queries. The service sets app.tenant_id at the start of
+-- every transaction, rows of other tenants are neither visible nor writable.
+-- Superusers and roles with BYPASSRLS are not subject to it.
+ALTER TABLE "article" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "article" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "article"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "product" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "product" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "product"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "product_article" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "product_article" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "product_article"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "supplier" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "supplier" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "supplier"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "article_supplier" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "article_supplier" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "article_supplier"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "purchase_order" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "purchase_order" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "purchase_order"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "purchase_order_line" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "purchase_order_line" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "purchase_order_line"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE "stock_history" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "stock_history" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "stock_history"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- background jobs work through every tenant, the function runs with the
+-- rights of its owner to see past the row level security
+CREATE OR REPLACE FUNCTION inventory_tenants()
+    RETURNS SETOF varchar
+    LANGUAGE sql STABLE SECURITY DEFINER
+    SET search_path = public
+    AS $$ SELECT DISTINCT tenant_id FROM article ORDER BY tenant_id $$;
@@ -0,0 +1,47 @@
+CREATE TABLE "audit_log" (
+    audit_id bigserial PRIMARY KEY,
+    tenant_id varchar(64) not null,
+    occurred_at timestamp default now() not null,
+    actor varchar(255),
+    route varchar(100) not null,
+    request_id varchar(100) not null,
+    method varchar(10) not null,
+    path text not null,
+    resource_type varchar(50),
+    resource_id varchar(255),
+    before jsonb,
+    after jsonb,
+    outcome varchar(20) not null,
+    status_code integer
+);
+CREATE INDEX "audit_log_tenant_id_occurred_at" ON "audit_log" (tenant_id, occurred_at);
+CREATE INDEX "audit_log_tenant_id_actor" ON "audit_log" (tenant_id, actor);
+CREATE INDEX "audit_log_tenant_id_resource" ON "audit_log" (tenant_id, resource_type, resource_id);
+
+-- the audit log is append-only, records can neither be changed nor removed
+CREATE OR REPLACE FUNCTION reject_audit_log_change()
+    RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER
+    audit_log_append_only
+    BEFORE UPDATE OR DELETE ON
+    audit_log
+    FOR EACH ROW EXECUTE PROCEDURE
+    reject_audit_log_change();
+
+CREATE TRIGGER
+    audit_log_no_truncate
+    BEFORE TRUNCATE ON
+    audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE
+    reject_audit_log_change();
+
+ALTER TABLE "audit_log" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "audit_log" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "audit_log"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
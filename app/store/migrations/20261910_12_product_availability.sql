@@ -0,0 +1,38 @@
+-- how many of every product can be built from the articles in stock, kept up
+-- to date by the service whenever the stock of an article or the articles of a
+-- product change
+CREATE TABLE "product_availability" (
+    tenant_id varchar(64) not null,
+    product_id uuid not null,
+    stock integer not null,
+    updated_at timestamp default now() not null,
+    PRIMARY KEY (tenant_id, product_id)
+);
+
+-- backfill tenant by tenant, row level security hides every row from roles
+-- subject to it unless app.tenant_id is set. inventory_tenants() runs as the
+-- owner of article, which FORCE subjects to the policies too, so it is lifted
+-- until the end of the backfill
+ALTER TABLE "article" NO FORCE ROW LEVEL SECURITY;
+DO $$
+DECLARE
+    tenant varchar;
+BEGIN
+    FOR tenant IN SELECT inventory_tenants() LOOP
+        PERFORM set_config('app.tenant_id', tenant, true);
+        INSERT INTO product_availability (tenant_id, product_id, stock)
+        SELECT product_article.tenant_id, product_article.product_id, COALESCE(MIN(article.stock / product_article.article_amount), 0)
+        FROM product_article
+        LEFT JOIN article ON article.article_id = product_article.article_id AND article.tenant_id = product_article.tenant_id
+        WHERE product_article.tenant_id = tenant
+        GROUP BY product_article.tenant_id, product_article.product_id;
+    END LOOP;
+    PERFORM set_config('app.tenant_id', '', true);
+END $$;
+ALTER TABLE "article" FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE "product_availability" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "product_availability" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "product_availability"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
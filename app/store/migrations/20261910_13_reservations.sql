@@ -0,0 +1,18 @@
+-- units of a product held for orders that aren't sold yet, replenishment
+-- counts them as already gone
+CREATE TABLE "reservation" (
+    reservation_id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+    product_id uuid not null REFERENCES product (product_id),
+    quantity integer not null,
+    reference varchar(64),
+    tenant_id varchar(64) not null,
+    created_at timestamp default now() not null,
+    CONSTRAINT reservation_quantity_positive CHECK (quantity > 0)
+);
+CREATE INDEX "reservation_tenant_id" ON "reservation" (tenant_id, product_id);
+
+ALTER TABLE "reservation" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "reservation" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "reservation"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
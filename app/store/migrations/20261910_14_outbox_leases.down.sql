@@ -0,0 +1,3 @@
+DROP INDEX "outbox_event_lease_token";
+ALTER TABLE "outbox_event" DROP COLUMN lease_token;
+ALTER TABLE "outbox_event" DROP COLUMN leased_until;
@@ -0,0 +1,6 @@
+-- a dispatcher leases the events it publishes instead of holding a
+-- transaction open while it talks to the sinks
+ALTER TABLE "outbox_event" ADD COLUMN leased_until timestamp;
+ALTER TABLE "outbox_event" ADD COLUMN lease_token uuid;
+CREATE INDEX "outbox_event_lease_token" ON "outbox_event" (lease_token)
+    WHERE lease_token IS NOT NULL;
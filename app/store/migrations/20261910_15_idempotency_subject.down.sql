@@ -0,0 +1,6 @@
+-- fails when callers of a tenant share idempotency keys, their rows have to
+-- be deleted first
+ALTER TABLE "idempotency_key" DROP CONSTRAINT idempotency_key_pkey;
+ALTER TABLE "idempotency_key" ADD PRIMARY KEY (tenant_id, idempotency_key);
+ALTER TABLE "idempotency_key" DROP COLUMN lock_token;
+ALTER TABLE "idempotency_key" DROP COLUMN subject;
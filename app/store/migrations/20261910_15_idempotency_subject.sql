@@ -0,0 +1,6 @@
+-- keys are scoped by the caller as well as the tenant, and the request holding
+-- a key proves it with the lock token when storing or releasing it
+ALTER TABLE "idempotency_key" ADD COLUMN subject varchar(255) DEFAULT '' not null;
+ALTER TABLE "idempotency_key" ADD COLUMN lock_token uuid DEFAULT uuid_generate_v4() not null;
+ALTER TABLE "idempotency_key" DROP CONSTRAINT idempotency_key_pkey;
+ALTER TABLE "idempotency_key" ADD PRIMARY KEY (tenant_id, subject, idempotency_key);
@@ -0,0 +1,5 @@
+DROP FUNCTION delete_expired_idempotency_keys(double precision);
+
+DROP POLICY tenant_isolation ON "idempotency_key";
+ALTER TABLE "idempotency_key" NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE "idempotency_key" DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,29 @@
+-- idempotency keys are only used on behalf of a tenant, except by the cleanup,
+-- which runs with the rights of its owner like inventory_tenants()
+ALTER TABLE "idempotency_key" ENABLE ROW LEVEL SECURITY;
+ALTER TABLE "idempotency_key" FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON "idempotency_key"
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+CREATE OR REPLACE FUNCTION delete_expired_idempotency_keys(retention_seconds double precision)
+    RETURNS bigint
+    LANGUAGE sql VOLATILE SECURITY DEFINER
+    SET search_path = public
+    AS $$
+    WITH deleted AS (
+        DELETE FROM idempotency_key
+        WHERE created_at < now() - make_interval(secs => retention_seconds)
+        RETURNING 1
+    )
+    SELECT count(*) FROM deleted $$;
+
+-- The remaining tables stay without row level security, their queries filter
+-- by tenant_id alone:
+-- webhook_subscription and webhook_delivery are claimed across tenants by the
+-- webhook dispatcher, and webhook_delivery has no tenant_id of its own, it
+-- belongs to the tenant of its subscription.
+-- outbox_event is leased across tenants by the outbox dispatcher and read by
+-- the event hub for every connected tenant.
+-- api_key is looked up by the hash of the presented key while authenticating,
+-- before the tenant of the request is known.
@@ -0,0 +1,9 @@
+ALTER TABLE "purchase_order_line" RENAME COLUMN unit_cost_cents TO unit_cost;
+ALTER TABLE "purchase_order_line" ALTER COLUMN unit_cost DROP DEFAULT;
+ALTER TABLE "purchase_order_line" ALTER COLUMN unit_cost TYPE numeric(12,2) USING unit_cost / 100.0;
+ALTER TABLE "purchase_order_line" ALTER COLUMN unit_cost SET DEFAULT 0;
+
+ALTER TABLE "article_supplier" RENAME COLUMN unit_cost_cents TO unit_cost;
+ALTER TABLE "article_supplier" ALTER COLUMN unit_cost DROP DEFAULT;
+ALTER TABLE "article_supplier" ALTER COLUMN unit_cost TYPE numeric(12,2) USING unit_cost / 100.0;
+ALTER TABLE "article_supplier" ALTER COLUMN unit_cost SET DEFAULT 0;
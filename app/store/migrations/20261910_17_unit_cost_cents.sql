@@ -0,0 +1,11 @@
+-- costs are kept in cents, binary floating point can't hold most of them and
+-- sums of them drift
+ALTER TABLE "article_supplier" ALTER COLUMN unit_cost DROP DEFAULT;
+ALTER TABLE "article_supplier" ALTER COLUMN unit_cost TYPE bigint USING round(unit_cost * 100);
+ALTER TABLE "article_supplier" ALTER COLUMN unit_cost SET DEFAULT 0;
+ALTER TABLE "article_supplier" RENAME COLUMN unit_cost TO unit_cost_cents;
+
+ALTER TABLE "purchase_order_line" ALTER COLUMN unit_cost DROP DEFAULT;
+ALTER TABLE "purchase_order_line" ALTER COLUMN unit_cost TYPE bigint USING round(unit_cost * 100);
+ALTER TABLE "purchase_order_line" ALTER COLUMN unit_cost SET DEFAULT 0;
+ALTER TABLE "purchase_order_line" RENAME COLUMN unit_cost TO unit_cost_cents;
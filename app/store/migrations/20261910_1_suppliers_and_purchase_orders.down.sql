@@ -0,0 +1,5 @@
+DROP TABLE "stock_history";
+DROP TABLE "purchase_order_line";
+DROP TABLE "purchase_order";
+DROP TABLE "article_supplier";
+DROP TABLE "supplier";
@@ -0,0 +1,82 @@
+CREATE TABLE "supplier" (
+    supplier_id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+    supplier_name varchar(50) not null,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null
+);
+
+CREATE TABLE "article_supplier" (
+    article_id varchar(10) not null REFERENCES article (article_id),
+    supplier_id uuid not null REFERENCES supplier (supplier_id),
+    supplier_sku varchar(30) not null,
+    lead_time_days integer DEFAULT 0 not null,
+    unit_cost numeric(12,2) DEFAULT 0 not null,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null,
+    PRIMARY KEY (article_id,supplier_id),
+    CONSTRAINT lead_time_nonnegative CHECK (lead_time_days >= 0),
+    CONSTRAINT unit_cost_nonnegative CHECK (unit_cost >= 0)
+);
+CREATE INDEX "article_supplier_supplier_id" ON "article_supplier" (supplier_id);
+
+CREATE TABLE "purchase_order" (
+    purchase_order_id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+    supplier_id uuid not null REFERENCES supplier (supplier_id),
+    state varchar(20) DEFAULT 'draft' not null,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null,
+    CONSTRAINT purchase_order_state CHECK (state IN ('draft', 'sent', 'partially_received', 'closed'))
+);
+CREATE INDEX "purchase_order_supplier_id" ON "purchase_order" (supplier_id);
+
+CREATE TABLE "purchase_order_line" (
+    purchase_order_id uuid not null REFERENCES purchase_order (purchase_order_id),
+    article_id varchar(10) not null REFERENCES article (article_id),
+    quantity_ordered integer not null,
+    quantity_received integer DEFAULT 0 not null,
+    unit_cost numeric(12,2) DEFAULT 0 not null,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null,
+    PRIMARY KEY (purchase_order_id,article_id),
+    CONSTRAINT quantity_ordered_positive CHECK (quantity_ordered > 0),
+    CONSTRAINT quantity_received_in_range CHECK (quantity_received >= 0 AND quantity_received <= quantity_ordered)
+);
+CREATE INDEX "purchase_order_line_article_id" ON "purchase_order_line" (article_id);
+
+CREATE TABLE "stock_history" (
+    stock_history_id bigserial PRIMARY KEY,
+    article_id varchar(10) not null,
+    delta integer not null,
+    reason varchar(20) not null,
+    reference varchar(64),
+    created_at timestamp default now() not null
+);
+CREATE INDEX "stock_history_article_id" ON "stock_history" (article_id, created_at);
+
+CREATE TRIGGER
+    supplier_updated_at
+    BEFORE UPDATE ON
+    supplier
+    FOR EACH ROW EXECUTE PROCEDURE
+    sync_updated_at();
+
+CREATE TRIGGER
+    article_supplier_updated_at
+    BEFORE UPDATE ON
+    article_supplier
+    FOR EACH ROW EXECUTE PROCEDURE
+    sync_updated_at();
+
+CREATE TRIGGER
+    purchase_order_updated_at
+    BEFORE UPDATE ON
+    purchase_order
+    FOR EACH ROW EXECUTE PROCEDURE
+    sync_updated_at();
+
+CREATE TRIGGER
+    purchase_order_line_updated_at
+    BEFORE UPDATE ON
+    purchase_order_line
+    FOR EACH ROW EXECUTE PROCEDURE
+    sync_updated_at();
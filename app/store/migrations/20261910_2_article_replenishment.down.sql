@@ -0,0 +1,7 @@
+DROP INDEX "stock_history_reason_created_at";
+DROP INDEX "purchase_order_state";
+
+ALTER TABLE "article"
+    DROP COLUMN reorder_point,
+    DROP COLUMN safety_stock,
+    DROP COLUMN reorder_quantity;
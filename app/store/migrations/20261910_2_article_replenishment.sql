@@ -0,0 +1,10 @@
+ALTER TABLE "article"
+    ADD COLUMN reorder_point integer DEFAULT 0 not null,
+    ADD COLUMN safety_stock integer DEFAULT 0 not null,
+    ADD COLUMN reorder_quantity integer DEFAULT 0 not null,
+    ADD CONSTRAINT reorder_point_nonnegative CHECK (reorder_point >= 0),
+    ADD CONSTRAINT safety_stock_nonnegative CHECK (safety_stock >= 0),
+    ADD CONSTRAINT reorder_quantity_nonnegative CHECK (reorder_quantity >= 0);
+
+CREATE INDEX "purchase_order_state" ON "purchase_order" (state);
+CREATE INDEX "stock_history_reason_created_at" ON "stock_history" (reason, created_at);
@@ -0,0 +1,30 @@
+CREATE TABLE "webhook_subscription" (
+    subscription_id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+    url varchar(2048) not null,
+    secret varchar(128) not null,
+    event_types text[] not null,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null
+);
+
+CREATE TABLE "webhook_delivery" (
+    delivery_id bigserial PRIMARY KEY,
+    subscription_id uuid not null REFERENCES webhook_subscription (subscription_id) ON DELETE CASCADE,
+    event_type varchar(50) not null,
+    payload jsonb not null,
+    attempts integer DEFAULT 0 not null,
+    next_attempt_at timestamp default now() not null,
+    last_error text,
+    delivered_at timestamp,
+    failed_at timestamp,
+    created_at timestamp default now() not null
+);
+CREATE INDEX "webhook_delivery_pending" ON "webhook_delivery" (next_attempt_at)
+    WHERE delivered_at IS NULL AND failed_at IS NULL;
+
+CREATE TRIGGER
+    webhook_subscription_updated_at
+    BEFORE UPDATE ON
+    webhook_subscription
+    FOR EACH ROW EXECUTE PROCEDURE
+    sync_updated_at();
@@ -0,0 +1,11 @@
+CREATE TABLE "outbox_event" (
+    event_id bigserial PRIMARY KEY,
+    aggregate_type varchar(30) not null,
+    aggregate_id varchar(64) not null,
+    event_type varchar(50) not null,
+    payload jsonb not null,
+    created_at timestamp default now() not null,
+    published_at timestamp
+);
+CREATE INDEX "outbox_event_unpublished" ON "outbox_event" (event_id)
+    WHERE published_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TRIGGER outbox_event_notify ON "outbox_event";
+DROP FUNCTION notify_outbox_event();
@@ -0,0 +1,14 @@
+CREATE OR REPLACE FUNCTION notify_outbox_event()
+    RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('outbox_event', NEW.event_id::text);
+RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER
+    outbox_event_notify
+    AFTER INSERT ON
+    outbox_event
+    FOR EACH ROW EXECUTE PROCEDURE
+    notify_outbox_event();
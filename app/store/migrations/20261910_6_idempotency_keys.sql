@@ -0,0 +1,11 @@
+CREATE TABLE "idempotency_key" (
+    idempotency_key varchar(255) PRIMARY KEY,
+    request_hash varchar(64) not null,
+    completed boolean DEFAULT false not null,
+    status_code integer,
+    content_type varchar(100),
+    response_body bytea,
+    locked_at timestamp default now() not null,
+    created_at timestamp default now() not null
+);
+CREATE INDEX "idempotency_key_created_at" ON "idempotency_key" (created_at);
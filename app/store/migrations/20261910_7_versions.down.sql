@@ -0,0 +1,6 @@
+DROP TRIGGER product_version ON "product";
+DROP TRIGGER article_version ON "article";
+DROP FUNCTION bump_version();
+
+ALTER TABLE "product" DROP COLUMN version;
+ALTER TABLE "article" DROP COLUMN version;
@@ -0,0 +1,27 @@
+ALTER TABLE "article"
+    ADD COLUMN version integer DEFAULT 1 not null;
+
+ALTER TABLE "product"
+    ADD COLUMN version integer DEFAULT 1 not null;
+
+CREATE OR REPLACE FUNCTION bump_version()
+    RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER
+    article_version
+    BEFORE UPDATE ON
+    article
+    FOR EACH ROW EXECUTE PROCEDURE
+    bump_version();
+
+CREATE TRIGGER
+    product_version
+    BEFORE UPDATE ON
+    product
+    FOR EACH ROW EXECUTE PROCEDURE
+    bump_version();
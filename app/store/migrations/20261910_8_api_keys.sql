@@ -0,0 +1,18 @@
+CREATE TABLE "api_key" (
+    api_key_id uuid DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name varchar(100) not null,
+    key_prefix varchar(16) not null,
+    key_hash varchar(64) not null,
+    scopes text[] not null,
+    revoked_at timestamp,
+    created_at timestamp default now() not null,
+    updated_at timestamp default now() not null,
+    CONSTRAINT unique_api_key_hash UNIQUE (key_hash)
+);
+
+CREATE TRIGGER
+    api_key_updated_at
+    BEFORE UPDATE ON
+    api_key
+    FOR EACH ROW EXECUTE PROCEDURE
+    sync_updated_at();
@@ -0,0 +1 @@
+ALTER TABLE "stock_history" DROP COLUMN actor;
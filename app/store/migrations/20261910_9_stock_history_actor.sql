@@ -0,0 +1,2 @@
+ALTER TABLE "stock_history"
+    ADD COLUMN actor varchar(255);
@@ -4,11 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	_ "github.com/lib/pq" // this is required to sql driver
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/tracing"
 )
 
 type Credentials struct {
@@ -18,78 +26,307 @@ type Credentials struct {
 
 type PostgresDB struct {
 	Database *sql.DB
+	// ProductLowStockThreshold is the buildable stock under which a
+	// product.below_threshold event is raised, 0 disables the event.
+	ProductLowStockThreshold int
+	// dsn is kept for connections that can't come from the pool, like LISTEN.
+	dsn string
+	// observer holds the QueryObserver, if any.
+	observer atomic.Value
+	// txRetries is how many times inTx runs a transaction again after a
+	// transient error.
+	txRetries int
+	// replicas get the reads of inReadTx, nextReplica takes turns between
+	// them.
+	replicas    []*replica
+	nextReplica uint32
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx so that read helpers can
+// run either standalone or as part of a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
+const (
+	pqForeignKeyViolation       = "23503"
+	pqInvalidTextRepresentation = "22P02"
+	pqSerializationFailure      = "40001"
+	pqDeadlockDetected          = "40P01"
+)
+
+const (
+	connectBackoffMin = 250 * time.Millisecond
+	connectBackoffMax = 10 * time.Second
+)
+
 func (pg *PostgresDB) Ping(ctx context.Context) error {
-	return pg.Database.Ping()
+	ctx, span := startSpan(ctx, "Ping")
+	defer span.End()
+	return pg.Database.PingContext(ctx)
+}
+
+// startSpan traces a method of PostgresDB, inTx does so for the methods
+// running a transaction.
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "PostgresDB."+method)
 }
 
 func (pg *PostgresDB) Close() error {
+	pg.closeReplicas()
 	return pg.Database.Close()
 }
 
-func NewPostgresDB(port int, host, dbname, credentialJSONFile string) (*PostgresDB, error) {
-	cred, err := credentialsFromFile(credentialJSONFile)
+// Config locates the database and tunes the connections to it. Zero values
+// keep the defaults of database/sql and postgres.
+type Config struct {
+	Host                string
+	Port                int
+	DB                  string
+	CredentialsFileName string
+	// SSLMode is one of the libpq sslmode values, disable when empty.
+	SSLMode string
+	// SSLRootCert is the file of the CA that verifies the server in the
+	// verify-ca and verify-full modes.
+	SSLRootCert     string
+	ApplicationName string
+	// ConnectTimeout bounds opening a connection, it is rounded up to
+	// seconds.
+	ConnectTimeout time.Duration
+	// StatementTimeout makes postgres cancel statements running longer.
+	StatementTimeout time.Duration
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	ConnMaxIdleTime  time.Duration
+	// TxRetries is how many times a transaction failing with a transient
+	// error is run again.
+	TxRetries int
+	// ReplicaDSNs are the connection strings of read replicas, they get the
+	// same pool settings as the primary.
+	ReplicaDSNs []string
+}
+
+func NewPostgresDB(cfg Config) (*PostgresDB, error) {
+	cred, err := credentialsFromFile(cfg.CredentialsFileName)
 	if err != nil {
-		log.Error().AnErr("error", err).Msgf("failed to read credentials from file: %v", credentialJSONFile)
+		log.Error().AnErr("error", err).Msgf("failed to read credentials from file: %v", cfg.CredentialsFileName)
 		return nil, err
 	}
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		host, port, cred.Username, cred.Password, dbname)
+	psqlInfo := dataSourceName(cfg, cred)
 
-	db, err := sql.Open("postgres", psqlInfo)
+	connector, err := pq.NewConnector(psqlInfo)
 	if err != nil {
-		log.Error().AnErr("error", err).Msgf("failed to connect to database with address: %v:%v", host, port)
+		log.Error().AnErr("error", err).Msgf("failed to connect to database with address: %v:%v", cfg.Host, cfg.Port)
 		return nil, err
 	}
-	return &PostgresDB{
-		Database: db,
-	}, nil
+	pg := &PostgresDB{dsn: psqlInfo, txRetries: cfg.TxRetries}
+	pg.Database = sql.OpenDB(&observedConnector{Connector: connector, pg: pg})
+	pg.Database.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		pg.Database.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	pg.Database.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pg.Database.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	err = pg.openReplicas(cfg)
+	if err != nil {
+		log.Error().AnErr("error", err).Msg("failed to connect to the replicas")
+		pg.closeReplicas()
+		_ = pg.Database.Close()
+		return nil, err
+	}
+	return pg, nil
+}
+
+// dataSourceName builds the libpq connection string, quoting every value.
+func dataSourceName(cfg Config, cred *Credentials) string {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	params := []string{
+		"host=" + quoteDSNValue(cfg.Host),
+		"port=" + strconv.Itoa(cfg.Port),
+		"user=" + quoteDSNValue(cred.Username),
+		"password=" + quoteDSNValue(cred.Password),
+		"dbname=" + quoteDSNValue(cfg.DB),
+		"sslmode=" + quoteDSNValue(sslMode),
+	}
+	if cfg.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSNValue(cfg.SSLRootCert))
+	}
+	if cfg.ApplicationName != "" {
+		params = append(params, "application_name="+quoteDSNValue(cfg.ApplicationName))
+	}
+	if cfg.ConnectTimeout > 0 {
+		seconds := int64((cfg.ConnectTimeout + time.Second - 1) / time.Second)
+		params = append(params, "connect_timeout="+strconv.FormatInt(seconds, 10))
+	}
+	if cfg.StatementTimeout > 0 {
+		// unknown keys are sent to postgres as run-time parameters
+		params = append(params, "statement_timeout="+strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
+	return strings.Join(params, " ")
+}
+
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// WaitForConnection pings the database until it answers, waiting twice as
+// long after every failure, or until ctx is done.
+func (pg *PostgresDB) WaitForConnection(ctx context.Context) error {
+	wait := connectBackoffMin
+	for {
+		err := pg.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		log.Ctx(ctx).Warn().AnErr("error", err).Dur("retryIn", wait).Msg("database is not reachable yet")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if wait > connectBackoffMax {
+			wait = connectBackoffMax
+		}
+	}
 }
 
 func (pg *PostgresDB) RemoveProductAndUpdateArticles(
 	ctx context.Context,
 	req RemoveProductAndUpdateArticlesRequest,
 ) error {
-	productArticles, err := pg.getProductArticlesByProductID(ctx, req.ProductID)
-	if err != nil {
-		log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to get product_article by product id")
-		return err
-	}
-	tx, err := pg.Database.Begin()
-	if err != nil {
-		log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to start transaction")
-		return err
-	}
-	defer func() {
+	return pg.inTx(ctx, "RemoveProductAndUpdateArticles", func(tx *sql.Tx) error {
+		productArticles, err := getProductArticles(ctx, tx, req.ProductID)
 		if err != nil {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil {
-				log.Ctx(ctx).Err(rollbackErr).Msg("error happened when rolling back tx in RemoveProductAndUpdateArticles")
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to get product_article by product id")
+			return err
+		}
+		if len(productArticles) == 0 {
+			return ErrProductNotFound
+		}
+		articleIDs := make([]string, 0, len(productArticles))
+		for _, productArticle := range productArticles {
+			articleIDs = append(articleIDs, productArticle.ArticleID)
+		}
+		// locking the articles serializes concurrent sells of products sharing them
+		articlesBefore, err := lockArticlesStock(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to lock articles")
+			return err
+		}
+		productsBefore, err := getProductsStock(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to get products stock")
+			return err
+		}
+		if productsBefore[req.ProductID] < 1 {
+			return ErrProductStockFinished
+		}
+		// TODO: enhance query so that all article updates happen in a single query
+		for _, productArticle := range productArticles {
+			before, err := auditedArticle.snapshot(ctx, tx, productArticle.ArticleID)
+			if err != nil {
+				return err
+			}
+			var stock int
+			err = tx.QueryRowContext(
+				ctx,
+				updateArticleStockForSellProduct,
+				productArticle.ArticleAmount,
+				productArticle.ArticleID,
+				TenantFromContext(ctx),
+			).Scan(&stock)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to update article")
+				return err
+			}
+			_, err = tx.ExecContext(
+				ctx,
+				createStockHistory,
+				productArticle.ArticleID,
+				-productArticle.ArticleAmount,
+				StockHistoryReasonSale,
+				req.ProductID,
+				actorFromContext(ctx),
+				TenantFromContext(ctx),
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to write stock_history")
+				return err
+			}
+			err = writeOutboxEvent(
+				ctx,
+				tx,
+				OutboxAggregateArticle,
+				productArticle.ArticleID,
+				OutboxEventArticleUpdated,
+				ArticleEventPayload{ArticleID: productArticle.ArticleID, Stock: stock},
+			)
+			if err != nil {
+				return err
+			}
+			err = auditedArticle.record(ctx, tx, productArticle.ArticleID, before, productArticle.ArticleID)
+			if err != nil {
+				return err
 			}
-		} else {
-			err = tx.Commit()
 		}
-	}()
-	// TODO: enhance query so that all article updates happen in a single query
-	for _, productArticle := range productArticles {
-		_, err = tx.Exec(updateArticleStockForSellProduct, productArticle.ArticleAmount, productArticle.ArticleID)
+		err = writeOutboxEvent(
+			ctx,
+			tx,
+			OutboxAggregateProduct,
+			req.ProductID,
+			OutboxEventProductSold,
+			ProductEventPayload{ProductID: req.ProductID, Articles: productArticles},
+		)
 		if err != nil {
-			log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to update article")
 			return err
 		}
-	}
-
-	return nil
+		productsAfter, err := refreshProductAvailability(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to update product availability")
+			return err
+		}
+		articlesAfter := make(map[string]articleStock, len(articlesBefore))
+		for articleID, article := range articlesBefore {
+			articlesAfter[articleID] = article
+		}
+		for _, productArticle := range productArticles {
+			article := articlesAfter[productArticle.ArticleID]
+			article.stock -= productArticle.ArticleAmount
+			articlesAfter[productArticle.ArticleID] = article
+		}
+		err = writeProductStockChanges(ctx, tx, productsBefore, productsAfter)
+		if err != nil {
+			return err
+		}
+		events := sellEvents(req.ProductID, pg.ProductLowStockThreshold, productsBefore, productsAfter, articlesBefore, articlesAfter)
+		for _, event := range events {
+			err = enqueueWebhookEvent(ctx, tx, event)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("sell product, failed to enqueue webhook event")
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (pg *PostgresDB) getProductArticlesByProductID(ctx context.Context, productID string) ([]ProductArticle, error) {
-	rows, err := pg.Database.Query(getProductArticlesByProductID, productID)
+func getProductArticles(ctx context.Context, q queryer, productID string) ([]ProductArticle, error) {
+	rows, err := q.QueryContext(ctx, getProductArticlesByProductID, productID, TenantFromContext(ctx))
 	if err != nil {
+		if pqErrorCode(err) == pqInvalidTextRepresentation {
+			return nil, ErrProductNotFound
+		}
 		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get product_article by product_id")
 		return nil, err
 	}
+	defer rows.Close()
 	productArticles := make([]ProductArticle, 0)
 	for rows.Next() {
 		var productArticle ProductArticle
@@ -100,74 +337,357 @@ func (pg *PostgresDB) getProductArticlesByProductID(ctx context.Context, product
 		}
 		productArticles = append(productArticles, productArticle)
 	}
-	return productArticles, nil
+	return productArticles, rows.Err()
 }
 
-func (pg *PostgresDB) GetAllProducts(ctx context.Context) (GetAllProductsResponse, error) {
-	rows, err := pg.Database.Query(getProductsWithStock)
+// setProductsArticles fills the articles of products with those of every
+// product of the tenant, in one query.
+func setProductsArticles(ctx context.Context, q queryer, products []Product) error {
+	rows, err := q.QueryContext(ctx, getAllProductArticles, TenantFromContext(ctx))
 	if err != nil {
-		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all products")
-		return GetAllProductsResponse{}, err
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all product_article")
+		return err
+	}
+	defer rows.Close()
+	productArticles := make(map[string][]ProductArticle)
+	for rows.Next() {
+		var productID string
+		var productArticle ProductArticle
+		err = rows.Scan(&productID, &productArticle.ArticleID, &productArticle.ArticleAmount)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all product_article")
+			return err
+		}
+		productArticles[productID] = append(productArticles[productID], productArticle)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for i := range products {
+		products[i].Articles = productArticles[products[i].ProductID]
+	}
+	return nil
+}
+
+type articleStock struct {
+	stock        int
+	reorderPoint int
+}
+
+func lockArticlesStock(ctx context.Context, q queryer, articleIDs []string) (map[string]articleStock, error) {
+	rows, err := q.QueryContext(ctx, getArticlesStockForUpdate, pq.Array(articleIDs), TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	articles := make(map[string]articleStock, len(articleIDs))
+	for rows.Next() {
+		var articleID string
+		var article articleStock
+		err = rows.Scan(&articleID, &article.stock, &article.reorderPoint)
+		if err != nil {
+			return nil, err
+		}
+		articles[articleID] = article
+	}
+	return articles, rows.Err()
+}
+
+// getProductsStock returns the buildable stock of every product that uses at
+// least one of articleIDs.
+func getProductsStock(ctx context.Context, q queryer, articleIDs []string) (map[string]int, error) {
+	rows, err := q.QueryContext(ctx, getProductsStockByArticleIDs, pq.Array(articleIDs), TenantFromContext(ctx))
+	if err != nil {
+		return nil, err
 	}
-	products := make([]Product, 0)
+	defer rows.Close()
+	products := make(map[string]int)
 	for rows.Next() {
-		var product Product
-		err = rows.Scan(&product.ProductID, &product.Stock)
+		var productID string
+		var stock int
+		err = rows.Scan(&productID, &stock)
 		if err != nil {
-			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all products")
-			return GetAllProductsResponse{}, err
+			return nil, err
 		}
-		products = append(products, product)
+		products[productID] = stock
+	}
+	return products, rows.Err()
+}
+
+func (pg *PostgresDB) GetAllProducts(ctx context.Context) (GetAllProductsResponse, error) {
+	var products []Product
+	err := pg.inReadTx(ctx, "GetAllProducts", func(tx *sql.Tx) error {
+		products = make([]Product, 0)
+		rows, err := tx.QueryContext(ctx, getProductsWithStock, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all products")
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var product Product
+			err = rows.Scan(&product.ProductID, &product.ProductName, &product.Version, &product.Stock)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all products")
+				return err
+			}
+			products = append(products, product)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return setProductsArticles(ctx, tx, products)
+	})
+	if err != nil {
+		return GetAllProductsResponse{}, err
 	}
-	log.Info().Msgf("####################### products: %v", products)
 	return GetAllProductsResponse{
 		Products: products,
 	}, nil
 }
 
 func (pg *PostgresDB) CreateOrUpdateProducts(ctx context.Context, req CreateOrUpdateProductsRequest) error {
-	tx, err := pg.Database.Begin()
-	if err != nil {
-		log.Ctx(ctx).Error().AnErr("error", err).Msg("create or update products, failed to start transaction")
-		return err
-	}
-	defer func() {
+	return pg.inTx(ctx, "CreateOrUpdateProducts", func(tx *sql.Tx) error {
+		_, productsBefore, productsAfter, err := createProducts(ctx, tx, req)
 		if err != nil {
-			rollbackErr := tx.Rollback()
-			if rollbackErr != nil {
-				log.Ctx(ctx).Err(rollbackErr).Msg("error happened when rolling back tx in CreateOrUpdateProducts")
-			}
-		} else {
-			err = tx.Commit()
+			return err
 		}
-	}()
+		return writeProductStockChanges(ctx, tx, productsBefore, productsAfter)
+	})
+}
+
+// createProducts creates the products of req with tx. It returns their ids
+// and the stock of the products using their articles before and after.
+func createProducts(
+	ctx context.Context,
+	tx *sql.Tx,
+	req CreateOrUpdateProductsRequest,
+) (productIDs []string, productsBefore, productsAfter map[string]int, err error) {
+	articleIDs := make([]string, 0)
+	for _, product := range req.Products {
+		for _, article := range product.Articles {
+			articleIDs = append(articleIDs, article.ArticleID)
+		}
+	}
+	productsBefore, err = getProductsStock(ctx, tx, articleIDs)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("create or update products, failed to get products stock")
+		return nil, nil, nil, err
+	}
+	productIDs = make([]string, 0, len(req.Products))
 	for _, product := range req.Products {
 		var productID string
-		err := tx.QueryRow(createProduct, product.ProductName).Scan(&productID)
+		err = tx.QueryRowContext(ctx, createProduct, product.ProductName, TenantFromContext(ctx)).Scan(&productID)
 		if err != nil {
 			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create product")
-			return err
+			return nil, nil, nil, err
 		}
 		for _, article := range product.Articles {
-			_, err = tx.Exec(createProductArticle, productID, article.ArticleID, article.ArticleAmount)
+			_, err = tx.ExecContext(
+				ctx,
+				createProductArticle,
+				productID,
+				article.ArticleID,
+				article.ArticleAmount,
+				TenantFromContext(ctx),
+			)
 			if err != nil {
 				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create product_article")
-				return err
+				return nil, nil, nil, err
 			}
 		}
+		err = writeOutboxEvent(
+			ctx,
+			tx,
+			OutboxAggregateProduct,
+			productID,
+			OutboxEventProductCreated,
+			ProductEventPayload{ProductID: productID, Name: product.ProductName, Articles: product.Articles},
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = auditedProduct.record(ctx, tx, productID, nil, productID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		productIDs = append(productIDs, productID)
 	}
-	return nil
+	productsAfter, err = refreshProductAvailability(ctx, tx, articleIDs)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("create or update products, failed to update product availability")
+		return nil, nil, nil, err
+	}
+	return productIDs, productsBefore, productsAfter, nil
 }
 
 func (pg *PostgresDB) CreateOrUpdateArticles(ctx context.Context, req CreateOrUpdateArticlesRequest) error {
+	return pg.inTx(ctx, "CreateOrUpdateArticles", func(tx *sql.Tx) error {
+		_, productsBefore, productsAfter, err := createOrUpdateArticles(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+		return writeProductStockChanges(ctx, tx, productsBefore, productsAfter)
+	})
+}
+
+// createOrUpdateArticles writes the articles of req with tx. It returns which
+// of them it inserted and the stock of the products using them before and
+// after.
+func createOrUpdateArticles(
+	ctx context.Context,
+	tx *sql.Tx,
+	req CreateOrUpdateArticlesRequest,
+) (inserted []bool, productsBefore, productsAfter map[string]int, err error) {
+	articleIDs := make([]string, 0, len(req.Articles))
+	for _, article := range req.Articles {
+		articleIDs = append(articleIDs, article.ArticleID)
+	}
+	productsBefore, err = getProductsStock(ctx, tx, articleIDs)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("create or update articles, failed to get products stock")
+		return nil, nil, nil, err
+	}
+	inserted = make([]bool, 0, len(req.Articles))
 	for _, article := range req.Articles {
-		_, err := pg.Database.Exec(createArticle, article.ArticleID, article.Stock, article.ArticleName)
+		before, err := auditedArticle.snapshot(ctx, tx, article.ArticleID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var created bool
+		err = tx.QueryRowContext(
+			ctx,
+			createOrUpdateArticle,
+			article.ArticleID,
+			article.Stock,
+			article.ArticleName,
+			TenantFromContext(ctx),
+		).Scan(&created)
 		if err != nil {
 			log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to create article with id %v", article.ArticleID)
+			return nil, nil, nil, err
+		}
+		eventType := OutboxEventArticleUpdated
+		if created {
+			eventType = OutboxEventArticleCreated
+		}
+		err = writeOutboxEvent(
+			ctx,
+			tx,
+			OutboxAggregateArticle,
+			article.ArticleID,
+			eventType,
+			ArticleEventPayload{ArticleID: article.ArticleID, Name: article.ArticleName, Stock: article.Stock},
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = auditedArticle.record(ctx, tx, article.ArticleID, before, article.ArticleID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		inserted = append(inserted, created)
+	}
+	productsAfter, err = refreshProductAvailability(ctx, tx, articleIDs)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("create or update articles, failed to update product availability")
+		return nil, nil, nil, err
+	}
+	return inserted, productsBefore, productsAfter, nil
+}
+
+// inTx runs fn inside a transaction, committing when fn succeeds and rolling
+// back otherwise. A transaction failing with a transient error is run again,
+// so fn must not keep anything from a previous attempt. name is only used for
+// logging.
+func (pg *PostgresDB) inTx(ctx context.Context, name string, fn func(tx *sql.Tx) error) (err error) {
+	ctx, span := startSpan(ctx, name)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		retryable, err = runTx(ctx, pg.Database, nil, name, fn)
+		if err == nil || !retryable || attempt >= pg.txRetries || ctx.Err() != nil {
+			return err
+		}
+		wait := txBackoff(attempt)
+		log.Ctx(ctx).Warn().AnErr("error", err).Int("attempt", attempt+1).Dur("retryIn", wait).Msgf("%s, retrying transaction", name)
+		select {
+		case <-ctx.Done():
 			return err
+		case <-time.After(wait):
 		}
 	}
-	return nil
+}
+
+// runTx runs fn once on db, the error is retryable when the transaction
+// surely didn't commit.
+func runTx(
+	ctx context.Context,
+	db *sql.DB,
+	opts *sql.TxOptions,
+	name string,
+	fn func(tx *sql.Tx) error,
+) (retryable bool, err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s, failed to start transaction", name)
+		return isTransientError(err), err
+	}
+	trail := auditTrailFromContext(ctx)
+	var recorded bool
+	if trail != nil {
+		recorded = trail.recorded
+	}
+	defer func() {
+		if err != nil {
+			// the audit records written by fn are rolled back too
+			if trail != nil {
+				trail.recorded = recorded
+			}
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				log.Ctx(ctx).Err(rollbackErr).Msgf("error happened when rolling back tx in %s", name)
+			}
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			if trail != nil {
+				trail.recorded = recorded
+			}
+			// a commit cut off with the connection may still have succeeded
+			retryable = isConflictError(err)
+		}
+	}()
+	err = setTenantForTx(ctx, tx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("%s, failed to set tenant", name)
+		return isTransientError(err), err
+	}
+	err = fn(tx)
+	return isTransientError(err), err
+}
+
+// pqErrorCode returns the postgres SQLSTATE of err, or an empty string if err
+// did not come from the server.
+func pqErrorCode(err error) pq.ErrorCode {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code
+	}
+	return ""
+}
+
+// pqConstraint returns the name of the constraint that caused err, if any.
+func pqConstraint(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint
+	}
+	return ""
 }
 
 func credentialsFromFile(filename string) (*Credentials, error) {
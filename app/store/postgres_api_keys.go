@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+func (pg *PostgresDB) CreateAPIKey(ctx context.Context, req CreateAPIKeyRequest) (APIKey, error) {
+	apiKey := APIKey{
+		TenantID:  TenantFromContext(ctx),
+		Name:      req.Name,
+		KeyPrefix: req.KeyPrefix,
+		Scopes:    req.Scopes,
+	}
+	err := pg.inTx(ctx, "CreateAPIKey", func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			createAPIKey,
+			req.Name,
+			req.KeyPrefix,
+			req.KeyHash,
+			pq.Array(req.Scopes),
+			apiKey.TenantID,
+		).Scan(&apiKey.APIKeyID, &apiKey.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return auditedAPIKey.record(ctx, tx, apiKey.APIKeyID, nil, apiKey.APIKeyID)
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create api_key")
+		return APIKey{}, err
+	}
+	return apiKey, nil
+}
+
+func (pg *PostgresDB) GetAllAPIKeys(ctx context.Context) (GetAllAPIKeysResponse, error) {
+	ctx, span := startSpan(ctx, "GetAllAPIKeys")
+	defer span.End()
+	rows, err := pg.Database.QueryContext(ctx, getAllAPIKeys, TenantFromContext(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all api_key")
+		return GetAllAPIKeysResponse{}, err
+	}
+	defer rows.Close()
+	apiKeys := make([]APIKey, 0)
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all api_key")
+			return GetAllAPIKeysResponse{}, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return GetAllAPIKeysResponse{
+		APIKeys: apiKeys,
+	}, rows.Err()
+}
+
+// GetAPIKeyByHash returns the key with keyHash unless it was revoked. Keys
+// are looked up across tenants, the key decides which tenant the caller acts
+// for.
+func (pg *PostgresDB) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	ctx, span := startSpan(ctx, "GetAPIKeyByHash")
+	defer span.End()
+	apiKey, err := scanAPIKey(pg.Database.QueryRowContext(ctx, getActiveAPIKeyByHash, keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get api_key by hash")
+		return APIKey{}, err
+	}
+	return apiKey, nil
+}
+
+func (pg *PostgresDB) RevokeAPIKey(ctx context.Context, apiKeyID string) error {
+	return pg.inTx(ctx, "RevokeAPIKey", func(tx *sql.Tx) error {
+		before, err := auditedAPIKey.snapshot(ctx, tx, apiKeyID)
+		if pqErrorCode(err) == pqInvalidTextRepresentation {
+			return ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, revokeAPIKey, apiKeyID, TenantFromContext(ctx))
+		if err != nil {
+			if pqErrorCode(err) == pqInvalidTextRepresentation {
+				return ErrAPIKeyNotFound
+			}
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to revoke api_key")
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrAPIKeyNotFound
+		}
+		return auditedAPIKey.record(ctx, tx, apiKeyID, before, apiKeyID)
+	})
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (APIKey, error) {
+	var apiKey APIKey
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&apiKey.APIKeyID,
+		&apiKey.TenantID,
+		&apiKey.Name,
+		&apiKey.KeyPrefix,
+		pq.Array(&apiKey.Scopes),
+		&apiKey.CreatedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if revokedAt.Valid {
+		apiKey.RevokedAt = &revokedAt.Time
+	}
+	return apiKey, nil
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// auditTrail follows the changes made on behalf of one API call.
+type auditTrail struct {
+	request AuditRequest
+	// recorded is set once a transaction wrote audit records, a rollback
+	// restores it.
+	recorded bool
+}
+
+type auditKey struct{}
+
+// WithAudit makes the store record every change done with ctx in the audit
+// log, in the same transaction as the change.
+func WithAudit(ctx context.Context, req AuditRequest) context.Context {
+	return context.WithValue(ctx, auditKey{}, &auditTrail{request: req})
+}
+
+// AuditRecorded reports whether changes made with ctx were committed together
+// with their audit records.
+func AuditRecorded(ctx context.Context) bool {
+	trail, ok := ctx.Value(auditKey{}).(*auditTrail)
+	return ok && trail.recorded
+}
+
+func auditTrailFromContext(ctx context.Context) *auditTrail {
+	trail, _ := ctx.Value(auditKey{}).(*auditTrail)
+	return trail
+}
+
+// auditedResource knows how to take a snapshot of the rows of a resource.
+// The snapshot query gets the keys of the resource followed by the tenant.
+type auditedResource struct {
+	resourceType  string
+	snapshotQuery string
+}
+
+var (
+	auditedArticle             = auditedResource{AuditResourceArticle, snapshotArticle}
+	auditedProduct             = auditedResource{AuditResourceProduct, snapshotProduct}
+	auditedSupplier            = auditedResource{AuditResourceSupplier, snapshotSupplier}
+	auditedArticleSupplier     = auditedResource{AuditResourceArticleSupplier, snapshotArticleSupplier}
+	auditedPurchaseOrder       = auditedResource{AuditResourcePurchaseOrder, snapshotPurchaseOrder}
+	auditedReservation         = auditedResource{AuditResourceReservation, snapshotReservation}
+	auditedWebhookSubscription = auditedResource{AuditResourceWebhookSubscription, snapshotWebhookSubscription}
+	auditedAPIKey              = auditedResource{AuditResourceAPIKey, snapshotAPIKey}
+)
+
+// snapshot returns the current rows of the resource, nil when it doesn't
+// exist or when ctx is not audited.
+func (a auditedResource) snapshot(ctx context.Context, q queryer, keys ...interface{}) (json.RawMessage, error) {
+	if auditTrailFromContext(ctx) == nil {
+		return nil, nil
+	}
+	var snapshot []byte
+	err := q.QueryRowContext(ctx, a.snapshotQuery, append(keys, TenantFromContext(ctx))...).Scan(&snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to take snapshot of %s", a.resourceType)
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// record writes the change of the resource from before to its current rows
+// to the audit log.
+func (a auditedResource) record(
+	ctx context.Context,
+	q queryer,
+	resourceID string,
+	before json.RawMessage,
+	keys ...interface{},
+) error {
+	if auditTrailFromContext(ctx) == nil {
+		return nil
+	}
+	after, err := a.snapshot(ctx, q, keys...)
+	if err != nil {
+		return err
+	}
+	return writeAuditRecord(ctx, q, AuditRecord{
+		ResourceType: a.resourceType,
+		ResourceID:   resourceID,
+		Before:       before,
+		After:        after,
+		Outcome:      AuditOutcomeSuccess,
+	})
+}
+
+func writeAuditRecord(ctx context.Context, q queryer, record AuditRecord) error {
+	trail := auditTrailFromContext(ctx)
+	if trail == nil {
+		return nil
+	}
+	_, err := q.ExecContext(
+		ctx,
+		createAuditRecord,
+		TenantFromContext(ctx),
+		actorFromContext(ctx),
+		trail.request.Route,
+		trail.request.RequestID,
+		trail.request.Method,
+		trail.request.Path,
+		nullString(record.ResourceType),
+		nullString(record.ResourceID),
+		nullJSON(record.Before),
+		nullJSON(record.After),
+		record.Outcome,
+		sql.NullInt64{Int64: int64(record.StatusCode), Valid: record.StatusCode != 0},
+	)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to write audit_log")
+		return err
+	}
+	trail.recorded = true
+	return nil
+}
+
+// CreateAuditRecord records the outcome of an API call that didn't commit
+// any change, like a rejected request.
+func (pg *PostgresDB) CreateAuditRecord(ctx context.Context, record AuditRecord) error {
+	return pg.inTx(ctx, "CreateAuditRecord", func(tx *sql.Tx) error {
+		return writeAuditRecord(ctx, tx, record)
+	})
+}
+
+func (pg *PostgresDB) GetAuditRecords(ctx context.Context, req GetAuditRecordsRequest) (GetAuditRecordsResponse, error) {
+	var records []AuditRecord
+	err := pg.inReadTx(ctx, "GetAuditRecords", func(tx *sql.Tx) error {
+		records = make([]AuditRecord, 0)
+		rows, err := tx.QueryContext(
+			ctx,
+			getAuditRecords,
+			req.Actor,
+			req.ResourceType,
+			req.ResourceID,
+			nullTime(req.From),
+			nullTime(req.To),
+			req.BeforeID,
+			req.Limit,
+			TenantFromContext(ctx),
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get audit_log")
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var record AuditRecord
+			var before, after []byte
+			err = rows.Scan(
+				&record.AuditID,
+				&record.OccurredAt,
+				&record.Actor,
+				&record.Route,
+				&record.RequestID,
+				&record.Method,
+				&record.Path,
+				&record.ResourceType,
+				&record.ResourceID,
+				&before,
+				&after,
+				&record.Outcome,
+				&record.StatusCode,
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan audit_log")
+				return err
+			}
+			record.Before = before
+			record.After = after
+			records = append(records, record)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return GetAuditRecordsResponse{}, err
+	}
+	return GetAuditRecordsResponse{
+		Records: records,
+	}, nil
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func nullJSON(value json.RawMessage) interface{} {
+	if value == nil {
+		return nil
+	}
+	return string(value)
+}
+
+func nullTime(value *time.Time) sql.NullTime {
+	if value == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: value.UTC(), Valid: true}
+}
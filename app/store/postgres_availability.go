@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// refreshProductAvailability brings product_availability up to date for the
+// products using the articles and returns their stock. Their rows are locked
+// first, so that of two transactions changing articles of the same product
+// the last one to commit writes what both changed.
+func refreshProductAvailability(ctx context.Context, q queryer, articleIDs []string) (map[string]int, error) {
+	tenant := TenantFromContext(ctx)
+	rows, err := q.QueryContext(ctx, lockProductAvailabilityByArticleIDs, pq.Array(articleIDs), tenant)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to lock product_availability")
+		return nil, err
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	products, err := getProductsStock(ctx, q, articleIDs)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get products stock")
+		return nil, err
+	}
+	if len(products) == 0 {
+		return products, nil
+	}
+	productIDs := make([]string, 0, len(products))
+	stocks := make([]int64, 0, len(products))
+	for _, productID := range sortedKeys(products) {
+		productIDs = append(productIDs, productID)
+		stocks = append(stocks, int64(products[productID]))
+	}
+	_, err = q.ExecContext(ctx, upsertProductAvailability, tenant, pq.Array(productIDs), pq.Array(stocks))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to update product_availability")
+		return nil, err
+	}
+	return products, nil
+}
+
+// deleteOrphanedAvailability removes the products that no longer use
+// any article, they can't be built anymore.
+func deleteOrphanedAvailability(ctx context.Context, q queryer, productIDs []string) error {
+	_, err := q.ExecContext(ctx, deleteOrphanedProductAvailability, pq.Array(productIDs), TenantFromContext(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to delete orphaned product_availability")
+	}
+	return err
+}
+
+// CheckProductAvailability recomputes the availability of every product from
+// scratch and returns the ones product_availability disagrees with. fix
+// overwrites them with the recomputed stock.
+func (pg *PostgresDB) CheckProductAvailability(ctx context.Context, fix bool) ([]ProductAvailabilityDrift, error) {
+	ctx, span := startSpan(ctx, "CheckProductAvailability")
+	defer span.End()
+	tenants, err := pg.GetTenants(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("check product availability, failed to get tenants")
+		return nil, err
+	}
+	drifts := make([]ProductAvailabilityDrift, 0)
+	for _, tenant := range tenants {
+		tenantCtx := WithTenant(ctx, tenant)
+		var tenantDrifts []ProductAvailabilityDrift
+		err = pg.inTx(tenantCtx, "CheckProductAvailability", func(tx *sql.Tx) error {
+			var err error
+			tenantDrifts, err = getProductAvailabilityDrifts(tenantCtx, tx, tenant)
+			if err != nil || !fix || len(tenantDrifts) == 0 {
+				return err
+			}
+			return repairProductAvailability(tenantCtx, tx, tenantDrifts)
+		})
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Str("tenant", tenant).Msg("failed to check product availability")
+			return nil, err
+		}
+		drifts = append(drifts, tenantDrifts...)
+	}
+	return drifts, nil
+}
+
+func getProductAvailabilityDrifts(ctx context.Context, q queryer, tenant string) ([]ProductAvailabilityDrift, error) {
+	rows, err := q.QueryContext(ctx, getProductAvailabilityDrift, tenant)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to compare product_availability")
+		return nil, err
+	}
+	defer rows.Close()
+	drifts := make([]ProductAvailabilityDrift, 0)
+	for rows.Next() {
+		drift := ProductAvailabilityDrift{Tenant: tenant}
+		var stored, actual sql.NullInt64
+		err = rows.Scan(&drift.ProductID, &stored, &actual)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan product_availability drift")
+			return nil, err
+		}
+		if stored.Valid {
+			stock := int(stored.Int64)
+			drift.Stored = &stock
+		}
+		if actual.Valid {
+			stock := int(actual.Int64)
+			drift.Actual = &stock
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts, rows.Err()
+}
+
+// repairProductAvailability recomputes the drifted products once their rows
+// are locked, a transaction changing them meanwhile is waited for.
+func repairProductAvailability(ctx context.Context, q queryer, drifts []ProductAvailabilityDrift) error {
+	productIDs := make([]string, 0, len(drifts))
+	for _, drift := range drifts {
+		productIDs = append(productIDs, drift.ProductID)
+	}
+	tenant := TenantFromContext(ctx)
+	rows, err := q.QueryContext(ctx, lockProductAvailabilityByProductIDs, pq.Array(productIDs), tenant)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to lock product_availability")
+		return err
+	}
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, recomputeProductAvailability, pq.Array(productIDs), tenant)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to recompute product_availability")
+		return err
+	}
+	return deleteOrphanedAvailability(ctx, q, productIDs)
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// errDryRun rolls back the transaction of a dry run once it is done.
+var errDryRun = errors.New("dry run")
+
+func (pg *PostgresDB) DryRunCreateOrUpdateArticles(ctx context.Context, req CreateOrUpdateArticlesRequest) (ImportDiff, error) {
+	var diff ImportDiff
+	err := pg.inDryRunTx(ctx, "DryRunCreateOrUpdateArticles", func(tx *sql.Tx) error {
+		articleIDs := make([]string, 0, len(req.Articles))
+		for _, article := range req.Articles {
+			articleIDs = append(articleIDs, article.ArticleID)
+		}
+		stored, err := getArticlesByID(ctx, tx, articleIDs)
+		if err != nil {
+			return err
+		}
+		inserted, productsBefore, productsAfter, err := createOrUpdateArticles(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+		diff = ImportDiff{Items: make([]ImportItem, 0, len(req.Articles))}
+		for i, article := range req.Articles {
+			item := ImportItem{Action: ImportActionUpdate}
+			if inserted[i] {
+				item.Action = ImportActionCreate
+			} else if before, ok := stored[article.ArticleID]; ok {
+				item.Before = &before
+			}
+			diff.Items = append(diff.Items, item)
+		}
+		diff.ProductStocks = productStockChanges(productsBefore, productsAfter, nil)
+		return nil
+	})
+	if err != nil {
+		return ImportDiff{}, err
+	}
+	return diff, nil
+}
+
+func (pg *PostgresDB) DryRunCreateOrUpdateProducts(ctx context.Context, req CreateOrUpdateProductsRequest) (ImportDiff, error) {
+	var diff ImportDiff
+	err := pg.inDryRunTx(ctx, "DryRunCreateOrUpdateProducts", func(tx *sql.Tx) error {
+		articleIDs := make([]string, 0)
+		for _, product := range req.Products {
+			for _, article := range product.Articles {
+				articleIDs = append(articleIDs, article.ArticleID)
+			}
+		}
+		stored, err := getArticlesByID(ctx, tx, articleIDs)
+		if err != nil {
+			return err
+		}
+		diff = ImportDiff{Items: make([]ImportItem, 0, len(req.Products))}
+		valid := CreateOrUpdateProductsRequest{Products: make([]Product, 0, len(req.Products))}
+		for _, product := range req.Products {
+			item := ImportItem{Action: ImportActionCreate}
+			for _, article := range product.Articles {
+				if _, ok := stored[article.ArticleID]; !ok {
+					item.Action = ""
+					item.MissingArticles = append(item.MissingArticles, article.ArticleID)
+				}
+			}
+			if item.Action != "" {
+				valid.Products = append(valid.Products, product)
+			}
+			diff.Items = append(diff.Items, item)
+		}
+		productIDs, productsBefore, productsAfter, err := createProducts(ctx, tx, valid)
+		if err != nil {
+			return err
+		}
+		created := make(map[string]bool, len(productIDs))
+		next := 0
+		for i := range diff.Items {
+			if diff.Items[i].Action == "" {
+				continue
+			}
+			diff.Items[i].Stock = productsAfter[productIDs[next]]
+			created[productIDs[next]] = true
+			next++
+		}
+		diff.ProductStocks = productStockChanges(productsBefore, productsAfter, created)
+		return nil
+	})
+	if err != nil {
+		return ImportDiff{}, err
+	}
+	return diff, nil
+}
+
+// inDryRunTx runs fn in a transaction that is rolled back even when fn
+// succeeds.
+func (pg *PostgresDB) inDryRunTx(ctx context.Context, name string, fn func(tx *sql.Tx) error) error {
+	err := pg.inTx(ctx, name, func(tx *sql.Tx) error {
+		err := fn(tx)
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// getArticlesByID returns the stored articles among articleIDs.
+func getArticlesByID(ctx context.Context, q queryer, articleIDs []string) (map[string]Article, error) {
+	rows, err := q.QueryContext(ctx, getArticlesByIDs, pq.Array(articleIDs), TenantFromContext(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get articles by id")
+		return nil, err
+	}
+	defer rows.Close()
+	articles := make(map[string]Article)
+	for rows.Next() {
+		var article Article
+		err = rows.Scan(&article.ArticleID, &article.ArticleName, &article.Stock, &article.Version)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan article by id")
+			return nil, err
+		}
+		articles[article.ArticleID] = article
+	}
+	return articles, rows.Err()
+}
+
+// productStockChanges lists the products whose stock differs between before
+// and after, except the created ones.
+func productStockChanges(before, after map[string]int, created map[string]bool) []ProductStockChange {
+	changes := make([]ProductStockChange, 0)
+	for _, productID := range sortedKeys(after) {
+		if created[productID] || before[productID] == after[productID] {
+			continue
+		}
+		changes = append(changes, ProductStockChange{ProductID: productID, Before: before[productID], After: after[productID]})
+	}
+	return changes
+}
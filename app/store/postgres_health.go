@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetLastMigration reads the changelog table the applied changesets are
+// recorded in.
+func (pg *PostgresDB) GetLastMigration(ctx context.Context) (string, error) {
+	ctx, span := startSpan(ctx, "GetLastMigration")
+	defer span.End()
+	var filename string
+	err := pg.Database.QueryRowContext(ctx, getLastMigration).Scan(&filename)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get last migration")
+		return "", err
+	}
+	return filename, nil
+}
+
+func (pg *PostgresDB) GetAppliedMigrations(ctx context.Context) ([]string, error) {
+	ctx, span := startSpan(ctx, "GetAppliedMigrations")
+	defer span.End()
+	rows, err := pg.Database.QueryContext(ctx, getMigrationFilenames)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get applied migrations")
+		return nil, err
+	}
+	defer rows.Close()
+	var filenames []string
+	for rows.Next() {
+		var filename string
+		if err = rows.Scan(&filename); err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan applied migrations")
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames, rows.Err()
+}
+
+func (pg *PostgresDB) GetOutboxBacklog(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "GetOutboxBacklog")
+	defer span.End()
+	var backlog int64
+	err := pg.Database.QueryRowContext(ctx, getOutboxBacklog).Scan(&backlog)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to count unpublished outbox events")
+		return 0, err
+	}
+	return backlog, nil
+}
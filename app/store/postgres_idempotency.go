@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// acquireIdempotencyKeyAttempts bounds the retries when a key disappears
+// between the insert and the read because it expired in the meantime.
+const acquireIdempotencyKeyAttempts = 3
+
+// AcquireIdempotencyKey claims req.Key of req.Subject for the caller. The key
+// is acquired when it is new, expired, or held by an identical request that
+// timed out, and gets a new lock token then. Otherwise the stored record is
+// returned, and concurrent requests with the same key are serialized by the
+// primary key.
+func (pg *PostgresDB) AcquireIdempotencyKey(
+	ctx context.Context,
+	req AcquireIdempotencyKeyRequest,
+) (AcquireIdempotencyKeyResponse, error) {
+	var res AcquireIdempotencyKeyResponse
+	err := pg.inTx(ctx, "AcquireIdempotencyKey", func(tx *sql.Tx) error {
+		var err error
+		res, err = tryAcquireIdempotencyKey(ctx, tx, req)
+		return err
+	})
+	return res, err
+}
+
+func tryAcquireIdempotencyKey(
+	ctx context.Context,
+	tx *sql.Tx,
+	req AcquireIdempotencyKeyRequest,
+) (AcquireIdempotencyKeyResponse, error) {
+	for i := 0; i < acquireIdempotencyKeyAttempts; i++ {
+		var lockToken string
+		err := tx.QueryRowContext(
+			ctx,
+			acquireIdempotencyKey,
+			req.Key,
+			req.RequestHash,
+			req.Retention.Seconds(),
+			req.LockTimeout.Seconds(),
+			TenantFromContext(ctx),
+			req.Subject,
+		).Scan(&lockToken)
+		if err == nil {
+			return AcquireIdempotencyKeyResponse{
+				Acquired: true,
+				Record: IdempotencyRecord{
+					Key:         req.Key,
+					Subject:     req.Subject,
+					RequestHash: req.RequestHash,
+					LockToken:   lockToken,
+				},
+			}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to acquire idempotency_key")
+			return AcquireIdempotencyKeyResponse{}, err
+		}
+		record := IdempotencyRecord{Subject: req.Subject}
+		err = tx.QueryRowContext(ctx, getIdempotencyKey, req.Key, TenantFromContext(ctx), req.Subject).Scan(
+			&record.Key,
+			&record.RequestHash,
+			&record.Completed,
+			&record.StatusCode,
+			&record.ContentType,
+			&record.Body,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get idempotency_key")
+			return AcquireIdempotencyKeyResponse{}, err
+		}
+		return AcquireIdempotencyKeyResponse{Record: record}, nil
+	}
+	return AcquireIdempotencyKeyResponse{}, ErrIdempotencyKeyUnavailable
+}
+
+// CompleteIdempotencyKey stores the response of the request holding
+// record.LockToken. A request whose key timed out and was acquired by a retry
+// in the meantime doesn't overwrite it.
+func (pg *PostgresDB) CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	return pg.inTx(ctx, "CompleteIdempotencyKey", func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			completeIdempotencyKey,
+			record.StatusCode,
+			record.ContentType,
+			record.Body,
+			record.Key,
+			TenantFromContext(ctx),
+			record.Subject,
+			record.LockToken,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to complete idempotency_key")
+			return err
+		}
+		return checkIdempotencyKeyHeld(ctx, res)
+	})
+}
+
+// ReleaseIdempotencyKey forgets a key whose request did not complete, so that
+// it can be retried. Like CompleteIdempotencyKey, only the holder of
+// record.LockToken can release it.
+func (pg *PostgresDB) ReleaseIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	return pg.inTx(ctx, "ReleaseIdempotencyKey", func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(
+			ctx,
+			deleteIdempotencyKey,
+			record.Key,
+			TenantFromContext(ctx),
+			record.Subject,
+			record.LockToken,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to release idempotency_key")
+			return err
+		}
+		return checkIdempotencyKeyHeld(ctx, res)
+	})
+}
+
+func checkIdempotencyKeyHeld(ctx context.Context, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		log.Ctx(ctx).Warn().Msg("idempotency_key was acquired by another request meanwhile")
+		return ErrIdempotencyKeyLost
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes the keys of every tenant older than
+// retention.
+func (pg *PostgresDB) DeleteExpiredIdempotencyKeys(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, span := startSpan(ctx, "DeleteExpiredIdempotencyKeys")
+	defer span.End()
+	var deleted int64
+	err := pg.Database.QueryRowContext(ctx, deleteExpiredIdempotencyKeys, retention.Seconds()).Scan(&deleted)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to delete expired idempotency_key")
+		return 0, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/tracing"
+)
+
+// QueryObserver is called after every statement with the name of its
+// constant in queries.go, or "other", and the error it failed with.
+type QueryObserver func(statement string, duration time.Duration, err error)
+
+func (pg *PostgresDB) ObserveQueries(observer QueryObserver) {
+	pg.observer.Store(observer)
+}
+
+func (pg *PostgresDB) Stats() sql.DBStats {
+	return pg.Database.Stats()
+}
+
+// GetInventoryMetrics sums up the stock of every tenant.
+func (pg *PostgresDB) GetInventoryMetrics(ctx context.Context) ([]InventoryMetrics, error) {
+	ctx, span := startSpan(ctx, "GetInventoryMetrics")
+	defer span.End()
+	tenants, err := pg.GetTenants(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("inventory metrics, failed to get tenants")
+		return nil, err
+	}
+	inventories := make([]InventoryMetrics, 0, len(tenants))
+	for _, tenant := range tenants {
+		tenantCtx := WithTenant(ctx, tenant)
+		inventory := InventoryMetrics{Tenant: tenant}
+		err = pg.inReadTx(tenantCtx, "GetInventoryMetrics", func(tx *sql.Tx) error {
+			return tx.QueryRowContext(tenantCtx, getInventoryMetrics, tenant).Scan(
+				&inventory.ArticleUnits,
+				&inventory.ProductsOutOfStock,
+			)
+		})
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Str("tenant", tenant).Msg("failed to get inventory metrics")
+			return nil, err
+		}
+		inventories = append(inventories, inventory)
+	}
+	return inventories, nil
+}
+
+// startStatement traces a statement, the returned function ends its span and
+// tells the QueryObserver how long it took.
+func (pg *PostgresDB) startStatement(ctx context.Context, query string) (context.Context, func(err error)) {
+	statement, ok := statementNames[query]
+	if !ok {
+		statement = "other"
+	}
+	start := time.Now()
+	ctx, span := tracing.Start(
+		ctx,
+		statement,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql"), attribute.String("db.statement", query)),
+	)
+	return ctx, func(err error) {
+		if err == driver.ErrSkip {
+			return
+		}
+		tracing.RecordError(span, err)
+		span.End()
+		if observer, _ := pg.observer.Load().(QueryObserver); observer != nil {
+			observer(statement, time.Since(start), err)
+		}
+	}
+}
+
+// observedConnector hands out connections that trace and time their
+// statements.
+type observedConnector struct {
+	driver.Connector
+	pg *PostgresDB
+}
+
+func (c *observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &observedConn{Conn: conn, pg: c.pg}, nil
+}
+
+type observedConn struct {
+	driver.Conn
+	pg *PostgresDB
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := c.pg.startStatement(ctx, query)
+	res, err := execer.ExecContext(ctx, query, args)
+	done(err)
+	return res, err
+}
+
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := c.pg.startStatement(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	done(err)
+	return rows, err
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"crypto/md5" // nolint
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migrationsLockID is the advisory lock held while migrating, instances
+// starting together migrate one after the other.
+const migrationsLockID = 4713290857
+
+// migrationsDir holds a YYYYDDMM_N_name.sql file per changeset, reverted by
+// YYYYDDMM_N_name.down.sql when it exists.
+const migrationsDir = "migrations"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d{4})(\d{2})(\d{2})_(\d+)_[a-z0-9_]+\.sql$`)
+
+// Migrations returns the changesets of the schema in the order they are
+// applied, by date and then by number.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	sortKeys := make(map[string]string)
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".down.sql") {
+			continue
+		}
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, entry.Name())
+		}
+		number, err := strconv.Atoi(match[4])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigrationName, entry.Name())
+		}
+		// year, month and day, the names put the day first
+		sortKeys[entry.Name()] = fmt.Sprintf("%s%s%s_%09d", match[1], match[3], match[2], number)
+		migration := Migration{Name: entry.Name()}
+		up, err := migrationFiles.ReadFile(path.Join(migrationsDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration.Up = string(up)
+		down, err := migrationFiles.ReadFile(path.Join(migrationsDir, strings.TrimSuffix(entry.Name(), ".sql")+".down.sql"))
+		if err == nil {
+			migration.Down = string(down)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return sortKeys[migrations[i].Name] < sortKeys[migrations[j].Name]
+	})
+	return migrations, nil
+}
+
+// LatestMigration is the name of the last changeset of this build, empty when
+// the changesets can't be read.
+func LatestMigration() string {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return ""
+	}
+	return migrations[len(migrations)-1].Name
+}
+
+type appliedMigration struct {
+	filename  string
+	appliedAt time.Time
+}
+
+func (pg *PostgresDB) MigrateUp(ctx context.Context) ([]string, error) {
+	ctx, span := startSpan(ctx, "MigrateUp")
+	defer span.End()
+	migrations, err := Migrations()
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to read migrations")
+		return nil, err
+	}
+	applied := make([]string, 0)
+	err = pg.withMigrationsLock(ctx, func(conn *sql.Conn) error {
+		done, err := readAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		names := make(map[string]bool, len(done))
+		for _, migration := range done {
+			names[path.Base(migration.filename)] = true
+		}
+		for _, migration := range migrations {
+			if names[migration.Name] {
+				continue
+			}
+			log.Ctx(ctx).Info().Str("migration", migration.Name).Msg("applying migration")
+			err = runMigration(ctx, conn, migration.Name, migration.Up, func(tx *sql.Tx) error {
+				checksum := md5.Sum([]byte(migration.Up)) // nolint
+				_, err := tx.ExecContext(
+					ctx,
+					createMigration,
+					strings.TrimSuffix(migration.Name, ".sql"),
+					path.Join(migrationsDir, migration.Name),
+					hex.EncodeToString(checksum[:]),
+				)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			applied = append(applied, migration.Name)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (pg *PostgresDB) MigrateDown(ctx context.Context, steps int) ([]string, error) {
+	ctx, span := startSpan(ctx, "MigrateDown")
+	defer span.End()
+	migrations, err := Migrations()
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to read migrations")
+		return nil, err
+	}
+	byName := make(map[string]Migration, len(migrations))
+	for _, migration := range migrations {
+		byName[migration.Name] = migration
+	}
+	reverted := make([]string, 0, steps)
+	err = pg.withMigrationsLock(ctx, func(conn *sql.Conn) error {
+		done, err := readAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(done) - 1; i >= 0 && len(reverted) < steps; i-- {
+			filename := done[i].filename
+			migration, ok := byName[path.Base(filename)]
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrUnknownMigration, path.Base(filename))
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %s", ErrIrreversibleMigration, migration.Name)
+			}
+			log.Ctx(ctx).Info().Str("migration", migration.Name).Msg("reverting migration")
+			err = runMigration(ctx, conn, migration.Name, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, deleteMigration, filename)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, migration.Name)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (pg *PostgresDB) GetMigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	ctx, span := startSpan(ctx, "GetMigrationStatus")
+	defer span.End()
+	migrations, err := Migrations()
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to read migrations")
+		return nil, err
+	}
+	var done []appliedMigration
+	err = pg.withMigrationsLock(ctx, func(conn *sql.Conn) error {
+		done, err = readAppliedMigrations(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[string]time.Time, len(done))
+	for _, migration := range done {
+		appliedAt[path.Base(migration.filename)] = migration.appliedAt
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	known := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Name] = true
+		status := MigrationStatus{Name: migration.Name}
+		if at, ok := appliedAt[migration.Name]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	for _, migration := range done {
+		name := path.Base(migration.filename)
+		if known[name] {
+			continue
+		}
+		at := migration.appliedAt
+		statuses = append(statuses, MigrationStatus{Name: name, AppliedAt: &at, Unknown: true})
+	}
+	return statuses, nil
+}
+
+// withMigrationsLock runs fn on a connection holding the migrations lock,
+// after making sure the changelog table exists. Statements on it aren't
+// subject to the statement timeout, migrations may take long.
+func (pg *PostgresDB) withMigrationsLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := pg.Database.Conn(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get a connection to migrate")
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, disableStatementTimeout)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to disable the statement timeout")
+		return err
+	}
+	defer func() {
+		// the connection goes back to the pool, with the timeout of the
+		// others
+		_, err := conn.ExecContext(context.Background(), resetStatementTimeout)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to reset the statement timeout")
+		}
+	}()
+	_, err = conn.ExecContext(ctx, lockMigrations, migrationsLockID)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to acquire the migrations lock")
+		return err
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.Background(), unlockMigrations, migrationsLockID)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to release the migrations lock")
+		}
+	}()
+	_, err = conn.ExecContext(ctx, createMigrationsTable)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create the changelog table")
+		return err
+	}
+	return fn(conn)
+}
+
+func readAppliedMigrations(ctx context.Context, conn *sql.Conn) ([]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, getAppliedMigrations)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get applied migrations")
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make([]appliedMigration, 0)
+	for rows.Next() {
+		var migration appliedMigration
+		err = rows.Scan(&migration.filename, &migration.appliedAt)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan applied migration")
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, rows.Err()
+}
+
+// runMigration runs the statements of a changeset and record, which updates
+// the changelog table, in one transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, name, statements string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Str("migration", name).Msg("failed to start migration transaction")
+		return err
+	}
+	_, err = tx.ExecContext(ctx, statements)
+	if err == nil {
+		err = record(tx)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Str("migration", name).Msg("migration failed")
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			log.Ctx(ctx).Err(rollbackErr).Str("migration", name).Msg("error happened when rolling back migration")
+		}
+		return fmt.Errorf("migration %s: %w", name, err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Str("migration", name).Msg("failed to commit migration")
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// outboxDispatchLockKey is the advisory lock that serializes the claims of
+// the dispatchers across all replicas, so that a claim sees the leases of the
+// previous ones.
+const outboxDispatchLockKey = 7355608
+
+// outboxNotifyChannel is the channel the notify_outbox_event trigger uses.
+const outboxNotifyChannel = "outbox_event"
+
+// writeOutboxEvent records an event in the caller's transaction.
+func writeOutboxEvent(
+	ctx context.Context,
+	q queryer,
+	aggregateType, aggregateID, eventType string,
+	payload interface{},
+) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(
+		ctx,
+		createOutboxEvent,
+		aggregateType,
+		aggregateID,
+		eventType,
+		string(body),
+		TenantFromContext(ctx),
+	)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to write %s outbox event", eventType)
+	}
+	return err
+}
+
+// ProcessOutboxEvents leases the oldest unpublished events, hands them to
+// req.Publish outside of any transaction and then marks the ones it reports
+// as published and releases the others. Events of an aggregate that has an
+// earlier event leased by another dispatcher are left for later, which keeps
+// the per-aggregate order. It does nothing when another dispatcher is
+// claiming at the same time.
+func (pg *PostgresDB) ProcessOutboxEvents(ctx context.Context, req ProcessOutboxEventsRequest) error {
+	var events []OutboxEvent
+	var leaseToken string
+	err := pg.inTx(ctx, "ClaimOutboxEvents", func(tx *sql.Tx) error {
+		events, leaseToken = nil, ""
+		var locked bool
+		err := tx.QueryRowContext(ctx, tryOutboxDispatchLock, outboxDispatchLockKey).Scan(&locked)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to take outbox dispatch lock")
+			return err
+		}
+		if !locked {
+			return nil
+		}
+		events, leaseToken, err = leaseOutboxEvents(ctx, tx, req.Limit, req.Lease)
+		return err
+	})
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	published := req.Publish(ctx, events)
+	ctx, span := startSpan(ctx, "ReleaseOutboxEvents")
+	defer span.End()
+	// the lease token makes sure a dispatcher whose lease expired doesn't
+	// touch the events another one claimed since
+	_, err = pg.Database.ExecContext(ctx, releaseOutboxEvents, pq.Array(published), leaseToken)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to mark outbox events as published")
+	}
+	return err
+}
+
+func (pg *PostgresDB) GetOutboxEvents(ctx context.Context, req GetOutboxEventsRequest) ([]OutboxEvent, error) {
+	ctx, span := startSpan(ctx, "GetOutboxEvents")
+	defer span.End()
+	rows, err := pg.Database.QueryContext(
+		ctx,
+		getOutboxEventsAfter,
+		req.AfterEventID,
+		pq.Array(req.EventTypes),
+		req.Limit,
+		TenantFromContext(ctx),
+	)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get outbox events")
+		return nil, err
+	}
+	return scanOutboxEvents(ctx, rows)
+}
+
+// ListenOutboxEvents relies on the notify_outbox_event trigger, which
+// notifies the id of every inserted event once its transaction commits.
+// Events committed while the listener was reconnecting are read back from the
+// table.
+func (pg *PostgresDB) ListenOutboxEvents(ctx context.Context, fn func(OutboxEvent)) error {
+	listener := pq.NewListener(pg.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Ctx(ctx).Warn().AnErr("error", err).Int("event", int(event)).Msg("outbox listener connection event")
+		}
+	})
+	defer listener.Close()
+	err := listener.Listen(outboxNotifyChannel)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to listen for outbox events")
+		return err
+	}
+	var lastEventID int64
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			var events []OutboxEvent
+			if notification == nil {
+				// the connection was re-established, catch up on what was missed
+				events, err = pg.catchUpOutboxEvents(ctx, lastEventID)
+			} else {
+				events, err = pg.getOutboxEvent(ctx, notification.Extra)
+			}
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to read notified outbox events")
+				continue
+			}
+			for _, event := range events {
+				if event.EventID > lastEventID {
+					lastEventID = event.EventID
+				}
+				fn(event)
+			}
+		}
+	}
+}
+
+func (pg *PostgresDB) getOutboxEvent(ctx context.Context, eventID string) ([]OutboxEvent, error) {
+	id, err := strconv.ParseInt(eventID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := pg.Database.QueryContext(ctx, getOutboxEventByID, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(ctx, rows)
+}
+
+func (pg *PostgresDB) catchUpOutboxEvents(ctx context.Context, afterEventID int64) ([]OutboxEvent, error) {
+	if afterEventID == 0 {
+		return nil, nil
+	}
+	rows, err := pg.Database.QueryContext(ctx, getAllOutboxEventsAfter, afterEventID)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(ctx, rows)
+}
+
+func leaseOutboxEvents(ctx context.Context, q queryer, limit int, lease time.Duration) ([]OutboxEvent, string, error) {
+	rows, err := q.QueryContext(ctx, claimOutboxEvents, limit, lease.Seconds())
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to claim outbox events")
+		return nil, "", err
+	}
+	defer rows.Close()
+	var leaseToken string
+	events := make([]OutboxEvent, 0)
+	for rows.Next() {
+		var event OutboxEvent
+		var payload []byte
+		err = rows.Scan(
+			&event.EventID,
+			&event.TenantID,
+			&event.AggregateType,
+			&event.AggregateID,
+			&event.EventType,
+			&payload,
+			&event.CreatedAt,
+			&leaseToken,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan claimed outbox events")
+			return nil, "", err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	// UPDATE ... RETURNING doesn't keep the order of the subquery
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventID < events[j].EventID
+	})
+	return events, leaseToken, rows.Err()
+}
+
+func scanOutboxEvents(ctx context.Context, rows *sql.Rows) ([]OutboxEvent, error) {
+	defer rows.Close()
+	events := make([]OutboxEvent, 0)
+	for rows.Next() {
+		var event OutboxEvent
+		var payload []byte
+		err := rows.Scan(
+			&event.EventID,
+			&event.TenantID,
+			&event.AggregateType,
+			&event.AggregateID,
+			&event.EventType,
+			&payload,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan outbox events")
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// writeProductStockChanges records product.stock_changed for every product
+// whose stock in after differs from before, including new products.
+func writeProductStockChanges(ctx context.Context, q queryer, before, after map[string]int) error {
+	for _, productID := range sortedKeys(after) {
+		stock, existed := before[productID]
+		if existed && stock == after[productID] {
+			continue
+		}
+		err := writeOutboxEvent(
+			ctx,
+			q,
+			OutboxAggregateProduct,
+			productID,
+			OutboxEventProductStockChanged,
+			ProductStockEventPayload{ProductID: productID, Stock: after[productID]},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
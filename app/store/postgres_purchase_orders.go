@@ -0,0 +1,420 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+func (pg *PostgresDB) CreateSupplier(ctx context.Context, req CreateSupplierRequest) (Supplier, error) {
+	supplier := Supplier{SupplierName: req.SupplierName}
+	err := pg.inTx(ctx, "CreateSupplier", func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, createSupplier, req.SupplierName, TenantFromContext(ctx)).Scan(&supplier.SupplierID)
+		if err != nil {
+			return err
+		}
+		return auditedSupplier.record(ctx, tx, supplier.SupplierID, nil, supplier.SupplierID)
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create supplier")
+		return Supplier{}, err
+	}
+	return supplier, nil
+}
+
+func (pg *PostgresDB) GetAllSuppliers(ctx context.Context) (GetAllSuppliersResponse, error) {
+	var suppliers []Supplier
+	err := pg.inReadTx(ctx, "GetAllSuppliers", func(tx *sql.Tx) error {
+		suppliers = make([]Supplier, 0)
+		rows, err := tx.QueryContext(ctx, getAllSuppliers, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all suppliers")
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var supplier Supplier
+			err = rows.Scan(&supplier.SupplierID, &supplier.SupplierName)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all suppliers")
+				return err
+			}
+			suppliers = append(suppliers, supplier)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return GetAllSuppliersResponse{}, err
+	}
+	return GetAllSuppliersResponse{
+		Suppliers: suppliers,
+	}, nil
+}
+
+func (pg *PostgresDB) CreateOrUpdateArticleSupplier(ctx context.Context, req ArticleSupplier) error {
+	return pg.inTx(ctx, "CreateOrUpdateArticleSupplier", func(tx *sql.Tx) error {
+		before, err := auditedArticleSupplier.snapshot(ctx, tx, req.SupplierID, req.ArticleID)
+		if err != nil {
+			return supplierOrArticleError(err)
+		}
+		res, err := tx.ExecContext(
+			ctx,
+			upsertArticleSupplier,
+			req.ArticleID,
+			req.SupplierID,
+			req.SupplierSKU,
+			req.LeadTimeDays,
+			req.UnitCostCents,
+			TenantFromContext(ctx),
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to link article %v to supplier %v", req.ArticleID, req.SupplierID)
+			return supplierOrArticleError(err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// the supplier is read within the tenant, no row means it belongs to another one
+		if affected == 0 {
+			return ErrSupplierNotFound
+		}
+		return auditedArticleSupplier.record(
+			ctx,
+			tx,
+			req.SupplierID+"/"+req.ArticleID,
+			before,
+			req.SupplierID,
+			req.ArticleID,
+		)
+	})
+}
+
+func (pg *PostgresDB) GetArticleSuppliers(ctx context.Context, supplierID string) (GetArticleSuppliersResponse, error) {
+	var articleSuppliers []ArticleSupplier
+	err := pg.inReadTx(ctx, "GetArticleSuppliers", func(tx *sql.Tx) error {
+		articleSuppliers = make([]ArticleSupplier, 0)
+		rows, err := tx.QueryContext(ctx, getArticleSuppliersBySupplierID, supplierID, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get article_supplier by supplier_id")
+			if pqErrorCode(err) == pqInvalidTextRepresentation {
+				return ErrSupplierNotFound
+			}
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var articleSupplier ArticleSupplier
+			err = rows.Scan(
+				&articleSupplier.ArticleID,
+				&articleSupplier.SupplierID,
+				&articleSupplier.SupplierSKU,
+				&articleSupplier.LeadTimeDays,
+				&articleSupplier.UnitCostCents,
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan article_supplier by supplier_id")
+				return err
+			}
+			articleSuppliers = append(articleSuppliers, articleSupplier)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return GetArticleSuppliersResponse{}, err
+	}
+	return GetArticleSuppliersResponse{
+		ArticleSuppliers: articleSuppliers,
+	}, nil
+}
+
+func (pg *PostgresDB) CreatePurchaseOrder(ctx context.Context, req CreatePurchaseOrderRequest) (PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := pg.inTx(ctx, "CreatePurchaseOrder", func(tx *sql.Tx) error {
+		var purchaseOrderID string
+		err := tx.QueryRowContext(ctx, createPurchaseOrder, req.SupplierID, TenantFromContext(ctx)).Scan(&purchaseOrderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSupplierNotFound
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create purchase_order")
+			return supplierOrArticleError(err)
+		}
+		for _, line := range req.Lines {
+			_, err = tx.ExecContext(
+				ctx,
+				createPurchaseOrderLine,
+				purchaseOrderID,
+				line.ArticleID,
+				line.QuantityOrdered,
+				line.UnitCostCents,
+				TenantFromContext(ctx),
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create purchase_order_line")
+				return supplierOrArticleError(err)
+			}
+		}
+		err = auditedPurchaseOrder.record(ctx, tx, purchaseOrderID, nil, purchaseOrderID)
+		if err != nil {
+			return err
+		}
+		purchaseOrder, err = getPurchaseOrder(ctx, tx, getPurchaseOrderByID, purchaseOrderID)
+		return err
+	})
+	if err != nil {
+		return PurchaseOrder{}, err
+	}
+	return purchaseOrder, nil
+}
+
+func (pg *PostgresDB) GetPurchaseOrder(ctx context.Context, purchaseOrderID string) (PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := pg.inReadTx(ctx, "GetPurchaseOrder", func(tx *sql.Tx) error {
+		var err error
+		purchaseOrder, err = getPurchaseOrder(ctx, tx, getPurchaseOrderByID, purchaseOrderID)
+		return err
+	})
+	if err != nil {
+		return PurchaseOrder{}, err
+	}
+	return purchaseOrder, nil
+}
+
+func (pg *PostgresDB) UpdatePurchaseOrderState(
+	ctx context.Context,
+	req UpdatePurchaseOrderStateRequest,
+) (PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := pg.inTx(ctx, "UpdatePurchaseOrderState", func(tx *sql.Tx) error {
+		current, err := getPurchaseOrder(ctx, tx, getPurchaseOrderByIDForUpdate, req.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+		if !current.State.CanTransitionTo(req.State) {
+			return ErrInvalidPurchaseOrderTransition
+		}
+		before, err := auditedPurchaseOrder.snapshot(ctx, tx, req.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, updatePurchaseOrderState, req.State, req.PurchaseOrderID, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to update purchase_order state")
+			return err
+		}
+		err = auditedPurchaseOrder.record(ctx, tx, req.PurchaseOrderID, before, req.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+		current.State = req.State
+		purchaseOrder = current
+		return nil
+	})
+	if err != nil {
+		return PurchaseOrder{}, err
+	}
+	return purchaseOrder, nil
+}
+
+// ReceivePurchaseOrder books received goods against the lines of a sent
+// purchase order, increases the article stock and records every receipt in
+// stock_history. The order moves to partially_received, or to closed once all
+// of its lines are fully received.
+func (pg *PostgresDB) ReceivePurchaseOrder(
+	ctx context.Context,
+	req ReceivePurchaseOrderRequest,
+) (PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := pg.inTx(ctx, "ReceivePurchaseOrder", func(tx *sql.Tx) error {
+		current, err := getPurchaseOrder(ctx, tx, getPurchaseOrderByIDForUpdate, req.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+		if current.State != PurchaseOrderStateSent && current.State != PurchaseOrderStatePartiallyReceived {
+			return ErrInvalidPurchaseOrderTransition
+		}
+		purchaseOrderBefore, err := auditedPurchaseOrder.snapshot(ctx, tx, req.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+		articleIDs := make([]string, 0, len(req.Lines))
+		for _, receipt := range req.Lines {
+			articleIDs = append(articleIDs, receipt.ArticleID)
+		}
+		productsBefore, err := getProductsStock(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("receive purchase order, failed to get products stock")
+			return err
+		}
+		lines := make(map[string]*PurchaseOrderLine, len(current.Lines))
+		for i := range current.Lines {
+			lines[current.Lines[i].ArticleID] = &current.Lines[i]
+		}
+		for _, receipt := range req.Lines {
+			line, ok := lines[receipt.ArticleID]
+			if !ok {
+				return ErrPurchaseOrderLineNotFound
+			}
+			if line.QuantityReceived+receipt.Quantity > line.QuantityOrdered {
+				return ErrReceiptExceedsOrderedQuantity
+			}
+			line.QuantityReceived += receipt.Quantity
+			articleBefore, err := auditedArticle.snapshot(ctx, tx, receipt.ArticleID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(
+				ctx,
+				updatePurchaseOrderLineReceived,
+				receipt.Quantity,
+				req.PurchaseOrderID,
+				receipt.ArticleID,
+				TenantFromContext(ctx),
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("receive purchase order, failed to update purchase_order_line")
+				return err
+			}
+			var stock int
+			err = tx.QueryRowContext(
+				ctx,
+				updateArticleStockForReceipt,
+				receipt.Quantity,
+				receipt.ArticleID,
+				TenantFromContext(ctx),
+			).Scan(&stock)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("receive purchase order, failed to update article")
+				return err
+			}
+			_, err = tx.ExecContext(
+				ctx,
+				createStockHistory,
+				receipt.ArticleID,
+				receipt.Quantity,
+				StockHistoryReasonReceipt,
+				req.PurchaseOrderID,
+				actorFromContext(ctx),
+				TenantFromContext(ctx),
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("receive purchase order, failed to write stock_history")
+				return err
+			}
+			err = writeOutboxEvent(
+				ctx,
+				tx,
+				OutboxAggregateArticle,
+				receipt.ArticleID,
+				OutboxEventArticleUpdated,
+				ArticleEventPayload{ArticleID: receipt.ArticleID, Stock: stock},
+			)
+			if err != nil {
+				return err
+			}
+			err = auditedArticle.record(ctx, tx, receipt.ArticleID, articleBefore, receipt.ArticleID)
+			if err != nil {
+				return err
+			}
+		}
+		productsAfter, err := refreshProductAvailability(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("receive purchase order, failed to update product availability")
+			return err
+		}
+		err = writeProductStockChanges(ctx, tx, productsBefore, productsAfter)
+		if err != nil {
+			return err
+		}
+		current.State = PurchaseOrderStateClosed
+		for _, line := range current.Lines {
+			if line.QuantityReceived < line.QuantityOrdered {
+				current.State = PurchaseOrderStatePartiallyReceived
+				break
+			}
+		}
+		_, err = tx.ExecContext(ctx, updatePurchaseOrderState, current.State, req.PurchaseOrderID, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("receive purchase order, failed to update purchase_order state")
+			return err
+		}
+		err = auditedPurchaseOrder.record(ctx, tx, req.PurchaseOrderID, purchaseOrderBefore, req.PurchaseOrderID)
+		if err != nil {
+			return err
+		}
+		purchaseOrder = current
+		return nil
+	})
+	if err != nil {
+		return PurchaseOrder{}, err
+	}
+	return purchaseOrder, nil
+}
+
+// CanTransitionTo reports whether a purchase order may be moved from s to next
+// by an explicit state change. Receipts move orders between sent,
+// partially_received and closed on their own.
+func (s PurchaseOrderState) CanTransitionTo(next PurchaseOrderState) bool {
+	switch s {
+	case PurchaseOrderStateDraft:
+		return next == PurchaseOrderStateSent || next == PurchaseOrderStateClosed
+	case PurchaseOrderStateSent, PurchaseOrderStatePartiallyReceived:
+		return next == PurchaseOrderStateClosed
+	case PurchaseOrderStateClosed:
+		return false
+	}
+	return false
+}
+
+func getPurchaseOrder(ctx context.Context, q queryer, query string, purchaseOrderID string) (PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := q.QueryRowContext(ctx, query, purchaseOrderID, TenantFromContext(ctx)).Scan(
+		&purchaseOrder.PurchaseOrderID,
+		&purchaseOrder.SupplierID,
+		&purchaseOrder.State,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || pqErrorCode(err) == pqInvalidTextRepresentation {
+			return PurchaseOrder{}, ErrPurchaseOrderNotFound
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get purchase_order by id")
+		return PurchaseOrder{}, err
+	}
+	rows, err := q.QueryContext(ctx, getPurchaseOrderLinesByPurchaseOrderID, purchaseOrderID, TenantFromContext(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get purchase_order_line by purchase_order_id")
+		return PurchaseOrder{}, err
+	}
+	defer rows.Close()
+	purchaseOrder.Lines = make([]PurchaseOrderLine, 0)
+	for rows.Next() {
+		var line PurchaseOrderLine
+		err = rows.Scan(&line.ArticleID, &line.QuantityOrdered, &line.QuantityReceived, &line.UnitCostCents)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan purchase_order_line by purchase_order_id")
+			return PurchaseOrder{}, err
+		}
+		purchaseOrder.Lines = append(purchaseOrder.Lines, line)
+	}
+	return purchaseOrder, rows.Err()
+}
+
+// supplierOrArticleError maps foreign key violations on supplier and article
+// references to the matching not found errors.
+func supplierOrArticleError(err error) error {
+	switch pqErrorCode(err) {
+	case pqInvalidTextRepresentation:
+		return ErrSupplierNotFound
+	case pqForeignKeyViolation:
+		switch pqConstraint(err) {
+		case "purchase_order_supplier_id_fkey", "article_supplier_supplier_id_fkey":
+			return ErrSupplierNotFound
+		case "purchase_order_line_article_id_fkey", "article_supplier_article_id_fkey":
+			return ErrArticleNotFound
+		}
+	}
+	return err
+}
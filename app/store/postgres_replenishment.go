@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+func (pg *PostgresDB) UpdateArticleReplenishment(ctx context.Context, req ArticleReplenishment) error {
+	return pg.inTx(ctx, "UpdateArticleReplenishment", func(tx *sql.Tx) error {
+		before, err := auditedArticle.snapshot(ctx, tx, req.ArticleID)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(
+			ctx,
+			updateArticleReplenishment,
+			req.ReorderPoint,
+			req.SafetyStock,
+			req.ReorderQuantity,
+			req.ArticleID,
+			TenantFromContext(ctx),
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to update replenishment settings of article %v", req.ArticleID)
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrArticleNotFound
+		}
+		return auditedArticle.record(ctx, tx, req.ArticleID, before, req.ArticleID)
+	})
+}
+
+func (pg *PostgresDB) GetReplenishmentCandidates(
+	ctx context.Context,
+	req GetReplenishmentCandidatesRequest,
+) (GetReplenishmentCandidatesResponse, error) {
+	var candidates []ReplenishmentCandidate
+	err := pg.inTx(ctx, "GetReplenishmentCandidates", func(tx *sql.Tx) error {
+		candidates = make([]ReplenishmentCandidate, 0)
+		rows, err := tx.QueryContext(ctx, getReplenishmentCandidates, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get replenishment candidates")
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var candidate ReplenishmentCandidate
+			err = rows.Scan(
+				&candidate.ArticleID,
+				&candidate.ArticleName,
+				&candidate.Stock,
+				&candidate.ReorderPoint,
+				&candidate.SafetyStock,
+				&candidate.ReorderQuantity,
+				&candidate.OnOrder,
+				&candidate.SupplierID,
+				&candidate.LeadTimeDays,
+				&candidate.UnitCostCents,
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan replenishment candidates")
+				return err
+			}
+			candidates = append(candidates, candidate)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return getReplenishmentConsumersOf(ctx, tx, candidates, req.DemandWindowDays)
+	})
+	if err != nil {
+		return GetReplenishmentCandidatesResponse{}, err
+	}
+	return GetReplenishmentCandidatesResponse{
+		Candidates: candidates,
+	}, nil
+}
+
+// getReplenishmentConsumersOf adds the products using them to candidates.
+func getReplenishmentConsumersOf(ctx context.Context, tx *sql.Tx, candidates []ReplenishmentCandidate, demandWindowDays int) error {
+	byArticle := make(map[string]*ReplenishmentCandidate, len(candidates))
+	for i := range candidates {
+		candidates[i].Consumers = make([]ReplenishmentConsumer, 0)
+		byArticle[candidates[i].ArticleID] = &candidates[i]
+	}
+	rows, err := tx.QueryContext(ctx, getReplenishmentConsumers, demandWindowDays, TenantFromContext(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get replenishment consumers")
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var articleID string
+		var consumer ReplenishmentConsumer
+		err = rows.Scan(
+			&articleID,
+			&consumer.ProductID,
+			&consumer.ProductName,
+			&consumer.ArticleAmount,
+			&consumer.Sold,
+			&consumer.Reserved,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan replenishment consumers")
+			return err
+		}
+		if candidate, ok := byArticle[articleID]; ok {
+			candidate.Consumers = append(candidate.Consumers, consumer)
+		}
+	}
+	return rows.Err()
+}
+
+func (pg *PostgresDB) CreateReservation(ctx context.Context, req Reservation) (Reservation, error) {
+	reservation := req
+	err := pg.inTx(ctx, "CreateReservation", func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			createReservation,
+			req.ProductID,
+			req.Quantity,
+			nullString(req.Reference),
+			TenantFromContext(ctx),
+		).Scan(&reservation.ReservationID)
+		if errors.Is(err, sql.ErrNoRows) || pqErrorCode(err) == pqInvalidTextRepresentation {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create reservation")
+			return err
+		}
+		return auditedReservation.record(ctx, tx, reservation.ReservationID, nil, reservation.ReservationID)
+	})
+	if err != nil {
+		return Reservation{}, err
+	}
+	return reservation, nil
+}
+
+// DeleteReservation releases the units held by a reservation, when its order
+// is sold or cancelled.
+func (pg *PostgresDB) DeleteReservation(ctx context.Context, reservationID string) error {
+	return pg.inTx(ctx, "DeleteReservation", func(tx *sql.Tx) error {
+		before, err := auditedReservation.snapshot(ctx, tx, reservationID)
+		if pqErrorCode(err) == pqInvalidTextRepresentation {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, deleteReservation, reservationID, TenantFromContext(ctx))
+		if err != nil {
+			if pqErrorCode(err) == pqInvalidTextRepresentation {
+				return ErrReservationNotFound
+			}
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to delete reservation")
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrReservationNotFound
+		}
+		return auditedReservation.record(ctx, tx, reservationID, before, reservationID)
+	})
+}
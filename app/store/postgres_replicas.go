@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/tracing"
+)
+
+// replica is a read only copy of the database, it gets no reads while it is
+// unhealthy.
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// setHealthy returns whether the health of the replica changed.
+func (r *replica) setHealthy(healthy bool) bool {
+	var value int32
+	if healthy {
+		value = 1
+	}
+	return atomic.SwapInt32(&r.healthy, value) != value
+}
+
+var readOnlyTx = &sql.TxOptions{ReadOnly: true}
+
+type primaryReadsKey struct{}
+
+// WithPrimaryReads makes the reads run with ctx go to the primary, e.g. for
+// a client that has to see its own writes.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// PrimaryReadsFromContext tells whether ctx was made with WithPrimaryReads.
+func PrimaryReadsFromContext(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryReadsKey{}).(bool)
+	return primary
+}
+
+func (pg *PostgresDB) openReplicas(cfg Config) error {
+	for i, dsn := range cfg.ReplicaDSNs {
+		connector, err := pq.NewConnector(dsn)
+		if err != nil {
+			return err
+		}
+		db := sql.OpenDB(&observedConnector{Connector: connector, pg: pg})
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		if cfg.MaxIdleConns > 0 {
+			db.SetMaxIdleConns(cfg.MaxIdleConns)
+		}
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+		pg.replicas = append(pg.replicas, &replica{
+			name:    "replica-" + strconv.Itoa(i),
+			db:      db,
+			healthy: 1,
+		})
+	}
+	return nil
+}
+
+// pickReplica returns the next healthy replica in turn, nil when there is
+// none.
+func (pg *PostgresDB) pickReplica() *replica {
+	n := uint32(len(pg.replicas))
+	if n == 0 {
+		return nil
+	}
+	start := atomic.AddUint32(&pg.nextReplica, 1)
+	for i := uint32(0); i < n; i++ {
+		r := pg.replicas[(start+i)%n]
+		if r.isHealthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+// inReadTx runs fn in a read only transaction on a replica. It falls back to
+// the primary when no replica is healthy, the replica fails to run it or ctx
+// asks for the primary.
+func (pg *PostgresDB) inReadTx(ctx context.Context, name string, fn func(tx *sql.Tx) error) error {
+	var r *replica
+	if !PrimaryReadsFromContext(ctx) {
+		r = pg.pickReplica()
+	}
+	if r == nil {
+		return pg.inTx(ctx, name, fn)
+	}
+	replicaCtx, span := tracing.Start(ctx, "PostgresDB."+name, trace.WithAttributes(attribute.String("db.replica", r.name)))
+	retryable, err := runTx(replicaCtx, r.db, readOnlyTx, name, fn)
+	tracing.RecordError(span, err)
+	span.End()
+	if err == nil || !retryable || ctx.Err() != nil {
+		return err
+	}
+	// conflicts with recovery surface as serialization failures on a
+	// replica, they are not a reason to take it out of rotation
+	if isConnectionError(err) && r.setHealthy(false) {
+		log.Ctx(ctx).Warn().AnErr("error", err).Str("replica", r.name).Msg("replica is unhealthy")
+	}
+	log.Ctx(ctx).Warn().AnErr("error", err).Str("replica", r.name).Msgf("%s, reading from the primary", name)
+	return pg.inTx(ctx, name, fn)
+}
+
+// RunReplicaChecks pings the replicas every interval until ctx is cancelled.
+// A replica unreachable or lagging more than maxLag behind the primary gets
+// no reads until it recovers, a zero maxLag accepts any lag.
+func (pg *PostgresDB) RunReplicaChecks(ctx context.Context, interval, maxLag time.Duration) {
+	if len(pg.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range pg.replicas {
+				pg.checkReplica(ctx, r, interval, maxLag)
+			}
+		}
+	}
+}
+
+func (pg *PostgresDB) checkReplica(ctx context.Context, r *replica, timeout, maxLag time.Duration) {
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var lagSeconds float64
+	err := r.db.QueryRowContext(checkCtx, getReplicationLag).Scan(&lagSeconds)
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	healthy := err == nil && (maxLag <= 0 || lag <= maxLag)
+	if !r.setHealthy(healthy) {
+		return
+	}
+	if healthy {
+		log.Info().Str("replica", r.name).Msg("replica is healthy again")
+		return
+	}
+	if err != nil {
+		log.Warn().AnErr("error", err).Str("replica", r.name).Msg("replica is unreachable")
+		return
+	}
+	log.Warn().Dur("lag", lag).Str("replica", r.name).Msg("replica is lagging behind")
+}
+
+func (pg *PostgresDB) closeReplicas() {
+	for _, r := range pg.replicas {
+		err := r.db.Close()
+		if err != nil {
+			log.Warn().AnErr("error", err).Str("replica", r.name).Msg("failed to close replica")
+		}
+	}
+}
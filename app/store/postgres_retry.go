@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	txBackoffMin = 20 * time.Millisecond
+	txBackoffMax = time.Second
+)
+
+// isTransientError tells whether a transaction that failed with err is
+// likely to succeed when run again.
+func isTransientError(err error) bool {
+	return isConflictError(err) || isConnectionError(err)
+}
+
+// isConflictError tells whether postgres aborted the transaction because of
+// a concurrent one.
+func isConflictError(err error) bool {
+	switch pqErrorCode(err) {
+	case pqSerializationFailure, pqDeadlockDetected:
+		return true
+	}
+	return false
+}
+
+// isConnectionError tells whether err came from losing the connection rather
+// than from the statement.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	code := pqErrorCode(err)
+	// class 08 is connection exception, 57P01 to 57P03 are the server
+	// shutting down or starting up
+	return code.Class() == "08" || code == "57P01" || code == "57P02" || code == "57P03"
+}
+
+// txBackoff doubles the wait after every failed attempt, with jitter so that
+// conflicting transactions don't meet again.
+func txBackoff(attempt int) time.Duration {
+	wait := txBackoffMin << attempt
+	if wait > txBackoffMax || wait <= 0 {
+		wait = txBackoffMax
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StreamArticles calls fn with every article of the tenant of ctx while they
+// are read, in the order of their ids. An error of fn stops the stream and is
+// returned.
+func (pg *PostgresDB) StreamArticles(ctx context.Context, fn func(article Article) error) error {
+	return pg.inStreamTx(ctx, "StreamArticles", func(tx *sql.Tx, sent *int) error {
+		rows, err := tx.QueryContext(ctx, getAllArticles, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to stream articles")
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var article Article
+			err = rows.Scan(&article.ArticleID, &article.ArticleName, &article.Stock, &article.Version)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan streamed article")
+				return err
+			}
+			err = fn(article)
+			if err != nil {
+				return err
+			}
+			*sent++
+		}
+		return rows.Err()
+	})
+}
+
+// StreamProducts calls fn with every product of the tenant of ctx, with its
+// articles and stock, while they are read in the order of their ids. Only the
+// product being read is held in memory. An error of fn stops the stream and
+// is returned.
+func (pg *PostgresDB) StreamProducts(ctx context.Context, fn func(product Product) error) error {
+	return pg.inStreamTx(ctx, "StreamProducts", func(tx *sql.Tx, sent *int) error {
+		rows, err := tx.QueryContext(ctx, streamProductsWithArticles, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to stream products")
+			return err
+		}
+		defer rows.Close()
+		var product *Product
+		for rows.Next() {
+			var row Product
+			var articleID sql.NullString
+			var articleAmount sql.NullInt64
+			err = rows.Scan(&row.ProductID, &row.ProductName, &row.Version, &row.Stock, &articleID, &articleAmount)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan streamed product")
+				return err
+			}
+			// the rows of a product follow each other, one per article
+			if product == nil || product.ProductID != row.ProductID {
+				if product != nil {
+					err = fn(*product)
+					if err != nil {
+						return err
+					}
+					*sent++
+				}
+				row.Articles = make([]ProductArticle, 0)
+				product = &row
+			}
+			if articleID.Valid {
+				product.Articles = append(product.Articles, ProductArticle{
+					ArticleID:     articleID.String,
+					ArticleAmount: int(articleAmount.Int64),
+				})
+			}
+		}
+		err = rows.Err()
+		if err != nil || product == nil {
+			return err
+		}
+		return fn(*product)
+	})
+}
+
+// inStreamTx runs fn in a read transaction, retried like the others until fn
+// sent a row on. After that the rows would be sent twice, the error is
+// returned as it is.
+func (pg *PostgresDB) inStreamTx(ctx context.Context, name string, fn func(tx *sql.Tx, sent *int) error) error {
+	var sent int
+	return pg.inReadTx(ctx, name, func(tx *sql.Tx) error {
+		err := fn(tx, &sent)
+		if err != nil && sent > 0 {
+			// not wrapped, a transient error would be retried
+			return fmt.Errorf("%s failed after %d rows: %v", name, sent, err) // nolint
+		}
+		return err
+	})
+}
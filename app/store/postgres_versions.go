@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+func (pg *PostgresDB) GetArticle(ctx context.Context, articleID string) (Article, error) {
+	var article Article
+	err := pg.inReadTx(ctx, "GetArticle", func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, getArticleByID, articleID, TenantFromContext(ctx)).Scan(
+			&article.ArticleID,
+			&article.ArticleName,
+			&article.Stock,
+			&article.Version,
+		)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Article{}, ErrArticleNotFound
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to get article %v", articleID)
+		return Article{}, err
+	}
+	return article, nil
+}
+
+func (pg *PostgresDB) GetAllArticles(ctx context.Context) (GetAllArticlesResponse, error) {
+	var articles []Article
+	err := pg.inReadTx(ctx, "GetAllArticles", func(tx *sql.Tx) error {
+		articles = make([]Article, 0)
+		rows, err := tx.QueryContext(ctx, getAllArticles, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all articles")
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var article Article
+			err = rows.Scan(&article.ArticleID, &article.ArticleName, &article.Stock, &article.Version)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all articles")
+				return err
+			}
+			articles = append(articles, article)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return GetAllArticlesResponse{}, err
+	}
+	return GetAllArticlesResponse{Articles: articles}, nil
+}
+
+func (pg *PostgresDB) UpdateArticle(ctx context.Context, req UpdateArticleRequest) (Article, error) {
+	var article Article
+	err := pg.inTx(ctx, "UpdateArticle", func(tx *sql.Tx) error {
+		var version int
+		err := tx.QueryRowContext(ctx, getArticleVersionForUpdate, req.ArticleID, TenantFromContext(ctx)).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrArticleNotFound
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("update article, failed to lock article %v", req.ArticleID)
+			return err
+		}
+		if req.ExpectedVersion != 0 && req.ExpectedVersion != version {
+			return ErrVersionConflict
+		}
+		before, err := auditedArticle.snapshot(ctx, tx, req.ArticleID)
+		if err != nil {
+			return err
+		}
+		articleIDs := []string{req.ArticleID}
+		productsBefore, err := getProductsStock(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("update article, failed to get products stock")
+			return err
+		}
+		err = tx.QueryRowContext(ctx, updateArticle, req.ArticleName, req.Stock, req.ArticleID, TenantFromContext(ctx)).Scan(
+			&article.ArticleID,
+			&article.ArticleName,
+			&article.Stock,
+			&article.Version,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to update article %v", req.ArticleID)
+			return err
+		}
+		err = writeOutboxEvent(
+			ctx,
+			tx,
+			OutboxAggregateArticle,
+			article.ArticleID,
+			OutboxEventArticleUpdated,
+			ArticleEventPayload{ArticleID: article.ArticleID, Name: article.ArticleName, Stock: article.Stock},
+		)
+		if err != nil {
+			return err
+		}
+		err = auditedArticle.record(ctx, tx, req.ArticleID, before, req.ArticleID)
+		if err != nil {
+			return err
+		}
+		productsAfter, err := refreshProductAvailability(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("update article, failed to update product availability")
+			return err
+		}
+		return writeProductStockChanges(ctx, tx, productsBefore, productsAfter)
+	})
+	if err != nil {
+		return Article{}, err
+	}
+	return article, nil
+}
+
+func (pg *PostgresDB) GetProduct(ctx context.Context, productID string) (Product, error) {
+	var product Product
+	err := pg.inReadTx(ctx, "GetProduct", func(tx *sql.Tx) error {
+		var err error
+		product, err = getProduct(ctx, tx, productID)
+		return err
+	})
+	if err != nil {
+		return Product{}, err
+	}
+	return product, nil
+}
+
+func getProduct(ctx context.Context, q queryer, productID string) (Product, error) {
+	var product Product
+	err := q.QueryRowContext(ctx, getProductByID, productID, TenantFromContext(ctx)).Scan(
+		&product.ProductID,
+		&product.ProductName,
+		&product.Version,
+	)
+	if errors.Is(err, sql.ErrNoRows) || pqErrorCode(err) == pqInvalidTextRepresentation {
+		return Product{}, ErrProductNotFound
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to get product %v", productID)
+		return Product{}, err
+	}
+	product.Articles, err = getProductArticles(ctx, q, productID)
+	if err != nil {
+		return Product{}, err
+	}
+	articleIDs := make([]string, 0, len(product.Articles))
+	for _, productArticle := range product.Articles {
+		articleIDs = append(articleIDs, productArticle.ArticleID)
+	}
+	stocks, err := getProductsStock(ctx, q, articleIDs)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to get stock of product %v", productID)
+		return Product{}, err
+	}
+	product.Stock = stocks[productID]
+	return product, nil
+}
+
+func (pg *PostgresDB) UpdateProduct(ctx context.Context, req UpdateProductRequest) (Product, error) {
+	var product Product
+	err := pg.inTx(ctx, "UpdateProduct", func(tx *sql.Tx) error {
+		var version int
+		err := tx.QueryRowContext(ctx, getProductVersionForUpdate, req.ProductID, TenantFromContext(ctx)).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) || pqErrorCode(err) == pqInvalidTextRepresentation {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("update product, failed to lock product %v", req.ProductID)
+			return err
+		}
+		if req.ExpectedVersion != 0 && req.ExpectedVersion != version {
+			return ErrVersionConflict
+		}
+		before, err := auditedProduct.snapshot(ctx, tx, req.ProductID)
+		if err != nil {
+			return err
+		}
+		previousArticles, err := getProductArticles(ctx, tx, req.ProductID)
+		if err != nil {
+			return err
+		}
+		articleIDs := make([]string, 0, len(previousArticles)+len(req.Articles))
+		for _, productArticle := range previousArticles {
+			articleIDs = append(articleIDs, productArticle.ArticleID)
+		}
+		for _, productArticle := range req.Articles {
+			articleIDs = append(articleIDs, productArticle.ArticleID)
+		}
+		productsBefore, err := getProductsStock(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("update product, failed to get products stock")
+			return err
+		}
+		_, err = tx.ExecContext(ctx, updateProduct, req.ProductName, req.ProductID, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to update product %v", req.ProductID)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, deleteProductArticles, req.ProductID, TenantFromContext(ctx))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msgf("failed to delete product_article of product %v", req.ProductID)
+			return err
+		}
+		for _, productArticle := range req.Articles {
+			_, err = tx.ExecContext(
+				ctx,
+				createProductArticle,
+				req.ProductID,
+				productArticle.ArticleID,
+				productArticle.ArticleAmount,
+				TenantFromContext(ctx),
+			)
+			if err != nil {
+				log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create product_article")
+				return err
+			}
+		}
+		err = writeOutboxEvent(
+			ctx,
+			tx,
+			OutboxAggregateProduct,
+			req.ProductID,
+			OutboxEventProductUpdated,
+			ProductEventPayload{ProductID: req.ProductID, Name: req.ProductName, Articles: req.Articles},
+		)
+		if err != nil {
+			return err
+		}
+		err = auditedProduct.record(ctx, tx, req.ProductID, before, req.ProductID)
+		if err != nil {
+			return err
+		}
+		err = deleteOrphanedAvailability(ctx, tx, []string{req.ProductID})
+		if err != nil {
+			return err
+		}
+		productsAfter, err := refreshProductAvailability(ctx, tx, articleIDs)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("update product, failed to update product availability")
+			return err
+		}
+		err = writeProductStockChanges(ctx, tx, productsBefore, productsAfter)
+		if err != nil {
+			return err
+		}
+		product, err = getProduct(ctx, tx, req.ProductID)
+		return err
+	})
+	if err != nil {
+		return Product{}, err
+	}
+	return product, nil
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// WebhookEvent is the body posted to webhook subscribers.
+type WebhookEvent struct {
+	Type       WebhookEventType `json:"type"`
+	OccurredAt time.Time        `json:"occurredAt"`
+	Data       interface{}      `json:"data"`
+}
+
+type productStockEventData struct {
+	ProductID string `json:"productId"`
+	Stock     int    `json:"stock"`
+	Threshold int    `json:"threshold,omitempty"`
+}
+
+type articleStockEventData struct {
+	ArticleID    string `json:"articleId"`
+	Stock        int    `json:"stock"`
+	ReorderPoint int    `json:"reorderPoint"`
+}
+
+func (pg *PostgresDB) CreateWebhookSubscription(ctx context.Context, req WebhookSubscription) (WebhookSubscription, error) {
+	err := pg.inTx(ctx, "CreateWebhookSubscription", func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			createWebhookSubscription,
+			req.URL,
+			req.Secret,
+			pq.Array(req.EventTypes),
+			TenantFromContext(ctx),
+		).Scan(&req.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		return auditedWebhookSubscription.record(ctx, tx, req.SubscriptionID, nil, req.SubscriptionID)
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to create webhook_subscription")
+		return WebhookSubscription{}, err
+	}
+	return req, nil
+}
+
+func (pg *PostgresDB) GetAllWebhookSubscriptions(ctx context.Context) (GetAllWebhookSubscriptionsResponse, error) {
+	ctx, span := startSpan(ctx, "GetAllWebhookSubscriptions")
+	defer span.End()
+	rows, err := pg.Database.QueryContext(ctx, getAllWebhookSubscriptions, TenantFromContext(ctx))
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to get all webhook_subscription")
+		return GetAllWebhookSubscriptionsResponse{}, err
+	}
+	defer rows.Close()
+	subscriptions := make([]WebhookSubscription, 0)
+	for rows.Next() {
+		var subscription WebhookSubscription
+		var eventTypes []string
+		err = rows.Scan(&subscription.SubscriptionID, &subscription.URL, pq.Array(&eventTypes))
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan all webhook_subscription")
+			return GetAllWebhookSubscriptionsResponse{}, err
+		}
+		for _, eventType := range eventTypes {
+			subscription.EventTypes = append(subscription.EventTypes, WebhookEventType(eventType))
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return GetAllWebhookSubscriptionsResponse{
+		Subscriptions: subscriptions,
+	}, rows.Err()
+}
+
+func (pg *PostgresDB) DeleteWebhookSubscription(ctx context.Context, subscriptionID string) error {
+	return pg.inTx(ctx, "DeleteWebhookSubscription", func(tx *sql.Tx) error {
+		before, err := auditedWebhookSubscription.snapshot(ctx, tx, subscriptionID)
+		if pqErrorCode(err) == pqInvalidTextRepresentation {
+			return ErrWebhookSubscriptionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, deleteWebhookSubscription, subscriptionID, TenantFromContext(ctx))
+		if err != nil {
+			if pqErrorCode(err) == pqInvalidTextRepresentation {
+				return ErrWebhookSubscriptionNotFound
+			}
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to delete webhook_subscription")
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrWebhookSubscriptionNotFound
+		}
+		return auditedWebhookSubscription.record(ctx, tx, subscriptionID, before, subscriptionID)
+	})
+}
+
+// ClaimWebhookDeliveries hands out due deliveries and pushes their next
+// attempt past the lease, so that a dispatcher that dies while sending does
+// not lose them and concurrent dispatchers do not send them twice.
+func (pg *PostgresDB) ClaimWebhookDeliveries(
+	ctx context.Context,
+	req ClaimWebhookDeliveriesRequest,
+) (ClaimWebhookDeliveriesResponse, error) {
+	ctx, span := startSpan(ctx, "ClaimWebhookDeliveries")
+	defer span.End()
+	rows, err := pg.Database.QueryContext(ctx, claimWebhookDeliveries, req.Limit, req.Lease.Seconds())
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to claim webhook_delivery")
+		return ClaimWebhookDeliveriesResponse{}, err
+	}
+	defer rows.Close()
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err = rows.Scan(
+			&delivery.DeliveryID,
+			&delivery.EventType,
+			&delivery.Payload,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to scan claimed webhook_delivery")
+			return ClaimWebhookDeliveriesResponse{}, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return ClaimWebhookDeliveriesResponse{
+		Deliveries: deliveries,
+	}, rows.Err()
+}
+
+func (pg *PostgresDB) MarkWebhookDelivered(ctx context.Context, deliveryID int64) error {
+	ctx, span := startSpan(ctx, "MarkWebhookDelivered")
+	defer span.End()
+	_, err := pg.Database.ExecContext(ctx, markWebhookDelivered, deliveryID)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to mark webhook_delivery as delivered")
+	}
+	return err
+}
+
+func (pg *PostgresDB) FailWebhookDelivery(ctx context.Context, req FailWebhookDeliveryRequest) error {
+	ctx, span := startSpan(ctx, "FailWebhookDelivery")
+	defer span.End()
+	_, err := pg.Database.ExecContext(ctx, failWebhookDelivery, req.Error, req.NextAttemptAt, req.GiveUp, req.DeliveryID)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("failed to record webhook_delivery failure")
+	}
+	return err
+}
+
+// enqueueWebhookEvent queues event for every subscription interested in its
+// type. It runs in the caller's transaction so that an event is queued if and
+// only if the change that caused it is committed.
+func enqueueWebhookEvent(ctx context.Context, q queryer, event WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, enqueueWebhookDeliveries, string(event.Type), string(payload), TenantFromContext(ctx))
+	return err
+}
+
+// sellEvents compares the stock of the products and articles touched by
+// selling productID before and after the sale, and returns the events for
+// every threshold that was crossed.
+func sellEvents(
+	productID string,
+	productThreshold int,
+	productsBefore, productsAfter map[string]int,
+	articlesBefore, articlesAfter map[string]articleStock,
+) []WebhookEvent {
+	now := time.Now().UTC()
+	events := []WebhookEvent{{
+		Type:       WebhookEventProductSold,
+		OccurredAt: now,
+		Data:       productStockEventData{ProductID: productID, Stock: productsAfter[productID]},
+	}}
+	for _, id := range sortedKeys(productsAfter) {
+		before, after := productsBefore[id], productsAfter[id]
+		if before > 0 && after <= 0 {
+			events = append(events, WebhookEvent{
+				Type:       WebhookEventProductOutOfStock,
+				OccurredAt: now,
+				Data:       productStockEventData{ProductID: id, Stock: after},
+			})
+		}
+		if productThreshold > 0 && before >= productThreshold && after < productThreshold {
+			events = append(events, WebhookEvent{
+				Type:       WebhookEventProductBelowThreshold,
+				OccurredAt: now,
+				Data:       productStockEventData{ProductID: id, Stock: after, Threshold: productThreshold},
+			})
+		}
+	}
+	for _, id := range sortedKeys(articlesAfter) {
+		before, after := articlesBefore[id], articlesAfter[id]
+		if after.reorderPoint > 0 && before.stock >= after.reorderPoint && after.stock < after.reorderPoint {
+			events = append(events, WebhookEvent{
+				Type:       WebhookEventArticleBelowThreshold,
+				OccurredAt: now,
+				Data: articleStockEventData{
+					ArticleID:    id,
+					Stock:        after.stock,
+					ReorderPoint: after.reorderPoint,
+				},
+			})
+		}
+	}
+	return events
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
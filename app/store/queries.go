@@ -2,27 +2,640 @@ package store
 
 const (
 	createProduct = `
-	INSERT INTO product (product_name)
-	VALUES ($1) RETURNING product_id;`
+	INSERT INTO product (product_name, tenant_id)
+	VALUES ($1, $2) RETURNING product_id;`
 
 	createProductArticle = `
-	INSERT INTO product_article (product_id, article_id, article_amount)
-	VALUES ($1, $2, $3);`
+	INSERT INTO product_article (product_id, article_id, article_amount, tenant_id)
+	VALUES ($1, $2, $3, $4);`
 
-	createArticle = `
-	INSERT INTO article (article_id, stock, article_name)
-	VALUES ($1, $2, $3);`
+	createOrUpdateArticle = `
+	INSERT INTO article (article_id, stock, article_name, tenant_id)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (tenant_id, article_id) DO UPDATE
+	SET stock = EXCLUDED.stock, article_name = EXCLUDED.article_name
+	RETURNING (xmax = 0) AS inserted;`
 
 	getProductArticlesByProductID = `
 	SELECT article_id, article_amount FROM product_article
-	WHERE product_id = $1`
+	WHERE product_id = $1 AND tenant_id = $2`
 
 	updateArticleStockForSellProduct = `
 	UPDATE article SET stock = stock - $1
-	WHERE article_id = $2;`
+	WHERE article_id = $2 AND tenant_id = $3
+	RETURNING stock;`
 
 	getProductsWithStock = `
+	SELECT product.product_id, product.product_name, product.version, product_availability.stock FROM product_availability
+	JOIN product ON product.product_id = product_availability.product_id AND product.tenant_id = product_availability.tenant_id
+	WHERE product_availability.tenant_id = $1;`
+
+	createSupplier = `
+	INSERT INTO supplier (supplier_name, tenant_id)
+	VALUES ($1, $2) RETURNING supplier_id;`
+
+	getAllSuppliers = `
+	SELECT supplier_id, supplier_name FROM supplier
+	WHERE tenant_id = $1
+	ORDER BY supplier_name;`
+
+	upsertArticleSupplier = `
+	INSERT INTO article_supplier (article_id, supplier_id, supplier_sku, lead_time_days, unit_cost_cents, tenant_id)
+	SELECT $1, supplier_id, $3, $4, $5, tenant_id FROM supplier
+	WHERE supplier_id = $2 AND tenant_id = $6
+	ON CONFLICT (tenant_id, article_id, supplier_id) DO UPDATE
+	SET supplier_sku = EXCLUDED.supplier_sku,
+		lead_time_days = EXCLUDED.lead_time_days,
+		unit_cost_cents = EXCLUDED.unit_cost_cents;`
+
+	getArticleSuppliersBySupplierID = `
+	SELECT article_id, supplier_id, supplier_sku, lead_time_days, unit_cost_cents FROM article_supplier
+	WHERE supplier_id = $1 AND tenant_id = $2
+	ORDER BY article_id;`
+
+	createPurchaseOrder = `
+	INSERT INTO purchase_order (supplier_id, tenant_id)
+	SELECT supplier_id, tenant_id FROM supplier
+	WHERE supplier_id = $1 AND tenant_id = $2
+	RETURNING purchase_order_id;`
+
+	createPurchaseOrderLine = `
+	INSERT INTO purchase_order_line (purchase_order_id, article_id, quantity_ordered, unit_cost_cents, tenant_id)
+	VALUES ($1, $2, $3, $4, $5);`
+
+	getPurchaseOrderByID = `
+	SELECT purchase_order_id, supplier_id, state FROM purchase_order
+	WHERE purchase_order_id = $1 AND tenant_id = $2;`
+
+	getPurchaseOrderByIDForUpdate = `
+	SELECT purchase_order_id, supplier_id, state FROM purchase_order
+	WHERE purchase_order_id = $1 AND tenant_id = $2
+	FOR UPDATE;`
+
+	getPurchaseOrderLinesByPurchaseOrderID = `
+	SELECT article_id, quantity_ordered, quantity_received, unit_cost_cents FROM purchase_order_line
+	WHERE purchase_order_id = $1 AND tenant_id = $2
+	ORDER BY article_id;`
+
+	updatePurchaseOrderState = `
+	UPDATE purchase_order SET state = $1
+	WHERE purchase_order_id = $2 AND tenant_id = $3;`
+
+	updatePurchaseOrderLineReceived = `
+	UPDATE purchase_order_line SET quantity_received = quantity_received + $1
+	WHERE purchase_order_id = $2 AND article_id = $3 AND tenant_id = $4;`
+
+	updateArticleStockForReceipt = `
+	UPDATE article SET stock = stock + $1
+	WHERE article_id = $2 AND tenant_id = $3
+	RETURNING stock;`
+
+	createStockHistory = `
+	INSERT INTO stock_history (article_id, delta, reason, reference, actor, tenant_id)
+	VALUES ($1, $2, $3, $4, $5, $6);`
+
+	updateArticleReplenishment = `
+	UPDATE article SET reorder_point = $1, safety_stock = $2, reorder_quantity = $3
+	WHERE article_id = $4 AND tenant_id = $5;`
+
+	getReplenishmentCandidates = `
+	WITH on_order AS (
+		SELECT purchase_order_line.article_id,
+			SUM(purchase_order_line.quantity_ordered - purchase_order_line.quantity_received) AS quantity
+		FROM purchase_order_line
+		JOIN purchase_order ON purchase_order.purchase_order_id = purchase_order_line.purchase_order_id
+		WHERE purchase_order.state IN ('draft', 'sent', 'partially_received')
+		AND purchase_order_line.tenant_id = $1
+		GROUP BY purchase_order_line.article_id
+	), preferred_supplier AS (
+		SELECT DISTINCT ON (article_id) article_id, supplier_id, lead_time_days, unit_cost_cents
+		FROM article_supplier
+		WHERE tenant_id = $1
+		ORDER BY article_id, lead_time_days, unit_cost_cents
+	)
+	SELECT article.article_id, article.article_name, article.stock,
+		article.reorder_point, article.safety_stock, article.reorder_quantity,
+		COALESCE(on_order.quantity, 0),
+		COALESCE(preferred_supplier.supplier_id::text, ''),
+		COALESCE(preferred_supplier.lead_time_days, 0),
+		COALESCE(preferred_supplier.unit_cost_cents, 0)
+	FROM article
+	LEFT JOIN on_order ON on_order.article_id = article.article_id
+	LEFT JOIN preferred_supplier ON preferred_supplier.article_id = article.article_id
+	WHERE article.reorder_point > 0 AND article.tenant_id = $1
+	ORDER BY article.article_id;`
+
+	// a sale writes a row per article of the product, the units sold of a
+	// product are the rows of any of its articles
+	getReplenishmentConsumers = `
+	WITH sold_articles AS (
+		SELECT reference AS product_id, article_id, COUNT(*) AS quantity FROM stock_history
+		WHERE reason = 'sale' AND created_at >= now() - make_interval(days => $1) AND tenant_id = $2
+		GROUP BY reference, article_id
+	), sold AS (
+		SELECT product_id, MAX(quantity) AS quantity FROM sold_articles
+		GROUP BY product_id
+	), reserved AS (
+		SELECT product_id, SUM(quantity) AS quantity FROM reservation
+		WHERE tenant_id = $2
+		GROUP BY product_id
+	)
+	SELECT product_article.article_id, product.product_id, product.product_name, product_article.article_amount,
+		COALESCE(sold.quantity, 0), COALESCE(reserved.quantity, 0)
+	FROM product_article
+	JOIN product ON product.product_id = product_article.product_id AND product.tenant_id = product_article.tenant_id
+	JOIN article ON article.article_id = product_article.article_id AND article.tenant_id = product_article.tenant_id
+	LEFT JOIN sold ON sold.product_id = product.product_id::text
+	LEFT JOIN reserved ON reserved.product_id = product.product_id
+	WHERE article.reorder_point > 0 AND product_article.tenant_id = $2
+	ORDER BY product_article.article_id, product.product_name, product.product_id;`
+
+	createReservation = `
+	INSERT INTO reservation (product_id, quantity, reference, tenant_id)
+	SELECT product_id, $2::integer, $3::varchar, tenant_id FROM product
+	WHERE product_id = $1 AND tenant_id = $4
+	RETURNING reservation_id;`
+
+	deleteReservation = `
+	DELETE FROM reservation
+	WHERE reservation_id = $1 AND tenant_id = $2;`
+
+	getArticlesStockForUpdate = `
+	SELECT article_id, stock, reorder_point FROM article
+	WHERE article_id = ANY($1) AND tenant_id = $2
+	ORDER BY article_id
+	FOR UPDATE;`
+
+	getProductsStockByArticleIDs = `
 	SELECT product_article.product_id, MIN(article.stock / product_article.article_amount) as stock FROM product_article
-	LEFT JOIN article ON article.article_id = product_article.article_id
+	LEFT JOIN article ON article.article_id = product_article.article_id AND article.tenant_id = product_article.tenant_id
+	WHERE product_article.tenant_id = $2 AND product_article.product_id IN (
+		SELECT product_id FROM product_article WHERE article_id = ANY($1) AND tenant_id = $2
+	)
 	GROUP BY product_article.product_id;`
+
+	createWebhookSubscription = `
+	INSERT INTO webhook_subscription (url, secret, event_types, tenant_id)
+	VALUES ($1, $2, $3, $4) RETURNING subscription_id;`
+
+	getAllWebhookSubscriptions = `
+	SELECT subscription_id, url, event_types FROM webhook_subscription
+	WHERE tenant_id = $1
+	ORDER BY created_at;`
+
+	deleteWebhookSubscription = `
+	DELETE FROM webhook_subscription
+	WHERE subscription_id = $1 AND tenant_id = $2;`
+
+	enqueueWebhookDeliveries = `
+	INSERT INTO webhook_delivery (subscription_id, event_type, payload)
+	SELECT subscription_id, $1::text, $2::jsonb FROM webhook_subscription
+	WHERE $1::text = ANY(event_types) AND tenant_id = $3;`
+
+	claimWebhookDeliveries = `
+	UPDATE webhook_delivery SET next_attempt_at = now() + make_interval(secs => $2)
+	FROM webhook_subscription
+	WHERE webhook_subscription.subscription_id = webhook_delivery.subscription_id
+	AND webhook_delivery.delivery_id IN (
+		SELECT delivery_id FROM webhook_delivery
+		WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+		ORDER BY delivery_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING webhook_delivery.delivery_id, webhook_delivery.event_type, webhook_delivery.payload,
+		webhook_delivery.attempts, webhook_subscription.url, webhook_subscription.secret;`
+
+	markWebhookDelivered = `
+	UPDATE webhook_delivery SET delivered_at = now(), attempts = attempts + 1, last_error = NULL
+	WHERE delivery_id = $1;`
+
+	failWebhookDelivery = `
+	UPDATE webhook_delivery SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2,
+		failed_at = CASE WHEN $3::boolean THEN now() END
+	WHERE delivery_id = $4;`
+
+	createOutboxEvent = `
+	INSERT INTO outbox_event (aggregate_type, aggregate_id, event_type, payload, tenant_id)
+	VALUES ($1, $2, $3, $4, $5);`
+
+	tryOutboxDispatchLock = `
+	SELECT pg_try_advisory_xact_lock($1);`
+
+	claimOutboxEvents = `
+	WITH lease AS (SELECT uuid_generate_v4() AS token)
+	UPDATE outbox_event SET leased_until = now() + make_interval(secs => $2), lease_token = lease.token
+	FROM lease
+	WHERE outbox_event.event_id IN (
+		SELECT event_id FROM outbox_event pending
+		WHERE pending.published_at IS NULL AND (pending.leased_until IS NULL OR pending.leased_until < now())
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox_event earlier
+			WHERE earlier.published_at IS NULL AND earlier.leased_until >= now()
+			AND earlier.aggregate_type = pending.aggregate_type AND earlier.aggregate_id = pending.aggregate_id
+			AND earlier.event_id < pending.event_id
+		)
+		ORDER BY event_id
+		LIMIT $1
+	)
+	RETURNING outbox_event.event_id, outbox_event.tenant_id, outbox_event.aggregate_type, outbox_event.aggregate_id,
+		outbox_event.event_type, outbox_event.payload, outbox_event.created_at, lease.token;`
+
+	releaseOutboxEvents = `
+	UPDATE outbox_event SET published_at = CASE WHEN event_id = ANY($1) THEN now() END,
+		leased_until = NULL, lease_token = NULL
+	WHERE lease_token = $2;`
+
+	getOutboxEventsAfter = `
+	SELECT event_id, tenant_id, aggregate_type, aggregate_id, event_type, payload, created_at FROM outbox_event
+	WHERE event_id > $1 AND event_type = ANY($2) AND tenant_id = $4
+	ORDER BY event_id
+	LIMIT $3;`
+
+	getOutboxEventByID = `
+	SELECT event_id, tenant_id, aggregate_type, aggregate_id, event_type, payload, created_at FROM outbox_event
+	WHERE event_id = $1;`
+
+	getAllOutboxEventsAfter = `
+	SELECT event_id, tenant_id, aggregate_type, aggregate_id, event_type, payload, created_at FROM outbox_event
+	WHERE event_id > $1
+	ORDER BY event_id;`
+
+	acquireIdempotencyKey = `
+	INSERT INTO idempotency_key (idempotency_key, request_hash, tenant_id, subject)
+	VALUES ($1, $2, $5, $6)
+	ON CONFLICT (tenant_id, subject, idempotency_key) DO UPDATE
+	SET request_hash = EXCLUDED.request_hash, completed = false, status_code = NULL,
+		content_type = NULL, response_body = NULL, locked_at = now(), created_at = now(),
+		lock_token = uuid_generate_v4()
+	WHERE idempotency_key.created_at < now() - make_interval(secs => $3)
+	OR (NOT idempotency_key.completed AND idempotency_key.request_hash = EXCLUDED.request_hash
+		AND idempotency_key.locked_at < now() - make_interval(secs => $4))
+	RETURNING lock_token;`
+
+	getIdempotencyKey = `
+	SELECT idempotency_key, request_hash, completed, COALESCE(status_code, 0),
+		COALESCE(content_type, ''), COALESCE(response_body, '')
+	FROM idempotency_key
+	WHERE idempotency_key = $1 AND tenant_id = $2 AND subject = $3;`
+
+	completeIdempotencyKey = `
+	UPDATE idempotency_key SET completed = true, status_code = $1, content_type = $2, response_body = $3
+	WHERE idempotency_key = $4 AND tenant_id = $5 AND subject = $6 AND lock_token = $7 AND NOT completed;`
+
+	deleteIdempotencyKey = `
+	DELETE FROM idempotency_key
+	WHERE idempotency_key = $1 AND tenant_id = $2 AND subject = $3 AND lock_token = $4 AND NOT completed;`
+
+	deleteExpiredIdempotencyKeys = `
+	SELECT delete_expired_idempotency_keys($1);`
+
+	getArticleByID = `
+	SELECT article_id, article_name, stock, version FROM article
+	WHERE article_id = $1 AND tenant_id = $2;`
+
+	getArticleVersionForUpdate = `
+	SELECT version FROM article
+	WHERE article_id = $1 AND tenant_id = $2
+	FOR UPDATE;`
+
+	updateArticle = `
+	UPDATE article SET article_name = $1, stock = $2
+	WHERE article_id = $3 AND tenant_id = $4
+	RETURNING article_id, article_name, stock, version;`
+
+	getAllProductArticles = `
+	SELECT product_id, article_id, article_amount FROM product_article
+	WHERE tenant_id = $1
+	ORDER BY product_id, article_id;`
+
+	getArticlesByIDs = `
+	SELECT article_id, article_name, stock, version FROM article
+	WHERE article_id = ANY($1) AND tenant_id = $2;`
+
+	streamProductsWithArticles = `
+	SELECT product.product_id, product.product_name, product.version, product_availability.stock,
+	product_article.article_id, product_article.article_amount FROM product_availability
+	JOIN product ON product.product_id = product_availability.product_id AND product.tenant_id = product_availability.tenant_id
+	LEFT JOIN product_article ON product_article.product_id = product.product_id AND product_article.tenant_id = product.tenant_id
+	WHERE product_availability.tenant_id = $1
+	ORDER BY product.product_id, product_article.article_id;`
+
+	getAllArticles = `
+	SELECT article_id, article_name, stock, version FROM article
+	WHERE tenant_id = $1
+	ORDER BY article_id;`
+
+	getProductByID = `
+	SELECT product_id, product_name, version FROM product
+	WHERE product_id = $1 AND tenant_id = $2;`
+
+	getProductVersionForUpdate = `
+	SELECT version FROM product
+	WHERE product_id = $1 AND tenant_id = $2
+	FOR UPDATE;`
+
+	updateProduct = `
+	UPDATE product SET product_name = $1
+	WHERE product_id = $2 AND tenant_id = $3
+	RETURNING version;`
+
+	deleteProductArticles = `
+	DELETE FROM product_article
+	WHERE product_id = $1 AND tenant_id = $2;`
+
+	createAPIKey = `
+	INSERT INTO api_key (name, key_prefix, key_hash, scopes, tenant_id)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING api_key_id, created_at;`
+
+	getAllAPIKeys = `
+	SELECT api_key_id, tenant_id, name, key_prefix, scopes, created_at, revoked_at FROM api_key
+	WHERE tenant_id = $1
+	ORDER BY created_at;`
+
+	getActiveAPIKeyByHash = `
+	SELECT api_key_id, tenant_id, name, key_prefix, scopes, created_at, revoked_at FROM api_key
+	WHERE key_hash = $1 AND revoked_at IS NULL;`
+
+	revokeAPIKey = `
+	UPDATE api_key SET revoked_at = COALESCE(revoked_at, now())
+	WHERE api_key_id = $1 AND tenant_id = $2;`
+
+	setTenant = `
+	SELECT set_config('app.tenant_id', $1, true);`
+
+	getTenants = `
+	SELECT inventory_tenants();`
+
+	createAuditRecord = `
+	INSERT INTO audit_log (tenant_id, actor, route, request_id, method, path,
+		resource_type, resource_id, before, after, outcome, status_code)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
+
+	getAuditRecords = `
+	SELECT audit_id, occurred_at, COALESCE(actor, ''), route, request_id, method, path,
+		COALESCE(resource_type, ''), COALESCE(resource_id, ''), before, after, outcome, COALESCE(status_code, 0)
+	FROM audit_log
+	WHERE tenant_id = $8
+	AND ($1::text = '' OR actor = $1::text)
+	AND ($2::text = '' OR resource_type = $2::text)
+	AND ($3::text = '' OR resource_id = $3::text)
+	AND ($4::timestamp IS NULL OR occurred_at >= $4::timestamp)
+	AND ($5::timestamp IS NULL OR occurred_at < $5::timestamp)
+	AND ($6::bigint = 0 OR audit_id < $6::bigint)
+	ORDER BY audit_id DESC
+	LIMIT $7;`
+
+	snapshotArticle = `
+	SELECT to_jsonb(article) FROM article
+	WHERE article_id = $1 AND tenant_id = $2;`
+
+	snapshotProduct = `
+	SELECT to_jsonb(product) || jsonb_build_object('articles', COALESCE((
+		SELECT jsonb_agg(to_jsonb(product_article) ORDER BY product_article.article_id) FROM product_article
+		WHERE product_article.product_id = product.product_id AND product_article.tenant_id = product.tenant_id
+	), '[]'::jsonb))
+	FROM product
+	WHERE product_id = $1 AND tenant_id = $2;`
+
+	snapshotReservation = `
+	SELECT to_jsonb(reservation) FROM reservation
+	WHERE reservation_id = $1 AND tenant_id = $2;`
+
+	snapshotSupplier = `
+	SELECT to_jsonb(supplier) FROM supplier
+	WHERE supplier_id = $1 AND tenant_id = $2;`
+
+	snapshotArticleSupplier = `
+	SELECT to_jsonb(article_supplier) FROM article_supplier
+	WHERE supplier_id = $1 AND article_id = $2 AND tenant_id = $3;`
+
+	snapshotPurchaseOrder = `
+	SELECT to_jsonb(purchase_order) || jsonb_build_object('lines', COALESCE((
+		SELECT jsonb_agg(to_jsonb(purchase_order_line) ORDER BY purchase_order_line.article_id) FROM purchase_order_line
+		WHERE purchase_order_line.purchase_order_id = purchase_order.purchase_order_id
+		AND purchase_order_line.tenant_id = purchase_order.tenant_id
+	), '[]'::jsonb))
+	FROM purchase_order
+	WHERE purchase_order_id = $1 AND tenant_id = $2;`
+
+	snapshotWebhookSubscription = `
+	SELECT to_jsonb(webhook_subscription) - 'secret' FROM webhook_subscription
+	WHERE subscription_id = $1 AND tenant_id = $2;`
+
+	snapshotAPIKey = `
+	SELECT to_jsonb(api_key) - 'key_hash' FROM api_key
+	WHERE api_key_id = $1 AND tenant_id = $2;`
+
+	getInventoryMetrics = `
+	SELECT
+		(SELECT COALESCE(SUM(stock), 0) FROM article WHERE tenant_id = $1),
+		(SELECT count(*) FROM product_availability WHERE tenant_id = $1 AND stock <= 0);`
+	getLastMigration = `
+	SELECT filename FROM databasechangelog
+	ORDER BY orderexecuted DESC LIMIT 1;`
+
+	getMigrationFilenames = `
+	SELECT filename FROM databasechangelog
+	ORDER BY orderexecuted;`
+
+	getOutboxBacklog = `
+	SELECT count(*) FROM outbox_event WHERE published_at IS NULL;`
+
+	getReplicationLag = `
+	SELECT CASE
+		WHEN pg_last_wal_receive_lsn() IS NULL OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END;`
+
+	lockProductAvailabilityByArticleIDs = `
+	SELECT product_id FROM product_availability
+	WHERE tenant_id = $2 AND product_id IN (
+		SELECT product_id FROM product_article WHERE article_id = ANY($1) AND tenant_id = $2
+	)
+	ORDER BY product_id
+	FOR UPDATE;`
+
+	lockProductAvailabilityByProductIDs = `
+	SELECT product_id FROM product_availability
+	WHERE tenant_id = $2 AND product_id = ANY($1::uuid[])
+	ORDER BY product_id
+	FOR UPDATE;`
+
+	upsertProductAvailability = `
+	INSERT INTO product_availability (tenant_id, product_id, stock)
+	SELECT $1, product_stock.product_id, product_stock.stock FROM unnest($2::uuid[], $3::integer[]) AS product_stock(product_id, stock)
+	ON CONFLICT (tenant_id, product_id) DO UPDATE SET stock = EXCLUDED.stock, updated_at = now()
+	WHERE product_availability.stock <> EXCLUDED.stock;`
+
+	deleteOrphanedProductAvailability = `
+	DELETE FROM product_availability
+	WHERE tenant_id = $2 AND product_id = ANY($1::uuid[]) AND NOT EXISTS (
+		SELECT 1 FROM product_article
+		WHERE product_article.product_id = product_availability.product_id
+		AND product_article.tenant_id = product_availability.tenant_id
+	);`
+
+	recomputeProductAvailability = `
+	INSERT INTO product_availability (tenant_id, product_id, stock)
+	SELECT product_article.tenant_id, product_article.product_id, COALESCE(MIN(article.stock / product_article.article_amount), 0)
+	FROM product_article
+	LEFT JOIN article ON article.article_id = product_article.article_id AND article.tenant_id = product_article.tenant_id
+	WHERE product_article.tenant_id = $2 AND product_article.product_id = ANY($1::uuid[])
+	GROUP BY product_article.tenant_id, product_article.product_id
+	ON CONFLICT (tenant_id, product_id) DO UPDATE SET stock = EXCLUDED.stock, updated_at = now();`
+
+	getProductAvailabilityDrift = `
+	SELECT COALESCE(actual.product_id, stored.product_id), stored.stock, actual.stock FROM (
+		SELECT product_article.product_id, COALESCE(MIN(article.stock / product_article.article_amount), 0) AS stock
+		FROM product_article
+		LEFT JOIN article ON article.article_id = product_article.article_id AND article.tenant_id = product_article.tenant_id
+		WHERE product_article.tenant_id = $1
+		GROUP BY product_article.product_id
+	) AS actual
+	FULL OUTER JOIN (
+		SELECT product_id, stock FROM product_availability WHERE tenant_id = $1
+	) AS stored ON stored.product_id = actual.product_id
+	WHERE stored.stock IS DISTINCT FROM actual.stock
+	ORDER BY 1;`
+
+	// databasechangelog is the table liquibase kept the applied changesets
+	// in, databases it migrated carry on with the same one.
+	createMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS databasechangelog (
+		id varchar(255) not null,
+		author varchar(255) not null,
+		filename varchar(255) not null,
+		dateexecuted timestamp not null,
+		orderexecuted integer not null,
+		exectype varchar(10) not null,
+		md5sum varchar(35),
+		description varchar(255),
+		comments varchar(255),
+		tag varchar(255),
+		liquibase varchar(20),
+		contexts varchar(255),
+		labels varchar(255),
+		deployment_id varchar(10)
+	);`
+
+	disableStatementTimeout = `
+	SET statement_timeout = 0;`
+
+	resetStatementTimeout = `
+	RESET statement_timeout;`
+
+	lockMigrations = `
+	SELECT pg_advisory_lock($1);`
+
+	unlockMigrations = `
+	SELECT pg_advisory_unlock($1);`
+
+	getAppliedMigrations = `
+	SELECT filename, dateexecuted FROM databasechangelog
+	ORDER BY orderexecuted;`
+
+	createMigration = `
+	INSERT INTO databasechangelog (id, author, filename, dateexecuted, orderexecuted, exectype, md5sum, description)
+	SELECT $1, 'warehouse', $2, now(), COALESCE(MAX(orderexecuted), 0) + 1, 'EXECUTED', $3, 'sql'
+	FROM databasechangelog;`
+
+	deleteMigration = `
+	DELETE FROM databasechangelog WHERE filename = $1;`
 )
+
+// statementNames labels the latency of the statements above.
+var statementNames = map[string]string{
+	createProduct:                          "createProduct",
+	createProductArticle:                   "createProductArticle",
+	createOrUpdateArticle:                  "createOrUpdateArticle",
+	getProductArticlesByProductID:          "getProductArticlesByProductID",
+	updateArticleStockForSellProduct:       "updateArticleStockForSellProduct",
+	getProductsWithStock:                   "getProductsWithStock",
+	createSupplier:                         "createSupplier",
+	getAllSuppliers:                        "getAllSuppliers",
+	upsertArticleSupplier:                  "upsertArticleSupplier",
+	getArticleSuppliersBySupplierID:        "getArticleSuppliersBySupplierID",
+	createPurchaseOrder:                    "createPurchaseOrder",
+	createPurchaseOrderLine:                "createPurchaseOrderLine",
+	getPurchaseOrderByID:                   "getPurchaseOrderByID",
+	getPurchaseOrderByIDForUpdate:          "getPurchaseOrderByIDForUpdate",
+	getPurchaseOrderLinesByPurchaseOrderID: "getPurchaseOrderLinesByPurchaseOrderID",
+	updatePurchaseOrderState:               "updatePurchaseOrderState",
+	updatePurchaseOrderLineReceived:        "updatePurchaseOrderLineReceived",
+	updateArticleStockForReceipt:           "updateArticleStockForReceipt",
+	createStockHistory:                     "createStockHistory",
+	updateArticleReplenishment:             "updateArticleReplenishment",
+	getReplenishmentCandidates:             "getReplenishmentCandidates",
+	getReplenishmentConsumers:              "getReplenishmentConsumers",
+	createReservation:                      "createReservation",
+	deleteReservation:                      "deleteReservation",
+	getArticlesStockForUpdate:              "getArticlesStockForUpdate",
+	getProductsStockByArticleIDs:           "getProductsStockByArticleIDs",
+	createWebhookSubscription:              "createWebhookSubscription",
+	getAllWebhookSubscriptions:             "getAllWebhookSubscriptions",
+	deleteWebhookSubscription:              "deleteWebhookSubscription",
+	enqueueWebhookDeliveries:               "enqueueWebhookDeliveries",
+	claimWebhookDeliveries:                 "claimWebhookDeliveries",
+	markWebhookDelivered:                   "markWebhookDelivered",
+	failWebhookDelivery:                    "failWebhookDelivery",
+	createOutboxEvent:                      "createOutboxEvent",
+	tryOutboxDispatchLock:                  "tryOutboxDispatchLock",
+	claimOutboxEvents:                      "claimOutboxEvents",
+	releaseOutboxEvents:                    "releaseOutboxEvents",
+	getOutboxEventsAfter:                   "getOutboxEventsAfter",
+	getOutboxEventByID:                     "getOutboxEventByID",
+	getAllOutboxEventsAfter:                "getAllOutboxEventsAfter",
+	acquireIdempotencyKey:                  "acquireIdempotencyKey",
+	getIdempotencyKey:                      "getIdempotencyKey",
+	completeIdempotencyKey:                 "completeIdempotencyKey",
+	deleteIdempotencyKey:                   "deleteIdempotencyKey",
+	deleteExpiredIdempotencyKeys:           "deleteExpiredIdempotencyKeys",
+	getArticleByID:                         "getArticleByID",
+	getArticleVersionForUpdate:             "getArticleVersionForUpdate",
+	updateArticle:                          "updateArticle",
+	getAllProductArticles:                  "getAllProductArticles",
+	getArticlesByIDs:                       "getArticlesByIDs",
+	streamProductsWithArticles:             "streamProductsWithArticles",
+	getAllArticles:                         "getAllArticles",
+	getProductByID:                         "getProductByID",
+	getProductVersionForUpdate:             "getProductVersionForUpdate",
+	updateProduct:                          "updateProduct",
+	deleteProductArticles:                  "deleteProductArticles",
+	createAPIKey:                           "createAPIKey",
+	getAllAPIKeys:                          "getAllAPIKeys",
+	getActiveAPIKeyByHash:                  "getActiveAPIKeyByHash",
+	revokeAPIKey:                           "revokeAPIKey",
+	setTenant:                              "setTenant",
+	getTenants:                             "getTenants",
+	createAuditRecord:                      "createAuditRecord",
+	getAuditRecords:                        "getAuditRecords",
+	snapshotArticle:                        "snapshotArticle",
+	snapshotProduct:                        "snapshotProduct",
+	snapshotReservation:                    "snapshotReservation",
+	snapshotSupplier:                       "snapshotSupplier",
+	snapshotArticleSupplier:                "snapshotArticleSupplier",
+	snapshotPurchaseOrder:                  "snapshotPurchaseOrder",
+	snapshotWebhookSubscription:            "snapshotWebhookSubscription",
+	snapshotAPIKey:                         "snapshotAPIKey",
+	getInventoryMetrics:                    "getInventoryMetrics",
+	getLastMigration:                       "getLastMigration",
+	getMigrationFilenames:                  "getMigrationFilenames",
+	getOutboxBacklog:                       "getOutboxBacklog",
+	getReplicationLag:                      "getReplicationLag",
+	lockProductAvailabilityByArticleIDs:    "lockProductAvailabilityByArticleIDs",
+	lockProductAvailabilityByProductIDs:    "lockProductAvailabilityByProductIDs",
+	upsertProductAvailability:              "upsertProductAvailability",
+	deleteOrphanedProductAvailability:      "deleteOrphanedProductAvailability",
+	recomputeProductAvailability:           "recomputeProductAvailability",
+	getProductAvailabilityDrift:            "getProductAvailabilityDrift",
+	createMigrationsTable:                  "createMigrationsTable",
+	disableStatementTimeout:                "disableStatementTimeout",
+	resetStatementTimeout:                  "resetStatementTimeout",
+	lockMigrations:                         "lockMigrations",
+	unlockMigrations:                       "unlockMigrations",
+	getAppliedMigrations:                   "getAppliedMigrations",
+	createMigration:                        "createMigration",
+	deleteMigration:                        "deleteMigration",
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DefaultTenant owns the data of callers that don't name a tenant, and every
+// row that existed before tenants were introduced.
+const DefaultTenant = "default"
+
+type tenantKey struct{}
+
+// WithTenant scopes every query run with ctx to tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant, or DefaultTenant.
+func TenantFromContext(ctx context.Context) string {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	if !ok || tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// GetTenants lists every tenant that has articles, for the background jobs
+// that work on all of them.
+func (pg *PostgresDB) GetTenants(ctx context.Context) ([]string, error) {
+	ctx, span := startSpan(ctx, "GetTenants")
+	defer span.End()
+	rows, err := pg.Database.QueryContext(ctx, getTenants)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tenants := make([]string, 0)
+	for rows.Next() {
+		var tenant string
+		err = rows.Scan(&tenant)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+// setTenantForTx makes the row level security policies of the tables
+// evaluate against the tenant of ctx until tx ends.
+func setTenantForTx(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, setTenant, TenantFromContext(ctx))
+	return err
+}
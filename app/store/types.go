@@ -1,5 +1,11 @@
 package store
 
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
 type RemoveProductAndUpdateArticlesRequest struct {
 	ProductID string
 }
@@ -9,17 +15,26 @@ type GetAllProductsResponse struct {
 }
 
 type ProductArticle struct {
-	ArticleID     string
-	ArticleAmount int
+	ArticleID     string `json:"articleId"`
+	ArticleAmount int    `json:"amount"`
 }
 
 type Product struct {
 	ProductName string
 	ProductID   string
 	Stock       int
+	Version     int
 	Articles    []ProductArticle
 }
 
+// UpdateProductRequest replaces the name and articles of a product. The
+// update fails with ErrVersionConflict unless the product is still at
+// ExpectedVersion, 0 skips the check.
+type UpdateProductRequest struct {
+	Product
+	ExpectedVersion int
+}
+
 type CreateOrUpdateProductsRequest struct {
 	Products []Product
 }
@@ -28,8 +43,452 @@ type Article struct {
 	Stock       int
 	ArticleName string
 	ArticleID   string
+	Version     int
+}
+
+// UpdateArticleRequest sets the name and stock of an article. The update
+// fails with ErrVersionConflict unless the article is still at
+// ExpectedVersion, 0 skips the check.
+type UpdateArticleRequest struct {
+	Article
+	ExpectedVersion int
 }
 
 type CreateOrUpdateArticlesRequest struct {
 	Articles []Article
 }
+
+type GetAllArticlesResponse struct {
+	Articles []Article
+}
+
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+)
+
+// ImportDiff is what an import would change, found by running it in a
+// transaction that is rolled back.
+type ImportDiff struct {
+	// Items are the outcomes of the articles or products of the request, in
+	// its order.
+	Items []ImportItem
+	// ProductStocks are the existing products whose stock would change.
+	ProductStocks []ProductStockChange
+}
+
+// ImportItem is what an import would do with one article or product.
+type ImportItem struct {
+	// Action is ImportActionCreate or ImportActionUpdate, empty when the item
+	// can't be imported.
+	Action string
+	// Before is the stored article an update would change.
+	Before *Article
+	// Stock is the stock a created product would have.
+	Stock int
+	// MissingArticles are the articles a product uses that don't exist.
+	MissingArticles []string
+}
+
+type ProductStockChange struct {
+	ProductID string
+	Before    int
+	After     int
+}
+
+type Supplier struct {
+	SupplierID   string
+	SupplierName string
+}
+
+type CreateSupplierRequest struct {
+	SupplierName string
+}
+
+type GetAllSuppliersResponse struct {
+	Suppliers []Supplier
+}
+
+type ArticleSupplier struct {
+	ArticleID     string
+	SupplierID    string
+	SupplierSKU   string
+	LeadTimeDays  int
+	UnitCostCents int64
+}
+
+type GetArticleSuppliersResponse struct {
+	ArticleSuppliers []ArticleSupplier
+}
+
+type PurchaseOrderState string
+
+const (
+	PurchaseOrderStateDraft             PurchaseOrderState = "draft"
+	PurchaseOrderStateSent              PurchaseOrderState = "sent"
+	PurchaseOrderStatePartiallyReceived PurchaseOrderState = "partially_received"
+	PurchaseOrderStateClosed            PurchaseOrderState = "closed"
+)
+
+type PurchaseOrderLine struct {
+	ArticleID        string
+	QuantityOrdered  int
+	QuantityReceived int
+	UnitCostCents    int64
+}
+
+type PurchaseOrder struct {
+	PurchaseOrderID string
+	SupplierID      string
+	State           PurchaseOrderState
+	Lines           []PurchaseOrderLine
+}
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID string
+	Lines      []PurchaseOrderLine
+}
+
+type UpdatePurchaseOrderStateRequest struct {
+	PurchaseOrderID string
+	State           PurchaseOrderState
+}
+
+type ReceiptLine struct {
+	ArticleID string
+	Quantity  int
+}
+
+type ReceivePurchaseOrderRequest struct {
+	PurchaseOrderID string
+	Lines           []ReceiptLine
+}
+
+type StockHistoryReason string
+
+const (
+	StockHistoryReasonReceipt StockHistoryReason = "receipt"
+	StockHistoryReasonSale    StockHistoryReason = "sale"
+)
+
+type ArticleReplenishment struct {
+	ArticleID       string
+	ReorderPoint    int
+	SafetyStock     int
+	ReorderQuantity int
+}
+
+// ReplenishmentCandidate is an article with a reorder point together with
+// everything needed to decide whether it has to be reordered.
+type ReplenishmentCandidate struct {
+	ArticleReplenishment
+	ArticleName string
+	Stock       int
+	// OnOrder is the quantity still to be received on open purchase orders.
+	OnOrder int
+	// Consumers are the products using the article.
+	Consumers []ReplenishmentConsumer
+	// SupplierID is empty when the article has no supplier.
+	SupplierID    string
+	LeadTimeDays  int
+	UnitCostCents int64
+}
+
+// ReplenishmentConsumer is a product using an article of a candidate.
+type ReplenishmentConsumer struct {
+	ProductID     string
+	ProductName   string
+	ArticleAmount int
+	// Sold is the number of the product sold in the demand window.
+	Sold int
+	// Reserved is the number of the product held by reservations.
+	Reserved int
+}
+
+// Reservation holds units of a product for an order that isn't sold yet.
+type Reservation struct {
+	ReservationID string
+	ProductID     string
+	Quantity      int
+	Reference     string
+}
+
+type GetReplenishmentCandidatesRequest struct {
+	DemandWindowDays int
+}
+
+type GetReplenishmentCandidatesResponse struct {
+	Candidates []ReplenishmentCandidate
+}
+
+type WebhookEventType string
+
+const (
+	WebhookEventProductSold           WebhookEventType = "product.sold"
+	WebhookEventProductOutOfStock     WebhookEventType = "product.out_of_stock"
+	WebhookEventProductBelowThreshold WebhookEventType = "product.below_threshold"
+	WebhookEventArticleBelowThreshold WebhookEventType = "article.below_threshold"
+)
+
+type WebhookSubscription struct {
+	SubscriptionID string
+	URL            string
+	Secret         string
+	EventTypes     []WebhookEventType
+}
+
+type GetAllWebhookSubscriptionsResponse struct {
+	Subscriptions []WebhookSubscription
+}
+
+// WebhookDelivery is a queued event for a single subscription.
+type WebhookDelivery struct {
+	DeliveryID int64
+	EventType  WebhookEventType
+	Payload    []byte
+	Attempts   int
+	URL        string
+	Secret     string
+}
+
+type ClaimWebhookDeliveriesRequest struct {
+	Limit int
+	// Lease is how long claimed deliveries are hidden from other
+	// dispatchers before they are handed out again.
+	Lease time.Duration
+}
+
+type ClaimWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery
+}
+
+type FailWebhookDeliveryRequest struct {
+	DeliveryID    int64
+	Error         string
+	NextAttemptAt time.Time
+	// GiveUp marks the delivery as failed for good.
+	GiveUp bool
+}
+
+const (
+	OutboxAggregateArticle = "article"
+	OutboxAggregateProduct = "product"
+
+	OutboxEventArticleCreated = "article.created"
+	OutboxEventArticleUpdated = "article.updated"
+	OutboxEventProductCreated = "product.created"
+	OutboxEventProductSold    = "product.sold"
+	OutboxEventProductUpdated = "product.updated"
+	// OutboxEventProductStockChanged is written for every product whose
+	// buildable stock changed, whatever the reason.
+	OutboxEventProductStockChanged = "product.stock_changed"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// it describes. Events of one aggregate are published in EventID order.
+type OutboxEvent struct {
+	EventID       int64           `json:"eventId"`
+	TenantID      string          `json:"tenantId"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateID   string          `json:"aggregateId"`
+	EventType     string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"occurredAt"`
+}
+
+// ArticleEventPayload is the payload of article.created and article.updated.
+type ArticleEventPayload struct {
+	ArticleID string `json:"articleId"`
+	Name      string `json:"name,omitempty"`
+	Stock     int    `json:"stock"`
+}
+
+// ProductEventPayload is the payload of product.created, product.updated and
+// product.sold.
+type ProductEventPayload struct {
+	ProductID string           `json:"productId"`
+	Name      string           `json:"name,omitempty"`
+	Articles  []ProductArticle `json:"articles,omitempty"`
+}
+
+// ProductStockEventPayload is the payload of product.stock_changed.
+type ProductStockEventPayload struct {
+	ProductID string `json:"productId"`
+	Stock     int    `json:"stock"`
+}
+
+type GetOutboxEventsRequest struct {
+	AfterEventID int64
+	EventTypes   []string
+	Limit        int
+}
+
+type ProcessOutboxEventsRequest struct {
+	Limit int
+	// Lease is how long the claimed events are hidden from other dispatchers,
+	// it must outlast Publish.
+	Lease time.Duration
+	// Publish is called with the pending events in order and returns the ids
+	// of the events it published.
+	Publish func(ctx context.Context, events []OutboxEvent) []int64
+}
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key. Completed is false while the first request is running.
+type IdempotencyRecord struct {
+	Key string
+	// Subject is the caller the key belongs to, keys of different callers
+	// don't collide.
+	Subject     string
+	RequestHash string
+	// LockToken identifies the request that acquired the key, only it can
+	// complete or release the key.
+	LockToken   string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+type AcquireIdempotencyKeyRequest struct {
+	Key         string
+	Subject     string
+	RequestHash string
+	// Retention is how long a key is remembered, expired keys can be reused.
+	Retention time.Duration
+	// LockTimeout is how long a key stays claimed by a request that never
+	// completed, for example because the server crashed.
+	LockTimeout time.Duration
+}
+
+type AcquireIdempotencyKeyResponse struct {
+	// Acquired is true when the caller has to execute the request.
+	Acquired bool
+	// Record is the existing record when the key was not acquired, and holds
+	// the lock token of the caller otherwise.
+	Record IdempotencyRecord
+}
+
+// APIKey is a client credential. Only the sha256 of the key is stored, the
+// prefix is kept to tell keys apart when listing them.
+type APIKey struct {
+	APIKeyID  string
+	TenantID  string
+	Name      string
+	KeyPrefix string
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string
+	KeyPrefix string
+	KeyHash   string
+	Scopes    []string
+}
+
+type GetAllAPIKeysResponse struct {
+	APIKeys []APIKey
+}
+
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "success"
+	AuditOutcomeFailure AuditOutcome = "failure"
+	// AuditOutcomeReplayed is a request answered with the stored response of
+	// its idempotency key, without changing anything.
+	AuditOutcomeReplayed AuditOutcome = "replayed"
+)
+
+const (
+	AuditResourceArticle             = "article"
+	AuditResourceProduct             = "product"
+	AuditResourceSupplier            = "supplier"
+	AuditResourceArticleSupplier     = "article_supplier"
+	AuditResourcePurchaseOrder       = "purchase_order"
+	AuditResourceReservation         = "reservation"
+	AuditResourceWebhookSubscription = "webhook_subscription"
+	AuditResourceAPIKey              = "api_key"
+)
+
+// AuditRequest describes the API call the changes done with a context are
+// audited for.
+type AuditRequest struct {
+	Route     string
+	RequestID string
+	Method    string
+	Path      string
+}
+
+// AuditRecord is one entry of the append-only audit log. Changes committed by
+// the store are recorded per changed resource with a snapshot of its rows
+// before and after the change. A call that didn't commit any change is
+// recorded once with its outcome and status code.
+type AuditRecord struct {
+	AuditID      int64
+	OccurredAt   time.Time
+	Actor        string
+	Route        string
+	RequestID    string
+	Method       string
+	Path         string
+	ResourceType string
+	ResourceID   string
+	Before       json.RawMessage
+	After        json.RawMessage
+	Outcome      AuditOutcome
+	StatusCode   int
+}
+
+type GetAuditRecordsRequest struct {
+	// Actor, ResourceType and ResourceID are ignored when empty, From and To
+	// when nil.
+	Actor        string
+	ResourceType string
+	ResourceID   string
+	From         *time.Time
+	To           *time.Time
+	// BeforeID pages back through the log, 0 starts with the newest record.
+	BeforeID int64
+	Limit    int
+}
+
+type GetAuditRecordsResponse struct {
+	Records []AuditRecord
+}
+
+// InventoryMetrics sums up the stock of a tenant.
+type InventoryMetrics struct {
+	Tenant             string
+	ArticleUnits       int64
+	ProductsOutOfStock int64
+}
+
+// ProductAvailabilityDrift is a product whose stored availability differs
+// from the one computed from its articles. Stored is nil when the product is
+// missing from product_availability, Actual when it uses no articles anymore.
+type ProductAvailabilityDrift struct {
+	Tenant    string
+	ProductID string
+	Stored    *int
+	Actual    *int
+}
+
+// Migration is a changeset of the schema. Down reverts it, it is empty when
+// the changeset can't be reverted.
+type Migration struct {
+	Name string
+	Up   string
+	Down string
+}
+
+// MigrationStatus tells whether a migration was applied. Unknown migrations
+// were applied to the database but aren't part of this build, e.g. by a newer
+// version of the service.
+type MigrationStatus struct {
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
@@ -0,0 +1,142 @@
+package suppliers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const maxSupplierNameLength = 50
+
+var (
+	errInvalidSupplierName = errors.New("supplier name must be between 1 and 50 characters")
+	errInvalidArticleLink  = errors.New("articleId and supplierSku are required, leadTimeDays and unitCostCents must not be negative")
+)
+
+type Handler struct {
+	SuppliersStore store.SuppliersStore
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// CreateSupplier is http api POST /suppliers
+func (h *Handler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &CreateSupplierRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateSupplier failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	if req.Name == "" || len(req.Name) > maxSupplierNameLength {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errInvalidSupplierName.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	supplier, err := h.SuppliersStore.CreateSupplier(ctx, store.CreateSupplierRequest{SupplierName: req.Name})
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateSupplier failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteCreatedResponse(ctx, w, Supplier{
+		SupplierID: supplier.SupplierID,
+		Name:       supplier.SupplierName,
+	})
+}
+
+// GetAllSuppliers is http api GET /suppliers
+func (h *Handler) GetAllSuppliers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.SuppliersStore.GetAllSuppliers(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllSuppliers failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := &GetAllSuppliersResponse{Suppliers: make([]Supplier, 0, len(res.Suppliers))}
+	for _, supplier := range res.Suppliers {
+		response.Suppliers = append(response.Suppliers, Supplier{
+			SupplierID: supplier.SupplierID,
+			Name:       supplier.SupplierName,
+		})
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
+
+// CreateOrUpdateArticleSupplier is http api POST /suppliers/{supplierId}/articles
+func (h *Handler) CreateOrUpdateArticleSupplier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &ArticleSupplier{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticleSupplier failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	if req.ArticleID == "" || req.SupplierSKU == "" || req.LeadTimeDays < 0 || req.UnitCostCents < 0 {
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, errInvalidArticleLink.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	err = h.SuppliersStore.CreateOrUpdateArticleSupplier(ctx, store.ArticleSupplier{
+		ArticleID:     req.ArticleID,
+		SupplierID:    mux.Vars(r)["supplierId"],
+		SupplierSKU:   req.SupplierSKU,
+		LeadTimeDays:  req.LeadTimeDays,
+		UnitCostCents: req.UnitCostCents,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrSupplierNotFound) || errors.Is(err, store.ErrArticleNotFound) {
+			log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticleSupplier failed to execute database query, resource not found")
+			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+			responses.WriteError(ctx, w, http.StatusNotFound, body)
+			return
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateOrUpdateArticleSupplier failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteCreatedResponse(ctx, w, nil)
+}
+
+// GetArticleSuppliers is http api GET /suppliers/{supplierId}/articles
+func (h *Handler) GetArticleSuppliers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.SuppliersStore.GetArticleSuppliers(ctx, mux.Vars(r)["supplierId"])
+	if err != nil {
+		if errors.Is(err, store.ErrSupplierNotFound) {
+			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+			responses.WriteError(ctx, w, http.StatusNotFound, body)
+			return
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetArticleSuppliers failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := &GetArticleSuppliersResponse{Articles: make([]ArticleSupplier, 0, len(res.ArticleSuppliers))}
+	for _, articleSupplier := range res.ArticleSuppliers {
+		response.Articles = append(response.Articles, ArticleSupplier{
+			ArticleID:     articleSupplier.ArticleID,
+			SupplierSKU:   articleSupplier.SupplierSKU,
+			LeadTimeDays:  articleSupplier.LeadTimeDays,
+			UnitCostCents: articleSupplier.UnitCostCents,
+		})
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
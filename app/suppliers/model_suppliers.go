@@ -0,0 +1,25 @@
+package suppliers
+
+type CreateSupplierRequest struct {
+	Name string `json:"name"`
+}
+
+type Supplier struct {
+	SupplierID string `json:"supplierId"`
+	Name       string `json:"name"`
+}
+
+type GetAllSuppliersResponse struct {
+	Suppliers []Supplier `json:"suppliers"`
+}
+
+type ArticleSupplier struct {
+	ArticleID     string `json:"articleId"`
+	SupplierSKU   string `json:"supplierSku"`
+	LeadTimeDays  int    `json:"leadTimeDays"`
+	UnitCostCents int64  `json:"unitCostCents"`
+}
+
+type GetArticleSuppliersResponse struct {
+	Articles []ArticleSupplier `json:"articles"`
+}
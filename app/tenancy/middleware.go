@@ -0,0 +1,89 @@
+package tenancy
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const HeaderTenantID = "X-Tenant-ID"
+
+var (
+	tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+	errInvalidTenantID = errors.New(HeaderTenantID + " must be 1 to 64 letters, digits, - or _")
+	errTenantMismatch  = errors.New("credentials are not valid for the requested tenant")
+	errUnboundIdentity = errors.New("credentials are not bound to a tenant")
+)
+
+// Middleware resolves the tenant a request acts for.
+type Middleware struct {
+	// MultiTenant rejects callers without admin scope whose credentials
+	// aren't bound to a tenant, instead of letting them act for the default
+	// one.
+	MultiTenant bool
+}
+
+func NewMiddleware(multiTenant bool) *Middleware {
+	return &Middleware{MultiTenant: multiTenant}
+}
+
+// Handler resolves the tenant a request acts for and scopes the store to it.
+// Credentials bound to a tenant always act for it, an X-Tenant-ID naming
+// another one is rejected. The header picks the tenant for admin credentials
+// that aren't bound to one, and for every caller when authentication is
+// disabled. Everybody else acts for the default tenant, or is rejected when
+// m.MultiTenant is set.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		requested := r.Header.Get(HeaderTenantID)
+		if requested != "" && !tenantIDPattern.MatchString(requested) {
+			body := responses.GenerateErrorResponseBody(ctx, responses.InvalidTenant, errInvalidTenantID.Error())
+			responses.WriteError(ctx, w, http.StatusBadRequest, body)
+			return
+		}
+		tenant, err := m.resolve(r, requested)
+		if err != nil {
+			body := responses.GenerateErrorResponseBody(ctx, responses.Forbidden, err.Error())
+			responses.WriteError(ctx, w, http.StatusForbidden, body)
+			return
+		}
+		ctx = store.WithTenant(ctx, tenant)
+		logger := zerolog.Ctx(ctx)
+		if logger.GetLevel() == zerolog.Disabled {
+			logger = &log.Logger
+		}
+		ctx = logger.With().Str("tenant", tenant).Logger().WithContext(ctx)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *Middleware) resolve(r *http.Request, requested string) (string, error) {
+	id, authenticated := auth.IdentityFromContext(r.Context())
+	switch {
+	case authenticated && id.Tenant != "":
+		if requested != "" && requested != id.Tenant {
+			return "", errTenantMismatch
+		}
+		return id.Tenant, nil
+	case authenticated && !id.HasScope(auth.ScopeAdmin):
+		if m.MultiTenant {
+			return "", errUnboundIdentity
+		}
+		if requested != "" && requested != store.DefaultTenant {
+			return "", errTenantMismatch
+		}
+		return store.DefaultTenant, nil
+	case requested != "":
+		return requested, nil
+	}
+	return store.DefaultTenant, nil
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/server/recorder"
+)
+
+// Middleware continues the trace of the caller, or starts one, with a server
+// span per request. The trace and span ids are added to the log lines of the
+// request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+		name := r.Method
+		attributes := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				name += " " + template
+				attributes = append(attributes, attribute.String("http.route", template))
+			}
+		}
+		ctx, span := Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+		defer span.End()
+		sc := span.SpanContext()
+		logger := zerolog.Ctx(ctx)
+		if logger.GetLevel() == zerolog.Disabled {
+			logger = &log.Logger
+		}
+		ctx = logger.With().Str("traceId", sc.TraceID().String()).Str("spanId", sc.SpanID().String()).Logger().WithContext(ctx)
+
+		rec := recorder.New(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		statusCode := rec.StatusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		if statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(statusCode)+" "+http.StatusText(statusCode))
+		}
+	})
+}
+
+// Handler traces next as a span of its own, to tell the time spent in the
+// handler from the one spent in the middlewares.
+func Handler(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Start(r.Context(), name)
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
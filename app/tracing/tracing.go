@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationScope = "github.com/warehouse"
+
+// propagator reads and writes the W3C traceparent and tracestate headers.
+var propagator = propagation.TraceContext{}
+
+// NewProvider returns a tracer provider that exports the sampled spans to
+// exporter in batches. Without an exporter spans only carry ids, for the log
+// lines and responses. sampleRatio is the share of traces started here that
+// are sampled, traces started by a caller follow its decision. The
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES environment variables take
+// precedence over serviceName.
+func NewProvider(ctx context.Context, exporter sdktrace.SpanExporter, serviceName string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	res, err := resource.New(
+		ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+// SetProvider makes provider start the spans of Start.
+func SetProvider(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+}
+
+// Start starts a span with the provider set by SetProvider, the caller must
+// end it. The span is a child of the current span of ctx, or of the span of
+// the caller extracted into ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationScope).Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed with err, nil is ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Extract returns ctx with the span context of the traceparent header of the
+// caller, ctx itself when the header is missing or invalid.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject sets the traceparent header of an outgoing request to the current
+// span of ctx.
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceIDFromContext returns the trace id of ctx as hex, or an empty string.
+func TraceIDFromContext(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.TraceID().IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,155 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/store"
+)
+
+const (
+	generatedSecretBytes = 32
+	maxSecretLength      = 128
+)
+
+var (
+	errInvalidURL        = errors.New("url must be an absolute http or https url")
+	errMissingEventTypes = errors.New("at least one event type is required")
+	errSecretTooLong     = fmt.Errorf("secret must not be longer than %d characters", maxSecretLength)
+)
+
+var knownEventTypes = map[store.WebhookEventType]struct{}{
+	store.WebhookEventProductSold:           {},
+	store.WebhookEventProductOutOfStock:     {},
+	store.WebhookEventProductBelowThreshold: {},
+	store.WebhookEventArticleBelowThreshold: {},
+}
+
+type Handler struct {
+	WebhooksStore store.WebhooksStore
+	// AllowPrivateTargets accepts subscriptions to loopback, link-local and
+	// private addresses.
+	AllowPrivateTargets bool
+}
+
+func NewHandler(allowPrivateTargets bool) *Handler {
+	return &Handler{AllowPrivateTargets: allowPrivateTargets}
+}
+
+// CreateWebhook is http api POST /webhooks
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := &CreateWebhookRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateWebhook failed to unmarshal request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.UnMarshalRequestError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	dbReq, err := getCreateWebhookDBRequest(req, h.AllowPrivateTargets)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateWebhook get database request from http request")
+		body := responses.GenerateErrorResponseBody(ctx, responses.InvalidBodyError, err.Error())
+		responses.WriteError(ctx, w, http.StatusBadRequest, body)
+		return
+	}
+	res, err := h.WebhooksStore.CreateWebhookSubscription(ctx, dbReq)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("CreateWebhook failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := getWebhookResponseFromDBResult(res)
+	response.Secret = res.Secret
+	responses.WriteCreatedResponse(ctx, w, response)
+}
+
+// GetAllWebhooks is http api GET /webhooks
+func (h *Handler) GetAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	res, err := h.WebhooksStore.GetAllWebhookSubscriptions(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("GetAllWebhooks failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	response := &GetAllWebhooksResponse{Webhooks: make([]Webhook, 0, len(res.Subscriptions))}
+	for _, subscription := range res.Subscriptions {
+		response.Webhooks = append(response.Webhooks, getWebhookResponseFromDBResult(subscription))
+	}
+	responses.WriteOkResponse(ctx, w, response)
+}
+
+// DeleteWebhook is http api DELETE /webhooks/{subscriptionId}
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.WebhooksStore.DeleteWebhookSubscription(ctx, mux.Vars(r)["subscriptionId"])
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookSubscriptionNotFound) {
+			body := responses.GenerateErrorResponseBody(ctx, responses.ResourceNotFound, err.Error())
+			responses.WriteError(ctx, w, http.StatusNotFound, body)
+			return
+		}
+		log.Ctx(ctx).Error().AnErr("error", err).Msg("DeleteWebhook failed to execute database query")
+		body := responses.GenerateErrorResponseBody(ctx, responses.DataBaseQueryFailureError, err.Error())
+		responses.WriteError(ctx, w, http.StatusInternalServerError, body)
+		return
+	}
+	responses.WriteNoContentResponse(ctx, w)
+}
+
+func getWebhookResponseFromDBResult(subscription store.WebhookSubscription) Webhook {
+	eventTypes := make([]string, 0, len(subscription.EventTypes))
+	for _, eventType := range subscription.EventTypes {
+		eventTypes = append(eventTypes, string(eventType))
+	}
+	return Webhook{
+		SubscriptionID: subscription.SubscriptionID,
+		URL:            subscription.URL,
+		EventTypes:     eventTypes,
+	}
+}
+
+func getCreateWebhookDBRequest(req *CreateWebhookRequest, allowPrivateTargets bool) (store.WebhookSubscription, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil {
+		return store.WebhookSubscription{}, errInvalidURL
+	}
+	if err = checkTarget(target, allowPrivateTargets); err != nil {
+		return store.WebhookSubscription{}, err
+	}
+	if len(req.EventTypes) == 0 {
+		return store.WebhookSubscription{}, errMissingEventTypes
+	}
+	res := store.WebhookSubscription{URL: req.URL, Secret: req.Secret}
+	for _, eventType := range req.EventTypes {
+		if _, ok := knownEventTypes[store.WebhookEventType(eventType)]; !ok {
+			return store.WebhookSubscription{}, fmt.Errorf("unknown event type %q", eventType)
+		}
+		res.EventTypes = append(res.EventTypes, store.WebhookEventType(eventType))
+	}
+	if len(res.Secret) > maxSecretLength {
+		return store.WebhookSubscription{}, errSecretTooLong
+	}
+	if res.Secret == "" {
+		secret := make([]byte, generatedSecretBytes)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return store.WebhookSubscription{}, err
+		}
+		res.Secret = hex.EncodeToString(secret)
+	}
+	return res, nil
+}
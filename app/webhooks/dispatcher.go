@@ -0,0 +1,166 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/store"
+	"github.com/warehouse/app/tracing"
+)
+
+const (
+	dispatchBatchSize = 10
+	maxBackoff        = time.Hour
+
+	SignatureHeader = "X-Warehouse-Signature"
+	TimestampHeader = "X-Warehouse-Timestamp"
+	EventHeader     = "X-Warehouse-Event"
+	DeliveryHeader  = "X-Warehouse-Delivery"
+)
+
+// Dispatcher posts queued webhook deliveries to their subscribers. Failed
+// deliveries are retried with exponential backoff until MaxAttempts is
+// reached. The queue lives in Postgres, so deliveries survive restarts.
+type Dispatcher struct {
+	Store       store.WebhooksStore
+	Client      *http.Client
+	Interval    time.Duration
+	MaxAttempts int
+}
+
+// NewDispatcher returns a dispatcher that refuses to deliver to private
+// addresses unless allowPrivateTargets.
+func NewDispatcher(
+	webhooksStore store.WebhooksStore,
+	interval, timeout time.Duration,
+	maxAttempts int,
+	allowPrivateTargets bool,
+) *Dispatcher {
+	return &Dispatcher{
+		Store:       webhooksStore,
+		Client:      newClient(timeout, allowPrivateTargets),
+		Interval:    interval,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// Run dispatches due deliveries every Interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := d.DispatchDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Error().AnErr("error", err).Msg("webhook dispatch failed")
+			}
+		}
+	}
+}
+
+// DispatchDue sends one batch of due deliveries.
+func (d *Dispatcher) DispatchDue(ctx context.Context) error {
+	res, err := d.Store.ClaimWebhookDeliveries(ctx, store.ClaimWebhookDeliveriesRequest{
+		Limit: dispatchBatchSize,
+		// the batch is sent sequentially, keep it hidden until all of it timed out
+		Lease: d.Client.Timeout*dispatchBatchSize + time.Minute,
+	})
+	if err != nil {
+		return err
+	}
+	for _, delivery := range res.Deliveries {
+		sendErr := d.send(ctx, delivery)
+		if sendErr == nil {
+			err = d.Store.MarkWebhookDelivered(ctx, delivery.DeliveryID)
+		} else {
+			attempts := delivery.Attempts + 1
+			giveUp := attempts >= d.MaxAttempts
+			log.Warn().
+				AnErr("error", sendErr).
+				Int64("deliveryId", delivery.DeliveryID).
+				Int("attempts", attempts).
+				Bool("giveUp", giveUp).
+				Msg("webhook delivery failed")
+			err = d.Store.FailWebhookDelivery(ctx, store.FailWebhookDeliveryRequest{
+				DeliveryID:    delivery.DeliveryID,
+				Error:         sendErr.Error(),
+				NextAttemptAt: time.Now().Add(backoff(attempts)),
+				GiveUp:        giveUp,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery store.WebhookDelivery) (err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"POST webhook",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", delivery.URL), attribute.String("webhook.event", string(delivery.EventType))),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	tracing.Inject(ctx, req.Header)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.DeliveryID, 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("subscriber responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the value of the signature header for body sent at timestamp.
+// Receivers recompute it with their secret as hex(HMAC-SHA256(timestamp + "." + body))
+// and should reject old timestamps to prevent replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait after every failed attempt, capped at maxBackoff.
+func backoff(attempts int) time.Duration {
+	if attempts >= 12 {
+		return maxBackoff
+	}
+	wait := time.Second << attempts
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
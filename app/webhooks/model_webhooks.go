@@ -0,0 +1,20 @@
+package webhooks
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	// Secret is generated when empty.
+	Secret string `json:"secret"`
+}
+
+type Webhook struct {
+	SubscriptionID string   `json:"subscriptionId"`
+	URL            string   `json:"url"`
+	EventTypes     []string `json:"eventTypes"`
+	// Secret is only returned when the subscription is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type GetAllWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errPrivateTarget = errors.New("webhook target is a loopback, link-local or private address")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, net.IP
+// doesn't count it as private.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkTarget rejects subscription urls that aren't http or https, and those
+// naming a private address unless allowPrivate. Host names are only resolved
+// when delivering, by the dialer of newClient.
+func checkTarget(target *url.URL, allowPrivate bool) error {
+	if !target.IsAbs() || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return errInvalidURL
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errPrivateTarget
+	}
+	if ip := net.ParseIP(host); ip != nil && privateIP(ip) {
+		return errPrivateTarget
+	}
+	return nil
+}
+
+// privateIP reports whether ip is not a public unicast address.
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsUnspecified() ||
+		ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// newClient returns the client of the deliveries. Unless allowPrivate it
+// refuses to connect to private addresses, whatever the host name of the
+// subscription or of a redirect resolves to at that time, and doesn't use a
+// proxy, which would connect on its behalf.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	if allowPrivate {
+		return &http.Client{Timeout: timeout}
+	}
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return errPrivateTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -1,26 +1,206 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/warehouse/app/cli"
 	"github.com/warehouse/app/server"
 )
 
-func main() {
-	log.Info().Msg("starting warehouse service")
+const usage = `usage: warehouse [command]
+
+commands:
+  serve                                  run the service, the default
+  import articles|products <file>        import a body of POST /articles or POST /products, - reads stdin
+  products list                          list the products with their stock
+  products sell <productId> -qty n       sell n units of a product
+  stock adjust <articleId> -by n         add n, which may be negative, to the stock of an article
+  export articles|products               write the articles or products as a body import takes
+  migrate up|down [-steps n]|status      manage the schema of the database
+  check-availability [-fix]              compare the stored availability of the products with their articles
 
+import, products, stock and export talk to the service of -server, or to the
+database when it is empty, with -api-key and -tenant. -o table|json picks the
+output.
+`
+
+func main() {
 	cfg, err := server.GetConfigurationFromEnv()
 	if err != nil {
 		log.Error().AnErr("error", err).Msg("reading configuration failed")
 		os.Exit(1)
 	}
 
-	err = server.StartServer(cfg)
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "serve":
+		serve(cfg)
+	case "check-availability":
+		checkAvailability(cfg, os.Args[2:])
+	case "migrate":
+		migrate(cfg, os.Args[2:])
+	case "import", "products", "stock", "export":
+		runTool(cfg, command, os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func serve(cfg server.Configuration) {
+	log.Info().Msg("starting warehouse service")
+	err := server.StartServer(cfg)
 	if err != nil {
 		log.Warn().AnErr("error", err).Msg("stopped warehouse service")
 		os.Exit(1)
 	}
 	log.Info().Msg("stopped warehouse service")
 }
+
+// runTool runs the commands working on the data of a tenant. They exit with 1
+// when the command fails and with 2 when it is misused.
+func runTool(cfg server.Configuration, command string, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	subcommand := args[0]
+	name := command + " " + subcommand
+	opts := cli.OptionsFromConfig(cfg)
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&opts.Server, "server", opts.Server, "URL of the service, the database is used when empty")
+	flags.StringVar(&opts.APIKey, "api-key", opts.APIKey, "api key sent to the service")
+	flags.StringVar(&opts.Tenant, "tenant", opts.Tenant, "tenant the command works on")
+	flags.StringVar(&opts.Output, "o", opts.Output, "output, table or json")
+	quantity := flags.Int("qty", 1, "units products sell sells")
+	delta := flags.Int("by", 0, "what stock adjust adds to the stock")
+	args = parseInterspersed(flags, args[1:])
+
+	argsWanted := map[string]int{
+		"import articles": 1,
+		"import products": 1,
+		"products list":   0,
+		"products sell":   1,
+		"stock adjust":    1,
+		"export articles": 0,
+		"export products": 0,
+	}
+	wanted, ok := argsWanted[name]
+	if !ok || len(args) != wanted {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	client, err := cli.Connect(ctx, cfg, opts)
+	if err != nil {
+		log.Error().AnErr("error", err).Msgf("%s failed to connect", name)
+		os.Exit(1)
+	}
+	defer client.Close()
+	ctx = cli.Context(ctx, opts)
+
+	switch name {
+	case "import articles", "import products":
+		err = importFile(ctx, client, subcommand, args[0])
+	case "products list":
+		err = cli.ListProducts(ctx, client, opts.Output, os.Stdout)
+	case "products sell":
+		var sold int
+		sold, err = cli.SellProduct(ctx, client, args[0], *quantity)
+		fmt.Printf("sold %d of %d\n", sold, *quantity)
+	case "stock adjust":
+		article, adjustErr := cli.AdjustStock(ctx, client, args[0], *delta)
+		err = adjustErr
+		if err == nil {
+			err = cli.WriteArticle(article, opts.Output, os.Stdout)
+		}
+	default:
+		err = cli.Export(ctx, client, subcommand, os.Stdout)
+	}
+	if err != nil {
+		// the deferred Close doesn't run on exit
+		client.Close()
+		log.Error().AnErr("error", err).Msgf("%s failed", name)
+		os.Exit(1)
+	}
+}
+
+func importFile(ctx context.Context, client cli.Client, kind, filename string) error {
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	imported, err := cli.Import(ctx, client, kind, r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d %s\n", imported, kind)
+	return nil
+}
+
+// parseInterspersed parses flags wherever they are among args, e.g. both
+// `products sell -qty 2 <id>` and `products sell <id> -qty 2`, and returns
+// the other arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0, len(args))
+	for {
+		_ = flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// checkAvailability exits with 1 when products drifted and weren't fixed, so
+// that a scheduled check can alert on it.
+func checkAvailability(cfg server.Configuration, args []string) {
+	flags := flag.NewFlagSet("check-availability", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "overwrite drifted products with the recomputed availability")
+	_ = flags.Parse(args)
+
+	drifted, err := server.CheckAvailability(cfg, *fix, os.Stdout)
+	if err != nil {
+		log.Error().AnErr("error", err).Msg("checking product availability failed")
+		os.Exit(2)
+	}
+	if drifted > 0 && !*fix {
+		os.Exit(1)
+	}
+}
+
+// migrate runs `migrate up`, `migrate down [-steps n]` or `migrate status`.
+func migrate(cfg server.Configuration, args []string) {
+	action := "status"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	steps := flags.Int("steps", 1, "how many migrations down reverts")
+	_ = flags.Parse(args)
+
+	err := server.Migrate(cfg, action, *steps, os.Stdout)
+	if err != nil {
+		log.Error().AnErr("error", err).Msgf("migrate %s failed", action)
+		os.Exit(1)
+	}
+}
@@ -1 +1,176 @@
 package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/store"
+)
+
+type versionedResponse struct {
+	status int
+	etag   string
+	body   string
+}
+
+func TestArticleETag(t *testing.T) {
+	tenant := "article-etag-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"10"}]}`, http.StatusCreated)
+
+	res := versionedRequest(t, tenant, http.MethodGet, "/articles/1", "", "")
+	var article struct {
+		Stock   string `json:"stock"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(res.body), &article); err != nil {
+		t.Fatalf("couldn't decode article %s: %v", res.body, err)
+	}
+	if res.status != http.StatusOK || res.etag != `"1"` || article.Version != 1 {
+		t.Fatalf("got status %d with ETag %s and version %d, want 200 with the ETag of version 1", res.status, res.etag, article.Version)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		ifMatch string
+		want    int
+		etag    string
+	}{
+		{"current version", `"1"`, http.StatusOK, `"2"`},
+		{"stale version", `"1"`, http.StatusPreconditionFailed, ""},
+		{"any version", "*", http.StatusOK, `"3"`},
+		{"no If-Match", "", http.StatusOK, `"4"`},
+		{"unquoted", "4", http.StatusBadRequest, ""},
+		{"weak", `W/"4"`, http.StatusBadRequest, ""},
+		{"list", `"3", "4"`, http.StatusBadRequest, ""},
+		{"not a version", `"abc"`, http.StatusBadRequest, ""},
+		{"version 0", `"0"`, http.StatusBadRequest, ""},
+	} {
+		res = versionedRequest(t, tenant, http.MethodPut, "/articles/1", tc.ifMatch, `{"name":"leg","stock":"20"}`)
+		if res.status != tc.want || res.etag != tc.etag {
+			t.Errorf("%s: got status %d with ETag %q, want %d with %q: %s", tc.name, res.status, res.etag, tc.want, tc.etag, res.body)
+		}
+		if tc.want == http.StatusPreconditionFailed && !strings.Contains(res.body, `"E010"`) {
+			t.Errorf("%s: got %s, want the version conflict error code", tc.name, res.body)
+		}
+	}
+	if res = versionedRequest(t, tenant, http.MethodGet, "/articles/1", "", ""); res.etag != `"4"` {
+		t.Errorf("got ETag %s after three updates, want \"4\"", res.etag)
+	}
+	if res = versionedRequest(t, tenant, http.MethodPut, "/articles/2", `"1"`, `{"name":"leg","stock":"20"}`); res.status != http.StatusNotFound {
+		t.Errorf("got status %d updating a missing article, want 404", res.status)
+	}
+
+	// the store reports the conflict as ErrVersionConflict
+	ctx := store.WithTenant(context.Background(), tenant)
+	_, err := testDB.UpdateArticle(ctx, store.UpdateArticleRequest{
+		Article:         store.Article{ArticleID: "1", ArticleName: "leg", Stock: 30},
+		ExpectedVersion: 3,
+	})
+	if !errors.Is(err, store.ErrVersionConflict) {
+		t.Errorf("got %v updating a stale version in the store, want ErrVersionConflict", err)
+	}
+	if stock := getTenantArticleStock(t, tenant, "1"); stock != 20 {
+		t.Errorf("got stock %d after the rejected updates, want 20", stock)
+	}
+}
+
+func TestArticleConcurrentUpdates(t *testing.T) {
+	tenant := "article-concurrent-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"10"}]}`, http.StatusCreated)
+
+	// two admins edit what they both read as version 1, only the first update
+	// goes through
+	const editors = 2
+	statuses := make(chan int, editors)
+	var wg sync.WaitGroup
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func(stock string) {
+			defer wg.Done()
+			statuses <- versionedRequest(t, tenant, http.MethodPut, "/articles/1", `"1"`, `{"name":"leg","stock":"`+stock+`"}`).status
+		}(strconv.Itoa(10 + i))
+	}
+	wg.Wait()
+	close(statuses)
+	got := make(map[int]int)
+	for status := range statuses {
+		got[status]++
+	}
+	if got[http.StatusOK] != 1 || got[http.StatusPreconditionFailed] != editors-1 {
+		t.Errorf("got statuses %v for concurrent updates of the same version, want one 200 and 412 for the others", got)
+	}
+	if res := versionedRequest(t, tenant, http.MethodGet, "/articles/1", "", ""); res.etag != `"2"` {
+		t.Errorf("got ETag %s after the concurrent updates, want a single update", res.etag)
+	}
+}
+
+func TestProductETag(t *testing.T) {
+	tenant := "product-etag-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	path := "/products/" + productID
+	update := `{"name":"desk","contain_articles":[{"art_id":"1","amount_of":"2"}]}`
+
+	if res := versionedRequest(t, tenant, http.MethodGet, path, "", ""); res.status != http.StatusOK || res.etag != `"1"` {
+		t.Fatalf("got status %d with ETag %s, want 200 with the ETag of version 1", res.status, res.etag)
+	}
+	if res := versionedRequest(t, tenant, http.MethodPut, path, `"1"`, update); res.status != http.StatusOK || res.etag != `"2"` {
+		t.Errorf("got status %d with ETag %s for the current version, want 200 with \"2\"", res.status, res.etag)
+	}
+	if res := versionedRequest(t, tenant, http.MethodPut, path, `"1"`, update); res.status != http.StatusPreconditionFailed {
+		t.Errorf("got status %d for a stale version, want 412", res.status)
+	}
+	if res := versionedRequest(t, tenant, http.MethodPut, path, "*", update); res.status != http.StatusOK || res.etag != `"3"` {
+		t.Errorf("got status %d with ETag %s for If-Match *, want 200 with \"3\"", res.status, res.etag)
+	}
+	if res := versionedRequest(t, tenant, http.MethodPut, path, "three", update); res.status != http.StatusBadRequest {
+		t.Errorf("got status %d for a malformed If-Match, want 400", res.status)
+	}
+
+	ctx := store.WithTenant(context.Background(), tenant)
+	_, err := testDB.UpdateProduct(ctx, store.UpdateProductRequest{
+		Product: store.Product{
+			ProductID:   productID,
+			ProductName: "desk",
+			Articles:    []store.ProductArticle{{ArticleID: "1", ArticleAmount: 1}},
+		},
+		ExpectedVersion: 2,
+	})
+	if !errors.Is(err, store.ErrVersionConflict) {
+		t.Errorf("got %v updating a stale version in the store, want ErrVersionConflict", err)
+	}
+}
+
+// versionedRequest makes a request of tenant with an If-Match header unless
+// ifMatch is empty.
+func versionedRequest(t *testing.T, tenant, method, path, ifMatch, body string) versionedResponse {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, integrationTestURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Errorf("couldn't create request: %v", err)
+		return versionedResponse{}
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	req.Header.Set("X-Tenant-ID", tenant)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Errorf("request failed: %v", err)
+		return versionedResponse{}
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("couldn't read response: %v", err)
+	}
+	return versionedResponse{status: res.StatusCode, etag: res.Header.Get("ETag"), body: string(data)}
+}
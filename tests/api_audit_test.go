@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type auditRecords struct {
+	Records []struct {
+		Actor        string          `json:"actor"`
+		Route        string          `json:"route"`
+		RequestID    string          `json:"requestId"`
+		ResourceType string          `json:"resourceType"`
+		ResourceID   string          `json:"resourceId"`
+		Before       json.RawMessage `json:"before"`
+		After        json.RawMessage `json:"after"`
+		Outcome      string          `json:"outcome"`
+		StatusCode   int             `json:"statusCode"`
+	} `json:"records"`
+}
+
+func TestAuditLog(t *testing.T) {
+	tenant := "audit-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"8"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPut, "/articles/1", `{"name":"leg","stock":"5"}`, http.StatusOK)
+	tenantRequest(t, tenant, http.MethodPut, "/articles/unknown", `{"name":"leg","stock":"5"}`, http.StatusNotFound)
+
+	var changes auditRecords
+	body := tenantRequest(t, tenant, http.MethodGet, "/audit?resourceType=article&resourceId=1", "", http.StatusOK)
+	err := json.Unmarshal([]byte(body), &changes)
+	if err != nil {
+		t.Fatalf("couldn't decode audit records: %v", err)
+	}
+	if len(changes.Records) != 2 {
+		t.Fatalf("got %d audit records for article 1, want 2: %s", len(changes.Records), body)
+	}
+	update, create := changes.Records[0], changes.Records[1]
+	if create.Route != "CreateOrUpdateArticles" || create.Before != nil || create.After == nil {
+		t.Errorf("unexpected record of the creation: %+v", create)
+	}
+	if update.Route != "UpdateArticle" || update.Outcome != "success" || update.Actor != "config:admin" || update.RequestID == "" {
+		t.Errorf("unexpected record of the update: %+v", update)
+	}
+	var before, after struct {
+		Stock int `json:"stock"`
+	}
+	if json.Unmarshal(update.Before, &before) != nil || json.Unmarshal(update.After, &after) != nil {
+		t.Fatalf("couldn't decode snapshots of the update: %s, %s", update.Before, update.After)
+	}
+	if before.Stock != 8 || after.Stock != 5 {
+		t.Errorf("got stock %d before and %d after the update, want 8 and 5", before.Stock, after.Stock)
+	}
+
+	var failures auditRecords
+	body = tenantRequest(t, tenant, http.MethodGet, "/audit?actor=config:admin", "", http.StatusOK)
+	err = json.Unmarshal([]byte(body), &failures)
+	if err != nil {
+		t.Fatalf("couldn't decode audit records: %v", err)
+	}
+	if len(failures.Records) != 3 || failures.Records[0].Outcome != "failure" || failures.Records[0].StatusCode != http.StatusNotFound {
+		t.Errorf("the failed update was not recorded: %s", body)
+	}
+
+	body = tenantRequest(t, "other-"+tenant, http.MethodGet, "/audit?resourceType=article&resourceId=1", "", http.StatusOK)
+	var others auditRecords
+	err = json.Unmarshal([]byte(body), &others)
+	if err != nil {
+		t.Fatalf("couldn't decode audit records: %v", err)
+	}
+	if len(others.Records) != 0 {
+		t.Errorf("another tenant sees the audit log: %s", body)
+	}
+
+	_, err = testDB.Database.ExecContext(context.Background(), `UPDATE audit_log SET outcome = 'success' WHERE tenant_id = $1`, tenant)
+	if err == nil {
+		t.Error("audit_log records could be changed")
+	}
+	_, err = testDB.Database.ExecContext(context.Background(), `DELETE FROM audit_log WHERE tenant_id = $1`, tenant)
+	if err == nil {
+		t.Error("audit_log records could be deleted")
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAPIKey struct {
+	APIKeyID  string     `json:"apiKeyId"`
+	TenantID  string     `json:"tenantId"`
+	KeyPrefix string     `json:"keyPrefix"`
+	Scopes    []string   `json:"scopes"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	Key       string     `json:"key"`
+}
+
+func TestAPIKeyCreation(t *testing.T) {
+	tenant := "auth-keys-" + time.Now().Format("150405000000")
+	apiKey := createTestAPIKey(t, tenant, `{"name":"reader","scopes":["inventory:read"]}`)
+	if !regexp.MustCompile(`^wh_[0-9a-f]{64}$`).MatchString(apiKey.Key) {
+		t.Errorf("got key %q, want wh_ and 64 hex digits", apiKey.Key)
+	}
+	if apiKey.KeyPrefix != apiKey.Key[:11] || apiKey.TenantID != tenant || len(apiKey.Scopes) != 1 || apiKey.Scopes[0] != "inventory:read" {
+		t.Errorf("got api key %+v, want the prefix of the key, the tenant and its scope", apiKey)
+	}
+
+	// only the sha256 of the key is stored
+	var keyHash, keyPrefix string
+	err := testDB.Database.QueryRowContext(context.Background(),
+		`SELECT key_hash, key_prefix FROM api_key WHERE api_key_id = $1`, apiKey.APIKeyID).Scan(&keyHash, &keyPrefix)
+	if err != nil {
+		t.Fatalf("couldn't read api_key: %v", err)
+	}
+	sum := sha256.Sum256([]byte(apiKey.Key))
+	if keyHash != hex.EncodeToString(sum[:]) || keyPrefix != apiKey.KeyPrefix {
+		t.Errorf("got hash %s and prefix %s stored, want the sha256 of the key and its prefix", keyHash, keyPrefix)
+	}
+	var stored int
+	err = testDB.Database.QueryRowContext(context.Background(),
+		`SELECT count(*) FROM api_key WHERE to_jsonb(api_key)::text LIKE '%' || $1 || '%'`, apiKey.Key[11:]).Scan(&stored)
+	if err != nil || stored != 0 {
+		t.Errorf("got the key stored in clear text in %d rows: %v", stored, err)
+	}
+
+	var listing struct {
+		APIKeys []testAPIKey `json:"apiKeys"`
+	}
+	data := tenantRequest(t, tenant, http.MethodGet, "/api-keys", "", http.StatusOK)
+	if err = json.Unmarshal([]byte(data), &listing); err != nil {
+		t.Fatalf("couldn't decode api keys %s: %v", data, err)
+	}
+	if len(listing.APIKeys) != 1 || listing.APIKeys[0].APIKeyID != apiKey.APIKeyID || listing.APIKeys[0].Key != "" {
+		t.Errorf("got api keys %s, want the created one without its key", data)
+	}
+
+	tenantRequest(t, tenant, http.MethodPost, "/api-keys", `{"name":"root","scopes":["root"]}`, http.StatusBadRequest)
+	tenantRequest(t, tenant, http.MethodPost, "/api-keys", `{"name":"nothing","scopes":[]}`, http.StatusBadRequest)
+	tenantRequest(t, tenant, http.MethodPost, "/api-keys", `{"scopes":["admin"]}`, http.StatusBadRequest)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	tenant := "auth-scopes-" + time.Now().Format("150405000000")
+	reader := createTestAPIKey(t, tenant, `{"name":"reader","scopes":["inventory:read"]}`).Key
+	seller := createTestAPIKey(t, tenant, `{"name":"seller","scopes":["sales:write"]}`).Key
+	writer := createTestAPIKey(t, tenant, `{"name":"writer","scopes":["inventory:read","inventory:write"]}`).Key
+	admin := createTestAPIKey(t, tenant, `{"name":"admin","scopes":["admin"]}`).Key
+	articles := `{"inventory":[{"art_id":"1","name":"leg","stock":"10"}]}`
+
+	for _, tc := range []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"public health", "", http.MethodGet, "/health", "", http.StatusOK},
+		{"no credentials", "", http.MethodGet, "/articles", "", http.StatusUnauthorized},
+		{"unknown key", "wh_" + strings.Repeat("0", 64), http.MethodGet, "/articles", "", http.StatusUnauthorized},
+		{"reader reads", reader, http.MethodGet, "/articles", "", http.StatusOK},
+		{"reader writes", reader, http.MethodPost, "/articles", articles, http.StatusForbidden},
+		{"reader sells", reader, http.MethodPost, "/products/sell", `{"productId":"unknown"}`, http.StatusForbidden},
+		{"reader manages keys", reader, http.MethodGet, "/api-keys", "", http.StatusForbidden},
+		{"seller reads", seller, http.MethodGet, "/articles", "", http.StatusForbidden},
+		{"seller sells", seller, http.MethodPost, "/products/sell", `{"productId":"00000000-0000-0000-0000-000000000000"}`, http.StatusNotFound},
+		{"writer writes", writer, http.MethodPost, "/articles", articles, http.StatusCreated},
+		{"writer sells", writer, http.MethodPost, "/products/sell", `{"productId":"unknown"}`, http.StatusForbidden},
+		{"writer manages keys", writer, http.MethodPost, "/api-keys", `{"name":"x","scopes":["admin"]}`, http.StatusForbidden},
+		{"admin reads", admin, http.MethodGet, "/articles", "", http.StatusOK},
+		{"admin sells", admin, http.MethodPost, "/products/sell", `{"productId":"00000000-0000-0000-0000-000000000000"}`, http.StatusNotFound},
+		{"admin manages keys", admin, http.MethodGet, "/api-keys", "", http.StatusOK},
+	} {
+		res := apiKeyRequest(t, tc.key, tc.method, tc.path, tc.body)
+		if res.StatusCode != tc.want {
+			t.Errorf("%s: got status %d for %s %s, want %d", tc.name, res.StatusCode, tc.method, tc.path, tc.want)
+		}
+		if res.StatusCode == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: got 401 without WWW-Authenticate", tc.name)
+		}
+	}
+}
+
+func TestAPIKeyRevocation(t *testing.T) {
+	tenant := "auth-revoke-" + time.Now().Format("150405000000")
+	apiKey := createTestAPIKey(t, tenant, `{"name":"reader","scopes":["inventory:read"]}`)
+	if res := apiKeyRequest(t, apiKey.Key, http.MethodGet, "/articles", ""); res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d before revoking, want 200", res.StatusCode)
+	}
+	tenantRequest(t, tenant, http.MethodDelete, "/api-keys/"+apiKey.APIKeyID, "", http.StatusNoContent)
+	if res := apiKeyRequest(t, apiKey.Key, http.MethodGet, "/articles", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d with a revoked key, want 401", res.StatusCode)
+	}
+	// revoking is idempotent and keeps the first revocation time
+	var revokedAt time.Time
+	err := testDB.Database.QueryRowContext(context.Background(),
+		`SELECT revoked_at FROM api_key WHERE api_key_id = $1`, apiKey.APIKeyID).Scan(&revokedAt)
+	if err != nil {
+		t.Fatalf("couldn't read api_key: %v", err)
+	}
+	tenantRequest(t, tenant, http.MethodDelete, "/api-keys/"+apiKey.APIKeyID, "", http.StatusNoContent)
+	var again time.Time
+	err = testDB.Database.QueryRowContext(context.Background(),
+		`SELECT revoked_at FROM api_key WHERE api_key_id = $1`, apiKey.APIKeyID).Scan(&again)
+	if err != nil || !again.Equal(revokedAt) {
+		t.Errorf("got revoked_at %v after revoking again, want %v: %v", again, revokedAt, err)
+	}
+	// keys of other tenants can't be revoked
+	other := createTestAPIKey(t, tenant+"-other", `{"name":"reader","scopes":["inventory:read"]}`)
+	tenantRequest(t, tenant, http.MethodDelete, "/api-keys/"+other.APIKeyID, "", http.StatusNotFound)
+	if res := apiKeyRequest(t, other.Key, http.MethodGet, "/articles", ""); res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d with the key of the other tenant, want 200", res.StatusCode)
+	}
+	tenantRequest(t, tenant, http.MethodDelete, "/api-keys/00000000-0000-0000-0000-000000000000", "", http.StatusNotFound)
+}
+
+func createTestAPIKey(t *testing.T, tenant, body string) testAPIKey {
+	t.Helper()
+	var apiKey testAPIKey
+	data := tenantRequest(t, tenant, http.MethodPost, "/api-keys", body, http.StatusCreated)
+	if err := json.Unmarshal([]byte(data), &apiKey); err != nil || apiKey.Key == "" {
+		t.Fatalf("couldn't decode api key %s: %v", data, err)
+	}
+	return apiKey
+}
+
+// apiKeyRequest makes a request with key, or without credentials when key is
+// empty.
+func apiKeyRequest(t *testing.T, key, method, path, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, integrationTestURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+	return res
+}
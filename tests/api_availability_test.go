@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProductAvailability(t *testing.T) {
+	ctx := context.Background()
+	tenant := "availability-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"10"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPost, "/products", `{"products":[{"name":"stool","contain_articles":[{"art_id":"1","amount_of":"3"}]}]}`, http.StatusCreated)
+	products := getTenantProducts(t, tenant)
+	if len(products.Products) != 1 || products.Products[0].Stock != 3 {
+		t.Fatalf("got %+v, want one product with stock 3", products.Products)
+	}
+	productID := products.Products[0].ProductID
+
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	if stock := getTenantProducts(t, tenant).Products[0].Stock; stock != 2 {
+		t.Errorf("got stock %d after a sale, want 2", stock)
+	}
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"1"}]}`, http.StatusCreated)
+	if stock := getTenantProducts(t, tenant).Products[0].Stock; stock != 0 {
+		t.Errorf("got stock %d after the article stock changed, want 0", stock)
+	}
+
+	_, err := testDB.Database.ExecContext(ctx, `UPDATE product_availability SET stock = 99 WHERE tenant_id = $1`, tenant)
+	if err != nil {
+		t.Fatalf("couldn't corrupt product_availability: %v", err)
+	}
+	for _, fix := range []bool{false, true} {
+		drifts, err := testDB.CheckProductAvailability(ctx, fix)
+		if err != nil {
+			t.Fatalf("check failed: %v", err)
+		}
+		var found bool
+		for _, drift := range drifts {
+			if drift.Tenant != tenant {
+				continue
+			}
+			found = drift.ProductID == productID && drift.Stored != nil && *drift.Stored == 99 && drift.Actual != nil && *drift.Actual == 0
+		}
+		if !found {
+			t.Errorf("fix=%v: drift of product %s not reported in %+v", fix, productID, drifts)
+		}
+	}
+	drifts, err := testDB.CheckProductAvailability(ctx, false)
+	if err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	for _, drift := range drifts {
+		if drift.Tenant == tenant {
+			t.Errorf("drift left after fixing it: %+v", drift)
+		}
+	}
+	if stock := getTenantProducts(t, tenant).Products[0].Stock; stock != 0 {
+		t.Errorf("got stock %d after fixing, want 0", stock)
+	}
+}
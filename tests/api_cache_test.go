@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/cache"
+	"github.com/warehouse/app/store"
+)
+
+func TestProductsCacheInvalidation(t *testing.T) {
+	tenant := "cache-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"12"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPost, "/products", `{"products":[{"name":"stool","contain_articles":[{"art_id":"1","amount_of":"3"}]},{"name":"table","contain_articles":[{"art_id":"1","amount_of":"4"}]}]}`, http.StatusCreated)
+	stocks := getTenantStocks(t, tenant)
+	if len(stocks) != 2 {
+		t.Fatalf("got %d products, want 2", len(stocks))
+	}
+	var stoolID, tableID string
+	for productID, stock := range stocks {
+		if stock == 4 {
+			stoolID = productID
+		} else {
+			tableID = productID
+		}
+	}
+	// warm the cache
+	getTenantStocks(t, tenant)
+	getTenantProductStock(t, tenant, tableID)
+	hitsBefore := scrapeMetrics(t)[`warehouse_products_cache_requests_total{result="hit"}`]
+
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+stoolID+`"}`, http.StatusNoContent)
+	stocks = getTenantStocks(t, tenant)
+	if stocks[stoolID] != 3 || stocks[tableID] != 2 {
+		t.Errorf("got stocks %v after a sale, want stool 3 and table 2", stocks)
+	}
+	if stock := getTenantProductStock(t, tenant, tableID); stock != 2 {
+		t.Errorf("got table stock %d after a sale of a stool, want 2", stock)
+	}
+
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"4"}]}`, http.StatusCreated)
+	if stock := getTenantProductStock(t, tenant, tableID); stock != 1 {
+		t.Errorf("got table stock %d after the article stock changed, want 1", stock)
+	}
+	if stocks = getTenantStocks(t, tenant); stocks[stoolID] != 1 {
+		t.Errorf("got stool stock %d after the article stock changed, want 1", stocks[stoolID])
+	}
+
+	// the products weren't changed since the last reads
+	getTenantStocks(t, tenant)
+	getTenantProductStock(t, tenant, tableID)
+	if hits := scrapeMetrics(t)[`warehouse_products_cache_requests_total{result="hit"}`]; hits < hitsBefore+2 {
+		t.Errorf("got %v cache hits, want at least %v", hits, hitsBefore+2)
+	}
+}
+
+// TestProductsCacheReplicas checks the cache fills from the primary, the
+// replica here has the schema but no products at all.
+func TestProductsCacheReplicas(t *testing.T) {
+	tenant := "cache-replica-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	name := "warehouse_replica_cache_" + time.Now().Format("150405000000")
+	replica := createReplicaDB(t, name, `SELECT 1`)
+	replicaDB, err := store.NewPostgresDB(store.Config{
+		Host:                testDBHost,
+		Port:                testDBPort,
+		DB:                  name,
+		CredentialsFileName: credentials,
+	})
+	if err != nil {
+		t.Fatalf("couldn't open the replica: %v", err)
+	}
+	defer replicaDB.Close()
+	if _, err = replicaDB.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("couldn't migrate the replica: %v", err)
+	}
+
+	products := cache.NewProductsStore(newReplicatedDB(t, replica.dsn), 10, time.Minute)
+	ctx := store.WithTenant(context.Background(), tenant)
+	for i := 0; i < 2; i++ {
+		res, err := products.GetAllProducts(ctx)
+		if err != nil || len(res.Products) != 1 {
+			t.Errorf("got products %+v, %v, want the product of the primary", res.Products, err)
+		}
+		product, err := products.GetProduct(ctx, productID)
+		if err != nil || product.Stock != 100 {
+			t.Errorf("got product %+v, %v, want the product of the primary", product, err)
+		}
+	}
+	if stats := products.Stats(); stats.Misses != 2 || stats.Hits != 2 {
+		t.Errorf("got %+v, want a miss and a hit per response", stats)
+	}
+}
+
+func getTenantStocks(t *testing.T, tenant string) map[string]int {
+	t.Helper()
+	stocks := make(map[string]int)
+	for _, product := range getTenantProducts(t, tenant).Products {
+		stocks[product.ProductID] = product.Stock
+	}
+	return stocks
+}
+
+func getTenantProductStock(t *testing.T, tenant, productID string) int {
+	t.Helper()
+	var product struct {
+		Stock int `json:"stock"`
+	}
+	err := json.Unmarshal([]byte(tenantRequest(t, tenant, http.MethodGet, "/products/"+productID, "", http.StatusOK)), &product)
+	if err != nil {
+		t.Fatalf("couldn't decode product: %v", err)
+	}
+	return product.Stock
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVImportAndExport(t *testing.T) {
+	tenant := "csv-" + time.Now().Format("150405000000")
+	csvRequest(t, tenant, http.MethodPost, "/articles", "art_id,name,stock\n1,leg,8\n2,screw,17\n", http.StatusCreated)
+	productsCSV := "name,art_id,amount_of\ntable,1,4\ntable,2,8\nchair,1,2\n"
+	csvRequest(t, tenant, http.MethodPost, "/products", productsCSV, http.StatusCreated)
+
+	products := getTenantProducts(t, tenant)
+	if len(products.Products) != 2 {
+		t.Fatalf("got products %+v, want table and chair", products.Products)
+	}
+
+	exported := csvRequest(t, tenant, http.MethodGet, "/articles", "", http.StatusOK)
+	want := "art_id,name,stock,version\n1,leg,8,1\n2,screw,17,1\n"
+	if exported != want {
+		t.Errorf("got articles export %q, want %q", exported, want)
+	}
+	exported = csvRequest(t, tenant, http.MethodGet, "/products", "", http.StatusOK)
+	if lines := strings.Split(strings.TrimSpace(exported), "\n"); len(lines) != 4 || !strings.HasSuffix(lines[0], "art_id,amount_of") {
+		t.Errorf("got products export %q, want a header and 3 rows", exported)
+	}
+	// the export imports back, its extra columns are ignored
+	csvRequest(t, tenant, http.MethodPost, "/articles", "art_id,name,stock,version\n1,leg,9,1\n", http.StatusCreated)
+}
+
+func TestCSVImportReportsInvalidRows(t *testing.T) {
+	tenant := "csv-invalid-" + time.Now().Format("150405000000")
+	body := csvRequest(t, tenant, http.MethodPost, "/articles", "art_id,name,stock\n1,leg,8\n2,screw,many\n,nut,1\n", http.StatusBadRequest)
+	var res struct {
+		Errors []struct {
+			Line    int    `json:"line"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err := json.Unmarshal([]byte(body), &res)
+	if err != nil {
+		t.Fatalf("couldn't decode error response %s: %v", body, err)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Line != 3 || res.Errors[1].Line != 4 {
+		t.Errorf("got errors %+v, want lines 3 and 4", res.Errors)
+	}
+	// nothing of a file with invalid rows is imported
+	csvRequest(t, tenant, http.MethodGet, "/articles/1", "", http.StatusNotFound)
+
+	csvRequest(t, tenant, http.MethodPost, "/products", "name,amount_of\ntable,4\n", http.StatusBadRequest)
+}
+
+// csvRequest sends a text/csv admin request on behalf of tenant, accepting
+// text/csv, and returns the response body.
+func csvRequest(t *testing.T, tenant, method, path, body string, want int) string {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, integrationTestURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	req.Header.Set("X-Tenant-ID", tenant)
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Accept", "text/csv")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("couldn't read response: %v", err)
+	}
+	if res.StatusCode != want {
+		t.Fatalf("%s %s for %s: got status %d, want %d: %s", method, path, tenant, res.StatusCode, want, data)
+	}
+	return string(data)
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type dryRunError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func TestArticlesDryRun(t *testing.T) {
+	tenant := "dry-run-articles-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"12"}]}`, http.StatusCreated)
+	productBody := `{"products":[{"name":"table","contain_articles":[{"art_id":"1","amount_of":"4"}]}]}`
+	tenantRequest(t, tenant, http.MethodPost, "/products", productBody, http.StatusCreated)
+	stocks := getTenantStocks(t, tenant)
+
+	body := tenantRequest(t, tenant, http.MethodPost, "/articles?dryRun=true",
+		`{"inventory":[{"art_id":"1","name":"leg","stock":"20"},{"art_id":"2","name":"screw","stock":"8"},`+
+			`{"art_id":"3","name":"nut","stock":"-1"},{"art_id":"2","name":"screw","stock":"1"}]}`, http.StatusOK)
+	var res struct {
+		Valid     bool `json:"valid"`
+		Creates   int  `json:"creates"`
+		Updates   int  `json:"updates"`
+		Inventory []struct {
+			ArticleID string `json:"art_id"`
+			Action    string `json:"action"`
+			Before    *struct {
+				Stock string `json:"stock"`
+			} `json:"before"`
+			Errors []dryRunError `json:"errors"`
+		} `json:"inventory"`
+		Products []struct {
+			StockBefore int `json:"stockBefore"`
+			StockAfter  int `json:"stockAfter"`
+		} `json:"products"`
+	}
+	err := json.Unmarshal([]byte(body), &res)
+	if err != nil {
+		t.Fatalf("couldn't decode dry run response %s: %v", body, err)
+	}
+	if res.Valid || res.Creates != 1 || res.Updates != 1 || len(res.Inventory) != 4 {
+		t.Fatalf("got dry run %s, want 1 create, 1 update and errors", body)
+	}
+	if item := res.Inventory[0]; item.Action != "update" || item.Before == nil || item.Before.Stock != "12" {
+		t.Errorf("got first article %+v, want an update of the stock of 12", item)
+	}
+	if res.Inventory[1].Action != "create" || len(res.Inventory[2].Errors) != 1 || len(res.Inventory[3].Errors) != 1 {
+		t.Errorf("got dry run %s, want a create, a negative stock and a repeated art_id", body)
+	}
+	if len(res.Products) != 1 || res.Products[0].StockBefore != 3 || res.Products[0].StockAfter != 5 {
+		t.Errorf("got product stock changes %+v, want table from 3 to 5", res.Products)
+	}
+
+	// nothing was stored
+	tenantRequest(t, tenant, http.MethodGet, "/articles/2", "", http.StatusNotFound)
+	for productID, stock := range getTenantStocks(t, tenant) {
+		if stock != stocks[productID] {
+			t.Errorf("got stock %d of %s after a dry run, want %d", stock, productID, stocks[productID])
+		}
+	}
+	tenantRequest(t, tenant, http.MethodPost, "/articles?dryRun=maybe", `{"inventory":[]}`, http.StatusBadRequest)
+}
+
+func TestProductsDryRun(t *testing.T) {
+	tenant := "dry-run-products-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"12"}]}`, http.StatusCreated)
+
+	body := csvRequest(t, tenant, http.MethodPost, "/products?dryRun=true",
+		"name,art_id,amount_of\ntable,1,4\nchair,1,2\nchair,9,1\n", http.StatusOK)
+	var res struct {
+		Valid    bool `json:"valid"`
+		Creates  int  `json:"creates"`
+		Products []struct {
+			Name   string        `json:"name"`
+			Action string        `json:"action"`
+			Stock  int           `json:"stock"`
+			Errors []dryRunError `json:"errors"`
+		} `json:"products"`
+	}
+	err := json.Unmarshal([]byte(body), &res)
+	if err != nil {
+		t.Fatalf("couldn't decode dry run response %s: %v", body, err)
+	}
+	if res.Valid || res.Creates != 1 || len(res.Products) != 2 {
+		t.Fatalf("got dry run %s, want 1 create and errors", body)
+	}
+	if table := res.Products[0]; table.Action != "create" || table.Stock != 3 {
+		t.Errorf("got table %+v, want a create with a stock of 3", table)
+	}
+	if chair := res.Products[1]; len(chair.Errors) != 1 || chair.Errors[0].Line != 4 {
+		t.Errorf("got chair errors %+v, want the missing article on line 4", chair.Errors)
+	}
+	if products := getTenantStocks(t, tenant); len(products) != 0 {
+		t.Errorf("got products %v after a dry run, want none", products)
+	}
+}
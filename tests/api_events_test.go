@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/events"
+	"github.com/warehouse/app/store"
+)
+
+type sseEvent struct {
+	id    int64
+	event string
+	data  string
+}
+
+// stock returns the stock of an article.updated or product.stock_changed
+// event.
+func (e sseEvent) stock(t *testing.T) int {
+	t.Helper()
+	var payload struct {
+		Stock int `json:"stock"`
+	}
+	if err := json.Unmarshal([]byte(e.data), &payload); err != nil {
+		t.Fatalf("couldn't decode event %s: %v", e.data, err)
+	}
+	return payload.Stock
+}
+
+func TestStockEventStream(t *testing.T) {
+	tenant := "sse-" + time.Now().Format("150405000000")
+	other := tenant + "-other"
+	productID := setupWebhookProduct(t, tenant)
+	tenantRequest(t, other, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"50"}]}`, http.StatusCreated)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, status := openStockStream(ctx, t, integrationTestURL+"/events/stock", tenant, "")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", status)
+	}
+
+	// the other tenant's change isn't streamed, so the first event is ours
+	tenantRequest(t, other, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"40"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	article := nextStockEvent(t, stream)
+	if article.event != store.OutboxEventArticleUpdated || article.stock(t) != 99 {
+		t.Fatalf("got %s with %s, want article.updated with a stock of 99", article.event, article.data)
+	}
+	if product := nextStockEvent(t, stream); product.event != store.OutboxEventProductStockChanged ||
+		!strings.Contains(product.data, productID) || product.stock(t) != 99 || product.id <= article.id {
+		t.Fatalf("got %s %d with %s, want the stock change of the product after %d", product.event, product.id, product.data, article.id)
+	}
+	cancel()
+
+	// reconnecting with Last-Event-ID replays what was missed, then goes on
+	// live without repeating it
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	stream, status = openStockStream(ctx, t, integrationTestURL+"/events/stock", tenant, strconv.FormatInt(article.id, 10))
+	if status != http.StatusOK {
+		t.Fatalf("got status %d on reconnection, want 200", status)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		event := nextStockEvent(t, stream)
+		got = append(got, event.event+":"+strconv.Itoa(event.stock(t)))
+	}
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	for i := 0; i < 2; i++ {
+		event := nextStockEvent(t, stream)
+		got = append(got, event.event+":"+strconv.Itoa(event.stock(t)))
+	}
+	want := "product.stock_changed:99,article.updated:98,product.stock_changed:98,article.updated:97,product.stock_changed:97"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %v after reconnecting, want %s", got, want)
+	}
+
+	// only the requested products
+	filtered, _ := openStockStream(ctx, t, integrationTestURL+"/events/stock?productId="+productID, tenant, "")
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	if event := nextStockEvent(t, filtered); event.event != store.OutboxEventProductStockChanged || event.stock(t) != 96 {
+		t.Errorf("got %s with %s on a product stream, want product.stock_changed with a stock of 96", event.event, event.data)
+	}
+
+	if _, status = openStockStream(ctx, t, integrationTestURL+"/events/stock", tenant, "last"); status != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid Last-Event-ID, want 400", status)
+	}
+}
+
+func TestStockEventStreamShutdown(t *testing.T) {
+	tenant := "sse-shutdown-" + time.Now().Format("150405000000")
+	hub := events.NewHub()
+	handler := events.NewHandler(hub)
+	handler.OutboxStore = testDB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.StreamStock(w, r.WithContext(store.WithTenant(r.Context(), tenant)))
+	}))
+	defer server.Close()
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	hubDone := make(chan struct{})
+	go func() {
+		defer close(hubDone)
+		hub.Run(hubCtx, testDB)
+	}()
+	defer stopHub()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, status := openStockStream(ctx, t, server.URL, tenant, "")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", status)
+	}
+	// far more events of other tenants than a client buffers don't get it
+	// disconnected, they never reach it
+	for i := 0; i < 1000; i++ {
+		hub.Publish(store.OutboxEvent{
+			EventID:       int64(i + 1),
+			TenantID:      tenant + "-other",
+			AggregateType: store.OutboxAggregateArticle,
+			AggregateID:   "1",
+			EventType:     store.OutboxEventArticleUpdated,
+			Payload:       json.RawMessage(`{"articleId":"1","stock":1}`),
+		})
+	}
+	hub.Publish(store.OutboxEvent{
+		EventID:       1001,
+		TenantID:      tenant,
+		AggregateType: store.OutboxAggregateArticle,
+		AggregateID:   "1",
+		EventType:     store.OutboxEventArticleUpdated,
+		Payload:       json.RawMessage(`{"articleId":"1","stock":2}`),
+	})
+	if event := nextStockEvent(t, stream); event.id != 1001 || event.stock(t) != 2 {
+		t.Fatalf("got event %d with %s, want the one of the tenant", event.id, event.data)
+	}
+
+	// shutting the hub down ends the open streams and refuses new ones
+	stopHub()
+	select {
+	case <-hubDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hub didn't stop")
+	}
+	select {
+	case event, open := <-stream:
+		if open {
+			t.Errorf("got event %d after the shutdown, want the stream closed", event.id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream wasn't closed on shutdown")
+	}
+	if _, status = openStockStream(ctx, t, server.URL, tenant, ""); status != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after the shutdown, want 503", status)
+	}
+}
+
+// openStockStream requests a stock event stream and returns its events, the
+// channel is closed once the stream ends. Events are only read when the
+// status is 200.
+func openStockStream(ctx context.Context, t *testing.T, url, tenant, lastEventID string) (<-chan sseEvent, int) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	req.Header.Set("X-Tenant-ID", tenant)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	// no client timeout, the stream is ended by cancelling ctx
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	stream := make(chan sseEvent, 100)
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		close(stream)
+		return stream, res.StatusCode
+	}
+	go func() {
+		defer close(stream)
+		defer res.Body.Close()
+		var event sseEvent
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.event != "" {
+					stream <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.id, _ = strconv.ParseInt(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return stream, res.StatusCode
+}
+
+func nextStockEvent(t *testing.T, stream <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, open := <-stream:
+		if !open {
+			t.Fatal("the stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event within 5 seconds")
+	}
+	return sseEvent{}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/warehouse/app/health"
+	"github.com/warehouse/app/store"
+)
+
+type healthReport struct {
+	Status string `json:"status"`
+	Checks []struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Critical bool   `json:"critical"`
+		Error    string `json:"error"`
+	} `json:"checks"`
+}
+
+func getHealthReport(t *testing.T, url string) (int, healthReport) {
+	t.Helper()
+	return readHealthReport(t, integrationTestURL+url)
+}
+
+func readHealthReport(t *testing.T, url string) (int, healthReport) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	var report healthReport
+	err = json.NewDecoder(res.Body).Decode(&report)
+	if err != nil {
+		t.Fatalf("couldn't decode health report: %v", err)
+	}
+	return res.StatusCode, report
+}
+
+func TestHealth(t *testing.T) {
+	statusCode, report := getHealthReport(t, urlHealth)
+	if statusCode != http.StatusOK || report.Status != "pass" {
+		t.Errorf("got %d %q, want 200 pass", statusCode, report.Status)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	statusCode, report := getHealthReport(t, urlReady)
+	if statusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %+v", statusCode, report)
+	}
+	checks := make(map[string]string)
+	for _, check := range report.Checks {
+		checks[check.Name] = check.Status
+		if check.Critical && check.Status != "pass" {
+			t.Errorf("critical check %s failed: %s", check.Name, check.Error)
+		}
+	}
+	for _, name := range []string{"database", "migration", "migration_ahead", "outbox"} {
+		if _, ok := checks[name]; !ok {
+			t.Errorf("check %s missing from the report", name)
+		}
+	}
+}
+
+func TestMigrationChecks(t *testing.T) {
+	ctx := context.Background()
+	migrations, err := store.Migrations()
+	if err != nil || len(migrations) < 2 {
+		t.Fatalf("got %d migrations, %v, want the embedded ones", len(migrations), err)
+	}
+	latest := migrations[len(migrations)-1].Name
+	previous := migrations[len(migrations)-2].Name
+	for _, tc := range []struct {
+		name     string
+		expected string
+		missing  error
+		ahead    error
+	}{
+		{"current", latest, nil, nil},
+		// the database was migrated by the next version of a rolling deploy
+		{"behind the database", previous, nil, health.ErrNewerMigration},
+		{"ahead of the database", "20991231_1_next.sql", health.ErrMissingMigration, nil},
+		{"liquibase path", "db/changelog/" + latest, nil, nil},
+	} {
+		if err = health.Migration(testDB, tc.expected).Check(ctx); !errors.Is(err, tc.missing) {
+			t.Errorf("%s: got %v from the migration check, want %v", tc.name, err, tc.missing)
+		}
+		if err = health.MigrationAhead(testDB, tc.expected).Check(ctx); !errors.Is(err, tc.ahead) {
+			t.Errorf("%s: got %v from the migration_ahead check, want %v", tc.name, err, tc.ahead)
+		}
+	}
+}
+
+func TestReadinessShutdown(t *testing.T) {
+	handler := health.NewHandler()
+	handler.Registry.Register(health.Check{Name: "database", Critical: true, Checker: health.Database(testDB)})
+	mux := http.NewServeMux()
+	mux.HandleFunc(urlHealth, handler.Health)
+	mux.HandleFunc(urlReady, handler.Ready)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if statusCode, report := readHealthReport(t, server.URL+urlReady); statusCode != http.StatusOK {
+		t.Fatalf("got status %d before the shutdown, want 200: %+v", statusCode, report)
+	}
+	handler.Shutdown()
+	statusCode, report := readHealthReport(t, server.URL+urlReady)
+	if statusCode != http.StatusServiceUnavailable || report.Status != health.StatusFail {
+		t.Errorf("got %d %q after the shutdown, want 503 fail", statusCode, report.Status)
+	}
+	if len(report.Checks) != 1 || report.Checks[0].Name != "shutdown" || !report.Checks[0].Critical {
+		t.Errorf("got checks %+v after the shutdown, want the critical shutdown check alone", report.Checks)
+	}
+	// the process is still alive and finishing its requests
+	if statusCode, report = readHealthReport(t, server.URL+urlHealth); statusCode != http.StatusOK || report.Status != health.StatusPass {
+		t.Errorf("got %d %q from the liveness probe after the shutdown, want 200 pass", statusCode, report.Status)
+	}
+}
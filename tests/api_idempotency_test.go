@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	log2 "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/idempotency"
+	"github.com/warehouse/app/store"
+)
+
+type idempotentResponse struct {
+	status int
+	header http.Header
+	body   string
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	tenant := "idempotency-" + time.Now().Format("150405000000")
+	key := "supplier-" + tenant
+	first := idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/suppliers", `{"name":"acme"}`)
+	if first.status != http.StatusCreated || first.header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("got status %d replayed %q for the first request, want 201 executed", first.status, first.header.Get("Idempotent-Replayed"))
+	}
+	replay := idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/suppliers", `{"name":"acme"}`)
+	if replay.status != first.status || replay.body != first.body || replay.header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("got status %d with %s replayed %q, want the stored %d with %s", replay.status, replay.body,
+			replay.header.Get("Idempotent-Replayed"), first.status, first.body)
+	}
+	if contentType := replay.header.Get("Content-Type"); contentType != first.header.Get("Content-Type") {
+		t.Errorf("got content type %q on replay, want %q", contentType, first.header.Get("Content-Type"))
+	}
+	var suppliers struct {
+		Suppliers []json.RawMessage `json:"suppliers"`
+	}
+	data := tenantRequest(t, tenant, http.MethodGet, "/suppliers", "", http.StatusOK)
+	if err := json.Unmarshal([]byte(data), &suppliers); err != nil || len(suppliers.Suppliers) != 1 {
+		t.Errorf("got suppliers %s, want the one created once: %v", data, err)
+	}
+
+	// a different body, or another endpoint, can't reuse the key
+	if res := idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/suppliers", `{"name":"other"}`); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for a reused key with a different body, want 422", res.status)
+	}
+	if res := idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/purchase-orders", `{"name":"acme"}`); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for a reused key on another endpoint, want 422", res.status)
+	}
+
+	// the same key of another tenant or caller is a different key
+	if res := idempotentRequest(t, tenant+"-other", testAdminKey, key, http.MethodPost, "/suppliers", `{"name":"other"}`); res.status != http.StatusCreated {
+		t.Errorf("got status %d for the key of another tenant, want 201", res.status)
+	}
+	var apiKey struct {
+		Key string `json:"key"`
+	}
+	created := tenantRequest(t, tenant, http.MethodPost, "/api-keys", `{"name":"buyer","scopes":["inventory:write"]}`, http.StatusCreated)
+	if err := json.Unmarshal([]byte(created), &apiKey); err != nil {
+		t.Fatalf("couldn't decode api key: %v", err)
+	}
+	res := idempotentRequest(t, tenant, apiKey.Key, key, http.MethodPost, "/suppliers", `{"name":"acme"}`)
+	if res.status != http.StatusCreated || res.header.Get("Idempotent-Replayed") != "" || res.body == first.body {
+		t.Errorf("got status %d with %s for the key of another caller, want a new supplier", res.status, res.body)
+	}
+}
+
+func TestIdempotentConcurrentSell(t *testing.T) {
+	tenant := "idempotency-sell-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	key := "sell-" + tenant
+	body := `{"productId":"` + productID + `"}`
+
+	// hold the article, so that the first sell waits inside the handler while
+	// holding the key
+	ctx := context.Background()
+	tx, err := testDB.Database.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("couldn't begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `SELECT stock FROM article WHERE tenant_id = $1 FOR UPDATE`, tenant)
+	if err != nil {
+		t.Fatalf("couldn't lock the article: %v", err)
+	}
+	firstDone := make(chan idempotentResponse, 1)
+	go func() {
+		firstDone <- idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/products/sell", body)
+	}()
+	waitForIdempotencyKey(t, tenant, key)
+
+	second := idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/products/sell", body)
+	if second.status != http.StatusConflict || second.header.Get("Retry-After") == "" {
+		t.Errorf("got status %d with Retry-After %q while the first sell runs, want 409 with Retry-After",
+			second.status, second.header.Get("Retry-After"))
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("couldn't release the article: %v", err)
+	}
+	select {
+	case first := <-firstDone:
+		if first.status != http.StatusNoContent {
+			t.Errorf("got status %d for the first sell, want 204", first.status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the first sell didn't finish")
+	}
+
+	retry := idempotentRequest(t, tenant, testAdminKey, key, http.MethodPost, "/products/sell", body)
+	if retry.status != http.StatusNoContent || retry.header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("got status %d replayed %q for the retry, want the stored 204", retry.status, retry.header.Get("Idempotent-Replayed"))
+	}
+	if stock := getTenantArticleStock(t, tenant, "1"); stock != 99 {
+		t.Errorf("got stock %d, want the product sold once", stock)
+	}
+}
+
+func TestIdempotencyKeyOwnership(t *testing.T) {
+	tenant := "idempotency-owner-" + time.Now().Format("150405000000")
+	ctx := store.WithTenant(context.Background(), tenant)
+	acquire := store.AcquireIdempotencyKeyRequest{
+		Key:         "key",
+		Subject:     "apikey:test",
+		RequestHash: "hash",
+		Retention:   time.Hour,
+		LockTimeout: time.Millisecond,
+	}
+	stale, err := testDB.AcquireIdempotencyKey(ctx, acquire)
+	if err != nil || !stale.Acquired {
+		t.Fatalf("got %+v, %v for a new key, want it acquired", stale, err)
+	}
+	// the first request timed out and an identical retry took the key over
+	time.Sleep(10 * time.Millisecond)
+	current, err := testDB.AcquireIdempotencyKey(ctx, acquire)
+	if err != nil || !current.Acquired || current.Record.LockToken == stale.Record.LockToken {
+		t.Fatalf("got %+v, %v after the lock timeout, want the key acquired again with a new token", current, err)
+	}
+
+	record := stale.Record
+	record.StatusCode = http.StatusTeapot
+	if err = testDB.CompleteIdempotencyKey(ctx, record); !errors.Is(err, store.ErrIdempotencyKeyLost) {
+		t.Errorf("got %v completing with a stale token, want ErrIdempotencyKeyLost", err)
+	}
+	if err = testDB.ReleaseIdempotencyKey(ctx, stale.Record); !errors.Is(err, store.ErrIdempotencyKeyLost) {
+		t.Errorf("got %v releasing with a stale token, want ErrIdempotencyKeyLost", err)
+	}
+	record = current.Record
+	record.StatusCode = http.StatusCreated
+	if err = testDB.CompleteIdempotencyKey(ctx, record); err != nil {
+		t.Errorf("couldn't complete with the current token: %v", err)
+	}
+	acquire.LockTimeout = time.Hour
+	res, err := testDB.AcquireIdempotencyKey(ctx, acquire)
+	if err != nil || res.Acquired || !res.Record.Completed || res.Record.StatusCode != http.StatusCreated {
+		t.Errorf("got %+v, %v, want the response stored by the current holder", res, err)
+	}
+}
+
+func TestIdempotentPanic(t *testing.T) {
+	tenant := "idempotency-panic-" + time.Now().Format("150405000000")
+	var panics int32 = 1
+	var runs int32
+	handler := idempotency.NewMiddleware(testDB, time.Hour, time.Minute).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&runs, 1)
+		if atomic.AddInt32(&panics, -1) >= 0 {
+			panic("sell failed")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(store.WithTenant(r.Context(), tenant)))
+	}))
+	server.Config.ErrorLog = log2.New(io.Discard, "", 0)
+	server.Start()
+	defer server.Close()
+	send := func() *http.Response {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("couldn't create request: %v", err)
+		}
+		req.Header.Set(idempotency.HeaderKey, "panic")
+		res, err := server.Client().Do(req)
+		if err != nil {
+			return nil
+		}
+		res.Body.Close()
+		return res
+	}
+
+	if res := send(); res != nil {
+		t.Errorf("got status %d from a panicking handler, want the connection dropped", res.StatusCode)
+	}
+	// the key was released rather than completed with a made up 200, so the
+	// retry runs the handler
+	res := send()
+	if res == nil || res.StatusCode != http.StatusCreated || res.Header.Get(idempotency.HeaderReplayed) != "" {
+		t.Fatalf("got %+v for the retry after a panic, want the handler run again", res)
+	}
+	if res = send(); res == nil || res.StatusCode != http.StatusCreated || res.Header.Get(idempotency.HeaderReplayed) != "true" {
+		t.Errorf("got %+v for the second retry, want the stored 201", res)
+	}
+	if got := atomic.LoadInt32(&runs); got != 2 {
+		t.Errorf("got the handler run %d times, want twice", got)
+	}
+}
+
+func idempotentRequest(t *testing.T, tenant, apiKey, key, method, path, body string) idempotentResponse {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, integrationTestURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Errorf("couldn't create request: %v", err)
+		return idempotentResponse{}
+	}
+	req.Header.Set("X-API-Key", apiKey)
+	req.Header.Set("X-Tenant-ID", tenant)
+	req.Header.Set("Idempotency-Key", key)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Errorf("request failed: %v", err)
+		return idempotentResponse{}
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("couldn't read response: %v", err)
+	}
+	return idempotentResponse{status: res.StatusCode, header: res.Header, body: string(data)}
+}
+
+func waitForIdempotencyKey(t *testing.T, tenant, key string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		var count int
+		err := testDB.Database.QueryRowContext(context.Background(),
+			`SELECT count(*) FROM idempotency_key WHERE tenant_id = $1 AND idempotency_key = $2`, tenant, key).Scan(&count)
+		if err != nil {
+			t.Fatalf("couldn't read idempotency_key: %v", err)
+		}
+		if count > 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("the first request didn't acquire the key")
+}
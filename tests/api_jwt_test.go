@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/auth"
+)
+
+func TestJWTAuthentication(t *testing.T) {
+	expired := testClaims("inventory:read")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	notYetValid := testClaims("inventory:read")
+	notYetValid["nbf"] = time.Now().Add(time.Hour).Unix()
+	wrongIssuer := testClaims("inventory:read")
+	wrongIssuer["iss"] = "https://someone-else.test"
+	wrongAudience := testClaims("inventory:read")
+	wrongAudience["aud"] = []string{"billing"}
+	audienceList := testClaims("inventory:read")
+	audienceList["aud"] = []string{"billing", testJWTAudience}
+	scopeArray := testClaims("")
+	scopeArray["scope"] = []string{"inventory:read"}
+	tampered := signToken("RS256", testRSAKeyID, testClaims("inventory:read"))
+	tampered = tampered[:strings.LastIndex(tampered, ".")] + ".c2lnbmF0dXJl"
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"rs256", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, testClaims("inventory:read"))), http.StatusOK},
+		{"es256", http.MethodGet, "/products", bearer(signToken("ES256", testECKeyID, testClaims("inventory:read"))), http.StatusOK},
+		{"hs256", http.MethodGet, "/products", bearer(signToken("HS256", testHMACKeyID, testClaims("inventory:read"))), http.StatusOK},
+		{"audience list", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, audienceList)), http.StatusOK},
+		{"scope array", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, scopeArray)), http.StatusOK},
+		{"admin scope", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, testClaims("admin"))), http.StatusOK},
+		{"missing token", http.MethodGet, "/products", "", http.StatusUnauthorized},
+		{"expired", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, expired)), http.StatusUnauthorized},
+		{"not yet valid", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, notYetValid)), http.StatusUnauthorized},
+		{"wrong issuer", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, wrongIssuer)), http.StatusUnauthorized},
+		{"wrong audience", http.MethodGet, "/products", bearer(signToken("RS256", testRSAKeyID, wrongAudience)), http.StatusUnauthorized},
+		{"tampered signature", http.MethodGet, "/products", bearer(tampered), http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/products", bearer(signToken("RS256", "unknown", testClaims("inventory:read"))), http.StatusUnauthorized},
+		{"key of another algorithm", http.MethodGet, "/products", bearer(signToken("HS256", testRSAKeyID, testClaims("inventory:read"))), http.StatusUnauthorized},
+		{"missing scope", http.MethodPost, "/products/sell", bearer(signToken("RS256", testRSAKeyID, testClaims("inventory:read"))), http.StatusForbidden},
+		{"public route", http.MethodGet, "/health", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		runJWTTest(t, tt.name, tt.method, tt.path, tt.authorization, tt.want)
+	}
+}
+
+func TestJWTRejections(t *testing.T) {
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&testKeys.rsa.PublicKey)
+	if err != nil {
+		t.Fatalf("couldn't marshal the rsa public key: %v", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+	missingAudience := testClaims("inventory:read")
+	delete(missingAudience, "aud")
+	missingIssuer := testClaims("inventory:read")
+	delete(missingIssuer, "iss")
+	missingSubject := testClaims("inventory:read")
+	delete(missingSubject, "sub")
+	missingExpiry := testClaims("inventory:read")
+	delete(missingExpiry, "exp")
+	withinLeeway := testClaims("inventory:read")
+	withinLeeway["nbf"] = time.Now().Add(10 * time.Second).Unix()
+	stringExpiry := testClaims("inventory:read")
+	stringExpiry["exp"] = "tomorrow"
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"alg none", unsignedToken("none", testClaims("admin")), http.StatusUnauthorized},
+		{"alg None", unsignedToken("None", testClaims("admin")), http.StatusUnauthorized},
+		{"alg none with a signature", unsignedToken("none", testClaims("admin")) + "c2lnbmF0dXJl", http.StatusUnauthorized},
+		// the public key is no secret, accepting it as an HMAC key would let
+		// anybody sign tokens
+		{"hs256 with the rsa public key pem", signTokenWithSecret(testRSAKeyID, publicKeyPEM, testClaims("admin")), http.StatusUnauthorized},
+		{"hs256 with the rsa public key der", signTokenWithSecret(testRSAKeyID, publicKeyDER, testClaims("admin")), http.StatusUnauthorized},
+		{"hs256 with the rsa modulus", signTokenWithSecret("", testKeys.rsa.N.Bytes(), testClaims("admin")), http.StatusUnauthorized},
+		{"hs256 with another secret", signTokenWithSecret(testHMACKeyID, []byte("guessed"), testClaims("admin")), http.StatusUnauthorized},
+		{"rs256 with the hmac key id", signToken("RS256", testHMACKeyID, testClaims("inventory:read")), http.StatusUnauthorized},
+		{"missing audience", bearerToken(missingAudience), http.StatusUnauthorized},
+		{"missing issuer", bearerToken(missingIssuer), http.StatusUnauthorized},
+		{"missing subject", bearerToken(missingSubject), http.StatusUnauthorized},
+		{"missing expiry", bearerToken(missingExpiry), http.StatusUnauthorized},
+		{"malformed expiry", bearerToken(stringExpiry), http.StatusUnauthorized},
+		{"nbf within the leeway", bearerToken(withinLeeway), http.StatusOK},
+		{"two segments", "e30.e30", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		runJWTTest(t, tt.name, http.MethodGet, "/products", bearer(tt.token), tt.want)
+	}
+}
+
+// TestJWKSRefreshThrottle checks that tokens with made up key ids reload the
+// key set at most once per throttle interval.
+func TestJWKSRefreshThrottle(t *testing.T) {
+	jwks, err := os.ReadFile(jwksFile)
+	if err != nil {
+		t.Fatalf("couldn't read the jwks: %v", err)
+	}
+	var fetches int32
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	defer issuer.Close()
+	validator := auth.NewJWTValidator(
+		auth.NewURLKeySet(issuer.URL, issuer.Client()),
+		testJWTIssuer,
+		testJWTAudience,
+		"scope",
+		0,
+	)
+	ctx := context.Background()
+
+	// the key set is loaded for the first token
+	id, err := validator.Validate(ctx, signToken("RS256", testRSAKeyID, testClaims("inventory:read")))
+	if err != nil || id.Subject != "user@example.com" {
+		t.Fatalf("got %+v, %v for a valid token, want it accepted", id, err)
+	}
+	for i := 0; i < 50; i++ {
+		_, err = validator.Validate(ctx, signToken("RS256", "made-up-"+time.Now().Format("150405.000000"), testClaims("inventory:read")))
+		if err == nil {
+			t.Fatal("a token with an unknown key id was accepted")
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("got %d jwks fetches for 50 unknown key ids, want the first load only", got)
+	}
+	// known keys keep working meanwhile
+	if _, err = validator.Validate(ctx, signToken("ES256", testECKeyID, testClaims("inventory:read"))); err != nil {
+		t.Errorf("couldn't validate a token of a known key after the unknown ones: %v", err)
+	}
+
+	// a key set that failed to load retries at the next unknown key id
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	atomic.StoreInt32(&fetches, 0)
+	validator.Keys = auth.NewURLKeySet(failing.URL, failing.Client())
+	for i := 0; i < 3; i++ {
+		if _, err = validator.Validate(ctx, signToken("RS256", testRSAKeyID, testClaims("inventory:read"))); err == nil {
+			t.Fatal("a token was accepted without keys")
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 3 {
+		t.Errorf("got %d jwks fetches while the issuer failed, want 3", got)
+	}
+
+	// concurrent requests share the reload they wait for, whether it succeeds
+	// or fails
+	for _, tc := range []struct {
+		name   string
+		status int
+	}{
+		{"issuer up", http.StatusOK},
+		{"issuer down", http.StatusServiceUnavailable},
+	} {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(tc.status)
+			_, _ = w.Write(jwks)
+		}))
+		atomic.StoreInt32(&fetches, 0)
+		validator.Keys = auth.NewURLKeySet(slow.URL, slow.Client())
+		var accepted int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := validator.Validate(ctx, signToken("RS256", testRSAKeyID, testClaims("inventory:read"))); err == nil {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		slow.Close()
+		if got := atomic.LoadInt32(&fetches); got != 1 {
+			t.Errorf("%s: got %d jwks fetches for 20 concurrent tokens, want 1", tc.name, got)
+		}
+		if want := map[int]int32{http.StatusOK: 20}[tc.status]; atomic.LoadInt32(&accepted) != want {
+			t.Errorf("%s: got %d tokens accepted, want %d", tc.name, accepted, want)
+		}
+	}
+}
+
+func runJWTTest(t *testing.T, name, method, path, authorization string, want int) {
+	t.Helper()
+	t.Run(name, func(t *testing.T) {
+		req, err := http.NewRequestWithContext(context.Background(), method, integrationTestURL+path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("couldn't create request: %v", err)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Errorf("got status %d, want %d", res.StatusCode, want)
+		}
+	})
+}
+
+func bearer(token string) string {
+	return "Bearer " + token
+}
+
+// bearerToken signs claims with the rsa test key.
+func bearerToken(claims map[string]interface{}) string {
+	return signToken("RS256", testRSAKeyID, claims)
+}
+
+// unsignedToken returns a token with alg and an empty signature.
+func unsignedToken(alg string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	return encodeSegment(header) + "." + encodeSegment(payload) + "."
+}
+
+// signTokenWithSecret signs claims with HS256 and secret, naming kid unless
+// it is empty.
+func signTokenWithSecret(kid string, secret []byte, claims map[string]interface{}) string {
+	header := map[string]string{"alg": "HS256", "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, _ := json.Marshal(header)
+	payload, _ := json.Marshal(claims)
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + encodeSegment(mac.Sum(nil))
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/auth"
+	"github.com/warehouse/app/limits"
+)
+
+func TestRateLimitPerClient(t *testing.T) {
+	tenant := "limits-" + time.Now().Format("150405000000")
+	created := tenantRequest(t, tenant, http.MethodPost, "/api-keys", `{"name":"seller","scopes":["sales:write"]}`, http.StatusCreated)
+	var apiKey struct {
+		Key string `json:"key"`
+	}
+	err := json.Unmarshal([]byte(created), &apiKey)
+	if err != nil {
+		t.Fatalf("couldn't decode api key: %v", err)
+	}
+
+	// the default limit of sells is a burst of 10 at 5 per second
+	var limited *http.Response
+	for i := 0; i < 20 && limited == nil; i++ {
+		res := sell(t, apiKey.Key, `{"productId":"unknown"}`)
+		if res.StatusCode == http.StatusTooManyRequests {
+			limited = res
+		}
+	}
+	if limited == nil {
+		t.Fatal("20 sells in a row were not rate limited")
+	}
+	if limited.Header.Get("Retry-After") == "" {
+		t.Error("rate limited response without Retry-After")
+	}
+
+	// other clients keep their own budget
+	res := sell(t, testAdminKey, `{"productId":"unknown"}`)
+	if res.StatusCode == http.StatusTooManyRequests {
+		t.Error("admin was rate limited by the sells of another key")
+	}
+}
+
+func TestRateLimitUnauthorized(t *testing.T) {
+	limiter := limits.NewRateLimiter(limits.Limit{}, nil)
+	limiter.Unauthorized = limits.Limit{Rate: 0.001, Burst: 3}
+	limiter.TrustedHops = 1
+	server := httptest.NewServer(limiter.UnauthorizedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer server.Close()
+	request := func(key, forwardedFor string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("couldn't create request: %v", err)
+		}
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	// successful requests don't count
+	for i := 0; i < 10; i++ {
+		if res := request("valid", "203.0.113.1"); res.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d for a valid key, want 200", res.StatusCode)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if res := request("guessed", "203.0.113.1"); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("got status %d for guess %d, want 401", res.StatusCode, i+1)
+		}
+	}
+	res := request("guessed", "203.0.113.1")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Errorf("got status %d with Retry-After %q after 3 failures, want 429 with Retry-After",
+			res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	if res = request("valid", "203.0.113.1"); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the blocked address, want 429", res.StatusCode)
+	}
+	// the proxy appends the address it got the request from, whatever the
+	// client put before it doesn't pick another bucket
+	if res = request("guessed", "198.51.100.7, 203.0.113.1"); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d with a spoofed X-Forwarded-For, want 429", res.StatusCode)
+	}
+	if res = request("valid", "203.0.113.1, 203.0.113.2"); res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for another address, want 200", res.StatusCode)
+	}
+}
+
+func TestRateLimitPerTenant(t *testing.T) {
+	limiter := limits.NewRateLimiter(limits.Limit{Rate: 0.001, Burst: 1}, nil)
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	request := func(tenant string) int {
+		ctx := auth.WithIdentity(context.Background(), auth.Identity{Subject: "user@example.com", Tenant: tenant})
+		req := httptest.NewRequest(http.MethodGet, "/products", nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if status := request("tenant-a"); status != http.StatusNoContent {
+		t.Fatalf("got status %d for the first request, want 204", status)
+	}
+	if status := request("tenant-a"); status != http.StatusTooManyRequests {
+		t.Errorf("got status %d for the second request, want 429", status)
+	}
+	// the same subject in another tenant is another client
+	if status := request("tenant-b"); status != http.StatusNoContent {
+		t.Errorf("got status %d for the subject in another tenant, want 204", status)
+	}
+}
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	res := sell(t, testAdminKey, `{"productId":"`+strings.Repeat("x", 8192)+`"}`)
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for a large sell, want %d", res.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func sell(t *testing.T, key, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, integrationTestURL+"/products/sell", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("X-API-Key", key)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+	return res
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleLine is a sample of the Prometheus text exposition format, with the
+// metric name, its labels and the value.
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(?:[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\]|\\.)*",?)*\})? (\S+)$`)
+
+func TestMetrics(t *testing.T) {
+	tenant := "metrics-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"4"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPost, "/products", `{"products":[{"name":"table","contain_articles":[{"art_id":"1","amount_of":"4"}]}]}`, http.StatusCreated)
+	products := getTenantProducts(t, tenant)
+	if len(products.Products) != 1 {
+		t.Fatalf("got %d products, want 1", len(products.Products))
+	}
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+products.Products[0].ProductID+`"}`, http.StatusNoContent)
+
+	samples := scrapeMetrics(t)
+	tests := []struct {
+		sample string
+		want   float64
+	}{
+		{`warehouse_products_sold_total{tenant="` + tenant + `"}`, 1},
+		{`warehouse_articles_imported_total{tenant="` + tenant + `"}`, 1},
+		{`warehouse_article_units{tenant="` + tenant + `"}`, 0},
+		{`warehouse_products_out_of_stock{tenant="` + tenant + `"}`, 1},
+	}
+	for _, tt := range tests {
+		got, ok := samples[tt.sample]
+		if !ok {
+			t.Errorf("%s is missing", tt.sample)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s is %v, want %v", tt.sample, got, tt.want)
+		}
+	}
+	for _, sample := range []string{
+		`warehouse_http_requests_total{route="SellProduct",status="204"}`,
+		`warehouse_http_request_duration_seconds_count{route="SellProduct",status="204"}`,
+		`warehouse_db_query_duration_seconds_count{statement="updateArticleStockForSellProduct",outcome="success"}`,
+	} {
+		if samples[sample] <= 0 {
+			t.Errorf("%s is missing or 0", sample)
+		}
+	}
+	if _, ok := samples[`warehouse_db_connections{state="idle"}`]; !ok {
+		t.Error("connection pool stats are missing")
+	}
+}
+
+func TestMetricsRequireAdmin(t *testing.T) {
+	tenant := "metrics-admin-" + time.Now().Format("150405000000")
+	reader := createTestAPIKey(t, tenant, `{"name":"reader","scopes":["inventory:read"]}`).Key
+	tenantAdmin := createTestAPIKey(t, tenant, `{"name":"admin","scopes":["admin"]}`).Key
+	for _, tc := range []struct {
+		name string
+		key  string
+		want int
+	}{
+		{"no credentials", "", http.StatusUnauthorized},
+		{"reader of a tenant", reader, http.StatusForbidden},
+		// the metrics show the inventory of the other tenants
+		{"admin of a tenant", tenantAdmin, http.StatusForbidden},
+		{"admin", testAdminKey, http.StatusOK},
+	} {
+		if res := apiKeyRequest(t, tc.key, http.MethodGet, "/metrics", ""); res.StatusCode != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, res.StatusCode, tc.want)
+		}
+	}
+}
+
+// scrapeMetrics reads GET /metrics the way Prometheus does and returns the
+// samples by name and labels.
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, integrationTestURL+"/metrics", nil)
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	req.Header.Set("X-API-Key", testAdminKey)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(res.Body)
+		t.Fatalf("got status %d, want 200: %s", res.StatusCode, data)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("got Content-Type %q", res.Header.Get("Content-Type"))
+	}
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		match := sampleLine.FindStringSubmatch(line)
+		if match == nil {
+			t.Fatalf("invalid sample line %q", line)
+		}
+		value, err := strconv.ParseFloat(match[3], 64)
+		if err != nil && match[3] != "+Inf" && match[3] != "-Inf" {
+			t.Fatalf("invalid value in %q: %v", line, err)
+		}
+		samples[match[1]+match[2]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("couldn't read metrics: %v", err)
+	}
+	return samples
+}
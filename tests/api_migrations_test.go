@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/store"
+)
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	latest := store.LatestMigration()
+	assertAllApplied := func() {
+		t.Helper()
+		statuses, err := testDB.GetMigrationStatus(ctx)
+		if err != nil {
+			t.Fatalf("couldn't get the migration status: %v", err)
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil || status.Unknown {
+				t.Errorf("migration %s: got %+v, want it applied", status.Name, status)
+			}
+		}
+		last, err := testDB.GetLastMigration(ctx)
+		if err != nil {
+			t.Fatalf("couldn't get the last migration: %v", err)
+		}
+		if path.Base(last) != latest {
+			t.Errorf("got last migration %s, want %s", last, latest)
+		}
+	}
+	assertAllApplied()
+
+	applied, err := testDB.MigrateUp(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("migrating a migrated database applied %v: %v", applied, err)
+	}
+	reverted, err := testDB.MigrateDown(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0] != latest {
+		t.Fatalf("got %v reverted: %v, want %s", reverted, err, latest)
+	}
+	statuses, err := testDB.GetMigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("couldn't get the migration status: %v", err)
+	}
+	if last := statuses[len(statuses)-1]; last.Name != latest || last.AppliedAt != nil {
+		t.Errorf("got %+v after reverting it, want it pending", last)
+	}
+	applied, err = testDB.MigrateUp(ctx)
+	if err != nil || len(applied) != 1 || applied[0] != latest {
+		t.Fatalf("got %v applied: %v, want %s", applied, err, latest)
+	}
+	assertAllApplied()
+}
+
+// TestProductAvailabilityMigration upgrades a database owned by a plain role,
+// which row level security applies to, to the changeset adding
+// product_availability and checks it is filled for every tenant.
+func TestProductAvailabilityMigration(t *testing.T) {
+	ctx := context.Background()
+	const role = "warehouse_migrate_test"
+	_, err := testDB.Database.ExecContext(ctx, `
+	DO $$ BEGIN
+		CREATE ROLE `+role+` LOGIN PASSWORD '`+dbPassword+`';
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$;`)
+	if err != nil {
+		t.Fatalf("couldn't create role: %v", err)
+	}
+	name := "availability_migration_" + time.Now().Format("150405000000")
+	// uuid-ossp isn't a trusted extension, only a superuser can create it
+	createReplicaDB(t, name, `CREATE EXTENSION IF NOT EXISTS "uuid-ossp"; ALTER DATABASE `+name+` OWNER TO `+role)
+
+	credFile := filepath.Join(t.TempDir(), "creds.json")
+	err = os.WriteFile(credFile, []byte(`{"USERNAME":"`+role+`","PASSWORD":"`+dbPassword+`"}`), 0o600)
+	if err != nil {
+		t.Fatalf("couldn't write credentials: %v", err)
+	}
+	db, err := store.NewPostgresDB(store.Config{
+		Host:                testDBHost,
+		Port:                testDBPort,
+		DB:                  name,
+		CredentialsFileName: credFile,
+	})
+	if err != nil {
+		t.Fatalf("couldn't open %s as %s: %v", name, role, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := store.Migrations()
+	if err != nil {
+		t.Fatalf("couldn't read the migrations: %v", err)
+	}
+	steps := -1
+	for i, migration := range migrations {
+		if migration.Name == "20261910_12_product_availability.sql" {
+			steps = len(migrations) - i
+		}
+	}
+	if steps < 0 {
+		t.Fatal("couldn't find the product_availability migration")
+	}
+	if _, err = db.MigrateUp(ctx); err != nil {
+		t.Fatalf("couldn't migrate up: %v", err)
+	}
+	if _, err = db.MigrateDown(ctx, steps); err != nil {
+		t.Fatalf("couldn't migrate down before product_availability: %v", err)
+	}
+
+	stocks := map[string]int{"tenant-a": 2, "tenant-b": 5}
+	for tenant, stock := range stocks {
+		tx, err := db.Database.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("couldn't begin: %v", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+		SELECT set_config('app.tenant_id', $1, true);`, tenant)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `
+			WITH new_product AS (
+				INSERT INTO product (tenant_id, product_name) VALUES ($1, 'stool') RETURNING product_id
+			), new_article AS (
+				INSERT INTO article (tenant_id, article_id, article_name, stock) VALUES ($1, '1', 'leg', $2)
+			)
+			INSERT INTO product_article (tenant_id, product_id, article_id, article_amount)
+			SELECT $1, product_id, '1', 3 FROM new_product`, tenant, stock*3)
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback() //nolint
+		}
+		if err != nil {
+			t.Fatalf("couldn't add the inventory of %s: %v", tenant, err)
+		}
+	}
+
+	if _, err = db.MigrateUp(ctx); err != nil {
+		t.Fatalf("couldn't migrate up as %s: %v", role, err)
+	}
+	for tenant, stock := range stocks {
+		products, err := db.GetAllProducts(store.WithTenant(ctx, tenant))
+		if err != nil {
+			t.Fatalf("couldn't get the products of %s: %v", tenant, err)
+		}
+		if len(products.Products) != 1 || products.Products[0].Stock != stock {
+			t.Errorf("got products %+v of %s after migrating, want one with stock %d", products.Products, tenant, stock)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/outbox"
+	"github.com/warehouse/app/store"
+)
+
+// failingSink fails the first attempt of the first event of type failFirst
+// and hands every other event to the channel sink.
+type failingSink struct {
+	*outbox.ChannelSink
+	mu        sync.Mutex
+	failFirst string
+}
+
+func (s *failingSink) Publish(ctx context.Context, event store.OutboxEvent) error {
+	s.mu.Lock()
+	fail := event.EventType == s.failFirst
+	if fail {
+		s.failFirst = ""
+	}
+	s.mu.Unlock()
+	if fail {
+		return errors.New("sink unavailable")
+	}
+	return s.ChannelSink.Publish(ctx, event)
+}
+
+// received returns the events of tenant the sink got so far, as
+// type:aggregateType.
+func (s *failingSink) received(tenant string) []string {
+	events := make([]string, 0)
+	for {
+		select {
+		case event := <-s.Events:
+			if event.TenantID == tenant {
+				events = append(events, event.EventType+":"+event.AggregateType)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func TestOutboxRolledBackSell(t *testing.T) {
+	tenant := "outbox-rollback-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	var subscription struct {
+		SubscriptionID string `json:"subscriptionId"`
+	}
+	data := tenantRequest(t, tenant, http.MethodPost, "/webhooks",
+		`{"url":"https://hooks.example.com/`+tenant+`","eventTypes":["product.sold"]}`, http.StatusCreated)
+	if err := json.Unmarshal([]byte(data), &subscription); err != nil {
+		t.Fatalf("couldn't decode webhook %s: %v", data, err)
+	}
+	defer tenantRequest(t, tenant, http.MethodDelete, "/webhooks/"+subscription.SubscriptionID, "", http.StatusNoContent)
+
+	// queueing the webhook delivery is the last write of a sell, failing it
+	// rolls back the outbox events written before
+	ctx := context.Background()
+	_, err := testDB.Database.ExecContext(ctx, `
+		CREATE OR REPLACE FUNCTION fail_webhook_delivery() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'webhook_delivery refused';
+		END
+		$$ LANGUAGE plpgsql;`)
+	if err != nil {
+		t.Fatalf("couldn't create trigger function: %v", err)
+	}
+	defer testDB.Database.ExecContext(ctx, `DROP FUNCTION fail_webhook_delivery();`)
+	_, err = testDB.Database.ExecContext(ctx, `
+		CREATE TRIGGER fail_webhook_delivery BEFORE INSERT ON webhook_delivery
+		FOR EACH ROW WHEN (NEW.subscription_id = '`+subscription.SubscriptionID+`')
+		EXECUTE PROCEDURE fail_webhook_delivery();`)
+	if err != nil {
+		t.Fatalf("couldn't create trigger: %v", err)
+	}
+	dropTrigger := func() {
+		_, err := testDB.Database.ExecContext(ctx, `DROP TRIGGER IF EXISTS fail_webhook_delivery ON webhook_delivery;`)
+		if err != nil {
+			t.Fatalf("couldn't drop trigger: %v", err)
+		}
+	}
+	defer dropTrigger()
+
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusInternalServerError)
+	if events := countTenantSaleEvents(t, tenant); events != 0 {
+		t.Errorf("got %d outbox events of a rolled back sell, want none", events)
+	}
+	if stock := getTenantArticleStock(t, tenant, "1"); stock != 100 {
+		t.Errorf("got stock %d after a rolled back sell, want 100", stock)
+	}
+
+	dropTrigger()
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	// article.updated, product.sold and product.stock_changed
+	if events := countTenantSaleEvents(t, tenant); events != 3 {
+		t.Errorf("got %d outbox events of a committed sell, want 3", events)
+	}
+}
+
+func TestOutboxRedelivery(t *testing.T) {
+	tenant := "outbox-redelivery-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	publishPendingOutboxEvents(t)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+
+	sink := &failingSink{ChannelSink: outbox.NewChannelSink(100), failFirst: store.OutboxEventArticleUpdated}
+	dispatcher := outbox.NewDispatcher(testDB, sink, time.Hour, time.Second)
+	dispatch := func() []string {
+		t.Helper()
+		if err := dispatcher.DispatchPending(context.Background()); err != nil {
+			t.Fatalf("couldn't dispatch: %v", err)
+		}
+		return sink.received(tenant)
+	}
+
+	// the article and the product are separate aggregates
+	if got := dispatch(); strings.Join(got, ",") != "product.sold:product,product.stock_changed:product" {
+		t.Errorf("got %v with the article event failing, want the product events", got)
+	}
+	if backlog := countTenantUnpublishedEvents(t, tenant); backlog != 1 {
+		t.Errorf("got %d unpublished events, want the failed one", backlog)
+	}
+	if got := dispatch(); strings.Join(got, ",") != "article.updated:article" {
+		t.Errorf("got %v on the second round, want the failed event again", got)
+	}
+	if got := dispatch(); len(got) != 0 {
+		t.Errorf("got %v once everything was published, want nothing", got)
+	}
+	if backlog := countTenantUnpublishedEvents(t, tenant); backlog != 0 {
+		t.Errorf("got %d unpublished events, want none", backlog)
+	}
+}
+
+func TestOutboxAggregateOrder(t *testing.T) {
+	tenant := "outbox-order-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	publishPendingOutboxEvents(t)
+	for i := 0; i < 2; i++ {
+		tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	}
+
+	sink := &failingSink{ChannelSink: outbox.NewChannelSink(100), failFirst: store.OutboxEventProductSold}
+	dispatcher := outbox.NewDispatcher(testDB, sink, time.Hour, time.Second)
+	if err := dispatcher.DispatchPending(context.Background()); err != nil {
+		t.Fatalf("couldn't dispatch: %v", err)
+	}
+	// the first product.sold failed, no later event of the product may
+	// overtake it
+	if got := sink.received(tenant); strings.Join(got, ",") != "article.updated:article,article.updated:article" {
+		t.Errorf("got %v with the first sale failing, want the article events only", got)
+	}
+	if err := dispatcher.DispatchPending(context.Background()); err != nil {
+		t.Fatalf("couldn't dispatch: %v", err)
+	}
+	want := "product.sold:product,product.stock_changed:product,product.sold:product,product.stock_changed:product"
+	if got := sink.received(tenant); strings.Join(got, ",") != want {
+		t.Errorf("got %v on the second round, want the product events in order", got)
+	}
+}
+
+func TestOutboxLeases(t *testing.T) {
+	tenant := "outbox-lease-" + time.Now().Format("150405000000")
+	productID := setupWebhookProduct(t, tenant)
+	publishPendingOutboxEvents(t)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	ctx := context.Background()
+	process := func(limit int, publish func(events []store.OutboxEvent) []int64) {
+		t.Helper()
+		err := testDB.ProcessOutboxEvents(ctx, store.ProcessOutboxEventsRequest{
+			Limit: limit,
+			Lease: time.Hour,
+			Publish: func(_ context.Context, events []store.OutboxEvent) []int64 {
+				return publish(events)
+			},
+		})
+		if err != nil {
+			t.Fatalf("couldn't process outbox events: %v", err)
+		}
+	}
+	types := func(events []store.OutboxEvent) string {
+		names := make([]string, 0, len(events))
+		for _, event := range events {
+			names = append(names, event.EventType)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// while the article event and the sale are leased, another dispatcher
+	// gets neither of them nor the stock change that follows the sale
+	process(2, func(events []store.OutboxEvent) []int64 {
+		if got := types(events); got != "article.updated,product.sold" {
+			t.Errorf("got %s claimed, want article.updated and product.sold", got)
+		}
+		process(100, func(nested []store.OutboxEvent) []int64 {
+			if len(nested) != 0 {
+				t.Errorf("got %s claimed by a second dispatcher, want nothing", types(nested))
+			}
+			return nil
+		})
+		// the sale failed
+		return []int64{events[0].EventID}
+	})
+	if backlog := countTenantUnpublishedEvents(t, tenant); backlog != 2 {
+		t.Errorf("got %d unpublished events, want the sale and the stock change", backlog)
+	}
+
+	// a dispatcher that outlived its lease can't mark events claimed again
+	// by another one
+	process(100, func(events []store.OutboxEvent) []int64 {
+		if got := types(events); got != "product.sold,product.stock_changed" {
+			t.Errorf("got %s claimed, want product.sold and product.stock_changed", got)
+		}
+		_, err := testDB.Database.ExecContext(ctx,
+			`UPDATE outbox_event SET leased_until = now() - interval '1 second' WHERE tenant_id = $1 AND published_at IS NULL`, tenant)
+		if err != nil {
+			t.Fatalf("couldn't expire the lease: %v", err)
+		}
+		process(100, func(nested []store.OutboxEvent) []int64 {
+			if got := types(nested); got != "product.sold,product.stock_changed" {
+				t.Errorf("got %s claimed after the lease expired, want product.sold and product.stock_changed", got)
+			}
+			return nil
+		})
+		return []int64{events[0].EventID, events[1].EventID}
+	})
+	if backlog := countTenantUnpublishedEvents(t, tenant); backlog != 2 {
+		t.Errorf("got %d unpublished events after an expired lease, want 2", backlog)
+	}
+}
+
+func TestOutboxFileSink(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "outbox-*.ndjson")
+	if err != nil {
+		t.Fatalf("couldn't create the outbox file: %v", err)
+	}
+	sink := outbox.NewFileSink(f)
+	event := store.OutboxEvent{
+		EventID:       1,
+		TenantID:      "default",
+		AggregateType: store.OutboxAggregateArticle,
+		AggregateID:   "1",
+		EventType:     store.OutboxEventArticleUpdated,
+		Payload:       json.RawMessage(`{"articleId":"1","stock":1}`),
+	}
+	if err = sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("couldn't publish to the file: %v", err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("couldn't read the outbox file: %v", err)
+	}
+	var written store.OutboxEvent
+	if err = json.Unmarshal(data, &written); err != nil || written.EventID != 1 || !strings.HasSuffix(string(data), "}\n") {
+		t.Errorf("got %q in the file, want the event as a line: %v", data, err)
+	}
+	// an event that can't be stored isn't published
+	f.Close()
+	if err = sink.Publish(context.Background(), event); err == nil {
+		t.Error("got an event published to a closed file")
+	}
+}
+
+// publishPendingOutboxEvents marks the events of the earlier tests as
+// published, so that a batch only holds the events of the running test.
+func publishPendingOutboxEvents(t *testing.T) {
+	t.Helper()
+	_, err := testDB.Database.ExecContext(context.Background(),
+		`UPDATE outbox_event SET published_at = now(), leased_until = NULL, lease_token = NULL WHERE published_at IS NULL`)
+	if err != nil {
+		t.Fatalf("couldn't publish pending outbox events: %v", err)
+	}
+}
+
+func countTenantSaleEvents(t *testing.T, tenant string) int {
+	t.Helper()
+	var count int
+	err := testDB.Database.QueryRowContext(context.Background(), `
+		SELECT count(*) FROM outbox_event
+		WHERE tenant_id = $1 AND event_type IN ('article.updated', 'product.sold', 'product.stock_changed')`, tenant).
+		Scan(&count)
+	if err != nil {
+		t.Fatalf("couldn't count outbox events: %v", err)
+	}
+	return count
+}
+
+func countTenantUnpublishedEvents(t *testing.T, tenant string) int {
+	t.Helper()
+	var count int
+	err := testDB.Database.QueryRowContext(context.Background(),
+		`SELECT count(*) FROM outbox_event WHERE tenant_id = $1 AND published_at IS NULL`, tenant).Scan(&count)
+	if err != nil {
+		t.Fatalf("couldn't count outbox events: %v", err)
+	}
+	return count
+}
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testPurchaseOrder struct {
+	PurchaseOrderID string `json:"purchaseOrderId"`
+	State           string `json:"state"`
+	Lines           []struct {
+		ArticleID        string `json:"articleId"`
+		QuantityReceived int    `json:"quantityReceived"`
+		UnitCostCents    int64  `json:"unitCostCents"`
+	} `json:"lines"`
+}
+
+func TestPurchaseOrderStateMachine(t *testing.T) {
+	tenant := "po-states-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"2"}]}`, http.StatusCreated)
+	supplierID := createTestSupplier(t, tenant)
+
+	draft := func() string {
+		return createTestPurchaseOrder(t, tenant, `{"supplierId":"`+supplierID+`","lines":[{"articleId":"1","quantity":5}]}`).PurchaseOrderID
+	}
+	patch := func(purchaseOrderID, state string, want int) {
+		t.Helper()
+		tenantRequest(t, tenant, http.MethodPatch, "/purchase-orders/"+purchaseOrderID, `{"state":"`+state+`"}`, want)
+	}
+
+	purchaseOrderID := draft()
+	// only a sent order receives goods
+	tenantRequest(t, tenant, http.MethodPost, "/purchase-orders/"+purchaseOrderID+"/receipts",
+		`{"lines":[{"articleId":"1","quantity":1}]}`, http.StatusConflict)
+	// receipts move orders to partially_received, a state change can't
+	patch(purchaseOrderID, "partially_received", http.StatusConflict)
+	patch(purchaseOrderID, "unknown", http.StatusConflict)
+	patch(purchaseOrderID, "sent", http.StatusOK)
+	patch(purchaseOrderID, "draft", http.StatusConflict)
+	patch(purchaseOrderID, "sent", http.StatusConflict)
+	patch(purchaseOrderID, "closed", http.StatusOK)
+	patch(purchaseOrderID, "sent", http.StatusConflict)
+	patch(purchaseOrderID, "draft", http.StatusConflict)
+	tenantRequest(t, tenant, http.MethodPost, "/purchase-orders/"+purchaseOrderID+"/receipts",
+		`{"lines":[{"articleId":"1","quantity":1}]}`, http.StatusConflict)
+
+	// a draft may be cancelled right away
+	patch(draft(), "closed", http.StatusOK)
+	patch("00000000-0000-0000-0000-000000000000", "sent", http.StatusNotFound)
+
+	if stock := getTenantArticleStock(t, tenant, "1"); stock != 2 {
+		t.Errorf("got stock %d, want 2 as nothing was received", stock)
+	}
+}
+
+func TestPurchaseOrderReceipts(t *testing.T) {
+	tenant := "po-receipts-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles",
+		`{"inventory":[{"art_id":"1","name":"leg","stock":"2"},{"art_id":"2","name":"screw","stock":"0"}]}`, http.StatusCreated)
+	supplierID := createTestSupplier(t, tenant)
+	purchaseOrder := createTestPurchaseOrder(t, tenant, `{"supplierId":"`+supplierID+`","lines":[`+
+		`{"articleId":"1","quantity":5,"unitCostCents":150},{"articleId":"2","quantity":3}]}`)
+	if purchaseOrder.State != "draft" {
+		t.Fatalf("got state %s of a new purchase order, want draft", purchaseOrder.State)
+	}
+	// costs are whole cents
+	tenantRequest(t, tenant, http.MethodPost, "/purchase-orders", `{"supplierId":"`+supplierID+`","lines":[`+
+		`{"articleId":"1","quantity":5,"unitCostCents":1.5}]}`, http.StatusBadRequest)
+	path := "/purchase-orders/" + purchaseOrder.PurchaseOrderID
+	tenantRequest(t, tenant, http.MethodPatch, path, `{"state":"sent"}`, http.StatusOK)
+
+	receive := func(body string, want int) testPurchaseOrder {
+		t.Helper()
+		var res testPurchaseOrder
+		data := tenantRequest(t, tenant, http.MethodPost, path+"/receipts", body, want)
+		if want == http.StatusCreated {
+			if err := json.Unmarshal([]byte(data), &res); err != nil {
+				t.Fatalf("couldn't decode purchase order %s: %v", data, err)
+			}
+		}
+		return res
+	}
+
+	if res := receive(`{"lines":[{"articleId":"1","quantity":2}]}`, http.StatusCreated); res.State != "partially_received" {
+		t.Errorf("got state %s after a partial receipt, want partially_received", res.State)
+	}
+	if stock := getTenantArticleStock(t, tenant, "1"); stock != 4 {
+		t.Errorf("got stock %d after a partial receipt, want 4", stock)
+	}
+	// more than ordered, or an article that isn't on the order, is rejected
+	// as a whole
+	receive(`{"lines":[{"articleId":"2","quantity":1},{"articleId":"1","quantity":4}]}`, http.StatusBadRequest)
+	receive(`{"lines":[{"articleId":"3","quantity":1}]}`, http.StatusBadRequest)
+	if stock := getTenantArticleStock(t, tenant, "2"); stock != 0 {
+		t.Errorf("got stock %d after a rejected receipt, want 0", stock)
+	}
+
+	res := receive(`{"lines":[{"articleId":"1","quantity":3},{"articleId":"2","quantity":3}]}`, http.StatusCreated)
+	if res.State != "closed" {
+		t.Errorf("got state %s after receiving everything, want closed", res.State)
+	}
+	for _, line := range res.Lines {
+		if want := map[string]int{"1": 5, "2": 3}[line.ArticleID]; line.QuantityReceived != want {
+			t.Errorf("got %d received of article %s, want %d", line.QuantityReceived, line.ArticleID, want)
+		}
+		if want := map[string]int64{"1": 150, "2": 0}[line.ArticleID]; line.UnitCostCents != want {
+			t.Errorf("got a unit cost of %d cents for article %s, want %d", line.UnitCostCents, line.ArticleID, want)
+		}
+	}
+	if stock := getTenantArticleStock(t, tenant, "1"); stock != 7 {
+		t.Errorf("got stock %d of article 1 after the full receipt, want 7", stock)
+	}
+	if stock := getTenantArticleStock(t, tenant, "2"); stock != 3 {
+		t.Errorf("got stock %d of article 2 after the full receipt, want 3", stock)
+	}
+	receive(`{"lines":[{"articleId":"1","quantity":1}]}`, http.StatusConflict)
+
+	rows, err := testDB.Database.QueryContext(context.Background(),
+		`SELECT article_id, delta, reason, reference FROM stock_history WHERE tenant_id = $1 ORDER BY stock_history_id`, tenant)
+	if err != nil {
+		t.Fatalf("couldn't read stock_history: %v", err)
+	}
+	defer rows.Close()
+	var history []string
+	for rows.Next() {
+		var articleID, reason, reference string
+		var delta int
+		if err = rows.Scan(&articleID, &delta, &reason, &reference); err != nil {
+			t.Fatalf("couldn't scan stock_history: %v", err)
+		}
+		if reason != "receipt" || reference != purchaseOrder.PurchaseOrderID {
+			t.Errorf("got stock_history of %s for %s, want a receipt of %s", reason, reference, purchaseOrder.PurchaseOrderID)
+		}
+		history = append(history, articleID+":"+strconv.Itoa(delta))
+	}
+	if len(history) != 3 || history[0] != "1:2" || history[1] != "1:3" || history[2] != "2:3" {
+		t.Errorf("got stock_history %v, want 1:2, 1:3 and 2:3", history)
+	}
+}
+
+func createTestSupplier(t *testing.T, tenant string) string {
+	t.Helper()
+	var supplier struct {
+		SupplierID string `json:"supplierId"`
+	}
+	data := tenantRequest(t, tenant, http.MethodPost, "/suppliers", `{"name":"acme"}`, http.StatusCreated)
+	if err := json.Unmarshal([]byte(data), &supplier); err != nil || supplier.SupplierID == "" {
+		t.Fatalf("couldn't decode supplier %s: %v", data, err)
+	}
+	return supplier.SupplierID
+}
+
+func createTestPurchaseOrder(t *testing.T, tenant, body string) testPurchaseOrder {
+	t.Helper()
+	var purchaseOrder testPurchaseOrder
+	data := tenantRequest(t, tenant, http.MethodPost, "/purchase-orders", body, http.StatusCreated)
+	if err := json.Unmarshal([]byte(data), &purchaseOrder); err != nil || purchaseOrder.PurchaseOrderID == "" {
+		t.Fatalf("couldn't decode purchase order %s: %v", data, err)
+	}
+	return purchaseOrder
+}
+
+func getTenantArticleStock(t *testing.T, tenant, articleID string) int {
+	t.Helper()
+	var article struct {
+		Stock string `json:"stock"`
+	}
+	data := tenantRequest(t, tenant, http.MethodGet, "/articles/"+articleID, "", http.StatusOK)
+	if err := json.Unmarshal([]byte(data), &article); err != nil {
+		t.Fatalf("couldn't decode article %s: %v", data, err)
+	}
+	stock, err := strconv.Atoi(article.Stock)
+	if err != nil {
+		t.Fatalf("got article stock %q: %v", article.Stock, err)
+	}
+	return stock
+}
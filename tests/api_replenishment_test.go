@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/replenishment"
+	"github.com/warehouse/app/store"
+)
+
+type testSuggestion struct {
+	ArticleID         string `json:"articleId"`
+	Stock             int    `json:"stock"`
+	OnOrder           int    `json:"onOrder"`
+	Reserved          int    `json:"reserved"`
+	ExpectedDemand    int    `json:"expectedDemand"`
+	SuggestedQuantity int    `json:"suggestedQuantity"`
+	Consumers         []struct {
+		Name          string `json:"name"`
+		ArticleAmount int    `json:"articleAmount"`
+		Sold          int    `json:"sold"`
+		Reserved      int    `json:"reserved"`
+		ExpectedSales int    `json:"expectedSales"`
+	} `json:"consumers"`
+}
+
+func TestReplenishmentSuggestions(t *testing.T) {
+	tenant := "replenishment-" + time.Now().Format("150405000000")
+	productIDs := setupReplenishment(t, tenant)
+
+	// the table sold once in the 30 day window and is expected to sell once
+	// more in the 10 days of lead time, the stool is reserved once
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productIDs["table"]+`"}`, http.StatusNoContent)
+	reservationID := createTestReservation(t, tenant, productIDs["stool"], `{"quantity":1,"reference":"order-1"}`)
+
+	suggestions := getTestSuggestions(t, tenant)
+	if len(suggestions) != 1 {
+		t.Fatalf("got suggestions %+v, want one for article 1", suggestions)
+	}
+	// 16 in stock, 3 legs reserved for the stool and 4 for the next table
+	suggestion := suggestions[0]
+	if suggestion.ArticleID != "1" || suggestion.Stock != 16 || suggestion.Reserved != 3 || suggestion.ExpectedDemand != 4 {
+		t.Errorf("got suggestion %+v, want 16 legs in stock, 3 reserved and a demand of 4", suggestion)
+	}
+	// 9 projected is 3 short of reorder point plus safety stock, the reorder
+	// quantity is 5
+	if suggestion.SuggestedQuantity != 5 {
+		t.Errorf("got suggested quantity %d, want 5", suggestion.SuggestedQuantity)
+	}
+	consumers := make(map[string]int)
+	for _, consumer := range suggestion.Consumers {
+		consumers[consumer.Name] = consumer.ArticleAmount*100 + consumer.Sold*10 + consumer.Reserved
+		if consumer.Name == "table" && consumer.ExpectedSales != 1 {
+			t.Errorf("got %d expected sales of the table, want 1", consumer.ExpectedSales)
+		}
+	}
+	if len(consumers) != 2 || consumers["table"] != 410 || consumers["stool"] != 301 {
+		t.Errorf("got consumers %+v, want the table with 4 legs sold once and the stool with 3 legs reserved once", suggestion.Consumers)
+	}
+
+	// releasing the reservation lifts the projection to the reorder point
+	tenantRequest(t, tenant, http.MethodDelete, "/reservations/"+reservationID, "", http.StatusNoContent)
+	tenantRequest(t, tenant, http.MethodDelete, "/reservations/"+reservationID, "", http.StatusNotFound)
+	if suggestions = getTestSuggestions(t, tenant); len(suggestions) != 0 {
+		t.Errorf("got suggestions %+v without the reservation, want none", suggestions)
+	}
+
+	tenantRequest(t, tenant, http.MethodPost, "/products/"+productIDs["stool"]+"/reservations", `{"quantity":0}`, http.StatusBadRequest)
+	tenantRequest(t, tenant, http.MethodPost, "/products/00000000-0000-0000-0000-000000000000/reservations", `{"quantity":1}`, http.StatusNotFound)
+	// products of other tenants can't be reserved
+	tenantRequest(t, tenant+"-other", http.MethodPost, "/products/"+productIDs["stool"]+"/reservations", `{"quantity":1}`, http.StatusNotFound)
+}
+
+func TestReplenishmentAutoDraft(t *testing.T) {
+	tenant := "auto-draft-" + time.Now().Format("150405000000")
+	productIDs := setupReplenishment(t, tenant)
+	createTestReservation(t, tenant, productIDs["table"], `{"quantity":3}`)
+	if suggestions := getTestSuggestions(t, tenant); len(suggestions) != 1 || suggestions[0].SuggestedQuantity != 5 {
+		t.Fatalf("got suggestions %+v, want the reorder quantity of 5 legs for 8 projected", suggestions)
+	}
+
+	handler := replenishment.NewHandler(30)
+	handler.ReplenishmentStore = testDB
+	handler.PurchaseOrdersStore = testDB
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// several rounds, the draft counts as on order for the next ones
+	handler.RunAutoDraft(ctx, 200*time.Millisecond)
+
+	rows, err := testDB.Database.QueryContext(context.Background(), `
+		SELECT purchase_order.state, purchase_order_line.article_id, purchase_order_line.quantity_ordered
+		FROM purchase_order
+		JOIN purchase_order_line ON purchase_order_line.purchase_order_id = purchase_order.purchase_order_id
+		WHERE purchase_order.tenant_id = $1`, tenant)
+	if err != nil {
+		t.Fatalf("couldn't read purchase orders: %v", err)
+	}
+	defer rows.Close()
+	lines := 0
+	for rows.Next() {
+		var state, articleID string
+		var quantity int
+		if err = rows.Scan(&state, &articleID, &quantity); err != nil {
+			t.Fatalf("couldn't scan purchase order: %v", err)
+		}
+		if state != "draft" || articleID != "1" || quantity != 5 {
+			t.Errorf("got %s purchase order of %d of article %s, want a draft of 5 of article 1", state, quantity, articleID)
+		}
+		lines++
+	}
+	if lines != 1 {
+		t.Errorf("got %d purchase order lines, want a single draft", lines)
+	}
+	if suggestions := getTestSuggestions(t, tenant); len(suggestions) != 0 {
+		t.Errorf("got suggestions %+v with the draft on order, want none", suggestions)
+	}
+
+	// drafting with nothing to suggest is a no-op
+	err = handler.DraftPurchaseOrders(store.WithTenant(context.Background(), tenant))
+	if err != nil {
+		t.Errorf("couldn't draft purchase orders: %v", err)
+	}
+}
+
+// setupReplenishment creates 20 legs with a reorder point of 10, supplied in
+// 10 days, used 4 times by a table and 3 times by a stool, and 100 screws
+// without a reorder point. It returns the product ids by name.
+func setupReplenishment(t *testing.T, tenant string) map[string]string {
+	t.Helper()
+	tenantRequest(t, tenant, http.MethodPost, "/articles",
+		`{"inventory":[{"art_id":"1","name":"leg","stock":"20"},{"art_id":"2","name":"screw","stock":"100"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPost, "/products", `{"products":[`+
+		`{"name":"table","contain_articles":[{"art_id":"1","amount_of":"4"}]},`+
+		`{"name":"stool","contain_articles":[{"art_id":"1","amount_of":"3"},{"art_id":"2","amount_of":"1"}]}]}`, http.StatusCreated)
+	supplierID := createTestSupplier(t, tenant)
+	tenantRequest(t, tenant, http.MethodPost, "/suppliers/"+supplierID+"/articles",
+		`{"articleId":"1","supplierSku":"L-1","leadTimeDays":10,"unitCostCents":200}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPut, "/articles/1/replenishment",
+		`{"reorderPoint":10,"safetyStock":2,"reorderQuantity":5}`, http.StatusNoContent)
+
+	var products struct {
+		Products []struct {
+			ProductID string `json:"productId"`
+			Name      string `json:"name"`
+		} `json:"products"`
+	}
+	data := tenantRequest(t, tenant, http.MethodGet, "/products", "", http.StatusOK)
+	if err := json.Unmarshal([]byte(data), &products); err != nil {
+		t.Fatalf("couldn't decode products %s: %v", data, err)
+	}
+	productIDs := make(map[string]string)
+	for _, product := range products.Products {
+		productIDs[product.Name] = product.ProductID
+	}
+	return productIDs
+}
+
+func createTestReservation(t *testing.T, tenant, productID, body string) string {
+	t.Helper()
+	var reservation struct {
+		ReservationID string `json:"reservationId"`
+	}
+	data := tenantRequest(t, tenant, http.MethodPost, "/products/"+productID+"/reservations", body, http.StatusCreated)
+	if err := json.Unmarshal([]byte(data), &reservation); err != nil || reservation.ReservationID == "" {
+		t.Fatalf("couldn't decode reservation %s: %v", data, err)
+	}
+	return reservation.ReservationID
+}
+
+func getTestSuggestions(t *testing.T, tenant string) []testSuggestion {
+	t.Helper()
+	var res struct {
+		Suggestions []testSuggestion `json:"suggestions"`
+	}
+	data := tenantRequest(t, tenant, http.MethodGet, "/replenishment/suggestions", "", http.StatusOK)
+	if err := json.Unmarshal([]byte(data), &res); err != nil {
+		t.Fatalf("couldn't decode suggestions %s: %v", data, err)
+	}
+	return res.Suggestions
+}
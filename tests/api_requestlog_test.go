@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRequestIDInErrorResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+	}{
+		{"propagated", "test-request-id"},
+		{"generated", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, integrationTestURL+"/products/unknown", nil)
+			if err != nil {
+				t.Fatalf("couldn't create request: %v", err)
+			}
+			req.Header.Set("X-API-Key", testAdminKey)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			res, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer res.Body.Close()
+			var body struct {
+				RequestID string `json:"requestId"`
+			}
+			err = json.NewDecoder(res.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("couldn't decode error response: %v", err)
+			}
+			echoed := res.Header.Get("X-Request-ID")
+			if echoed == "" || body.RequestID != echoed {
+				t.Errorf("got request id %q in the body and %q in the header, want the same", body.RequestID, echoed)
+			}
+			if tt.requestID != "" && echoed != tt.requestID {
+				t.Errorf("got request id %q, want %q", echoed, tt.requestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/audit"
+	"github.com/warehouse/app/consistency"
+	"github.com/warehouse/app/idempotency"
+	"github.com/warehouse/app/limits"
+	"github.com/warehouse/app/metrics"
+	"github.com/warehouse/app/requestlog"
+	"github.com/warehouse/app/store"
+	"github.com/warehouse/app/tracing"
+)
+
+func TestNDJSONListings(t *testing.T) {
+	tenant := "ndjson-" + time.Now().Format("150405000000")
+	articles := make([]string, 0, 250)
+	for i := 0; i < 250; i++ {
+		articles = append(articles, fmt.Sprintf(`{"art_id":"%03d","name":"part","stock":"10"}`, i))
+	}
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[`+strings.Join(articles, ",")+`]}`, http.StatusCreated)
+	productBody := `{"products":[{"name":"table","contain_articles":[{"art_id":"000","amount_of":"4"},{"art_id":"001","amount_of":"2"}]},` +
+		`{"name":"chair","contain_articles":[{"art_id":"001","amount_of":"5"}]}]}`
+	tenantRequest(t, tenant, http.MethodPost, "/products", productBody, http.StatusCreated)
+
+	var article struct {
+		ArticleID string `json:"art_id"`
+		Stock     string `json:"stock"`
+		Version   int    `json:"version"`
+	}
+	lines := ndjsonRequest(t, tenant, "/articles")
+	if len(lines) != 250 {
+		t.Fatalf("got %d articles, want 250", len(lines))
+	}
+	for i, line := range lines {
+		err := json.Unmarshal([]byte(line), &article)
+		if err != nil || article.ArticleID != fmt.Sprintf("%03d", i) || article.Stock != "10" {
+			t.Fatalf("got article line %d %s: %v", i, line, err)
+		}
+	}
+
+	var product struct {
+		Name     string `json:"name"`
+		Stock    int    `json:"stock"`
+		Articles []struct {
+			ArticleID string `json:"art_id"`
+		} `json:"contain_articles"`
+	}
+	lines = ndjsonRequest(t, tenant, "/products")
+	if len(lines) != 2 {
+		t.Fatalf("got %d products, want 2: %v", len(lines), lines)
+	}
+	articlesOf := make(map[string]int)
+	for _, line := range lines {
+		err := json.Unmarshal([]byte(line), &product)
+		if err != nil {
+			t.Fatalf("couldn't decode product line %s: %v", line, err)
+		}
+		articlesOf[product.Name] = len(product.Articles)
+	}
+	if articlesOf["table"] != 2 || articlesOf["chair"] != 1 {
+		t.Errorf("got articles per product %v, want 2 for table and 1 for chair", articlesOf)
+	}
+}
+
+// ndjsonRequest gets path as application/x-ndjson on behalf of tenant and
+// returns its lines.
+// TestMiddlewaresFlush checks that responses can be streamed behind every
+// middleware wrapping the response writer.
+func TestMiddlewaresFlush(t *testing.T) {
+	tenant := "flush-" + time.Now().Format("150405000000")
+	auditor := audit.NewMiddleware()
+	auditor.Store = testDB
+	limiter := limits.NewRateLimiter(limits.Limit{}, nil)
+	limiter.Unauthorized = limits.Limit{Rate: 1, Burst: 10}
+	for _, tc := range []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+	}{
+		{"tracing", tracing.Middleware},
+		{"requestlog", requestlog.Middleware},
+		{"metrics", metrics.Middleware},
+		{"unauthorized limit", limiter.UnauthorizedHandler},
+		{"read your writes", consistency.NewReadYourWrites(time.Second).Handler},
+		{"audit", auditor.Handler},
+		{"body limit", limits.NewBodyLimiter(1024, nil).Handler},
+		{"idempotency", idempotency.NewMiddleware(testDB, time.Hour, time.Minute).Handler},
+	} {
+		handler := tc.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				t.Errorf("%s: got a response writer that can't flush", tc.name)
+				return
+			}
+			_, _ = w.Write([]byte("data: first\n\n"))
+			flusher.Flush()
+		}))
+		ctx := store.WithTenant(context.Background(), tenant)
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader("{}")).WithContext(ctx)
+		req.Header.Set("Idempotency-Key", tc.name)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if !res.Flushed || res.Code != http.StatusOK || res.Body.String() != "data: first\n\n" {
+			t.Errorf("%s: got status %d with %q flushed %v, want the event flushed", tc.name, res.Code, res.Body.String(), res.Flushed)
+		}
+	}
+}
+
+func ndjsonRequest(t *testing.T, tenant, path string) []string {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, integrationTestURL+path, nil)
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	req.Header.Set("X-Tenant-ID", tenant)
+	req.Header.Set("Accept", "application/x-ndjson")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "application/x-ndjson") {
+		t.Fatalf("GET %s: got status %d and %s, want 200 application/x-ndjson", path, res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatalf("couldn't read response: %v", err)
+	}
+	return lines
+}
@@ -0,0 +1,288 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tenantProducts struct {
+	Products []struct {
+		ProductID string `json:"productId"`
+		Stock     int    `json:"stock"`
+	} `json:"products"`
+}
+
+func TestTenantIsolation(t *testing.T) {
+	suffix := time.Now().Format("150405000000")
+	tenantA, tenantB := "tenant-a-"+suffix, "tenant-b-"+suffix
+
+	// both tenants use the same article id with different stock
+	tenantRequest(t, tenantA, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"8"}]}`, http.StatusCreated)
+	tenantRequest(t, tenantB, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"2"}]}`, http.StatusCreated)
+	productBody := `{"products":[{"name":"table","contain_articles":[{"art_id":"1","amount_of":"4"}]}]}`
+	tenantRequest(t, tenantA, http.MethodPost, "/products", productBody, http.StatusCreated)
+
+	productsA := getTenantProducts(t, tenantA)
+	if len(productsA.Products) != 1 || productsA.Products[0].Stock != 2 {
+		t.Fatalf("tenant A sees %+v, want its one product with stock 2", productsA.Products)
+	}
+	productA := productsA.Products[0].ProductID
+	productsB := getTenantProducts(t, tenantB)
+	if len(productsB.Products) != 0 {
+		t.Fatalf("tenant B sees %+v, want no products", productsB.Products)
+	}
+
+	tenantRequest(t, tenantB, http.MethodGet, "/products/"+productA, "", http.StatusNotFound)
+	tenantRequest(t, tenantB, http.MethodPost, "/products/sell", `{"productId":"`+productA+`"}`, http.StatusNotFound)
+	tenantRequest(t, tenantB, http.MethodPut, "/products/"+productA, `{"name":"taken","contain_articles":[{"art_id":"1","amount_of":"1"}]}`, http.StatusNotFound)
+
+	// selling within tenant A only takes from its own article
+	tenantRequest(t, tenantA, http.MethodPost, "/products/sell", `{"productId":"`+productA+`"}`, http.StatusNoContent)
+	article := tenantRequest(t, tenantB, http.MethodGet, "/articles/1", "", http.StatusOK)
+	if !strings.Contains(article, `"stock":"2"`) {
+		t.Errorf("tenant B article changed by a sale of tenant A: %s", article)
+	}
+	article = tenantRequest(t, tenantA, http.MethodGet, "/articles/1", "", http.StatusOK)
+	if !strings.Contains(article, `"stock":"4"`) {
+		t.Errorf("tenant A article not changed by its sale: %s", article)
+	}
+}
+
+func TestTenantOfAPIKeyCannotBeOverridden(t *testing.T) {
+	tenant := "tenant-key-" + time.Now().Format("150405000000")
+	created := tenantRequest(t, tenant, http.MethodPost, "/api-keys", `{"name":"reader","scopes":["inventory:read"]}`, http.StatusCreated)
+	var apiKey struct {
+		Key      string `json:"key"`
+		TenantID string `json:"tenantId"`
+	}
+	err := json.Unmarshal([]byte(created), &apiKey)
+	if err != nil {
+		t.Fatalf("couldn't decode api key: %v", err)
+	}
+	if apiKey.TenantID != tenant {
+		t.Fatalf("got api key of tenant %q, want %q", apiKey.TenantID, tenant)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"tenant of the key", "", http.StatusOK},
+		{"same tenant", tenant, http.StatusOK},
+		{"other tenant", "default", http.StatusForbidden},
+		{"invalid tenant", "not a tenant!", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, integrationTestURL+"/products", nil)
+			if err != nil {
+				t.Fatalf("couldn't create request: %v", err)
+			}
+			req.Header.Set("X-API-Key", apiKey.Key)
+			if tt.header != "" {
+				req.Header.Set("X-Tenant-ID", tt.header)
+			}
+			res, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", res.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnboundCredentials(t *testing.T) {
+	tenant := "tenant-unbound-" + time.Now().Format("150405000000")
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"3"}]}`, http.StatusCreated)
+	bound := testClaims("inventory:read")
+	bound["tenant"] = tenant
+	unbound := testClaims("inventory:read")
+	delete(unbound, "tenant")
+	unboundAdmin := testClaims("admin")
+	delete(unboundAdmin, "tenant")
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"bound token", bearerToken(bound), "", http.StatusOK},
+		// without a tenant of its own the token would act for the default
+		// tenant
+		{"unbound token", bearerToken(unbound), "", http.StatusForbidden},
+		{"unbound token naming the default tenant", bearerToken(unbound), "default", http.StatusForbidden},
+		{"unbound token naming a tenant", bearerToken(unbound), tenant, http.StatusForbidden},
+		{"unbound admin token", bearerToken(unboundAdmin), tenant, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, integrationTestURL+"/articles/1", nil)
+			if err != nil {
+				t.Fatalf("couldn't create request: %v", err)
+			}
+			req.Header.Set("Authorization", bearer(tt.token))
+			if tt.header != "" {
+				req.Header.Set("X-Tenant-ID", tt.header)
+			}
+			res, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			data, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatalf("couldn't read response: %v", err)
+			}
+			if res.StatusCode != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.StatusCode, tt.want, data)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(string(data), `"stock":"3"`) {
+				t.Errorf("got article %s, want the one of %s", data, tenant)
+			}
+		})
+	}
+}
+
+// TestRowLevelSecurity checks the policies on their own, without the tenant
+// conditions of the queries. The test database user is a superuser, which row
+// level security doesn't apply to, so the queries run as a plain role.
+func TestRowLevelSecurity(t *testing.T) {
+	ctx := context.Background()
+	suffix := time.Now().Format("150405000000")
+	tenantA, tenantB := "rls-a-"+suffix, "rls-b-"+suffix
+	_, err := testDB.Database.ExecContext(ctx, `
+	DO $$ BEGIN
+		CREATE ROLE warehouse_rls_test NOLOGIN;
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$;
+	GRANT SELECT, INSERT, UPDATE ON article TO warehouse_rls_test;
+	GRANT SELECT ON idempotency_key TO warehouse_rls_test;`)
+	if err != nil {
+		t.Fatalf("couldn't create role: %v", err)
+	}
+
+	asTenant := func(tenant string, fn func(tx *sql.Tx) error) error {
+		tx, err := testDB.Database.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() //nolint
+		_, err = tx.ExecContext(ctx, `SET LOCAL ROLE warehouse_rls_test`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true)`, tenant)
+		if err != nil {
+			return err
+		}
+		err = fn(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	err = asTenant(tenantA, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO article (tenant_id, article_id, article_name, stock) VALUES ($1, 'rls', 'leg', 5)`, tenantA)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("couldn't insert the article of tenant A: %v", err)
+	}
+
+	err = asTenant(tenantB, func(tx *sql.Tx) error {
+		var count int
+		err := tx.QueryRowContext(ctx, `SELECT count(*) FROM article WHERE tenant_id = $1`, tenantA).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count != 0 {
+			return fmt.Errorf("tenant B sees %d articles of tenant A", count)
+		}
+		res, err := tx.ExecContext(ctx, `UPDATE article SET stock = 0 WHERE article_id = 'rls'`)
+		if err != nil {
+			return err
+		}
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated != 0 {
+			return fmt.Errorf("tenant B updated %d articles of tenant A", updated)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = asTenant(tenantB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO article (tenant_id, article_id, article_name, stock) VALUES ($1, 'rls-b', 'leg', 5)`, tenantA)
+		return err
+	})
+	if err == nil {
+		t.Error("tenant B could insert an article for tenant A")
+	}
+
+	_, err = testDB.Database.ExecContext(ctx,
+		`INSERT INTO idempotency_key (idempotency_key, request_hash, tenant_id) VALUES ('rls', 'hash', $1)`, tenantA)
+	if err != nil {
+		t.Fatalf("couldn't insert the idempotency key of tenant A: %v", err)
+	}
+	for tenant, want := range map[string]int{tenantA: 1, tenantB: 0} {
+		var count int
+		err = asTenant(tenant, func(tx *sql.Tx) error {
+			return tx.QueryRowContext(ctx, `SELECT count(*) FROM idempotency_key WHERE idempotency_key = 'rls'`).Scan(&count)
+		})
+		if err != nil || count != want {
+			t.Errorf("%s sees %d idempotency keys of tenant A, want %d: %v", tenant, count, want, err)
+		}
+	}
+}
+
+func getTenantProducts(t *testing.T, tenant string) tenantProducts {
+	t.Helper()
+	var products tenantProducts
+	err := json.Unmarshal([]byte(tenantRequest(t, tenant, http.MethodGet, "/products", "", http.StatusOK)), &products)
+	if err != nil {
+		t.Fatalf("couldn't decode products: %v", err)
+	}
+	return products
+}
+
+// tenantRequest sends an admin request on behalf of tenant and returns the
+// response body.
+func tenantRequest(t *testing.T, tenant, method, path, body string, want int) string {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, integrationTestURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	req.Header.Set("X-Tenant-ID", tenant)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("couldn't read response: %v", err)
+	}
+	if res.StatusCode != want {
+		t.Fatalf("%s %s for %s: got status %d, want %d: %s", method, path, tenant, res.StatusCode, want, data)
+	}
+	return string(data)
+}
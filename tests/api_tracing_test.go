@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/warehouse/app/server/responses"
+	"github.com/warehouse/app/tracing"
+)
+
+func TestTraceIDInErrorResponse(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, integrationTestURL+"/products/sell", strings.NewReader(`{"productId":"unknown"}`))
+	if err != nil {
+		t.Fatalf("couldn't create request: %v", err)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	var body struct {
+		TraceID string `json:"traceId"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("couldn't decode error response: %v", err)
+	}
+	if res.StatusCode != http.StatusNotFound || body.TraceID != traceID {
+		t.Errorf("got status %d with trace id %q, want %d with the trace id of the traceparent", res.StatusCode, body.TraceID, http.StatusNotFound)
+	}
+}
+
+// TestTraceparentContinued records the spans of the tracing middleware with
+// an in-memory exporter. Traces started by the service aren't sampled, so
+// only the ones of sampled callers are exported.
+func TestTraceparentContinued(t *testing.T) {
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := tracing.NewProvider(ctx, exporter, "warehouse-test", 0)
+	if err != nil {
+		t.Fatalf("couldn't create the tracer provider: %v", err)
+	}
+	defer provider.Shutdown(ctx) //nolint
+	previous := otel.GetTracerProvider()
+	tracing.SetProvider(provider)
+	defer tracing.SetProvider(previous)
+
+	server := httptest.NewServer(tracing.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the trace goes on to the services called by the handler
+		outgoing := http.Header{}
+		tracing.Inject(r.Context(), outgoing)
+		w.Header().Set("X-Outgoing-Traceparent", outgoing.Get("traceparent"))
+		body := responses.GenerateErrorResponseBody(r.Context(), responses.ResourceNotFound, "not found")
+		responses.WriteError(r.Context(), w, http.StatusNotFound, body)
+	})))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name        string
+		traceparent string
+		continued   bool
+		sampled     bool
+	}{
+		{"sampled caller", "00-" + traceID + "-" + parentSpanID + "-01", true, true},
+		{"caller not sampled", "00-" + traceID + "-" + parentSpanID + "-00", true, false},
+		{"invalid trace id", "00-00000000000000000000000000000000-" + parentSpanID + "-01", false, false},
+		{"upper case", "00-" + strings.ToUpper(traceID) + "-" + parentSpanID + "-01", false, false},
+		{"no traceparent", "", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter.Reset()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/articles/1", nil)
+			if err != nil {
+				t.Fatalf("couldn't create request: %v", err)
+			}
+			if tc.traceparent != "" {
+				req.Header.Set("traceparent", tc.traceparent)
+			}
+			res, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer res.Body.Close()
+			var body struct {
+				TraceID string `json:"traceId"`
+			}
+			if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("couldn't decode error response: %v", err)
+			}
+			if tc.continued != (body.TraceID == traceID) || len(body.TraceID) != 32 {
+				t.Errorf("got trace id %q in the error response, want the one of the caller: %v", body.TraceID, tc.continued)
+			}
+			outgoing := strings.Split(res.Header.Get("X-Outgoing-Traceparent"), "-")
+			wantFlags := "00"
+			if tc.sampled {
+				wantFlags = "01"
+			}
+			if len(outgoing) != 4 || outgoing[1] != body.TraceID || outgoing[2] == parentSpanID || outgoing[3] != wantFlags {
+				t.Errorf("got outgoing traceparent %v, want trace %s with the span of the request and flags %s", outgoing, body.TraceID, wantFlags)
+			}
+
+			if err = provider.ForceFlush(ctx); err != nil {
+				t.Fatalf("couldn't flush the spans: %v", err)
+			}
+			spans := exporter.GetSpans()
+			if !tc.sampled {
+				if len(spans) != 0 {
+					t.Errorf("got %d spans exported, want none of an unsampled trace", len(spans))
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans exported, want the one of the request", len(spans))
+			}
+			span := spans[0]
+			if span.SpanContext.TraceID().String() != traceID || span.Parent.SpanID().String() != parentSpanID ||
+				!span.Parent.IsRemote() || span.SpanKind != trace.SpanKindServer {
+				t.Errorf("got span %s of trace %s with parent %s, want a server span continuing the caller's", span.Name,
+					span.SpanContext.TraceID(), span.Parent.SpanID())
+			}
+			if span.SpanContext.SpanID().String() != outgoing[2] {
+				t.Errorf("got span %s, want the one passed on %s", span.SpanContext.SpanID(), outgoing[2])
+			}
+			status := attribute.Int("http.response.status_code", http.StatusNotFound)
+			var found bool
+			for _, kv := range span.Attributes {
+				found = found || kv == status
+			}
+			if !found {
+				t.Errorf("got attributes %v, want %v", span.Attributes, status)
+			}
+		})
+	}
+
+	// failed spans are exported with the error
+	exporter.Reset()
+	ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	_, span := tracing.Start(ctx, "failing")
+	tracing.RecordError(span, errors.New("broken"))
+	span.End()
+	if err = provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("couldn't flush the spans: %v", err)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Status.Description != "broken" || len(spans[0].Events) != 1 {
+		t.Errorf("got spans %+v, want the failed one with its error", spans)
+	}
+}
@@ -0,0 +1,333 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/store"
+	"github.com/warehouse/app/webhooks"
+)
+
+// webhookReceiver answers the deliveries it gets with the next status of
+// statuses, 204 once they are used up.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{statuses: statuses}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, receivedWebhook{header: r.Header.Clone(), body: body})
+		status := http.StatusNoContent
+		if len(receiver.statuses) > 0 {
+			status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+		}
+		receiver.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return receiver
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	tenant := "webhook-signature-" + time.Now().Format("150405000000")
+	receiver := newWebhookReceiver()
+	defer receiver.Close()
+	createTestWebhook(t, tenant, receiver.URL, "s3cret")
+	productID := setupWebhookProduct(t, tenant)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+
+	dispatcher := webhooks.NewDispatcher(testDB, time.Hour, 5*time.Second, 3, true)
+	if err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("couldn't dispatch: %v", err)
+	}
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(requests))
+	}
+	header, body := requests[0].header, requests[0].body
+	if header.Get("X-Warehouse-Event") != "product.sold" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("got event %q of %q, want product.sold as application/json", header.Get("X-Warehouse-Event"), header.Get("Content-Type"))
+	}
+	timestamp, err := strconv.ParseInt(header.Get("X-Warehouse-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Errorf("got timestamp %q, want the unix time of the delivery", header.Get("X-Warehouse-Timestamp"))
+	}
+	signature := header.Get("X-Warehouse-Signature")
+	if !regexp.MustCompile(`^sha256=[0-9a-f]{64}$`).MatchString(signature) {
+		t.Fatalf("got signature %q, want sha256= and 64 hex digits", signature)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(header.Get("X-Warehouse-Timestamp") + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("got signature %s, want %s", signature, want)
+	}
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			ProductID string `json:"productId"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &event); err != nil || event.Data.ProductID != productID {
+		t.Errorf("got payload %s, want the sale of %s: %v", body, productID, err)
+	}
+	if state := getWebhookDeliveryState(t, tenant); state.attempts != 1 || !state.delivered {
+		t.Errorf("got delivery %+v, want delivered at the first attempt", state)
+	}
+}
+
+func TestWebhookRetryBackoff(t *testing.T) {
+	tenant := "webhook-retry-" + time.Now().Format("150405000000")
+	receiver := newWebhookReceiver(http.StatusInternalServerError, http.StatusBadGateway)
+	defer receiver.Close()
+	createTestWebhook(t, tenant, receiver.URL, "")
+	productID := setupWebhookProduct(t, tenant)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	dispatcher := webhooks.NewDispatcher(testDB, time.Hour, 5*time.Second, 3, true)
+	dispatch := func() {
+		t.Helper()
+		if err := dispatcher.DispatchDue(context.Background()); err != nil {
+			t.Fatalf("couldn't dispatch: %v", err)
+		}
+	}
+
+	// the wait doubles after every failed attempt, from 2 seconds
+	for attempt, wantWait := range []float64{2, 4} {
+		dispatch()
+		state := getWebhookDeliveryState(t, tenant)
+		if state.attempts != attempt+1 || state.delivered || state.failed || !strings.Contains(state.lastError, "status 50") {
+			t.Fatalf("got delivery %+v after attempt %d, want a failed attempt to retry", state, attempt+1)
+		}
+		if state.wait < wantWait-1 || state.wait > wantWait+0.5 {
+			t.Errorf("got next attempt in %.1fs after attempt %d, want %vs", state.wait, attempt+1, wantWait)
+		}
+		// not due yet
+		dispatch()
+		if got := len(receiver.received()); got != attempt+1 {
+			t.Fatalf("got %d deliveries before the backoff passed, want %d", got, attempt+1)
+		}
+		makeWebhookDeliveriesDue(t, tenant)
+	}
+	dispatch()
+	if state := getWebhookDeliveryState(t, tenant); state.attempts != 3 || !state.delivered || state.lastError != "" {
+		t.Errorf("got delivery %+v, want delivered at the third attempt", state)
+	}
+
+	// a delivery failing MaxAttempts times is given up
+	failing := newWebhookReceiver(http.StatusInternalServerError)
+	defer failing.Close()
+	tenant += "-give-up"
+	createTestWebhook(t, tenant, failing.URL, "")
+	productID = setupWebhookProduct(t, tenant)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	if err := webhooks.NewDispatcher(testDB, time.Hour, 5*time.Second, 1, true).DispatchDue(context.Background()); err != nil {
+		t.Fatalf("couldn't dispatch: %v", err)
+	}
+	makeWebhookDeliveriesDue(t, tenant)
+	dispatch()
+	if state := getWebhookDeliveryState(t, tenant); state.attempts != 1 || !state.failed || len(failing.received()) != 1 {
+		t.Errorf("got delivery %+v and %d attempts, want it given up after one", state, len(failing.received()))
+	}
+}
+
+func TestWebhookDeliveryLease(t *testing.T) {
+	tenant := "webhook-lease-" + time.Now().Format("150405000000")
+	target := "https://hooks.example.com/" + tenant
+	createTestWebhook(t, tenant, target, "")
+	productID := setupWebhookProduct(t, tenant)
+	for i := 0; i < 6; i++ {
+		tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	}
+	ctx := context.Background()
+	claim := func() map[int64]int {
+		t.Helper()
+		res, err := testDB.ClaimWebhookDeliveries(ctx, store.ClaimWebhookDeliveriesRequest{Limit: 100, Lease: time.Hour})
+		if err != nil {
+			t.Fatalf("couldn't claim deliveries: %v", err)
+		}
+		claimed := make(map[int64]int)
+		for _, delivery := range res.Deliveries {
+			if delivery.URL == target {
+				claimed[delivery.DeliveryID] = delivery.Attempts
+			}
+		}
+		return claimed
+	}
+
+	// concurrent dispatchers never get the same delivery
+	var wg sync.WaitGroup
+	claims := make([]map[int64]int, 2)
+	for i := range claims {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			claims[i] = claim()
+		}(i)
+	}
+	wg.Wait()
+	for id := range claims[0] {
+		if _, ok := claims[1][id]; ok {
+			t.Errorf("delivery %d was claimed twice", id)
+		}
+	}
+	if total := len(claims[0]) + len(claims[1]); total != 6 {
+		t.Fatalf("got %d deliveries claimed, want 6", total)
+	}
+	// a leased delivery isn't handed out again while the lease lasts
+	if claimed := claim(); len(claimed) != 0 {
+		t.Errorf("got %d deliveries claimed during the lease, want none", len(claimed))
+	}
+	// nor lost when its dispatcher dies before the lease ends
+	makeWebhookDeliveriesDue(t, tenant)
+	claimed := claim()
+	if len(claimed) != 6 {
+		t.Errorf("got %d deliveries claimed after the lease, want 6", len(claimed))
+	}
+	for id, attempts := range claimed {
+		if attempts != 0 {
+			t.Errorf("got %d attempts of delivery %d, want a lease not to count as one", attempts, id)
+		}
+	}
+}
+
+func TestWebhookPrivateTargets(t *testing.T) {
+	tenant := "webhook-private-" + time.Now().Format("150405000000")
+	handler := webhooks.NewHandler(false)
+	handler.WebhooksStore = testDB
+	create := func(url string) int {
+		body := `{"url":"` + url + `","eventTypes":["product.sold"]}`
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+		req = req.WithContext(store.WithTenant(req.Context(), tenant))
+		res := httptest.NewRecorder()
+		handler.CreateWebhook(res, req)
+		return res.Code
+	}
+	for _, url := range []string{
+		"ftp://hooks.example.com/",
+		"http://127.0.0.1:8080/",
+		"http://localhost/",
+		"http://10.1.2.3/",
+		"http://192.168.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"http://[fe80::1]/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://0.0.0.0/",
+	} {
+		if status := create(url); status != http.StatusBadRequest {
+			t.Errorf("got status %d for %s, want 400", status, url)
+		}
+	}
+	if status := create("https://hooks.example.com/"); status != http.StatusCreated {
+		t.Errorf("got status %d for a public host name, want 201", status)
+	}
+
+	// the address is checked again when the dispatcher dials, as a host name
+	// may resolve to a private one
+	receiver := newWebhookReceiver()
+	defer receiver.Close()
+	tenant += "-dial"
+	createTestWebhook(t, tenant, receiver.URL, "")
+	productID := setupWebhookProduct(t, tenant)
+	tenantRequest(t, tenant, http.MethodPost, "/products/sell", `{"productId":"`+productID+`"}`, http.StatusNoContent)
+	if err := webhooks.NewDispatcher(testDB, time.Hour, 5*time.Second, 1, false).DispatchDue(context.Background()); err != nil {
+		t.Fatalf("couldn't dispatch: %v", err)
+	}
+	if len(receiver.received()) != 0 {
+		t.Errorf("got a delivery to a private address")
+	}
+	if state := getWebhookDeliveryState(t, tenant); !state.failed || !strings.Contains(state.lastError, "private") {
+		t.Errorf("got delivery %+v, want it refused as private", state)
+	}
+}
+
+func createTestWebhook(t *testing.T, tenant, url, secret string) {
+	t.Helper()
+	tenantRequest(t, tenant, http.MethodPost, "/webhooks",
+		`{"url":"`+url+`","eventTypes":["product.sold"],"secret":"`+secret+`"}`, http.StatusCreated)
+}
+
+// setupWebhookProduct creates a product of 100 articles of a tenant and
+// returns its id.
+func setupWebhookProduct(t *testing.T, tenant string) string {
+	t.Helper()
+	tenantRequest(t, tenant, http.MethodPost, "/articles", `{"inventory":[{"art_id":"1","name":"leg","stock":"100"}]}`, http.StatusCreated)
+	tenantRequest(t, tenant, http.MethodPost, "/products",
+		`{"products":[{"name":"table","contain_articles":[{"art_id":"1","amount_of":"1"}]}]}`, http.StatusCreated)
+	products := getTenantProducts(t, tenant).Products
+	if len(products) != 1 {
+		t.Fatalf("got %d products, want 1", len(products))
+	}
+	return products[0].ProductID
+}
+
+type webhookDeliveryState struct {
+	attempts  int
+	delivered bool
+	failed    bool
+	lastError string
+	// wait is the number of seconds until the next attempt.
+	wait float64
+}
+
+// getWebhookDeliveryState returns the state of the only delivery of tenant.
+func getWebhookDeliveryState(t *testing.T, tenant string) webhookDeliveryState {
+	t.Helper()
+	var state webhookDeliveryState
+	var lastError *string
+	err := testDB.Database.QueryRowContext(context.Background(), `
+		SELECT attempts, delivered_at IS NOT NULL, failed_at IS NOT NULL, last_error,
+			EXTRACT(EPOCH FROM next_attempt_at - now()::timestamp)::float8
+		FROM webhook_delivery
+		JOIN webhook_subscription ON webhook_subscription.subscription_id = webhook_delivery.subscription_id
+		WHERE webhook_subscription.tenant_id = $1`, tenant).
+		Scan(&state.attempts, &state.delivered, &state.failed, &lastError, &state.wait)
+	if err != nil {
+		t.Fatalf("couldn't read the delivery of %s: %v", tenant, err)
+	}
+	if lastError != nil {
+		state.lastError = *lastError
+	}
+	return state
+}
+
+// makeWebhookDeliveriesDue ends the backoff or lease of the deliveries of
+// tenant.
+func makeWebhookDeliveriesDue(t *testing.T, tenant string) {
+	t.Helper()
+	_, err := testDB.Database.ExecContext(context.Background(), `
+		UPDATE webhook_delivery SET next_attempt_at = now() - interval '1 second'
+		FROM webhook_subscription
+		WHERE webhook_subscription.subscription_id = webhook_delivery.subscription_id
+		AND webhook_subscription.tenant_id = $1`, tenant)
+	if err != nil {
+		t.Fatalf("couldn't make the deliveries of %s due: %v", tenant, err)
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warehouse/app/articles"
+	"github.com/warehouse/app/cli"
+	"github.com/warehouse/app/store"
+)
+
+func TestCLI(t *testing.T) {
+	clients := map[string]cli.Client{
+		"http":     cli.NewHTTPClient(integrationTestURL, testAdminKey, "", 15*time.Second),
+		"database": cli.NewStoreClient(testDB),
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			tenant := "cli-" + name + "-" + time.Now().Format("150405000000")
+			if httpClient, ok := client.(*cli.HTTPClient); ok {
+				httpClient.Tenant = tenant
+			}
+			ctx := store.WithTenant(context.Background(), tenant)
+
+			imported, err := cli.Import(ctx, client, cli.KindArticles, strings.NewReader(`{"inventory":[{"art_id":"1","name":"leg","stock":"8"}]}`))
+			if err != nil || imported != 1 {
+				t.Fatalf("got %d articles imported: %v", imported, err)
+			}
+			productBody := `{"products":[{"name":"table","contain_articles":[{"art_id":"1","amount_of":"4"}]}]}`
+			_, err = cli.Import(ctx, client, cli.KindProducts, strings.NewReader(productBody))
+			if err != nil {
+				t.Fatalf("couldn't import products: %v", err)
+			}
+
+			res, err := client.GetAllProducts(ctx)
+			if err != nil || len(res.Products) != 1 || res.Products[0].Stock != 2 || res.Products[0].Name != "table" {
+				t.Fatalf("got products %+v: %v, want table with stock 2", res, err)
+			}
+			productID := res.Products[0].ProductID
+			var out bytes.Buffer
+			err = cli.ListProducts(ctx, client, cli.OutputTable, &out)
+			if err != nil || !strings.Contains(out.String(), productID) {
+				t.Errorf("got table %q: %v, want product %s", out.String(), err, productID)
+			}
+
+			sold, err := cli.SellProduct(ctx, client, productID, 3)
+			if err == nil || sold != 2 {
+				t.Errorf("got %d of 3 sold: %v, want 2 and an error", sold, err)
+			}
+
+			article, err := cli.AdjustStock(ctx, client, "1", 5)
+			if err != nil || article.Stock != "5" {
+				t.Fatalf("got article %+v after adjusting: %v, want stock 5", article, err)
+			}
+			_, err = cli.AdjustStock(ctx, client, "1", -6)
+			if !errors.Is(err, cli.ErrNegativeStock) {
+				t.Errorf("got %v adjusting below 0, want %v", err, cli.ErrNegativeStock)
+			}
+			_, err = client.UpdateArticle(ctx, "1", article.Version-1, &articles.UpdateArticleRequest{Name: "leg", Stock: "1"})
+			if !errors.Is(err, store.ErrVersionConflict) {
+				t.Errorf("got %v updating an old version, want %v", err, store.ErrVersionConflict)
+			}
+
+			out.Reset()
+			err = cli.Export(ctx, client, cli.KindArticles, &out)
+			if err != nil {
+				t.Fatalf("couldn't export articles: %v", err)
+			}
+			want := `"stock": "5"`
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("got export %s, want %s", out.String(), want)
+			}
+			_, err = cli.Import(ctx, client, cli.KindArticles, &out)
+			if err != nil {
+				t.Errorf("couldn't import the export back: %v", err)
+			}
+		})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	log2 "log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"testing"
 	"time"
 
@@ -17,6 +16,7 @@ import (
 
 var (
 	httpClient *http.Client
+	jwksFile   string
 )
 
 const (
@@ -86,17 +86,18 @@ func TestMain(m *testing.M) {
 		NoColor: true,
 	})
 
-	pwd, err := os.Getwd()
+	StartDB()
+	jwksDir, err := os.MkdirTemp("", "warehouse-jwks")
 	if err != nil {
-		log.Fatal().Msgf("couldn't get local dir: %v", err)
+		log.Fatal().Msgf("couldn't create jwks dir: %v", err)
 	}
-	parent := filepath.Dir(pwd)
-	StartDB(parent)
+	jwksFile = SetupJWKS(jwksDir)
 	SetupHTTPServer()
 	SetupHTTPClient()
 	CheckHTTPServerHealthyAndReady()
 	// os.Exit() does not respect defer statements
 	code := m.Run()
+	os.RemoveAll(jwksDir)
 	os.Exit(code)
 }
 
@@ -107,5 +108,20 @@ func getTestConfig() server.Configuration {
 		log2.Fatal("Error setting up HTTPServer: " + err.Error())
 	}
 	cfg.PostgresConfiguration.CredentialsFileName = "../creds.json"
+	// a database of POSTGRES_HOST is migrated by the server itself
+	cfg.PostgresConfiguration.AutoMigrate = true
+	cfg.Auth.Enabled = true
+	cfg.Auth.AdminKey = testAdminKey
+	cfg.Auth.JWKSFile = jwksFile
+	cfg.Auth.JWTIssuer = testJWTIssuer
+	cfg.Auth.JWTAudience = testJWTAudience
+	cfg.Tenancy.MultiTenant = true
+	// the tests fail authentication on purpose far more often than a client
+	// should
+	cfg.RateLimit.UnauthorizedBurst = 10000
+	// the receivers of the webhook tests listen on 127.0.0.1, and the tests
+	// dispatch the deliveries themselves
+	cfg.Webhooks.AllowPrivateTargets = true
+	cfg.Webhooks.DispatchInterval = time.Hour.Milliseconds()
 	return cfg
 }
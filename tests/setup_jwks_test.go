@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	testJWTIssuer   = "https://gateway.test"
+	testJWTAudience = "warehouse"
+	testAdminKey    = "test-admin-key"
+
+	testRSAKeyID  = "rsa-test"
+	testECKeyID   = "ec-test"
+	testHMACKeyID = "hmac-test"
+)
+
+// testKeys are generated for every run and published to the server through
+// a JWKS file.
+var testKeys struct {
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+	hmac []byte
+}
+
+// SetupJWKS writes the public test keys to a JWKS file in dir and returns its
+// path.
+func SetupJWKS(dir string) string {
+	var err error
+	testKeys.rsa, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal().Msgf("couldn't generate rsa key: %v", err)
+	}
+	testKeys.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatal().Msgf("couldn't generate ec key: %v", err)
+	}
+	testKeys.hmac = make([]byte, 32)
+	_, err = rand.Read(testKeys.hmac)
+	if err != nil {
+		log.Fatal().Msgf("couldn't generate hmac key: %v", err)
+	}
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": testRSAKeyID,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   encodeSegment(testKeys.rsa.N.Bytes()),
+				"e":   encodeSegment(big.NewInt(int64(testKeys.rsa.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": testECKeyID,
+				"alg": "ES256",
+				"crv": "P-256",
+				"x":   encodeSegment(testKeys.ec.X.FillBytes(make([]byte, 32))),
+				"y":   encodeSegment(testKeys.ec.Y.FillBytes(make([]byte, 32))),
+			},
+			{
+				"kty": "oct",
+				"kid": testHMACKeyID,
+				"alg": "HS256",
+				"k":   encodeSegment(testKeys.hmac),
+			},
+		},
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		log.Fatal().Msgf("couldn't marshal jwks: %v", err)
+	}
+	path := filepath.Join(dir, "jwks.json")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		log.Fatal().Msgf("couldn't write jwks: %v", err)
+	}
+	return path
+}
+
+// testClaims are valid claims for the test issuer and audience, bound to the
+// default tenant.
+func testClaims(scope string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":    testJWTIssuer,
+		"aud":    testJWTAudience,
+		"sub":    "user@example.com",
+		"scope":  scope,
+		"tenant": "default",
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+}
+
+func signToken(alg, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		log.Fatal().Msgf("couldn't marshal token header: %v", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		log.Fatal().Msgf("couldn't marshal token claims: %v", err)
+	}
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	var signature []byte
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, testKeys.rsa, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, testKeys.ec, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case "HS256":
+		mac := hmac.New(sha256.New, testKeys.hmac)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	if err != nil {
+		log.Fatal().Msgf("couldn't sign token: %v", err)
+	}
+	return signingInput + "." + encodeSegment(signature)
+}
+
+func encodeSegment(data []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(data), "=")
+}
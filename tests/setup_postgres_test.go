@@ -2,10 +2,8 @@ package tests
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"strconv"
-	"time"
 
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
@@ -16,6 +14,10 @@ import (
 
 var (
 	testDB *store.PostgresDB
+	// testDBHost and testDBPort locate the test database, for tests that
+	// open connections of their own.
+	testDBHost string
+	testDBPort int
 )
 
 const (
@@ -26,10 +28,19 @@ const (
 	credentials = "../creds.json" // nolint
 )
 
-func StartDB(liquidasePath string) (*dockertest.Resource, *dockertest.Pool, *docker.Network) {
+func StartDB() (*dockertest.Resource, *dockertest.Pool) {
 	postgresHost := os.Getenv("POSTGRES_HOST")
 	if postgresHost != "" {
-		return nil, nil, nil
+		// a database of its own, the server migrates it when it starts
+		postgresPort := os.Getenv("POSTGRES_PORT")
+		if postgresPort == "" {
+			postgresPort = dbPort
+		}
+		log.Info().Msgf("connecting to database with %s:%s and %s", postgresHost, postgresPort, credentials)
+		if err := createDB(postgresHost, postgresPort, credentials); err != nil {
+			log.Fatal().Msgf("Could not create postgres connection: %s", err)
+		}
+		return nil, nil
 	}
 	postgresPort := "5432"
 	os.Setenv("POSTGRES_HOST", postgresHost)
@@ -37,7 +48,6 @@ func StartDB(liquidasePath string) (*dockertest.Resource, *dockertest.Pool, *doc
 	os.Setenv("POSTGRES_DATABASE", "warehouse")
 	var container *dockertest.Resource
 	var pool *dockertest.Pool
-	var network *docker.Network
 	var err error
 
 	os.Setenv("POSTGRES_CREDENTIALS_FILENAME", credentials)
@@ -50,12 +60,7 @@ func StartDB(liquidasePath string) (*dockertest.Resource, *dockertest.Pool, *doc
 			log.Fatal().Msgf("Could not connect to docker: %s", err)
 		}
 
-		network, err = pool.Client.CreateNetwork(docker.CreateNetworkOptions{Name: "database_migration_network"})
-		if err != nil {
-			log.Fatal().Msgf("could not create a network to liquidbase: %s", err)
-		}
-
-		container, postgresPort = initPostgres(pool, postgresHost, postgresPort, network.ID, containerName)
+		container, postgresPort = initPostgres(pool, postgresHost, postgresPort, containerName)
 		if err = pool.Retry(func() error {
 			if err = createDB(postgresHost, postgresPort, credentials); err != nil {
 				return err
@@ -66,7 +71,7 @@ func StartDB(liquidasePath string) (*dockertest.Resource, *dockertest.Pool, *doc
 		}
 
 		log.Info().Msgf("start migrations")
-		err = runMigrations(pool, containerName, network.ID, liquidasePath)
+		_, err = testDB.MigrateUp(context.Background())
 		if err != nil {
 			log.Fatal().Msgf("Could not run postgres migration: %s", err)
 		}
@@ -80,48 +85,7 @@ func StartDB(liquidasePath string) (*dockertest.Resource, *dockertest.Pool, *doc
 			log.Fatal().Msgf("Could not create postgres connection: %s", err)
 		}
 	}
-	return container, pool, network
-}
-
-func runMigrations(pool *dockertest.Pool, host string, networkID string, liquidasePath string) error {
-	options := dockertest.RunOptions{
-		Repository: "liquibase/liquibase",
-		Tag:        "4.3.5",
-		NetworkID:  networkID,
-		Cmd: []string{
-			"--url",
-			fmt.Sprintf("jdbc:postgresql://%s:%s/%s", host, dbPort, dbName),
-			"--changeLogFile",
-			"changelog/master.yml",
-			"--username",
-			dbUser,
-			"--password",
-			dbPassword,
-			"--logLevel",
-			"debug",
-			"update",
-		},
-	}
-	resource, err := pool.RunWithOptions(&options, func(config *docker.HostConfig) {
-		config.Mounts = []docker.HostMount{
-			{
-				Target:   "/liquibase/changelog",
-				Source:   fmt.Sprintf("%s/liquibase/changelog/", liquidasePath),
-				Type:     "bind",
-				ReadOnly: true,
-			},
-		}
-	})
-	if err != nil {
-		return err
-	}
-	err = resource.Expire(60)
-	if err != nil {
-		return err
-	}
-
-	time.Sleep(5 * time.Second)
-	return nil
+	return container, pool
 }
 
 func createDB(host string, sPort string, credFile string) error {
@@ -129,16 +93,21 @@ func createDB(host string, sPort string, credFile string) error {
 	if err != nil {
 		log.Fatal().Msgf("Could not get postgres port: %s", err)
 	}
-	testDB, err = store.NewPostgresDB(port, host, dbName, credFile)
+	testDBHost, testDBPort = host, port
+	testDB, err = store.NewPostgresDB(store.Config{
+		Host:                host,
+		Port:                port,
+		DB:                  dbName,
+		CredentialsFileName: credFile,
+	})
 	return err
 }
 
-func initPostgres(pool *dockertest.Pool, host string, port string, networkID string, containerName string) (*dockertest.Resource, string) {
+func initPostgres(pool *dockertest.Pool, host string, port string, containerName string) (*dockertest.Resource, string) {
 	options := dockertest.RunOptions{
 		Repository: "postgres",
 		Name:       containerName,
 		Tag:        "12.9",
-		NetworkID:  networkID,
 		Hostname:   host,
 		Env: []string{
 			"POSTGRES_USER=" + dbUser,